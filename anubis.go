@@ -1,4 +1,5 @@
-// Package anubis contains the version number of Anubis.
+// Package anubis contains the version number of Anubis and the settings its
+// packages share.
 package anubis
 
 import "time"
@@ -10,20 +11,27 @@ import "time"
 var Version = "devel"
 
 // CookieName is the name of the cookie that Anubis uses in order to validate
-// access.
+// access. It is the default for lib.Options.CookieName.
 var CookieName = "techaro.lol-anubis"
 
 // TestCookieName is the name of the cookie that Anubis uses in order to check
-// if cookies are enabled on the client's browser.
+// if cookies are enabled on the client's browser. It is the default for
+// lib.Options.TestCookieName.
 var TestCookieName = "techaro.lol-anubis-cookie-verification"
 
 // CookieDefaultExpirationTime is the amount of time before the cookie/JWT expires.
 const CookieDefaultExpirationTime = 7 * 24 * time.Hour
 
-// BasePrefix is a global prefix for all Anubis endpoints. Can be emptied to remove the prefix entirely.
+// BasePrefix is a global prefix for all Anubis endpoints.
+//
+// Deprecated: Anubis no longer reads this variable. Set lib.Options.BasePrefix
+// instead, see Settings.
 var BasePrefix = ""
 
 // PublicUrl is the externally accessible URL for this Anubis instance.
+//
+// Deprecated: Anubis no longer reads this variable. Set lib.Options.PublicUrl
+// instead, see Settings.
 var PublicUrl = ""
 
 // StaticPath is the location where all static Anubis assets are located.
@@ -37,8 +45,9 @@ const APIPrefix = "/.within.website/x/cmd/anubis/api/"
 const DefaultDifficulty = 4
 
 // ForcedLanguage is the language being used instead of the one of the request's Accept-Language header
-// if being set.
+// if being set. It is the default for lib.Options.ForcedLanguage.
 var ForcedLanguage = ""
 
-// UseSimplifiedExplanation can be set to true for using the simplified explanation
+// UseSimplifiedExplanation can be set to true for using the simplified explanation.
+// It is the default for lib.Options.UseSimplifiedExplanation.
 var UseSimplifiedExplanation = false
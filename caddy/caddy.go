@@ -0,0 +1,189 @@
+// Package caddy registers Anubis as a Caddy HTTP handler module named
+// http.handlers.anubis, with the Caddyfile directive anubis.
+//
+// Build Caddy with it using xcaddy:
+//
+//	xcaddy build --with github.com/TecharoHQ/anubis/caddy
+package caddy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/TecharoHQ/anubis/lib/middleware"
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+func init() {
+	caddy.RegisterModule(Anubis{})
+	httpcaddyfile.RegisterHandlerDirective("anubis", parseCaddyfile)
+	httpcaddyfile.RegisterDirectiveOrder("anubis", httpcaddyfile.Before, "reverse_proxy")
+}
+
+// Anubis challenges clients before passing their requests to the next
+// handler.
+type Anubis struct {
+	PolicyFile           string   `json:"policy_file,omitempty"`
+	Difficulty           int      `json:"difficulty,omitempty"`
+	BasePrefix           string   `json:"base_prefix,omitempty"`
+	PublicURL            string   `json:"public_url,omitempty"`
+	RedirectDomains      []string `json:"redirect_domains,omitempty"`
+	ServeRobotsTXT       bool     `json:"serve_robots_txt,omitempty"`
+	ForcedLanguage       string   `json:"forced_language,omitempty"`
+	CookieDomain         string   `json:"cookie_domain,omitempty"`
+	CookiePrefix         string   `json:"cookie_prefix,omitempty"`
+	InsecureCookies      bool     `json:"insecure_cookies,omitempty"`
+	ED25519PrivateKeyHex string   `json:"ed25519_private_key_hex,omitempty"`
+
+	handler http.Handler
+}
+
+func (Anubis) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.anubis",
+		New: func() caddy.Module { return new(Anubis) },
+	}
+}
+
+type nextKey struct{}
+
+// nextHandler holds the rest of Caddy's handler chain for one request, along
+// with the error it returned.
+type nextHandler struct {
+	next caddyhttp.Handler
+	err  error
+}
+
+func (a *Anubis) Provision(ctx caddy.Context) error {
+	h, err := middleware.New(ctx, middleware.Config{
+		PolicyFile:           a.PolicyFile,
+		Difficulty:           a.Difficulty,
+		BasePrefix:           a.BasePrefix,
+		PublicUrl:            a.PublicURL,
+		RedirectDomains:      a.RedirectDomains,
+		ServeRobotsTXT:       a.ServeRobotsTXT,
+		ForcedLanguage:       a.ForcedLanguage,
+		CookieDomain:         a.CookieDomain,
+		CookiePrefix:         a.CookiePrefix,
+		InsecureCookies:      a.InsecureCookies,
+		ED25519PrivateKeyHex: a.ED25519PrivateKeyHex,
+		Logger:               ctx.Slogger(),
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nh := r.Context().Value(nextKey{}).(*nextHandler)
+		nh.err = nh.next.ServeHTTP(w, r)
+	}))
+	if err != nil {
+		return err
+	}
+
+	a.handler = h
+	return nil
+}
+
+func (a *Anubis) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	nh := &nextHandler{next: next}
+	r = r.WithContext(context.WithValue(r.Context(), nextKey{}, nh))
+
+	// Use the client IP Caddy worked out from its trusted_proxies setting.
+	if ip, ok := caddyhttp.GetVar(r.Context(), caddyhttp.ClientIPVarKey).(string); ok && ip != "" {
+		r.RemoteAddr = net.JoinHostPort(ip, "0")
+	}
+
+	a.handler.ServeHTTP(w, r)
+	return nh.err
+}
+
+// UnmarshalCaddyfile sets up the handler from Caddyfile tokens:
+//
+//	anubis {
+//		policy_file <path>
+//		difficulty <n>
+//		base_prefix <prefix>
+//		public_url <url>
+//		redirect_domains <domains...>
+//		serve_robots_txt
+//		forced_language <lang>
+//		cookie_domain <domain>
+//		cookie_prefix <prefix>
+//		insecure_cookies
+//		ed25519_private_key_hex <hex>
+//	}
+func (a *Anubis) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	d.Next() // consume directive name
+
+	if d.NextArg() {
+		return d.ArgErr()
+	}
+
+	for d.NextBlock(0) {
+		var err error
+
+		switch d.Val() {
+		case "policy_file":
+			err = oneArg(d, &a.PolicyFile)
+		case "difficulty":
+			var val string
+			if err = oneArg(d, &val); err == nil {
+				a.Difficulty, err = strconv.Atoi(val)
+			}
+		case "base_prefix":
+			err = oneArg(d, &a.BasePrefix)
+		case "public_url":
+			err = oneArg(d, &a.PublicURL)
+		case "redirect_domains":
+			a.RedirectDomains = append(a.RedirectDomains, d.RemainingArgs()...)
+			if len(a.RedirectDomains) == 0 {
+				err = d.ArgErr()
+			}
+		case "serve_robots_txt":
+			a.ServeRobotsTXT = true
+		case "forced_language":
+			err = oneArg(d, &a.ForcedLanguage)
+		case "cookie_domain":
+			err = oneArg(d, &a.CookieDomain)
+		case "cookie_prefix":
+			err = oneArg(d, &a.CookiePrefix)
+		case "insecure_cookies":
+			a.InsecureCookies = true
+		case "ed25519_private_key_hex":
+			err = oneArg(d, &a.ED25519PrivateKeyHex)
+		default:
+			err = d.Errf("unknown subdirective %q", d.Val())
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func oneArg(d *caddyfile.Dispenser, dst *string) error {
+	if !d.NextArg() {
+		return d.ArgErr()
+	}
+	*dst = d.Val()
+
+	if d.NextArg() {
+		return d.ArgErr()
+	}
+	return nil
+}
+
+func parseCaddyfile(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+	var a Anubis
+	err := a.UnmarshalCaddyfile(h.Dispenser)
+	return &a, err
+}
+
+var (
+	_ caddy.Provisioner           = (*Anubis)(nil)
+	_ caddyhttp.MiddlewareHandler = (*Anubis)(nil)
+	_ caddyfile.Unmarshaler       = (*Anubis)(nil)
+)
@@ -0,0 +1,117 @@
+package caddy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+func TestUnmarshalCaddyfile(t *testing.T) {
+	d := caddyfile.NewTestDispenser(`anubis {
+		policy_file /etc/anubis/policy.yaml
+		difficulty 5
+		base_prefix /anubis
+		redirect_domains example.com example.org
+		insecure_cookies
+	}`)
+
+	var a Anubis
+	if err := a.UnmarshalCaddyfile(d); err != nil {
+		t.Fatal(err)
+	}
+
+	if a.PolicyFile != "/etc/anubis/policy.yaml" || a.Difficulty != 5 || a.BasePrefix != "/anubis" || !a.InsecureCookies {
+		t.Errorf("wrong settings: %+v", a)
+	}
+
+	if !slices.Equal(a.RedirectDomains, []string{"example.com", "example.org"}) {
+		t.Errorf("wrong redirect domains: %v", a.RedirectDomains)
+	}
+
+	for _, bad := range []string{
+		"anubis foo",
+		"anubis {\n\tdifficulty\n}",
+		"anubis {\n\tdifficulty hard\n}",
+		"anubis {\n\tbogus\n}",
+	} {
+		if err := new(Anubis).UnmarshalCaddyfile(caddyfile.NewTestDispenser(bad)); err == nil {
+			t.Errorf("wanted an error for %q", bad)
+		}
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+
+	a := &Anubis{PolicyFile: "../lib/testdata/aggressive_403.yaml"}
+	if err := a.Provision(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	errUpstream := errors.New("upstream failed")
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := a.ServeHTTP(w, r, caddyhttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+			if r.Header.Get("X-Fail") != "" {
+				return errUpstream
+			}
+			io.WriteString(w, "upstream")
+			return nil
+		}))
+		if err != nil {
+			w.Header().Set("X-Error", err.Error())
+		}
+	}))
+	defer ts.Close()
+
+	for _, cs := range []struct {
+		userAgent string
+		fail      bool
+		status    int
+		body      string
+		err       string
+	}{
+		{userAgent: "Mozilla/5.0", status: http.StatusOK, body: "upstream"},
+		{userAgent: "Mozilla/5.0", fail: true, status: http.StatusOK, err: errUpstream.Error()},
+		{userAgent: "DENY", status: http.StatusForbidden},
+		{userAgent: "CHALLENGE", status: http.StatusUnauthorized},
+	} {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("User-Agent", cs.userAgent)
+		if cs.fail {
+			req.Header.Set("X-Fail", "yes")
+		}
+
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != cs.status {
+			t.Errorf("%s: wanted status %d, got: %d", cs.userAgent, cs.status, resp.StatusCode)
+		}
+
+		if !strings.Contains(string(body), cs.body) {
+			t.Errorf("%s: wanted body to contain %q", cs.userAgent, cs.body)
+		}
+
+		if got := resp.Header.Get("X-Error"); got != cs.err {
+			t.Errorf("%s: wanted error %q from the next handler, got: %q", cs.userAgent, cs.err, got)
+		}
+	}
+}
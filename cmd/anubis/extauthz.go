@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"net/http"
+
+	"github.com/TecharoHQ/anubis/internal"
+	"github.com/TecharoHQ/anubis/internal/extauthz"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	"google.golang.org/grpc"
+	healthv1 "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// extAuthzServer serves the Envoy ext_authz gRPC API on ext-authz-bind until
+// ctx is cancelled. Every check is sent through h.
+func extAuthzServer(ctx context.Context, lg *slog.Logger, h http.Handler, done func()) {
+	defer done()
+
+	srv := grpc.NewServer()
+	authv3.RegisterAuthorizationServer(srv, extauthz.New(h))
+	healthv1.RegisterHealthServer(srv, internal.HealthSrv)
+
+	listener, listenerUrl := setupListener(*extAuthzBindNetwork, *extAuthzBind)
+	lg.Info("listening for Envoy ext_authz checks", "url", listenerUrl)
+
+	go func() {
+		<-ctx.Done()
+		srv.GracefulStop()
+	}()
+
+	if err := srv.Serve(listener); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// startHTTP3 serves h over HTTP/3 on http3-bind using the same certificates as
+// the HTTPS listener. The returned server is used to advertise the QUIC
+// listener to TCP clients with Alt-Svc.
+func startHTTP3(ctx context.Context, lg *slog.Logger, tlsConf *tls.Config, h http.Handler, done func()) (*http3.Server, error) {
+	conn, err := net.ListenPacket("udp", *http3Bind)
+	if err != nil {
+		done()
+		return nil, err
+	}
+
+	srv := &http3.Server{
+		Handler:   h,
+		TLSConfig: http3.ConfigureTLSConfig(tlsConf),
+		Port:      *http3AltSvcPort,
+	}
+
+	lg.Debug("listening for HTTP/3", "addr", conn.LocalAddr().String())
+
+	go func() {
+		<-ctx.Done()
+		c, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(c); err != nil {
+			log.Printf("cannot shut down: %v", err)
+		}
+	}()
+
+	go func() {
+		defer done()
+		if err := srv.Serve(conn); err != nil && !errors.Is(err, http.ErrServerClosed) && ctx.Err() == nil {
+			log.Fatal(err)
+		}
+	}()
+
+	return srv, nil
+}
+
+// altSvc advertises the HTTP/3 listener on responses sent over TCP so that
+// browsers switch to QUIC for later requests.
+func altSvc(srv *http3.Server, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor < 3 {
+			if err := srv.SetQUICHeaders(w.Header()); err != nil {
+				slog.Debug("can't set Alt-Svc header", "err", err)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
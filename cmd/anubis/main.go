@@ -16,7 +16,7 @@ import (
 	"log/slog"
 	"net"
 	"net/http"
-	"net/http/httputil"
+	"net/netip"
 	"net/url"
 	"os"
 	"os/signal"
@@ -30,10 +30,13 @@ import (
 	"github.com/TecharoHQ/anubis"
 	"github.com/TecharoHQ/anubis/data"
 	"github.com/TecharoHQ/anubis/internal"
+	"github.com/TecharoHQ/anubis/internal/upstream"
+	"github.com/TecharoHQ/anubis/internal/verifiedcrawler"
 	libanubis "github.com/TecharoHQ/anubis/lib"
 	"github.com/TecharoHQ/anubis/lib/config"
 	botPolicy "github.com/TecharoHQ/anubis/lib/policy"
 	"github.com/TecharoHQ/anubis/lib/thoth"
+	"github.com/TecharoHQ/anubis/lib/thoth/mmdb"
 	"github.com/TecharoHQ/anubis/web"
 	"github.com/facebookgo/flagenv"
 	_ "github.com/joho/godotenv/autoload"
@@ -85,10 +88,44 @@ var (
 	xffStripPrivate          = flag.Bool("xff-strip-private", true, "if set, strip private addresses from X-Forwarded-For")
 	customRealIPHeader       = flag.String("custom-real-ip-header", "", "if set, read remote IP from header of this name (in case your environment doesn't set X-Real-IP header)")
 
-	thothInsecure        = flag.Bool("thoth-insecure", false, "if set, connect to Thoth over plain HTTP/2, don't enable this unless support told you to")
-	thothURL             = flag.String("thoth-url", "", "if set, URL for Thoth, the IP reputation database for Anubis")
-	thothToken           = flag.String("thoth-token", "", "if set, API token for Thoth, the IP reputation database for Anubis")
-	jwtRestrictionHeader = flag.String("jwt-restriction-header", "X-Real-IP", "If set, the JWT is only valid if the current value of this header matched the value when the JWT was created")
+	thothInsecure         = flag.Bool("thoth-insecure", false, "if set, connect to Thoth over plain HTTP/2, don't enable this unless support told you to")
+	thothURL              = flag.String("thoth-url", "", "if set, URL for Thoth, the IP reputation database for Anubis")
+	thothToken            = flag.String("thoth-token", "", "if set, API token for Thoth, the IP reputation database for Anubis")
+	thothTimeout          = flag.Duration("thoth-timeout", thoth.DefaultTimeout, "how long a Thoth lookup may take before Anubis gives up on it")
+	thothBreakerThreshold = flag.Int("thoth-breaker-threshold", thoth.DefaultBreakerThreshold, "how many Thoth lookups in a row must fail before Anubis stops asking Thoth for a while")
+	thothBreakerCooldown  = flag.Duration("thoth-breaker-cooldown", thoth.DefaultBreakerCooldown, "how long Anubis stops asking Thoth for after too many lookups failed")
+	thothCacheTTL         = flag.Duration("thoth-cache-ttl", thoth.DefaultCacheTTL, "how long Thoth lookup results are cached")
+	thothCacheSize        = flag.Int("thoth-cache-size", thoth.DefaultCacheSize, "how many networks from Thoth lookup results are cached at most")
+	thothNegativeTTL      = flag.Duration("thoth-negative-cache-ttl", thoth.DefaultNegativeCacheTTL, "how long a failed Thoth lookup is cached for the client's address")
+	mmdbASNFile           = flag.String("mmdb-asn-file", "", "if set, MMDB file (such as GeoLite2-ASN.mmdb) to look up autonomous systems in for asns rules without Thoth")
+	mmdbCountryFile       = flag.String("mmdb-country-file", "", "if set, MMDB file (such as GeoLite2-Country.mmdb) to look up countries in for geoip rules without Thoth")
+	mmdbReloadInterval    = flag.Duration("mmdb-reload-interval", mmdb.DefaultReloadInterval, "how often to check the MMDB files for changes and reload them")
+	jwtRestrictionHeader  = flag.String("jwt-restriction-header", "X-Real-IP", "If set, the JWT is only valid if the current value of this header matched the value when the JWT was created")
+
+	verifiedCrawlersOffline = flag.Bool("verified-crawlers-offline", false, "if set, never fetch the IP ranges of verified crawlers and only use the built-in snapshots and local files")
+
+	tlsCertFile      = flag.String("tls-cert-file", "", "if set, comma-separated list of PEM certificate files to serve HTTPS with, picked by the server name the client asks for")
+	tlsKeyFile       = flag.String("tls-key-file", "", "comma-separated list of PEM private key files, one for each file in tls-cert-file")
+	tlsHTTPBind      = flag.String("tls-http-bind", "", "if set, network address to answer ACME HTTP-01 challenges and redirect plain HTTP to HTTPS on, e.g. :80")
+	tlsRedirectPort  = flag.Int("tls-redirect-port", 0, "if set, the port plain HTTP requests are redirected to instead of the port in bind")
+	acmeDomains      = flag.String("acme-domains", "", "if set, comma-separated list of domains to get TLS certificates for with ACME")
+	acmeEmail        = flag.String("acme-email", "", "contact email address for the ACME account")
+	acmeDirectoryURL = flag.String("acme-directory-url", "https://acme-v02.api.letsencrypt.org/directory", "ACME directory URL of the certificate authority")
+	acmeCAFile       = flag.String("acme-ca-file", "", "if set, PEM bundle used to verify the ACME certificate authority, useful for testing with Pebble")
+
+	http3Bind       = flag.String("http3-bind", "", "if set, UDP network address to serve HTTP/3 (QUIC) on, needs TLS to be enabled")
+	http3AltSvcPort = flag.Int("http3-alt-svc-port", 0, "if set, the UDP port advertised to clients in the Alt-Svc header instead of the port in http3-bind")
+
+	proxyProtocol             = flag.Bool("proxy-protocol", false, "if true, read the client's IP address from PROXY protocol v1/v2 headers sent by a load balancer in TCP mode")
+	proxyProtocolTrustedCIDRs = flag.String("proxy-protocol-trusted-cidrs", "", "comma-separated list of CIDR ranges allowed to send PROXY protocol headers, e.g. 10.0.0.0/8")
+
+	extAuthzBind        = flag.String("ext-authz-bind", "", "if set, network address to serve the Envoy ext_authz gRPC API on")
+	extAuthzBindNetwork = flag.String("ext-authz-bind-network", "tcp", "network family for the Envoy ext_authz server to bind to")
+
+	upgradeEnforceJWTExpiry = flag.Bool("upgrade-enforce-jwt-expiry", false, "if true, close upgraded connections such as WebSockets when the client's JWT expires")
+
+	spoeBind        = flag.String("spoe-bind", "", "if set, network address to serve HAProxy SPOE (Stream Processing Offload Engine) checks on")
+	spoeBindNetwork = flag.String("spoe-bind-network", "tcp", "network family for the HAProxy SPOE agent to bind to")
 )
 
 func keyFromHex(value string) (ed25519.PrivateKey, error) {
@@ -208,60 +245,38 @@ func setupListener(network string, address string) (net.Listener, string) {
 	return listener, formattedAddress
 }
 
-func makeReverseProxy(target string, targetSNI string, targetHost string, insecureSkipVerify bool, targetDisableKeepAlive bool) (http.Handler, error) {
-	targetUri, err := url.Parse(target)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse target URL: %w", err)
-	}
-
-	transport := http.DefaultTransport.(*http.Transport).Clone()
-
-	if targetDisableKeepAlive {
-		transport.DisableKeepAlives = true
-	}
-
-	// https://github.com/oauth2-proxy/oauth2-proxy/blob/4e2100a2879ef06aea1411790327019c1a09217c/pkg/upstream/http.go#L124
-	if targetUri.Scheme == "unix" {
-		// clean path up so we don't use the socket path in proxied requests
-		addr := targetUri.Path
-		targetUri.Path = ""
-		// tell transport how to dial unix sockets
-		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
-			dialer := net.Dialer{}
-			return dialer.DialContext(ctx, "unix", addr)
+// parseCIDRs parses a comma-separated list of CIDR ranges.
+func parseCIDRs(s string) ([]netip.Prefix, error) {
+	var result []netip.Prefix
+	for _, item := range commaList(s) {
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, err
 		}
-		// tell transport how to handle the unix url scheme
-		transport.RegisterProtocol("unix", libanubis.UnixRoundTripper{Transport: transport})
+		result = append(result, prefix)
 	}
+	return result, nil
+}
 
-	if insecureSkipVerify || targetSNI != "" {
-		transport.TLSClientConfig = &tls.Config{}
-	}
-	if insecureSkipVerify {
-		slog.Warn("TARGET_INSECURE_SKIP_VERIFY is set to true, TLS certificate validation will not be performed", "target", target)
-		transport.TLSClientConfig.InsecureSkipVerify = true
-	}
-	if targetSNI != "" && targetSNI != "auto" {
-		transport.TLSClientConfig.ServerName = targetSNI
+// handlerChain wraps h with the middleware that every listener needs to work
+// out the client's IP address and fingerprint its request.
+func handlerChain(h http.Handler, network string, clientIP *config.ClientIP) http.Handler {
+	h = internal.CustomRealIPHeader(*customRealIPHeader, h)
+	if clientIP == nil {
+		// With trusted proxies, go-proxyproto already made the PROXY header's
+		// source address the remote address that TrustedProxyXRealIP starts
+		// walking from.
+		h = internal.ProxyProtocolXRealIP(h)
+		h = internal.RemoteXRealIP(*useRemoteAddress, network, h)
+		h = internal.XForwardedForToXRealIP(h)
 	}
-
-	rp := httputil.NewSingleHostReverseProxy(targetUri)
-	rp.Transport = transport
-
-	if targetHost != "" || targetSNI == "auto" {
-		originalDirector := rp.Director
-		rp.Director = func(req *http.Request) {
-			originalDirector(req)
-			if targetHost != "" {
-				req.Host = targetHost
-			}
-			if targetSNI == "auto" {
-				transport.TLSClientConfig.ServerName = req.Host
-			}
-		}
+	h = internal.XForwardedForUpdate(*xffStripPrivate, h)
+	if clientIP != nil {
+		// This has to see X-Forwarded-For before XForwardedForUpdate flattens it.
+		h = internal.TrustedProxyXRealIP(clientIP.Prefixes(), clientIP.HeaderNames(), h)
 	}
-
-	return rp, nil
+	h = internal.JA4H(h)
+	return h
 }
 
 func main() {
@@ -301,6 +316,18 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
+	if flag.NArg() != 0 {
+		switch flag.Arg(0) {
+		case "store":
+			if err := storeCommand(ctx, lg, flag.Args()[1:]); err != nil {
+				log.Fatal(err)
+			}
+		default:
+			log.Fatalf("%v: %s", ErrUnknownSubcommand, flag.Arg(0))
+		}
+		return
+	}
+
 	wg := new(sync.WaitGroup)
 
 	if *metricsBind != "" {
@@ -312,7 +339,12 @@ func main() {
 	// when using anubis via Systemd and environment variables, then it is not possible to set targe to an empty string but only to space
 	if strings.TrimSpace(*target) != "" {
 		var err error
-		rp, err = makeReverseProxy(*target, *targetSNI, *targetHost, *targetInsecureSkipVerify, *targetDisableKeepAlive)
+		rp, err = upstream.NewReverseProxy(*target, upstream.Options{
+			Host:               *targetHost,
+			SNI:                *targetSNI,
+			InsecureSkipVerify: *targetInsecureSkipVerify,
+			DisableKeepAlive:   *targetDisableKeepAlive,
+		})
 		if err != nil {
 			log.Fatalf("can't make reverse proxy: %v", err)
 		}
@@ -330,7 +362,14 @@ func main() {
 		lg.Warn("THOTH_TOKEN is set but no THOTH_URL is set")
 	case *thothURL != "" && *thothToken != "":
 		lg.Debug("connecting to Thoth")
-		thothClient, err := thoth.New(ctx, *thothURL, *thothToken, *thothInsecure)
+		thothClient, err := thoth.New(ctx, *thothURL, *thothToken, *thothInsecure, thoth.Options{
+			Timeout:          *thothTimeout,
+			BreakerThreshold: *thothBreakerThreshold,
+			BreakerCooldown:  *thothBreakerCooldown,
+			CacheTTL:         *thothCacheTTL,
+			CacheSize:        *thothCacheSize,
+			NegativeCacheTTL: *thothNegativeTTL,
+		})
 		if err != nil {
 			log.Fatalf("can't dial thoth at %s: %v", *thothURL, err)
 		}
@@ -338,6 +377,33 @@ func main() {
 		ctx = thoth.With(ctx, thothClient)
 	}
 
+	// Offline ASN and GeoIP lookups
+	if *mmdbASNFile != "" || *mmdbCountryFile != "" {
+		svc, err := mmdb.New(ctx, mmdb.Options{
+			ASNFile:        *mmdbASNFile,
+			CountryFile:    *mmdbCountryFile,
+			ReloadInterval: *mmdbReloadInterval,
+			Logger:         lg,
+		})
+		if err != nil {
+			log.Fatalf("can't load MMDB files: %v", err)
+		}
+
+		thothClient, ok := thoth.FromContext(ctx)
+		if ok {
+			lg.Info("using MMDB files instead of Thoth for ASN and GeoIP lookups")
+		} else {
+			thothClient = &thoth.Client{}
+		}
+
+		thothClient.WithIPToASNService(svc)
+		ctx = thoth.With(ctx, thothClient)
+	}
+
+	if *verifiedCrawlersOffline {
+		ctx = verifiedcrawler.WithOffline(ctx)
+	}
+
 	lg.Info("loading policy file", "fname", *policyFname)
 	policy, err := libanubis.LoadPoliciesOrDefault(ctx, *policyFname, *challengeDifficulty, *slogLevel)
 	if err != nil {
@@ -347,6 +413,22 @@ func main() {
 	lg.Debug("swapped to new logger")
 	slog.SetDefault(lg)
 
+	if policy.ClientIP != nil {
+		if *customRealIPHeader != "" {
+			log.Fatal("CUSTOM_REAL_IP_HEADER can't be used with client_ip in the policy file, add the header to client_ip.headers instead")
+		}
+		lg.Info("reading client IP addresses from trusted proxies", "trusted_proxies", policy.ClientIP.TrustedProxies, "headers", policy.ClientIP.HeaderNames())
+	}
+
+	if len(policy.Routes) != 0 {
+		router, err := upstream.NewRouter(ctx, policy.Routes, rp)
+		if err != nil {
+			log.Fatalf("can't make upstream routes: %v", err)
+		}
+		rp = router
+		lg.Info("routing requests to upstreams", "routes", len(policy.Routes), "has_default_target", strings.TrimSpace(*target) != "")
+	}
+
 	// Warn if persistent storage is used without a configured signing key
 	if policy.Store.IsPersistent() {
 		if *hs512Secret == "" && *ed25519PrivateKeyHex == "" && *ed25519PrivateKeyHexFile == "" {
@@ -430,11 +512,6 @@ func main() {
 		lg.Warn("REDIRECT_DOMAINS is not set, Anubis will only redirect to the same domain a request is coming from, see https://anubis.techaro.lol/docs/admin/configuration/redirect-domains")
 	}
 
-	anubis.CookieName = *cookiePrefix + "-auth"
-	anubis.TestCookieName = *cookiePrefix + "-cookie-verification"
-	anubis.ForcedLanguage = *forcedLanguage
-	anubis.UseSimplifiedExplanation = *useSimplifiedExplanation
-
 	// If OpenGraph configuration values are not set in the config file, use the
 	// values from flags / envvars.
 	if !policy.OpenGraph.Enabled {
@@ -469,21 +546,64 @@ func main() {
 		JWTRestrictionHeader:     *jwtRestrictionHeader,
 		Logger:                   policy.Logger.With("subsystem", "anubis"),
 		DifficultyInJWT:          *difficultyInJWT,
+		CookieName:               *cookiePrefix + "-auth",
+		TestCookieName:           *cookiePrefix + "-cookie-verification",
+		ForcedLanguage:           *forcedLanguage,
+		UseSimplifiedExplanation: *useSimplifiedExplanation,
+		UpgradeEnforceJWTExpiry:  *upgradeEnforceJWTExpiry,
 	})
 	if err != nil {
 		log.Fatalf("can't construct libanubis.Server: %v", err)
 	}
 
-	var h http.Handler
-	h = s
-	h = internal.CustomRealIPHeader(*customRealIPHeader, h)
-	h = internal.RemoteXRealIP(*useRemoteAddress, *bindNetwork, h)
-	h = internal.XForwardedForToXRealIP(h)
-	h = internal.XForwardedForUpdate(*xffStripPrivate, h)
-	h = internal.JA4H(h)
+	h := handlerChain(s, *bindNetwork, policy.ClientIP)
+
+	if *extAuthzBind != "" {
+		wg.Add(1)
+		go extAuthzServer(ctx, lg, handlerChain(http.HandlerFunc(s.ServeAuthCheck), "tcp", policy.ClientIP), wg.Done)
+	}
+
+	if *spoeBind != "" {
+		wg.Add(1)
+		// HAProxy sends the client's address, so it is always the remote address.
+		go spoeServer(ctx, lg, internal.RemoteXRealIP(true, "tcp", handlerChain(http.HandlerFunc(s.ServeAuthCheck), "tcp", policy.ClientIP)), wg.Done)
+	}
 
 	srv := http.Server{Handler: h, ErrorLog: internal.GetFilteredHTTPLogger()}
 	listener, listenerUrl := setupListener(*bindNetwork, *bind)
+
+	if *proxyProtocol {
+		trusted, err := parseCIDRs(*proxyProtocolTrustedCIDRs)
+		if err != nil {
+			log.Fatalf("can't parse PROXY protocol trusted CIDRs: %v", err)
+		}
+		if len(trusted) == 0 && *bindNetwork != "unix" {
+			log.Fatal("PROXY protocol needs PROXY_PROTOCOL_TRUSTED_CIDRS to be set")
+		}
+		listener = internal.ProxyProtocolListener(listener, trusted)
+		srv.ConnContext = internal.ProxyProtocolConnContext
+	}
+
+	if tlsEnabled() {
+		wg.Add(1)
+		tlsConf, err := setupTLS(ctx, lg, policy.Store, httpsPort(listener), wg.Done)
+		if err != nil {
+			log.Fatalf("can't set up TLS: %v", err)
+		}
+		listener = tls.NewListener(listener, tlsConf)
+		listenerUrl = strings.Replace(listenerUrl, "http://", "https://", 1)
+
+		if *http3Bind != "" {
+			wg.Add(1)
+			h3, err := startHTTP3(ctx, lg, tlsConf, handlerChain(s, "udp", policy.ClientIP), wg.Done)
+			if err != nil {
+				log.Fatalf("can't set up HTTP/3: %v", err)
+			}
+			srv.Handler = altSvc(h3, h)
+		}
+	} else if *http3Bind != "" {
+		log.Fatal("HTTP/3 needs TLS, set TLS_CERT_FILE or ACME_DOMAINS")
+	}
 	lg.Info(
 		"listening",
 		"url", listenerUrl,
@@ -524,8 +644,13 @@ func metricsServer(ctx context.Context, lg slog.Logger, done func()) {
 	mux := http.NewServeMux()
 	mux.Handle("/metrics", promhttp.Handler())
 	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
-		st, ok := internal.GetHealth("anubis")
-		if !ok {
+		svc := "anubis"
+		if name := r.URL.Query().Get("upstream"); name != "" {
+			svc = upstream.HealthService(name)
+		}
+
+		st, ok := internal.GetHealth(svc)
+		if !ok && svc == "anubis" {
 			slog.Error("health service anubis does not exist, file a bug")
 		}
 
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"testing"
+
+	"github.com/TecharoHQ/anubis/internal"
+	"github.com/TecharoHQ/anubis/lib/config"
+	"github.com/pires/go-proxyproto"
+)
+
+func TestHandlerChainProxyProtocol(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		clientIP *config.ClientIP
+		want     string
+	}{
+		{
+			// CDN -> PROXY protocol load balancer -> Anubis: the PROXY header
+			// names the CDN edge and X-Forwarded-For names the client.
+			name: "trusted-proxies",
+			clientIP: &config.ClientIP{
+				TrustedProxies: []string{"127.0.0.0/8", "198.51.100.0/24"},
+			},
+			want: "192.0.2.1 192.0.2.1",
+		},
+		{
+			name: "no-trusted-proxies",
+			want: "198.51.100.7 198.51.100.7",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			h := handlerChain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				realIP, _ := internal.RealIP(r)
+				fmt.Fprintf(w, "%s %s", r.Header.Get("X-Real-Ip"), realIP)
+			}), "tcp", tt.clientIP)
+
+			srv := &http.Server{Handler: h, ConnContext: internal.ProxyProtocolConnContext}
+			go srv.Serve(internal.ProxyProtocolListener(ln, []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}))
+			t.Cleanup(func() { srv.Close() })
+
+			conn, err := net.Dial("tcp", ln.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			hdr := proxyproto.HeaderProxyFromAddrs(2, &net.TCPAddr{IP: net.ParseIP("198.51.100.7"), Port: 1234}, conn.LocalAddr())
+			if _, err := hdr.WriteTo(conn); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := io.WriteString(conn, "GET / HTTP/1.1\r\nHost: example.com\r\nX-Forwarded-For: 192.0.2.1\r\nConnection: close\r\n\r\n"); err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := string(body); got != tt.want {
+				t.Logf("want: %q", tt.want)
+				t.Logf("got:  %q", got)
+				t.Error("wrong client address")
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"net/http"
+
+	"github.com/TecharoHQ/anubis/internal/spop"
+)
+
+// spoeServer answers HAProxy SPOE checks on spoe-bind until ctx is cancelled.
+// Every check is sent through h.
+func spoeServer(ctx context.Context, lg *slog.Logger, h http.Handler, done func()) {
+	defer done()
+
+	srv := &spop.Server{
+		Handler: spop.HTTPHandler(h),
+		Logger:  lg.With("subsystem", "spoe"),
+	}
+
+	listener, listenerUrl := setupListener(*spoeBindNetwork, *spoeBind)
+	lg.Info("listening for HAProxy SPOE checks", "url", listenerUrl)
+
+	if err := srv.Serve(ctx, listener); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	libanubis "github.com/TecharoHQ/anubis/lib"
+	"github.com/TecharoHQ/anubis/lib/store"
+)
+
+var (
+	ErrUnknownSubcommand = errors.New("unknown subcommand")
+)
+
+const storeUsage = `Usage: anubis [flags] store <export|import> [options]
+
+Copies the contents of the store configured in the policy file to or from JSON
+lines so that state can be migrated between storage backends or backed up.
+
+Examples:
+
+  anubis -policy-fname old.yaml store export -output anubis.jsonl
+  anubis -policy-fname new.yaml store import -input anubis.jsonl
+`
+
+// storeCommand implements the "anubis store" subcommand.
+func storeCommand(ctx context.Context, lg *slog.Logger, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, storeUsage)
+		return fmt.Errorf("%w: store requires export or import", ErrUnknownSubcommand)
+	}
+
+	fs := flag.NewFlagSet("store "+args[0], flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), storeUsage)
+		fs.PrintDefaults()
+	}
+
+	switch args[0] {
+	case "export":
+		output := fs.String("output", "-", "file to write JSON lines to, - means standard output")
+		prefix := fs.String("prefix", "", "only export keys starting with this prefix")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+
+		st, err := loadStore(ctx)
+		if err != nil {
+			return err
+		}
+
+		var out io.Writer = os.Stdout
+		if *output != "-" {
+			fout, err := os.Create(*output)
+			if err != nil {
+				return fmt.Errorf("can't create %s: %w", *output, err)
+			}
+			defer fout.Close()
+			out = fout
+		}
+
+		n, err := store.Export(ctx, st, out, *prefix)
+		if err != nil {
+			return fmt.Errorf("can't export store after %d records: %w", n, err)
+		}
+
+		lg.Info("exported store", "records", n)
+	case "import":
+		input := fs.String("input", "-", "file to read JSON lines from, - means standard input")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+
+		st, err := loadStore(ctx)
+		if err != nil {
+			return err
+		}
+
+		var in io.Reader = os.Stdin
+		if *input != "-" {
+			fin, err := os.Open(*input)
+			if err != nil {
+				return fmt.Errorf("can't open %s: %w", *input, err)
+			}
+			defer fin.Close()
+			in = fin
+		}
+
+		n, err := store.Import(ctx, st, in)
+		if err != nil {
+			return fmt.Errorf("can't import store after %d records: %w", n, err)
+		}
+
+		lg.Info("imported store", "records", n)
+	default:
+		fmt.Fprint(os.Stderr, storeUsage)
+		return fmt.Errorf("%w: store %s", ErrUnknownSubcommand, args[0])
+	}
+
+	return nil
+}
+
+func loadStore(ctx context.Context) (store.Interface, error) {
+	policy, err := libanubis.LoadPoliciesOrDefault(ctx, *policyFname, *challengeDifficulty, *slogLevel)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse policy file: %w", err)
+	}
+
+	if !policy.Store.IsPersistent() {
+		return nil, fmt.Errorf("%w: the policy file does not configure a persistent storage backend", store.ErrBadConfig)
+	}
+
+	return policy.Store, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/TecharoHQ/anubis/internal"
+	"github.com/TecharoHQ/anubis/internal/tlsconfig"
+	"github.com/TecharoHQ/anubis/lib/store"
+)
+
+// tlsEnabled returns true if Anubis should terminate HTTPS itself.
+func tlsEnabled() bool {
+	return *tlsCertFile != "" || *acmeDomains != ""
+}
+
+// httpsPort returns the port plain HTTP requests are redirected to, which is
+// tls-redirect-port or else the port HTTPS is served on.
+func httpsPort(l net.Listener) int {
+	if *tlsRedirectPort != 0 {
+		return *tlsRedirectPort
+	}
+
+	if addr, ok := l.Addr().(*net.TCPAddr); ok {
+		return addr.Port
+	}
+
+	return 0
+}
+
+// setupTLS builds the TLS configuration for the configured certificates. If
+// tls-http-bind is set, it also starts a plain HTTP server that answers ACME
+// HTTP-01 challenges and redirects everything else to HTTPS on httpsPort.
+func setupTLS(ctx context.Context, lg *slog.Logger, st store.Interface, httpsPort int, done func()) (*tls.Config, error) {
+	conf, err := tlsconfig.New(tlsconfig.Options{
+		CertFiles: commaList(*tlsCertFile),
+		KeyFiles:  commaList(*tlsKeyFile),
+		ACME: tlsconfig.ACME{
+			Domains:      commaList(*acmeDomains),
+			Email:        *acmeEmail,
+			DirectoryURL: *acmeDirectoryURL,
+			CAFile:       *acmeCAFile,
+		},
+		Store:     st,
+		HTTPSPort: httpsPort,
+	})
+	if err != nil {
+		done()
+		return nil, err
+	}
+
+	if *tlsHTTPBind == "" {
+		if *acmeDomains != "" {
+			lg.Warn("TLS_HTTP_BIND is not set, ACME certificates can only be issued with the TLS-ALPN-01 challenge")
+		}
+		done()
+	} else {
+		go challengeServer(ctx, lg, conf.HTTPHandler(), done)
+	}
+
+	return conf.TLSConfig(), nil
+}
+
+func challengeServer(ctx context.Context, lg *slog.Logger, h http.Handler, done func()) {
+	defer done()
+
+	srv := http.Server{Handler: h, ErrorLog: internal.GetFilteredHTTPLogger()}
+	listener, listenerUrl := setupListener("tcp", *tlsHTTPBind)
+	lg.Debug("listening for ACME HTTP-01 challenges and HTTPS redirects", "url", listenerUrl)
+
+	go func() {
+		<-ctx.Done()
+		c, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(c); err != nil {
+			log.Printf("cannot shut down: %v", err)
+		}
+	}()
+
+	if err := srv.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+}
+
+// commaList splits a comma-separated flag value, dropping empty entries.
+func commaList(s string) []string {
+	var result []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
@@ -5,4 +5,14 @@ import "embed"
 var (
 	//go:embed botPolicies.yaml all:apps all:bots all:clients all:common all:crawlers all:meta all:services
 	BotPolicies embed.FS
+
+	// CrawlerRanges holds snapshots of the IP range feeds that verified
+	// crawlers publish. They are used until the first refresh succeeds.
+	//go:embed crawler-ranges
+	CrawlerRanges embed.FS
+
+	// HostingProviders lists the autonomous systems of hosting and cloud
+	// providers. Refresh it with utils/cmd/hostingasns.
+	//go:embed hosting/providers.yaml
+	HostingProviders []byte
 )
@@ -23,6 +23,11 @@ func TestBotPoliciesEmbed(t *testing.T) {
 	for _, filePath := range yamlFiles {
 		embeddedPath := strings.TrimPrefix(filePath, "./")
 
+		// The hosting provider dataset is embedded on its own, not as a policy.
+		if strings.HasPrefix(embeddedPath, "hosting/") {
+			continue
+		}
+
 		t.Run(embeddedPath, func(t *testing.T) {
 			content, err := BotPolicies.ReadFile(embeddedPath)
 			if err != nil {
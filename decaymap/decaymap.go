@@ -127,6 +127,26 @@ func (m *Impl[K, V]) Cleanup() {
 	}
 }
 
+// Range calls fn for every unexpired entry in the DecayMap along with the time
+// it expires at. If fn returns false, iteration stops.
+//
+// The DecayMap is read-locked while Range runs, so fn must not modify it.
+func (m *Impl[K, V]) Range(fn func(key K, value V, expiry time.Time) bool) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	now := time.Now()
+	for key, entry := range m.data {
+		if now.After(entry.expiry) {
+			continue
+		}
+
+		if !fn(key, entry.Value, entry.expiry) {
+			return
+		}
+	}
+}
+
 // Len returns the number of entries in the DecayMap.
 func (m *Impl[K, V]) Len() int {
 	m.lock.RLock()
@@ -73,3 +73,41 @@ func TestCleanup(t *testing.T) {
 		t.Error("test3 should still be found after cleanup")
 	}
 }
+
+func TestRange(t *testing.T) {
+	dm := New[string, string]()
+	t.Cleanup(dm.Close)
+
+	dm.Set("test1", "hi1", time.Minute)
+	dm.Set("test2", "hi2", time.Minute)
+	dm.Set("test3", "hi3", time.Minute)
+
+	dm.expire("test2")
+
+	seen := map[string]string{}
+	dm.Range(func(key, value string, expiry time.Time) bool {
+		if time.Now().After(expiry) {
+			t.Errorf("Range returned expired key %q", key)
+		}
+		seen[key] = value
+		return true
+	})
+
+	if len(seen) != 2 {
+		t.Errorf("wanted 2 entries, got %d: %v", len(seen), seen)
+	}
+
+	if _, ok := seen["test2"]; ok {
+		t.Error("Range returned force-expired key test2")
+	}
+
+	count := 0
+	dm.Range(func(string, string, time.Time) bool {
+		count++
+		return false
+	})
+
+	if count != 1 {
+		t.Errorf("Range did not stop early, called fn %d times", count)
+	}
+}
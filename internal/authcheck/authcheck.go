@@ -0,0 +1,40 @@
+// Package authcheck runs requests from external authorization integrations
+// (such as Envoy ext_authz or HAProxy SPOE) through Anubis' HTTP handlers
+// without proxying them to the upstream.
+package authcheck
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+)
+
+type decisionKey struct{}
+
+type decision struct {
+	allowed bool
+}
+
+// Allow marks r as allowed if it came from Run. It returns true if it did, in
+// which case the caller must not write a response or proxy the request.
+func Allow(r *http.Request) bool {
+	d, ok := r.Context().Value(decisionKey{}).(*decision)
+	if !ok {
+		return false
+	}
+
+	d.allowed = true
+	return true
+}
+
+// Run passes r to h. If h calls Allow, allowed is true and the request
+// headers h set are in r.Header. Otherwise the response h wrote is returned.
+func Run(h http.Handler, r *http.Request) (allowed bool, resp *httptest.ResponseRecorder) {
+	d := &decision{}
+	r = r.WithContext(context.WithValue(r.Context(), decisionKey{}, d))
+
+	resp = httptest.NewRecorder()
+	h.ServeHTTP(resp, r)
+
+	return d.allowed, resp
+}
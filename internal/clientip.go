@@ -0,0 +1,173 @@
+package internal
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// TrustedProxyXRealIP sets the X-Real-Ip header to the client's IP address.
+// Requests from peers outside of trusted use the peer's address. Requests from
+// trusted peers use the first of headers that names a client, walking
+// X-Forwarded-For and Forwarded from the right and stopping at the first hop
+// that is not a trusted proxy. Unix socket peers are always trusted.
+func TrustedProxyXRealIP(trusted []netip.Prefix, headers []string, next http.Handler) http.Handler {
+	if len(trusted) == 0 {
+		slog.Debug("skipping middleware, no trusted proxies are configured")
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addr, ok := resolveClientIP(r, trusted, headers)
+		if !ok {
+			slog.Debug("can't work out client IP address", "remote_addr", r.RemoteAddr)
+			r.Header.Del("X-Real-Ip")
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		r.Header.Set("X-Real-Ip", addr.String())
+		r = r.WithContext(context.WithValue(r.Context(), realIPKey{}, addr))
+		next.ServeHTTP(w, r)
+	})
+}
+
+func resolveClientIP(r *http.Request, trusted []netip.Prefix, headers []string) (netip.Addr, bool) {
+	var peer netip.Addr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		peer, _ = netip.ParseAddr(host)
+		peer = peer.Unmap()
+	}
+
+	if peer.IsValid() && !isTrusted(trusted, peer) {
+		return peer, true
+	}
+
+	for _, name := range headers {
+		var addr netip.Addr
+		var ok bool
+
+		switch name {
+		case "X-Forwarded-For":
+			addr, ok = walkHops(xffHops(r.Header.Values(name)), trusted)
+		case "Forwarded":
+			addr, ok = walkHops(forwardedHops(r.Header.Values(name)), trusted)
+		default:
+			addr, ok = parseHop(r.Header.Get(name))
+		}
+
+		if ok {
+			return addr, true
+		}
+	}
+
+	return peer, peer.IsValid()
+}
+
+func isTrusted(trusted []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// walkHops returns the right-most hop that is not a trusted proxy. If every
+// hop is trusted, it returns the left-most one. Walking stops at the first hop
+// that can't be parsed, as nothing to the left of it can be trusted.
+func walkHops(hops []string, trusted []netip.Prefix) (netip.Addr, bool) {
+	var result netip.Addr
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, ok := parseHop(hops[i])
+		if !ok {
+			break
+		}
+
+		result = addr
+		if !isTrusted(trusted, addr) {
+			break
+		}
+	}
+
+	return result, result.IsValid()
+}
+
+// parseHop parses an IP address with an optional port, as found in
+// X-Forwarded-For and the for= parameter of Forwarded.
+func parseHop(hop string) (netip.Addr, bool) {
+	hop = strings.Trim(strings.TrimSpace(hop), `"`)
+
+	if addr, err := netip.ParseAddr(hop); err == nil {
+		return addr.Unmap(), true
+	}
+
+	if addrPort, err := netip.ParseAddrPort(hop); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+
+	// [2001:db8::1] without a port
+	if strings.HasPrefix(hop, "[") && strings.HasSuffix(hop, "]") {
+		if addr, err := netip.ParseAddr(hop[1 : len(hop)-1]); err == nil {
+			return addr.Unmap(), true
+		}
+	}
+
+	return netip.Addr{}, false
+}
+
+func xffHops(values []string) []string {
+	var result []string
+	for _, value := range values {
+		result = append(result, strings.Split(value, ",")...)
+	}
+	return result
+}
+
+// forwardedHops returns the for= parameter of every element of the RFC 7239
+// Forwarded header. Elements without one become empty hops.
+func forwardedHops(values []string) []string {
+	var result []string
+	for _, value := range values {
+		for _, element := range splitQuoted(value, ',') {
+			var hop string
+			for _, pair := range splitQuoted(element, ';') {
+				key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(key, "for") {
+					hop = val
+				}
+			}
+			result = append(result, hop)
+		}
+	}
+	return result
+}
+
+// splitQuoted splits s on sep, except inside double quotes.
+func splitQuoted(s string, sep byte) []string {
+	var result []string
+	quoted := false
+	start := 0
+
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			quoted = !quoted
+		case '\\':
+			if quoted {
+				i++
+			}
+		case sep:
+			if !quoted {
+				result = append(result, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+
+	return append(result, s[start:])
+}
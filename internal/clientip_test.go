@@ -0,0 +1,180 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestTrustedProxyXRealIP(t *testing.T) {
+	trusted := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("2001:db8:ffff::/48"),
+	}
+
+	for _, tt := range []struct {
+		name       string
+		remoteAddr string
+		headers    []string
+		reqHeaders map[string][]string
+		want       string
+	}{
+		{
+			name:       "untrusted peer ignores headers",
+			remoteAddr: "198.51.100.1:1234",
+			headers:    []string{"X-Forwarded-For", "CF-Connecting-IP"},
+			reqHeaders: map[string][]string{
+				"X-Forwarded-For":  {"192.0.2.1"},
+				"Cf-Connecting-Ip": {"192.0.2.2"},
+				"X-Real-Ip":        {"192.0.2.3"},
+			},
+			want: "198.51.100.1",
+		},
+		{
+			name:       "xff walked from the right",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    []string{"X-Forwarded-For"},
+			reqHeaders: map[string][]string{
+				"X-Forwarded-For": {"192.0.2.66, 198.51.100.7, 10.0.0.2"},
+			},
+			want: "198.51.100.7",
+		},
+		{
+			name:       "xff over multiple header lines",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    []string{"X-Forwarded-For"},
+			reqHeaders: map[string][]string{
+				"X-Forwarded-For": {"192.0.2.66", "198.51.100.7, 10.0.0.2"},
+			},
+			want: "198.51.100.7",
+		},
+		{
+			name:       "xff all trusted uses left-most",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    []string{"X-Forwarded-For"},
+			reqHeaders: map[string][]string{
+				"X-Forwarded-For": {"10.1.1.1, 10.0.0.2"},
+			},
+			want: "10.1.1.1",
+		},
+		{
+			name:       "xff stops at garbage",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    []string{"X-Forwarded-For"},
+			reqHeaders: map[string][]string{
+				"X-Forwarded-For": {"192.0.2.66, not-an-ip, 10.0.0.2"},
+			},
+			want: "10.0.0.2",
+		},
+		{
+			name:       "forwarded",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    []string{"Forwarded"},
+			reqHeaders: map[string][]string{
+				"Forwarded": {`for=192.0.2.66, for="[2001:db8::7]:4711";proto=https, For=10.0.0.2;by=10.0.0.1`},
+			},
+			want: "2001:db8::7",
+		},
+		{
+			name:       "forwarded obfuscated node stops the walk",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    []string{"Forwarded"},
+			reqHeaders: map[string][]string{
+				"Forwarded": {`for=192.0.2.66, for=_hidden, for=10.0.0.2`},
+			},
+			want: "10.0.0.2",
+		},
+		{
+			name:       "forwarded quoted comma",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    []string{"Forwarded"},
+			reqHeaders: map[string][]string{
+				"Forwarded": {`for=198.51.100.7;host="a,b"`},
+			},
+			want: "198.51.100.7",
+		},
+		{
+			name:       "cdn header from trusted peer",
+			remoteAddr: "[2001:db8:ffff::1]:1234",
+			headers:    []string{"CF-Connecting-IP", "X-Forwarded-For"},
+			reqHeaders: map[string][]string{
+				"Cf-Connecting-Ip": {"192.0.2.9"},
+				"X-Forwarded-For":  {"198.51.100.7"},
+			},
+			want: "192.0.2.9",
+		},
+		{
+			name:       "falls through to next header",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    []string{"True-Client-IP", "X-Forwarded-For"},
+			reqHeaders: map[string][]string{
+				"X-Forwarded-For": {"198.51.100.7"},
+			},
+			want: "198.51.100.7",
+		},
+		{
+			name:       "headers not in the list are ignored",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    []string{"X-Forwarded-For"},
+			reqHeaders: map[string][]string{
+				"Cf-Connecting-Ip": {"192.0.2.9"},
+			},
+			want: "10.0.0.1",
+		},
+		{
+			name:       "ipv4-mapped peer",
+			remoteAddr: "[::ffff:10.0.0.1]:1234",
+			headers:    []string{"X-Forwarded-For"},
+			reqHeaders: map[string][]string{
+				"X-Forwarded-For": {"198.51.100.7"},
+			},
+			want: "198.51.100.7",
+		},
+		{
+			name:       "unix socket peer is trusted",
+			remoteAddr: "@",
+			headers:    []string{"X-Forwarded-For"},
+			reqHeaders: map[string][]string{
+				"X-Forwarded-For": {"198.51.100.7"},
+			},
+			want: "198.51.100.7",
+		},
+		{
+			name:       "unix socket peer without headers",
+			remoteAddr: "@",
+			headers:    []string{"X-Forwarded-For"},
+			reqHeaders: map[string][]string{
+				"X-Real-Ip": {"192.0.2.3"},
+			},
+			want: "",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			var gotRealIP netip.Addr
+			h := TrustedProxyXRealIP(trusted, tt.headers, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.Header.Get("X-Real-Ip")
+				gotRealIP, _ = RealIP(r)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for k, v := range tt.reqHeaders {
+				req.Header[k] = v
+			}
+
+			h.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got != tt.want {
+				t.Logf("want: %q", tt.want)
+				t.Logf("got:  %q", got)
+				t.Error("wrong X-Real-Ip")
+			}
+
+			if tt.want != "" && gotRealIP.String() != tt.want {
+				t.Errorf("wanted real IP in context to be %s, got: %s", tt.want, gotRealIP)
+			}
+		})
+	}
+}
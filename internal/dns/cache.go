@@ -14,9 +14,12 @@ type DnsCache struct {
 	reverse    store.JSON[[]string]
 	forwardTTL time.Duration
 	reverseTTL time.Duration
+	// negativeTTL is how long names without records are cached. If it is
+	// zero, they are not cached.
+	negativeTTL time.Duration
 }
 
-func NewDNSCache(forwardTTL int, reverseTTL int, backend store.Interface) *DnsCache {
+func NewDNSCache(forwardTTL int, reverseTTL int, negativeTTL int, backend store.Interface) *DnsCache {
 	return &DnsCache{
 		forward: store.JSON[[]string]{
 			Underlying: backend,
@@ -26,8 +29,9 @@ func NewDNSCache(forwardTTL int, reverseTTL int, backend store.Interface) *DnsCa
 			Underlying: backend,
 			Prefix:     "reverseDNS",
 		},
-		forwardTTL: time.Duration(forwardTTL) * time.Second,
-		reverseTTL: time.Duration(reverseTTL) * time.Second,
+		forwardTTL:  time.Duration(forwardTTL) * time.Second,
+		reverseTTL:  time.Duration(reverseTTL) * time.Second,
+		negativeTTL: time.Duration(negativeTTL) * time.Second,
 	}
 }
 
@@ -68,3 +72,17 @@ func (d *Dns) reverseCachePut(addr string, entries []string) {
 	}
 	d.cache.reverse.Set(d.ctx, addr, entries, d.cache.reverseTTL)
 }
+
+func (d *Dns) forwardCachePutNegative(host string) {
+	if d.cache == nil || d.cache.negativeTTL <= 0 {
+		return
+	}
+	d.cache.forward.Set(d.ctx, host, []string{}, d.cache.negativeTTL)
+}
+
+func (d *Dns) reverseCachePutNegative(addr string) {
+	if d.cache == nil || d.cache.negativeTTL <= 0 {
+		return
+	}
+	d.cache.reverse.Set(d.ctx, addr, []string{}, d.cache.negativeTTL)
+}
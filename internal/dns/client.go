@@ -0,0 +1,354 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	mdns "github.com/miekg/dns"
+)
+
+var (
+	ErrNoUpstreams       = errors.New("dns: client has no upstream resolvers")
+	ErrUnknownProtocol   = errors.New("dns: unknown upstream protocol")
+	ErrServerMisbehaving = errors.New("server misbehaving")
+	ErrNotAuthenticated  = errors.New("answer is not authenticated with DNSSEC")
+)
+
+// Resolver answers DNS queries. *net.Resolver and *Client implement it.
+type Resolver interface {
+	LookupAddr(ctx context.Context, addr string) ([]string, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+	LookupIP(ctx context.Context, network, host string) ([]net.IP, error)
+}
+
+// Protocol is how a Client talks to an upstream resolver.
+type Protocol string
+
+const (
+	ProtocolUDP   Protocol = "udp"
+	ProtocolTCP   Protocol = "tcp"
+	ProtocolTLS   Protocol = "tls"
+	ProtocolHTTPS Protocol = "https"
+)
+
+// Upstream is a DNS server that a Client sends queries to.
+type Upstream struct {
+	Protocol Protocol
+
+	// Address is host:port for UDP, TCP and TLS upstreams, and the URL of the
+	// DNS-over-HTTPS endpoint for HTTPS upstreams.
+	Address string
+
+	// ServerName is the name to verify the TLS certificate of TLS upstreams
+	// against. If it is empty, the host in Address is used.
+	ServerName string
+}
+
+func (u Upstream) String() string {
+	if u.Protocol == ProtocolHTTPS {
+		return u.Address
+	}
+
+	return string(u.Protocol) + "://" + u.Address
+}
+
+const (
+	// DefaultTimeout is how long a Client waits for an answer to one query
+	// if its Timeout is not set.
+	DefaultTimeout = 2 * time.Second
+
+	// DefaultAttempts is how many times a Client sends a query if its
+	// Attempts is not set.
+	DefaultAttempts = 3
+)
+
+// Client is a stub resolver that sends queries to a list of upstream
+// resolvers over UDP, TCP, DNS-over-TLS or DNS-over-HTTPS. Failed queries are
+// retried against the next upstream in the list.
+type Client struct {
+	Upstreams []Upstream
+
+	// Timeout is how long to wait for an answer to one attempt of a query.
+	Timeout time.Duration
+
+	// Attempts is how many times a query is sent before giving up. Each
+	// attempt goes to the next upstream.
+	Attempts int
+
+	// DNSSEC asks upstreams to validate answers with DNSSEC and only accepts
+	// answers that they mark as authenticated. Validating upstreams answer
+	// SERVFAIL instead of returning bogus records. Names in zones that aren't
+	// signed can't be looked up.
+	DNSSEC bool
+
+	// HTTPClient is used for DNS-over-HTTPS upstreams. If it is nil,
+	// http.DefaultClient is used.
+	HTTPClient *http.Client
+}
+
+// LookupAddr returns the names that addr points to with PTR records.
+func (c *Client) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	name, err := mdns.ReverseAddr(addr)
+	if err != nil {
+		return nil, &net.DNSError{Err: err.Error(), Name: addr}
+	}
+
+	answers, err := c.query(ctx, name, mdns.TypePTR)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []string
+	for _, rr := range answers {
+		if ptr, ok := rr.(*mdns.PTR); ok {
+			result = append(result, ptr.Ptr)
+		}
+	}
+
+	if len(result) == 0 {
+		return nil, notFound(addr)
+	}
+
+	return result, nil
+}
+
+// LookupHost returns the IPv4 and IPv6 addresses of host.
+func (c *Client) LookupHost(ctx context.Context, host string) ([]string, error) {
+	ips, err := c.LookupIP(ctx, "ip", host)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		result = append(result, ip.String())
+	}
+
+	return result, nil
+}
+
+// LookupIP returns the addresses of host. network is "ip4" for IPv4
+// addresses, "ip6" for IPv6 addresses or "ip" for both.
+func (c *Client) LookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	var qtypes []uint16
+	switch network {
+	case "ip":
+		qtypes = []uint16{mdns.TypeA, mdns.TypeAAAA}
+	case "ip4":
+		qtypes = []uint16{mdns.TypeA}
+	case "ip6":
+		qtypes = []uint16{mdns.TypeAAAA}
+	default:
+		return nil, net.UnknownNetworkError(network)
+	}
+
+	var (
+		result []net.IP
+		errs   []error
+	)
+
+	for _, qtype := range qtypes {
+		answers, err := c.query(ctx, mdns.Fqdn(host), qtype)
+		if err != nil {
+			var dnsErr *net.DNSError
+			if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+				errs = append(errs, err)
+			}
+			continue
+		}
+
+		for _, rr := range answers {
+			switch rr := rr.(type) {
+			case *mdns.A:
+				result = append(result, rr.A)
+			case *mdns.AAAA:
+				result = append(result, rr.AAAA)
+			}
+		}
+	}
+
+	if len(result) != 0 {
+		return result, nil
+	}
+
+	if len(errs) != 0 {
+		return nil, errs[0]
+	}
+
+	return nil, notFound(host)
+}
+
+// query sends a question for name and returns the records in the answer
+// section. Failed attempts are retried against the next upstream.
+func (c *Client) query(ctx context.Context, name string, qtype uint16) ([]mdns.RR, error) {
+	if len(c.Upstreams) == 0 {
+		return nil, ErrNoUpstreams
+	}
+
+	attempts := c.Attempts
+	if attempts <= 0 {
+		attempts = DefaultAttempts
+	}
+
+	msg := new(mdns.Msg)
+	msg.SetQuestion(name, qtype)
+	if c.DNSSEC {
+		msg.AuthenticatedData = true
+		msg.SetEdns0(4096, true)
+	}
+
+	var lastErr error
+	for i := range attempts {
+		if err := ctx.Err(); err != nil {
+			return nil, &net.DNSError{Err: err.Error(), Name: name, IsTimeout: true}
+		}
+
+		upstream := c.Upstreams[i%len(c.Upstreams)]
+
+		resp, err := c.exchange(ctx, upstream, msg)
+		if err != nil {
+			lastErr = &net.DNSError{
+				Err:         err.Error(),
+				Name:        name,
+				Server:      upstream.String(),
+				IsTimeout:   isTimeout(err),
+				IsTemporary: true,
+			}
+			continue
+		}
+
+		if c.DNSSEC && !resp.AuthenticatedData && (resp.Rcode == mdns.RcodeSuccess || resp.Rcode == mdns.RcodeNameError) {
+			lastErr = &net.DNSError{
+				Err:    ErrNotAuthenticated.Error(),
+				Name:   name,
+				Server: upstream.String(),
+			}
+			continue
+		}
+
+		switch resp.Rcode {
+		case mdns.RcodeSuccess:
+			return slices.DeleteFunc(resp.Answer, func(rr mdns.RR) bool {
+				return rr.Header().Rrtype != qtype
+			}), nil
+		case mdns.RcodeNameError:
+			return nil, notFound(name)
+		default:
+			lastErr = &net.DNSError{
+				Err:         fmt.Sprintf("%s: %s", ErrServerMisbehaving, mdns.RcodeToString[resp.Rcode]),
+				Name:        name,
+				Server:      upstream.String(),
+				IsTemporary: true,
+			}
+		}
+	}
+
+	return nil, lastErr
+}
+
+// exchange sends msg to upstream once and waits for the answer.
+func (c *Client) exchange(ctx context.Context, upstream Upstream, msg *mdns.Msg) (*mdns.Msg, error) {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	switch upstream.Protocol {
+	case ProtocolUDP, ProtocolTCP:
+		resp, _, err := (&mdns.Client{Net: string(upstream.Protocol), Timeout: timeout}).ExchangeContext(ctx, msg, upstream.Address)
+		if err == nil && resp.Truncated && upstream.Protocol == ProtocolUDP {
+			resp, _, err = (&mdns.Client{Net: "tcp", Timeout: timeout}).ExchangeContext(ctx, msg, upstream.Address)
+		}
+		return resp, err
+	case ProtocolTLS:
+		serverName := upstream.ServerName
+		if serverName == "" {
+			serverName, _, _ = net.SplitHostPort(upstream.Address)
+		}
+
+		cli := &mdns.Client{
+			Net:       "tcp-tls",
+			Timeout:   timeout,
+			TLSConfig: &tls.Config{ServerName: serverName, MinVersion: tls.VersionTLS12},
+		}
+		resp, _, err := cli.ExchangeContext(ctx, msg, upstream.Address)
+		return resp, err
+	case ProtocolHTTPS:
+		return c.exchangeHTTPS(ctx, upstream, msg)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownProtocol, upstream.Protocol)
+	}
+}
+
+// exchangeHTTPS sends msg to a DNS-over-HTTPS endpoint as described in RFC
+// 8484.
+func (c *Client) exchangeHTTPS(ctx context.Context, upstream Upstream, msg *mdns.Msg) (*mdns.Msg, error) {
+	// RFC 8484 section 4.1: use an ID of 0 so that responses are cacheable
+	query := msg.Copy()
+	query.Id = 0
+
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, upstream.Address, bytes.NewReader(packed))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/dns-message")
+	req.Header.Set("Content-Type", "application/dns-message")
+
+	cli := c.HTTPClient
+	if cli == nil {
+		cli = http.DefaultClient
+	}
+
+	resp, err := cli.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: HTTP status %d", ErrServerMisbehaving, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, mdns.MaxMsgSize))
+	if err != nil {
+		return nil, err
+	}
+
+	result := new(mdns.Msg)
+	if err := result.Unpack(body); err != nil {
+		return nil, err
+	}
+	result.Id = msg.Id
+
+	return result, nil
+}
+
+func notFound(name string) error {
+	return &net.DNSError{Err: "no such host", Name: strings.TrimSuffix(name, "."), IsNotFound: true}
+}
+
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,260 @@
+package dns
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	mdns "github.com/miekg/dns"
+)
+
+// answer is a tiny authoritative server used by the upstream test servers.
+func answer(req *mdns.Msg) *mdns.Msg {
+	resp := new(mdns.Msg)
+	resp.SetReply(req)
+
+	q := req.Question[0]
+	switch {
+	case q.Name == "4.3.2.1.in-addr.arpa." && q.Qtype == mdns.TypePTR:
+		rr, _ := mdns.NewRR("4.3.2.1.in-addr.arpa. 60 IN PTR one.example.")
+		resp.Answer = append(resp.Answer, rr)
+	case q.Name == "one.example." && q.Qtype == mdns.TypeA:
+		rr, _ := mdns.NewRR("one.example. 60 IN A 1.2.3.4")
+		resp.Answer = append(resp.Answer, rr)
+	case q.Name == "one.example." && q.Qtype == mdns.TypeAAAA:
+		rr, _ := mdns.NewRR("one.example. 60 IN AAAA 2001:db8::1")
+		resp.Answer = append(resp.Answer, rr)
+	case q.Name == "one.example.":
+	case q.Name == "signed.example." && q.Qtype == mdns.TypeA:
+		rr, _ := mdns.NewRR("signed.example. 60 IN A 1.2.3.5")
+		resp.Answer = append(resp.Answer, rr)
+		resp.AuthenticatedData = true
+	case q.Name == "signed.example.":
+		resp.AuthenticatedData = true
+	case q.Name == "missing.signed.example.":
+		resp.Rcode = mdns.RcodeNameError
+		resp.AuthenticatedData = true
+	case q.Name == "servfail.example.":
+		resp.Rcode = mdns.RcodeServerFailure
+	default:
+		resp.Rcode = mdns.RcodeNameError
+	}
+
+	return resp
+}
+
+func spawnUpstream(t *testing.T, protocol Protocol) Upstream {
+	t.Helper()
+
+	handler := mdns.HandlerFunc(func(w mdns.ResponseWriter, req *mdns.Msg) {
+		w.WriteMsg(answer(req))
+	})
+
+	started := make(chan struct{})
+	srv := &mdns.Server{Handler: handler, NotifyStartedFunc: func() { close(started) }}
+
+	var addr string
+	switch protocol {
+	case ProtocolUDP:
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv.PacketConn = pc
+		addr = pc.LocalAddr().String()
+	case ProtocolTCP:
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv.Listener = ln
+		addr = ln.Addr().String()
+	case ProtocolHTTPS:
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Content-Type") != "application/dns-message" {
+				http.Error(w, "wrong content type", http.StatusUnsupportedMediaType)
+				return
+			}
+
+			body, _ := io.ReadAll(r.Body)
+			req := new(mdns.Msg)
+			if err := req.Unpack(body); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			packed, _ := answer(req).Pack()
+			w.Header().Set("Content-Type", "application/dns-message")
+			w.Write(packed)
+		}))
+		t.Cleanup(ts.Close)
+		return Upstream{Protocol: ProtocolHTTPS, Address: ts.URL + "/dns-query"}
+	}
+
+	go srv.ActivateAndServe()
+	t.Cleanup(func() { srv.Shutdown() })
+	<-started
+
+	return Upstream{Protocol: protocol, Address: addr}
+}
+
+func TestClient(t *testing.T) {
+	for _, protocol := range []Protocol{ProtocolUDP, ProtocolTCP, ProtocolHTTPS} {
+		t.Run(string(protocol), func(t *testing.T) {
+			cli := &Client{Upstreams: []Upstream{spawnUpstream(t, protocol)}, Timeout: time.Second}
+
+			names, err := cli.LookupAddr(t.Context(), "1.2.3.4")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(names, []string{"one.example."}) {
+				t.Errorf("wrong PTR records: %v", names)
+			}
+
+			addrs, err := cli.LookupHost(t.Context(), "one.example")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(addrs, []string{"1.2.3.4", "2001:db8::1"}) {
+				t.Errorf("wrong addresses: %v", addrs)
+			}
+
+			ips, err := cli.LookupIP(t.Context(), "ip4", "one.example")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(ips) != 1 || !ips[0].Equal(net.ParseIP("1.2.3.4")) {
+				t.Errorf("wrong IPv4 addresses: %v", ips)
+			}
+
+			_, err = cli.LookupHost(t.Context(), "missing.example")
+			var dnsErr *net.DNSError
+			if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+				t.Errorf("wanted a not found error, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestClientDNSSEC(t *testing.T) {
+	cli := &Client{Upstreams: []Upstream{spawnUpstream(t, ProtocolUDP)}, Timeout: time.Second, DNSSEC: true}
+
+	ips, err := cli.LookupIP(t.Context(), "ip4", "signed.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ips) != 1 || !ips[0].Equal(net.ParseIP("1.2.3.5")) {
+		t.Errorf("wrong IPv4 addresses: %v", ips)
+	}
+
+	_, err = cli.LookupIP(t.Context(), "ip4", "missing.signed.example")
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+		t.Errorf("wanted a not found error for an authenticated NXDOMAIN, got: %v", err)
+	}
+
+	for _, name := range []string{"one.example", "missing.example"} {
+		_, err := cli.LookupIP(t.Context(), "ip4", name)
+
+		t.Logf("want: %v", ErrNotAuthenticated)
+		t.Logf("got:  %v", err)
+
+		var dnsErr *net.DNSError
+		if !errors.As(err, &dnsErr) || dnsErr.Err != ErrNotAuthenticated.Error() {
+			t.Errorf("wanted unauthenticated answer for %s to be rejected", name)
+		}
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	// a UDP socket that never answers
+	dead, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dead.Close() })
+
+	good := spawnUpstream(t, ProtocolUDP)
+
+	t.Run("fails over to the next upstream", func(t *testing.T) {
+		cli := &Client{
+			Upstreams: []Upstream{{Protocol: ProtocolUDP, Address: dead.LocalAddr().String()}, good},
+			Timeout:   100 * time.Millisecond,
+			Attempts:  2,
+		}
+
+		addrs, err := cli.LookupHost(t.Context(), "one.example")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(addrs) != 2 {
+			t.Errorf("wrong addresses: %v", addrs)
+		}
+	})
+
+	t.Run("gives up after attempts", func(t *testing.T) {
+		cli := &Client{
+			Upstreams: []Upstream{{Protocol: ProtocolUDP, Address: dead.LocalAddr().String()}},
+			Timeout:   50 * time.Millisecond,
+			Attempts:  2,
+		}
+
+		start := time.Now()
+		_, err := cli.LookupIP(t.Context(), "ip4", "one.example")
+		var dnsErr *net.DNSError
+		if !errors.As(err, &dnsErr) || !dnsErr.IsTimeout {
+			t.Errorf("wanted a timeout error, got: %v", err)
+		}
+
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("lookup took %s, wanted about 100ms", elapsed)
+		}
+	})
+
+	t.Run("SERVFAIL is retried", func(t *testing.T) {
+		var calls atomic.Int64
+		handler := mdns.HandlerFunc(func(w mdns.ResponseWriter, req *mdns.Msg) {
+			calls.Add(1)
+			w.WriteMsg(answer(req))
+		})
+
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		started := make(chan struct{})
+		srv := &mdns.Server{PacketConn: pc, Handler: handler, NotifyStartedFunc: func() { close(started) }}
+		go srv.ActivateAndServe()
+		t.Cleanup(func() { srv.Shutdown() })
+		<-started
+
+		cli := &Client{
+			Upstreams: []Upstream{{Protocol: ProtocolUDP, Address: pc.LocalAddr().String()}},
+			Timeout:   time.Second,
+			Attempts:  3,
+		}
+
+		_, err = cli.LookupIP(t.Context(), "ip4", "servfail.example")
+		var dnsErr *net.DNSError
+		if !errors.As(err, &dnsErr) || dnsErr.IsNotFound || !dnsErr.IsTemporary {
+			t.Errorf("wanted a temporary error, got: %v", err)
+		}
+
+		if got := calls.Load(); got != 3 {
+			t.Errorf("wanted 3 attempts, got: %d", got)
+		}
+	})
+
+	t.Run("no upstreams", func(t *testing.T) {
+		cli := &Client{}
+		if _, err := cli.LookupHost(t.Context(), "one.example"); !errors.Is(err, ErrNoUpstreams) {
+			t.Errorf("wanted %v, got: %v", ErrNoUpstreams, err)
+		}
+	})
+}
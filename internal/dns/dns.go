@@ -10,6 +10,8 @@ import (
 	"regexp"
 	"slices"
 	"strings"
+
+	"golang.org/x/sync/singleflight"
 )
 
 var (
@@ -17,16 +19,87 @@ var (
 	DNSLookupHost = net.LookupHost
 )
 
+// systemResolver uses the host's resolver through DNSLookupAddr and
+// DNSLookupHost.
+type systemResolver struct{}
+
+func (systemResolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	return DNSLookupAddr(addr)
+}
+
+func (systemResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	return DNSLookupHost(host)
+}
+
+func (systemResolver) LookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	return net.DefaultResolver.LookupIP(ctx, network, host)
+}
+
 type Dns struct {
-	cache *DnsCache
-	ctx   context.Context
+	cache        *DnsCache
+	ctx          context.Context
+	resolver     Resolver
+	limiter      *limiter
+	fallbackPass bool
+	group        singleflight.Group
 }
 
-func New(ctx context.Context, cache *DnsCache) *Dns {
+// New creates a Dns that caches answers from resolver in cache. If resolver
+// is nil, the host's resolver is used. Lookups are limited with the default
+// Limits until SetLimits is called.
+func New(ctx context.Context, cache *DnsCache, resolver Resolver) *Dns {
+	if resolver == nil {
+		resolver = systemResolver{}
+	}
+
 	return &Dns{
-		cache: cache,
-		ctx:   ctx,
+		cache:    cache,
+		ctx:      ctx,
+		resolver: resolver,
+		limiter:  newLimiter(Limits{}),
+	}
+}
+
+// SetLimits changes how many lookups d makes at once. It must be called
+// before d is used.
+func (d *Dns) SetLimits(l Limits) {
+	d.limiter = newLimiter(l)
+	d.fallbackPass = l.FallbackPass
+}
+
+// LookupIP looks up the addresses of host without caching them. It lets
+// other packages such as internal/dnsbl use the same resolver.
+func (d *Dns) LookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	if err := d.limiter.acquire(ctx, "ip"); err != nil {
+		return nil, err
+	}
+	defer d.limiter.release()
+
+	return d.resolver.LookupIP(ctx, network, host)
+}
+
+// lookupShared runs fn unless an identical lookup is already in flight, in
+// which case it waits for that lookup's result instead. Either way, fn only
+// runs once it gets a slot from the limiter.
+func (d *Dns) lookupShared(kind, key string, fn func() ([]string, error)) ([]string, error) {
+	result, err, shared := d.group.Do(kind+":"+key, func() (any, error) {
+		if err := d.limiter.acquire(d.ctx, kind); err != nil {
+			return nil, err
+		}
+		defer d.limiter.release()
+
+		return fn()
+	})
+
+	if shared {
+		lookupsDeduplicated.WithLabelValues(kind).Inc()
+	}
+
+	if err != nil {
+		return nil, err
 	}
+
+	return result.([]string), nil
 }
 
 // ReverseDNS performs a reverse DNS lookup for the given IP address and trims the trailing dot from the results.
@@ -37,10 +110,17 @@ func (d *Dns) ReverseDNS(addr string) ([]string, error) {
 		return cached, nil
 	}
 
-	names, err := DNSLookupAddr(addr)
+	return d.lookupShared("reverse", addr, func() ([]string, error) {
+		return d.reverseDNS(addr)
+	})
+}
+
+func (d *Dns) reverseDNS(addr string) ([]string, error) {
+	names, err := d.resolver.LookupAddr(d.ctx, addr)
 	if err != nil {
 		if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
 			slog.Debug("DNS: no PTR record found", "addr", addr)
+			d.reverseCachePutNegative(addr)
 			return []string{}, nil
 		}
 		slog.Error("DNS: reverse lookup failed", "addr", addr, "err", err)
@@ -66,10 +146,17 @@ func (d *Dns) LookupHost(host string) ([]string, error) {
 		return cached, nil
 	}
 
-	addrs, err := DNSLookupHost(host)
+	return d.lookupShared("forward", host, func() ([]string, error) {
+		return d.lookupHost(host)
+	})
+}
+
+func (d *Dns) lookupHost(host string) ([]string, error) {
+	addrs, err := d.resolver.LookupHost(d.ctx, host)
 	if err != nil {
 		if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
 			slog.Debug("DNS: no A/AAAA record found", "host", host)
+			d.forwardCachePutNegative(host)
 			return []string{}, nil
 		}
 		slog.Error("DNS: forward lookup failed", "host", host, "err", err)
@@ -85,12 +172,15 @@ func (d *Dns) LookupHost(host string) ([]string, error) {
 // pre-fetched list of names to perform the forward lookups.
 func (d *Dns) verifyFCrDNSInternal(addr string, names []string) bool {
 	for _, name := range names {
-		if cached, err := d.LookupHost(name); err == nil {
-			if slices.Contains(cached, addr) {
-				slog.Info("DNS: forward lookup confirmed original IP", "name", name, "addr", addr)
-				return true
-			}
-			continue
+		cached, err := d.LookupHost(name)
+		if errors.Is(err, ErrOverloaded) {
+			slog.Warn("DNS: FCrDNS forward lookup dropped, too many lookups in flight", "name", name, "addr", addr, "pass", d.fallbackPass)
+			return d.fallbackPass
+		}
+
+		if err == nil && slices.Contains(cached, addr) {
+			slog.Info("DNS: forward lookup confirmed original IP", "name", name, "addr", addr)
+			return true
 		}
 	}
 
@@ -108,6 +198,10 @@ func (d *Dns) VerifyFCrDNS(addr string, pattern *string) bool {
 	slog.Debug("DNS: performing FCrDNS lookup", "addr", addr, "pattern", patternVal)
 
 	names, err := d.ReverseDNS(addr)
+	if errors.Is(err, ErrOverloaded) {
+		slog.Warn("DNS: FCrDNS reverse lookup dropped, too many lookups in flight", "addr", addr, "pass", d.fallbackPass)
+		return d.fallbackPass
+	}
 	if err != nil {
 		return false
 	}
@@ -15,8 +15,8 @@ import (
 func newTestDNS(forwardTTL int, reverseTTL int) *Dns {
 	ctx := context.Background()
 	memStore := memory.New(ctx)
-	cache := NewDNSCache(forwardTTL, reverseTTL, memStore)
-	return New(ctx, cache)
+	cache := NewDNSCache(forwardTTL, reverseTTL, 0, memStore)
+	return New(ctx, cache, nil)
 }
 
 // mockLookupAddr is a mock implementation of the net.LookupAddr function.
@@ -306,3 +306,59 @@ func TestDns_VerifyFCrDNS(t *testing.T) {
 		}
 	})
 }
+
+func TestDns_NegativeCache(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		negativeTTL int
+		wantCalls   int
+	}{
+		{name: "cached", negativeTTL: 60, wantCalls: 1},
+		{name: "disabled", negativeTTL: 0, wantCalls: 2},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cache := NewDNSCache(300, 300, tt.negativeTTL, memory.New(ctx))
+
+			var calls int
+			originalLookupHost := DNSLookupHost
+			DNSLookupHost = func(host string) ([]string, error) {
+				calls++
+				return mockLookupHost(host)
+			}
+			defer func() { DNSLookupHost = originalLookupHost }()
+
+			d := New(ctx, cache, nil)
+			for range 2 {
+				addrs, err := d.LookupHost("example.com")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(addrs) != 0 {
+					t.Errorf("wanted no addresses, got: %v", addrs)
+				}
+			}
+
+			if calls != tt.wantCalls {
+				t.Errorf("wanted %d lookups, got: %d", tt.wantCalls, calls)
+			}
+		})
+	}
+}
+
+func TestDns_Resolver(t *testing.T) {
+	cli := &Client{Upstreams: []Upstream{spawnUpstream(t, ProtocolUDP)}, Timeout: time.Second}
+	d := New(context.Background(), nil, cli)
+
+	if !d.VerifyFCrDNS("1.2.3.4", nil) {
+		t.Error("wanted FCrDNS to pass with the configured resolver")
+	}
+
+	ips, err := d.LookupIP(t.Context(), "ip6", "one.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ips) != 1 || !ips[0].Equal(net.ParseIP("2001:db8::1")) {
+		t.Errorf("wrong IPv6 addresses: %v", ips)
+	}
+}
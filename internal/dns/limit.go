@@ -0,0 +1,121 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// ErrOverloaded is returned when a lookup is dropped because too many
+// lookups are already running or waiting.
+var ErrOverloaded = errors.New("dns: too many lookups in flight")
+
+var (
+	lookupsInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "anubis_dns_lookups_in_flight",
+		Help: "The number of DNS lookups that are running",
+	})
+
+	lookupsQueued = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "anubis_dns_lookups_queued",
+		Help: "The number of DNS lookups that are waiting for a free slot",
+	})
+
+	lookupsDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "anubis_dns_lookups_dropped_total",
+		Help: "The total number of DNS lookups dropped because too many were in flight",
+	}, []string{"kind"})
+
+	lookupsDeduplicated = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "anubis_dns_lookups_deduplicated_total",
+		Help: "The total number of DNS lookups that shared the result of an identical lookup already in flight",
+	}, []string{"kind"})
+)
+
+const (
+	// DefaultMaxConcurrent is how many lookups may run at once if
+	// Limits.MaxConcurrent is not set.
+	DefaultMaxConcurrent = 64
+
+	// DefaultMaxQueued is how many lookups may wait for a free slot if
+	// Limits.MaxQueued is not set.
+	DefaultMaxQueued = 256
+)
+
+// Limits bounds how many lookups a Dns makes at once.
+type Limits struct {
+	// MaxConcurrent is how many lookups may run at once.
+	MaxConcurrent int
+
+	// MaxQueued is how many lookups may wait for a free slot. Lookups beyond
+	// that fail with ErrOverloaded.
+	MaxQueued int
+
+	// FallbackPass makes VerifyFCrDNS pass instead of fail when its lookups
+	// are dropped.
+	FallbackPass bool
+}
+
+// limiter is a semaphore with a bounded queue.
+type limiter struct {
+	slots     chan struct{}
+	queued    atomic.Int64
+	maxQueued int64
+}
+
+func newLimiter(l Limits) *limiter {
+	maxConcurrent := l.MaxConcurrent
+	if maxConcurrent <= 0 {
+		maxConcurrent = DefaultMaxConcurrent
+	}
+
+	maxQueued := l.MaxQueued
+	if maxQueued <= 0 {
+		maxQueued = DefaultMaxQueued
+	}
+
+	return &limiter{
+		slots:     make(chan struct{}, maxConcurrent),
+		maxQueued: int64(maxQueued),
+	}
+}
+
+// acquire waits for a free slot. It fails with ErrOverloaded if the queue is
+// full or ctx is done first.
+func (l *limiter) acquire(ctx context.Context, kind string) error {
+	select {
+	case l.slots <- struct{}{}:
+		lookupsInFlight.Inc()
+		return nil
+	default:
+	}
+
+	if l.queued.Add(1) > l.maxQueued {
+		l.queued.Add(-1)
+		lookupsDropped.WithLabelValues(kind).Inc()
+		return ErrOverloaded
+	}
+
+	lookupsQueued.Inc()
+	defer func() {
+		l.queued.Add(-1)
+		lookupsQueued.Dec()
+	}()
+
+	select {
+	case l.slots <- struct{}{}:
+		lookupsInFlight.Inc()
+		return nil
+	case <-ctx.Done():
+		lookupsDropped.WithLabelValues(kind).Inc()
+		return errors.Join(ErrOverloaded, ctx.Err())
+	}
+}
+
+func (l *limiter) release() {
+	<-l.slots
+	lookupsInFlight.Dec()
+}
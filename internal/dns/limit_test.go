@@ -0,0 +1,130 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingResolver answers every lookup with 127.0.0.1 and localhost, but
+// only once release is closed.
+type blockingResolver struct {
+	release chan struct{}
+	calls   atomic.Int64
+}
+
+func (b *blockingResolver) wait(ctx context.Context) error {
+	b.calls.Add(1)
+	select {
+	case <-b.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *blockingResolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	if err := b.wait(ctx); err != nil {
+		return nil, err
+	}
+	return []string{"localhost."}, nil
+}
+
+func (b *blockingResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if err := b.wait(ctx); err != nil {
+		return nil, err
+	}
+	return []string{"127.0.0.1"}, nil
+}
+
+func (b *blockingResolver) LookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	if err := b.wait(ctx); err != nil {
+		return nil, err
+	}
+	return []net.IP{net.ParseIP("127.0.0.1")}, nil
+}
+
+func TestDns_Deduplicate(t *testing.T) {
+	res := &blockingResolver{release: make(chan struct{})}
+	d := New(t.Context(), nil, res)
+
+	var wg sync.WaitGroup
+	for range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			names, err := d.ReverseDNS("127.0.0.1")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if len(names) != 1 || names[0] != "localhost" {
+				t.Errorf("wrong names: %v", names)
+			}
+		}()
+	}
+
+	// Give every goroutine time to join the lookup before it finishes.
+	time.Sleep(50 * time.Millisecond)
+	close(res.release)
+	wg.Wait()
+
+	if got := res.calls.Load(); got != 1 {
+		t.Errorf("wanted 1 lookup, got: %d", got)
+	}
+}
+
+func TestDns_Overloaded(t *testing.T) {
+	for _, tt := range []struct {
+		name         string
+		fallbackPass bool
+	}{
+		{name: "fail"},
+		{name: "pass", fallbackPass: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			res := &blockingResolver{release: make(chan struct{})}
+			d := New(t.Context(), nil, res)
+			d.SetLimits(Limits{MaxConcurrent: 1, MaxQueued: 1, FallbackPass: tt.fallbackPass})
+
+			var wg sync.WaitGroup
+			defer wg.Wait()
+			defer close(res.release)
+
+			// Take the only slot, then fill the queue.
+			for _, addr := range []string{"10.0.0.1", "10.0.0.2"} {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					d.ReverseDNS(addr)
+				}()
+			}
+
+			deadline := time.Now().Add(time.Second)
+			for res.calls.Load() != 1 || d.limiter.queued.Load() != 1 {
+				if time.Now().After(deadline) {
+					t.Fatal("lookups did not start")
+				}
+				time.Sleep(time.Millisecond)
+			}
+
+			if _, err := d.ReverseDNS("10.0.0.3"); !errors.Is(err, ErrOverloaded) {
+				t.Logf("want: %v", ErrOverloaded)
+				t.Logf("got:  %v", err)
+				t.Error("wrong error from an overloaded lookup")
+			}
+
+			if got := d.VerifyFCrDNS("10.0.0.4", nil); got != tt.fallbackPass {
+				t.Errorf("wanted VerifyFCrDNS to return %v, got: %v", tt.fallbackPass, got)
+			}
+
+			if got := res.calls.Load(); got != 1 {
+				t.Errorf("wanted 1 lookup to reach the resolver, got: %d", got)
+			}
+		})
+	}
+}
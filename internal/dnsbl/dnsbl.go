@@ -1,10 +1,12 @@
 package dnsbl
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net"
 	"strings"
+	"time"
 )
 
 //go:generate go tool golang.org/x/tools/cmd/stringer -type=DroneBLResponse
@@ -65,31 +67,153 @@ func reverse6(ip net.IP) string {
 	return sb.String()[:len(sb.String())-1]
 }
 
-func Lookup(ipStr string) (DroneBLResponse, error) {
-	ip := net.ParseIP(ipStr)
-	if ip == nil {
-		return Unknown, errors.New("dnsbl: input is not an IP address")
+// Resolver looks up the IP addresses of a DNS name. *net.Resolver implements
+// it.
+type Resolver interface {
+	LookupIP(ctx context.Context, network, host string) ([]net.IP, error)
+}
+
+// List is a DNS blocklist zone that IP addresses can be looked up in.
+type List struct {
+	// Zone is the DNS zone of the list, such as dnsbl.dronebl.org.
+	Zone string
+
+	// Responses maps the addresses the list answers with to what they mean.
+	// If it is empty, any answer in 127.0.0.0/8 means the address is listed.
+	// If it is not, answers that aren't in it are ignored.
+	Responses map[string]string
+
+	// Timeout is how long a lookup may take. If it is zero, DefaultTimeout is
+	// used. Lookups give up after Timeout even if the resolver doesn't.
+	Timeout time.Duration
+}
+
+// DefaultTimeout is how long a lookup in a List may take if its Timeout is
+// not set.
+const DefaultTimeout = time.Second
+
+// Result is the outcome of looking up an IP address in one List.
+type Result struct {
+	Zone   string `json:"zone"`
+	Listed bool   `json:"listed"`
+
+	// Code is the address the list answered with, such as 127.0.0.3.
+	Code string `json:"code,omitempty"`
+
+	// Reason is what Code means according to the list's Responses.
+	Reason string `json:"reason,omitempty"`
+
+	// Failed is true if the lookup failed, so it is not known if the client
+	// is listed.
+	Failed bool `json:"failed,omitempty"`
+}
+
+// Lookup checks if ip is listed in l.
+func (l List) Lookup(ctx context.Context, res Resolver, ip net.IP) (Result, error) {
+	result := Result{Zone: l.Zone}
+
+	timeout := l.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
 	}
 
-	revIP := Reverse(ip) + ".dnsbl.dronebl.org"
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type answer struct {
+		addrs []net.IP
+		err   error
+	}
+
+	answers := make(chan answer, 1)
+	go func() {
+		addrs, err := res.LookupIP(ctx, "ip4", Reverse(ip)+"."+l.Zone)
+		answers <- answer{addrs, err}
+	}()
+
+	var (
+		addrs []net.IP
+		err   error
+	)
+
+	select {
+	case a := <-answers:
+		addrs, err = a.addrs, a.err
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
 
-	ips, err := net.LookupIP(revIP)
 	if err != nil {
 		var dnserr *net.DNSError
-		if errors.As(err, &dnserr) {
-			if dnserr.IsNotFound {
-				return AllGood, nil
+		if errors.As(err, &dnserr) && dnserr.IsNotFound {
+			return result, nil
+		}
+
+		return result, fmt.Errorf("dnsbl: can't look up %s in %s: %w", ip, l.Zone, err)
+	}
+
+	for _, addr := range addrs {
+		addr4 := addr.To4()
+		if addr4 == nil {
+			continue
+		}
+
+		code := addr4.String()
+
+		if len(l.Responses) == 0 {
+			if addr4[0] != 127 {
+				continue
 			}
+
+			result.Listed = true
+			result.Code = code
+			result.Reason = code
+			return result, nil
 		}
 
-		return Unknown, err
+		if reason, ok := l.Responses[code]; ok {
+			result.Listed = true
+			result.Code = code
+			result.Reason = reason
+			return result, nil
+		}
 	}
 
-	if len(ips) != 0 {
-		for _, ip := range ips {
-			return DroneBLResponse(ip.To4()[3]), nil
+	return result, nil
+}
+
+// DroneBLZone is the DNS zone of DroneBL.
+const DroneBLZone = "dnsbl.dronebl.org"
+
+// DroneBL returns the List for DroneBL, with the meaning of every response
+// code it documents.
+func DroneBL() List {
+	responses := map[string]string{}
+	for code := IRCDrone; code <= AutoDetectedBotIP; code++ {
+		name := code.String()
+		if strings.HasPrefix(name, "DroneBLResponse(") {
+			continue
 		}
+
+		responses[fmt.Sprintf("127.0.0.%d", code)] = name
+	}
+
+	return List{
+		Zone:      DroneBLZone,
+		Responses: responses,
 	}
+}
+
+type resultsKey struct{}
+
+// WithResults returns a copy of ctx that carries the results of looking up
+// the client's IP address.
+func WithResults(ctx context.Context, results []Result) context.Context {
+	return context.WithValue(ctx, resultsKey{}, results)
+}
 
-	return UnknownSpambotOrDrone, nil
+// ResultsFrom returns the results stored in ctx by WithResults.
+func ResultsFrom(ctx context.Context) ([]Result, bool) {
+	results, ok := ctx.Value(resultsKey{}).([]Result)
+	return results, ok
 }
@@ -1,10 +1,14 @@
 package dnsbl
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
 	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestReverse4(t *testing.T) {
@@ -46,16 +50,121 @@ func TestReverse6(t *testing.T) {
 	}
 }
 
+type fakeResolver map[string][]net.IP
+
+func (fr fakeResolver) LookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	if strings.HasSuffix(host, ".slow.example") {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	// stuck.example ignores the context like a misbehaving resolver would
+	if strings.HasSuffix(host, ".stuck.example") {
+		time.Sleep(time.Second)
+		return nil, errors.New("too late")
+	}
+
+	addrs, ok := fr[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+
+	return addrs, nil
+}
+
+func TestListLookup(t *testing.T) {
+	res := fakeResolver{
+		"4.3.2.1.any.example":   {net.ParseIP("127.0.0.2")},
+		"4.3.2.1.codes.example": {net.ParseIP("127.0.0.4"), net.ParseIP("127.0.0.3")},
+		"4.3.2.1.error.example": {net.ParseIP("192.0.2.1")},
+	}
+
+	for _, tt := range []struct {
+		name string
+		list List
+		want Result
+		err  bool
+	}{
+		{
+			name: "not listed",
+			list: List{Zone: "clean.example"},
+			want: Result{Zone: "clean.example"},
+		},
+		{
+			name: "any loopback answer",
+			list: List{Zone: "any.example"},
+			want: Result{Zone: "any.example", Listed: true, Code: "127.0.0.2", Reason: "127.0.0.2"},
+		},
+		{
+			name: "response map",
+			list: List{Zone: "codes.example", Responses: map[string]string{"127.0.0.3": "IRC drone"}},
+			want: Result{Zone: "codes.example", Listed: true, Code: "127.0.0.3", Reason: "IRC drone"},
+		},
+		{
+			name: "unknown response code",
+			list: List{Zone: "codes.example", Responses: map[string]string{"127.0.0.9": "HTTP proxy"}},
+			want: Result{Zone: "codes.example"},
+		},
+		{
+			name: "answer outside loopback",
+			list: List{Zone: "error.example"},
+			want: Result{Zone: "error.example"},
+		},
+		{
+			name: "timeout",
+			list: List{Zone: "slow.example", Timeout: 10 * time.Millisecond},
+			want: Result{Zone: "slow.example"},
+			err:  true,
+		},
+		{
+			name: "resolver ignores timeout",
+			list: List{Zone: "stuck.example", Timeout: 10 * time.Millisecond},
+			want: Result{Zone: "stuck.example"},
+			err:  true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			got, err := tt.list.Lookup(t.Context(), res, net.ParseIP("1.2.3.4"))
+			if (err != nil) != tt.err {
+				t.Fatalf("wanted error: %v, got: %v", tt.err, err)
+			}
+
+			if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+				t.Errorf("lookup took %s, wanted it to give up after its timeout", elapsed)
+			}
+
+			if got != tt.want {
+				t.Logf("want: %+v", tt.want)
+				t.Logf("got:  %+v", got)
+				t.Error("wrong result")
+			}
+		})
+	}
+}
+
+func TestDroneBL(t *testing.T) {
+	l := DroneBL()
+
+	if got := l.Responses["127.0.0.3"]; got != IRCDrone.String() {
+		t.Errorf("wanted 127.0.0.3 to mean %s, got: %q", IRCDrone, got)
+	}
+
+	if _, ok := l.Responses["127.0.0.4"]; ok {
+		t.Error("127.0.0.4 is not a documented DroneBL response")
+	}
+}
+
 func TestLookup(t *testing.T) {
 	if os.Getenv("DONT_USE_NETWORK") != "" {
 		t.Skip("test requires network egress")
 		return
 	}
 
-	resp, err := Lookup("27.65.243.194")
+	resp, err := DroneBL().Lookup(t.Context(), net.DefaultResolver, net.ParseIP("27.65.243.194"))
 	if err != nil {
 		t.Fatalf("it broked: %v", err)
 	}
 
-	t.Logf("response: %d", resp)
+	t.Logf("response: %+v", resp)
 }
@@ -0,0 +1,187 @@
+// Package extauthz serves the Envoy ext_authz gRPC API on top of an HTTP
+// handler that decides whether requests may reach the upstream.
+package extauthz
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/TecharoHQ/anubis/internal/authcheck"
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
+)
+
+var ErrNoSourceAddress = errors.New("extauthz: check request has no source socket address")
+
+// UpstreamHeaders are the request headers the check handler sets that are
+// passed to the upstream when a request is allowed.
+var UpstreamHeaders = []string{"X-Anubis-Rule", "X-Anubis-Action", "X-Anubis-Status"}
+
+// Server implements envoy.service.auth.v3.Authorization. Every CheckRequest
+// is turned into an *http.Request and passed to the handler. If the handler
+// calls authcheck.Allow, the request is allowed. Otherwise the response the
+// handler wrote is sent to the client.
+type Server struct {
+	authv3.UnimplementedAuthorizationServer
+	next http.Handler
+}
+
+func New(next http.Handler) *Server {
+	return &Server{next: next}
+}
+
+func (s *Server) Check(ctx context.Context, req *authv3.CheckRequest) (*authv3.CheckResponse, error) {
+	r, err := NewRequest(ctx, req)
+	if err != nil {
+		return nil, grpcstatus.Error(codes.InvalidArgument, err.Error())
+	}
+
+	allowed, rec := authcheck.Run(s.next, r)
+
+	if allowed {
+		var headers []*corev3.HeaderValueOption
+		for _, name := range UpstreamHeaders {
+			if val := r.Header.Get(name); val != "" {
+				headers = append(headers, headerValue(name, val))
+			}
+		}
+
+		return &authv3.CheckResponse{
+			Status: &status.Status{Code: int32(codes.OK)},
+			HttpResponse: &authv3.CheckResponse_OkResponse{
+				OkResponse: &authv3.OkHttpResponse{Headers: headers},
+			},
+		}, nil
+	}
+
+	code := rec.Code
+	if code < http.StatusMultipleChoices {
+		// Deny pages can be configured to use 200, which Envoy would show
+		// to the client as if nothing went wrong.
+		code = http.StatusForbidden
+	}
+
+	var headers []*corev3.HeaderValueOption
+	for name, vals := range rec.Header() {
+		for _, val := range vals {
+			headers = append(headers, headerValue(name, val))
+		}
+	}
+
+	return &authv3.CheckResponse{
+		Status: &status.Status{Code: int32(codes.PermissionDenied)},
+		HttpResponse: &authv3.CheckResponse_DeniedResponse{
+			DeniedResponse: &authv3.DeniedHttpResponse{
+				Status:  &typev3.HttpStatus{Code: typev3.StatusCode(code)},
+				Headers: headers,
+				Body:    rec.Body.String(),
+			},
+		},
+	}, nil
+}
+
+func headerValue(name, val string) *corev3.HeaderValueOption {
+	return &corev3.HeaderValueOption{
+		Header:       &corev3.HeaderValue{Key: name, Value: val},
+		AppendAction: corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
+	}
+}
+
+// NewRequest converts the attributes of req into the request Envoy received.
+// X-Forwarded-Proto, X-Forwarded-Host and X-Forwarded-Uri are set from the
+// request so that challenges can redirect back to it.
+func NewRequest(ctx context.Context, req *authv3.CheckRequest) (*http.Request, error) {
+	attrs := req.GetAttributes().GetRequest().GetHttp()
+
+	method := attrs.GetMethod()
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	path := attrs.GetPath()
+	if path == "" {
+		path = "/"
+	}
+
+	u, err := url.ParseRequestURI(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	r.RequestURI = path
+	r.Host = attrs.GetHost()
+
+	if proto := attrs.GetProtocol(); proto != "" {
+		if major, minor, ok := parseHTTPVersion(proto); ok {
+			r.Proto, r.ProtoMajor, r.ProtoMinor = proto, major, minor
+		}
+	}
+
+	for name, val := range attrs.GetHeaders() {
+		if !skipHeader(name) {
+			r.Header.Add(name, val)
+		}
+	}
+
+	for _, hv := range attrs.GetHeaderMap().GetHeaders() {
+		if skipHeader(hv.GetKey()) {
+			continue
+		}
+
+		val := hv.GetValue()
+		if len(hv.GetRawValue()) != 0 {
+			val = string(hv.GetRawValue())
+		}
+		r.Header.Add(hv.GetKey(), val)
+	}
+
+	sa := req.GetAttributes().GetSource().GetAddress().GetSocketAddress()
+	if sa == nil {
+		return nil, ErrNoSourceAddress
+	}
+	r.RemoteAddr = net.JoinHostPort(sa.GetAddress(), strconv.Itoa(int(sa.GetPortValue())))
+
+	scheme := attrs.GetScheme()
+	if scheme == "" {
+		scheme = "http"
+	}
+
+	r.Header.Set("X-Forwarded-Proto", scheme)
+	r.Header.Set("X-Forwarded-Host", r.Host)
+	r.Header.Set("X-Forwarded-Uri", path)
+
+	return r, nil
+}
+
+// skipHeader reports whether name is an HTTP/2 pseudo-header or the Host
+// header, which net/http keeps out of the header map.
+func skipHeader(name string) bool {
+	return strings.HasPrefix(name, ":") || strings.EqualFold(name, "Host")
+}
+
+// parseHTTPVersion is like http.ParseHTTPVersion, but also accepts the
+// "HTTP/2" and "HTTP/3" that Envoy uses.
+func parseHTTPVersion(proto string) (int, int, bool) {
+	switch proto {
+	case "HTTP/2":
+		return 2, 0, true
+	case "HTTP/3":
+		return 3, 0, true
+	}
+
+	return http.ParseHTTPVersion(proto)
+}
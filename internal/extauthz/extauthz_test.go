@@ -0,0 +1,182 @@
+package extauthz
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/TecharoHQ/anubis/internal/authcheck"
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
+)
+
+func checkRequest(http *authv3.AttributeContext_HttpRequest) *authv3.CheckRequest {
+	return &authv3.CheckRequest{
+		Attributes: &authv3.AttributeContext{
+			Source: &authv3.AttributeContext_Peer{
+				Address: &corev3.Address{
+					Address: &corev3.Address_SocketAddress{
+						SocketAddress: &corev3.SocketAddress{
+							Address:       "2001:db8::1",
+							PortSpecifier: &corev3.SocketAddress_PortValue{PortValue: 4711},
+						},
+					},
+				},
+			},
+			Request: &authv3.AttributeContext_Request{Http: http},
+		},
+	}
+}
+
+func TestNewRequest(t *testing.T) {
+	r, err := NewRequest(t.Context(), checkRequest(&authv3.AttributeContext_HttpRequest{
+		Method:   http.MethodPost,
+		Scheme:   "https",
+		Host:     "example.com",
+		Path:     "/login?next=/",
+		Protocol: "HTTP/2",
+		Headers: map[string]string{
+			":authority":        "example.com",
+			":path":             "/login?next=/",
+			"host":              "example.com",
+			"user-agent":        "Mozilla/5.0",
+			"x-forwarded-proto": "gopher",
+		},
+		HeaderMap: &corev3.HeaderMap{
+			Headers: []*corev3.HeaderValue{
+				{Key: "accept-language", RawValue: []byte("en-US")},
+			},
+		},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name, want, got string
+	}{
+		{"method", http.MethodPost, r.Method},
+		{"host", "example.com", r.Host},
+		{"path", "/login", r.URL.Path},
+		{"query", "next=/", r.URL.RawQuery},
+		{"remote addr", "[2001:db8::1]:4711", r.RemoteAddr},
+		{"proto", "HTTP/2", r.Proto},
+		{"user agent", "Mozilla/5.0", r.UserAgent()},
+		{"raw header", "en-US", r.Header.Get("Accept-Language")},
+		{"forwarded proto", "https", r.Header.Get("X-Forwarded-Proto")},
+		{"forwarded host", "example.com", r.Header.Get("X-Forwarded-Host")},
+		{"forwarded uri", "/login?next=/", r.Header.Get("X-Forwarded-Uri")},
+		{"pseudo header", "", r.Header.Get(":authority")},
+		{"host header", "", r.Header.Get("Host")},
+	} {
+		if tt.got != tt.want {
+			t.Errorf("%s: want %q, got %q", tt.name, tt.want, tt.got)
+		}
+	}
+
+	if r.ProtoMajor != 2 {
+		t.Errorf("wanted ProtoMajor 2, got: %d", r.ProtoMajor)
+	}
+}
+
+func TestNewRequestNoSource(t *testing.T) {
+	req := checkRequest(&authv3.AttributeContext_HttpRequest{Path: "/"})
+	req.Attributes.Source = nil
+
+	if _, err := NewRequest(t.Context(), req); !errors.Is(err, ErrNoSourceAddress) {
+		t.Logf("want: %v", ErrNoSourceAddress)
+		t.Logf("got:  %v", err)
+		t.Error("wrong error")
+	}
+
+	_, err := New(http.NotFoundHandler()).Check(t.Context(), req)
+	if st, _ := grpcstatus.FromError(err); st.Code() != codes.InvalidArgument {
+		t.Errorf("wanted %s, got: %v", codes.InvalidArgument, err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		handler  http.HandlerFunc
+		allowed  bool
+		status   int
+		location string
+	}{
+		{
+			name: "allowed",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				r.Header.Set("X-Anubis-Status", "PASS")
+				authcheck.Allow(r)
+			},
+			allowed: true,
+		},
+		{
+			name: "redirect",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Redirect(w, r, "https://anubis.example.com/", http.StatusTemporaryRedirect)
+			},
+			status:   http.StatusTemporaryRedirect,
+			location: "https://anubis.example.com/",
+		},
+		{
+			name: "deny page with status 200",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("no"))
+			},
+			status: http.StatusForbidden,
+		},
+		{
+			name: "unauthorized",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusUnauthorized)
+			},
+			status: http.StatusUnauthorized,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := New(tt.handler).Check(t.Context(), checkRequest(&authv3.AttributeContext_HttpRequest{Path: "/"}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.allowed {
+				if resp.GetStatus().GetCode() != int32(codes.OK) || resp.GetOkResponse() == nil {
+					t.Fatalf("wanted request to be allowed, got: %v", resp)
+				}
+
+				hdrs := resp.GetOkResponse().GetHeaders()
+				if len(hdrs) != 1 || hdrs[0].GetHeader().GetKey() != "X-Anubis-Status" || hdrs[0].GetHeader().GetValue() != "PASS" {
+					t.Errorf("wanted X-Anubis-Status: PASS to be sent upstream, got: %v", hdrs)
+				}
+				return
+			}
+
+			denied := resp.GetDeniedResponse()
+			if resp.GetStatus().GetCode() != int32(codes.PermissionDenied) || denied == nil {
+				t.Fatalf("wanted request to be denied, got: %v", resp)
+			}
+
+			if code := int(denied.GetStatus().GetCode()); code != tt.status {
+				t.Errorf("wanted status %d, got: %d", tt.status, code)
+			}
+
+			if tt.location == "" {
+				return
+			}
+
+			var location string
+			for _, hv := range denied.GetHeaders() {
+				if hv.GetHeader().GetKey() == "Location" {
+					location = hv.GetHeader().GetValue()
+				}
+			}
+
+			if location != tt.location {
+				t.Errorf("wanted Location %q, got: %q", tt.location, location)
+			}
+		})
+	}
+}
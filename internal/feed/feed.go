@@ -0,0 +1,311 @@
+// Package feed keeps named tables of IP ranges up to date from feeds and
+// local files. Verified crawlers and IP lists are both built on it.
+package feed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gaissmai/bart"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	ErrEmpty     = errors.New("feed: has no IP ranges")
+	ErrBadStatus = errors.New("feed: returned an unexpected status code")
+	ErrNoSource  = errors.New("feed: has no url or file")
+	ErrBadPrefix = errors.New("feed: not an IP address or CIDR range")
+)
+
+// RetryInterval is how long to wait before trying again after a refresh
+// fails.
+const RetryInterval = 5 * time.Minute
+
+// ParseFunc reads the IP ranges out of a feed or file.
+type ParseFunc func(data []byte) ([]netip.Prefix, error)
+
+// Source is where the IP ranges of one table come from.
+type Source struct {
+	// Name is what rules call the table.
+	Name string
+
+	// URL is the feed to fetch the ranges from.
+	URL string
+
+	// File is a local file to read the ranges from instead of URL.
+	File string
+
+	// Refresh is how often the ranges are fetched or read again. It must be
+	// positive.
+	Refresh time.Duration
+
+	// Seed holds ranges in the format Parse reads, which are used until the
+	// first refresh succeeds.
+	Seed []byte
+
+	// Parse reads the ranges out of the feed, file or seed.
+	Parse ParseFunc
+}
+
+// Config describes one kind of table, such as verified crawlers.
+type Config struct {
+	// Subsystem is the name the registry logs with, such as verified-crawlers.
+	Subsystem string
+
+	// Kind is what a table is called in logs, errors and metric labels, such
+	// as crawler.
+	Kind string
+
+	// UserAgent is sent when fetching feeds.
+	UserAgent string
+
+	// FetchTimeout is how long fetching a feed may take.
+	FetchTimeout time.Duration
+
+	// MaxSize is the largest feed that will be read, in bytes.
+	MaxSize int64
+
+	// Offline turns off fetching feeds. Tables with a seed keep using it,
+	// tables with a file still read it, and every other table contains no
+	// addresses.
+	Offline bool
+
+	// Refreshes counts the refreshes of each table by result, and Prefixes
+	// is the number of ranges in each table.
+	Refreshes *prometheus.CounterVec
+	Prefixes  *prometheus.GaugeVec
+}
+
+// Registry holds the IP ranges of every table. The ranges of a table are
+// refreshed in the background once it is started, until the Registry's
+// context is done.
+type Registry struct {
+	ctx    context.Context
+	lg     *slog.Logger
+	cfg    Config
+	client *http.Client
+	tables map[string]*table
+}
+
+type table struct {
+	src    Source
+	ranges atomic.Pointer[bart.Lite]
+	start  sync.Once
+}
+
+// New creates a Registry with the given sources. Files and seeds are read
+// right away, so a missing file is an error.
+func New(ctx context.Context, lg *slog.Logger, cfg Config, sources []Source) (*Registry, error) {
+	r := &Registry{
+		ctx:    ctx,
+		lg:     lg.With("subsystem", cfg.Subsystem),
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.FetchTimeout},
+		tables: map[string]*table{},
+	}
+
+	var (
+		errs  []error
+		empty []string
+	)
+	for _, src := range sources {
+		t := &table{src: src}
+		r.tables[src.Name] = t
+
+		if err := r.load(t); err != nil {
+			errs = append(errs, fmt.Errorf("%s %s: %w", cfg.Kind, src.Name, err))
+		}
+
+		if cfg.Offline && src.File == "" && src.Seed == nil {
+			empty = append(empty, src.Name)
+		}
+	}
+
+	if len(errs) != 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	if len(empty) != 0 {
+		slices.Sort(empty)
+		r.lg.Warn("feeds are not fetched while offline, these match no addresses", cfg.Kind+"s", empty)
+	}
+
+	return r, nil
+}
+
+// load fills in the first IP ranges of t from its file or seed.
+func (r *Registry) load(t *table) error {
+	switch {
+	case t.src.File != "":
+		return r.refresh(t)
+	case t.src.URL == "":
+		return ErrNoSource
+	case t.src.Seed != nil:
+		return r.update(t, t.src.Seed)
+	}
+
+	return nil
+}
+
+// Has returns true if the registry knows the table with the given name.
+func (r *Registry) Has(name string) bool {
+	if r == nil {
+		return false
+	}
+
+	_, ok := r.tables[name]
+	return ok
+}
+
+// Start starts refreshing the IP ranges of the table with the given name in
+// the background, unless that already happened. Rules start the tables they
+// use when the policy is loaded, so that their feeds are fetched before
+// requests check them. Start returns false if the registry doesn't know the
+// table.
+func (r *Registry) Start(name string) bool {
+	if r == nil {
+		return false
+	}
+
+	t, ok := r.tables[name]
+	if !ok {
+		return false
+	}
+
+	if !r.cfg.Offline || t.src.File != "" {
+		t.start.Do(func() { go r.run(t) })
+	}
+
+	return true
+}
+
+// Contains returns true if addr is in the table with the given name. Unknown
+// tables contain no addresses, and so do tables whose feed wasn't fetched
+// yet. Contains never waits for a feed. It starts the table in case no rule
+// did, such as when an expression builds the name at runtime.
+func (r *Registry) Contains(name string, addr netip.Addr) bool {
+	if !r.Start(name) {
+		return false
+	}
+
+	ranges := r.tables[name].ranges.Load()
+	return ranges != nil && ranges.Contains(addr.Unmap())
+}
+
+// run refreshes the IP ranges of t until the registry's context is done.
+func (r *Registry) run(t *table) {
+	lg := r.lg.With(r.cfg.Kind, t.src.Name)
+
+	// Files were just read in New, feeds are fetched right away because
+	// they were never fetched or the seed may be old.
+	wait := time.Duration(0)
+	if t.src.File != "" {
+		wait = t.src.Refresh
+	}
+
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		wait = t.src.Refresh
+		if err := r.refresh(t); err != nil {
+			lg.Warn("can't refresh IP ranges, keeping the old ones", "err", err)
+			wait = min(wait, RetryInterval)
+		}
+	}
+}
+
+// refresh reads the IP ranges of t from its file or URL.
+func (r *Registry) refresh(t *table) error {
+	buf, err := r.fetch(t.src)
+	if err == nil {
+		err = r.update(t, buf)
+	}
+
+	if err != nil {
+		r.cfg.Refreshes.WithLabelValues(t.src.Name, "error").Inc()
+		return err
+	}
+
+	r.cfg.Refreshes.WithLabelValues(t.src.Name, "ok").Inc()
+	return nil
+}
+
+func (r *Registry) fetch(src Source) ([]byte, error) {
+	if src.File != "" {
+		return os.ReadFile(src.File)
+	}
+
+	ctx, cancel := context.WithTimeout(r.ctx, r.cfg.FetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", r.cfg.UserAgent)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s", ErrBadStatus, resp.Status)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, r.cfg.MaxSize))
+}
+
+// update replaces the IP ranges of t with the ones in buf. An empty list is
+// rejected so that a broken feed can't empty a table that rules depend on.
+func (r *Registry) update(t *table, buf []byte) error {
+	ranges, err := t.src.Parse(buf)
+	if err != nil {
+		return err
+	}
+
+	if len(ranges) == 0 {
+		return ErrEmpty
+	}
+
+	lite := new(bart.Lite)
+	for _, prefix := range ranges {
+		lite.Insert(prefix)
+	}
+
+	t.ranges.Store(lite)
+	r.cfg.Prefixes.WithLabelValues(t.src.Name).Set(float64(len(ranges)))
+	r.lg.Debug("loaded IP ranges", r.cfg.Kind, t.src.Name, "count", len(ranges))
+
+	return nil
+}
+
+// ParsePrefix parses a CIDR range, or a single address as a range that only
+// contains it.
+func ParsePrefix(s string) (netip.Prefix, error) {
+	if prefix, err := netip.ParsePrefix(s); err == nil {
+		return prefix.Masked(), nil
+	}
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("%w: %q", ErrBadPrefix, s)
+	}
+
+	return netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()), nil
+}
@@ -0,0 +1,290 @@
+package feed
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// parseLines reads one address or range per line.
+func parseLines(data []byte) ([]netip.Prefix, error) {
+	var result []netip.Prefix
+	for _, line := range strings.Fields(string(data)) {
+		prefix, err := ParsePrefix(line)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, prefix)
+	}
+
+	return result, nil
+}
+
+func testConfig() Config {
+	return Config{
+		Subsystem:    "test",
+		Kind:         "table",
+		UserAgent:    "Anubis-Test/1.0",
+		FetchTimeout: 5 * time.Second,
+		MaxSize:      1 << 20,
+		Refreshes:    prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_refreshes_total"}, []string{"table", "result"}),
+		Prefixes:     prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test_prefixes"}, []string{"table"}),
+	}
+}
+
+// waitFor polls cond until it is true, failing the test if that takes too
+// long.
+func waitFor(t *testing.T, cond func() bool, msg string) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRegistryURL(t *testing.T) {
+	var hits atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if got := r.Header.Get("User-Agent"); got != "Anubis-Test/1.0" {
+			t.Errorf("wanted the configured User-Agent, got: %q", got)
+		}
+		w.Write([]byte("192.0.2.0/24\n"))
+	}))
+	defer srv.Close()
+
+	r, err := New(t.Context(), slog.Default(), testConfig(), []Source{{Name: "example", URL: srv.URL, Refresh: time.Hour, Parse: parseLines}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if hits.Load() != 0 {
+		t.Error("wanted feeds to only be fetched once they are started")
+	}
+
+	if !r.Start("example") || r.Start("nonexistent") {
+		t.Error("wanted Start to only know the registry's sources")
+	}
+
+	waitFor(t, func() bool { return r.Contains("example", netip.MustParseAddr("192.0.2.1")) }, "wanted the fetched ranges to be used")
+
+	if r.Contains("example", netip.MustParseAddr("198.51.100.1")) {
+		t.Error("wanted 198.51.100.1 to not be in the fetched ranges")
+	}
+
+	if n := hits.Load(); n != 1 {
+		t.Errorf("wanted the feed to be fetched once, got %d requests", n)
+	}
+}
+
+func TestRegistryNoWait(t *testing.T) {
+	// The feed doesn't answer until the test is done.
+	block := make(chan struct{})
+	var hits atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		<-block
+		w.Write([]byte("192.0.2.0/24\n"))
+	}))
+	defer srv.Close()
+	defer close(block)
+
+	r, err := New(t.Context(), slog.Default(), testConfig(), []Source{{Name: "example", URL: srv.URL, Refresh: time.Hour, Parse: parseLines}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Checks don't wait for the first fetch, a table without ranges contains
+	// nothing until it is done.
+	start := time.Now()
+	for range 3 {
+		if r.Contains("example", netip.MustParseAddr("192.0.2.1")) {
+			t.Error("wanted a feed that wasn't fetched yet to contain nothing")
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("wanted checks to not wait for the feed, took %s", elapsed)
+	}
+
+	// Checking the table started it.
+	waitFor(t, func() bool { return hits.Load() == 1 }, "wanted the first check to start fetching the feed")
+}
+
+func TestRegistrySeed(t *testing.T) {
+	// The feed never answers, so only the seed can match.
+	block := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	defer srv.Close()
+	defer close(block)
+
+	r, err := New(t.Context(), slog.Default(), testConfig(), []Source{{Name: "example", URL: srv.URL, Refresh: time.Hour, Seed: []byte("192.0.2.0/24\n"), Parse: parseLines}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !r.Contains("example", netip.MustParseAddr("192.0.2.1")) {
+		t.Error("wanted the seed to be used without waiting for the feed")
+	}
+}
+
+func TestRegistryOffline(t *testing.T) {
+	var hits atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Write([]byte("192.0.2.0/24\n"))
+	}))
+	defer srv.Close()
+
+	cfg := testConfig()
+	cfg.Offline = true
+
+	r, err := New(t.Context(), slog.Default(), cfg, []Source{
+		{Name: "seeded", URL: srv.URL, Refresh: time.Hour, Seed: []byte("198.51.100.0/24\n"), Parse: parseLines},
+		{Name: "unseeded", URL: srv.URL, Refresh: time.Hour, Parse: parseLines},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for range 3 {
+		if !r.Contains("seeded", netip.MustParseAddr("198.51.100.1")) {
+			t.Error("wanted the seed to be used while offline")
+		}
+
+		if r.Contains("unseeded", netip.MustParseAddr("192.0.2.1")) {
+			t.Error("wanted a table without a seed to contain nothing while offline")
+		}
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if n := hits.Load(); n != 0 {
+		t.Errorf("wanted no feeds to be fetched while offline, got %d requests", n)
+	}
+}
+
+func TestRegistryFile(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "example.txt")
+	if err := os.WriteFile(fname, []byte("192.0.2.0/24\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := New(t.Context(), slog.Default(), testConfig(), []Source{{Name: "example", File: fname, Refresh: time.Hour, Parse: parseLines}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !r.Contains("example", netip.MustParseAddr("192.0.2.1")) {
+		t.Fatal("wanted the file to be read right away")
+	}
+
+	// A new list replaces the old one.
+	if err := os.WriteFile(fname, []byte("198.51.100.0/24\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.refresh(r.tables["example"]); err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Contains("example", netip.MustParseAddr("192.0.2.1")) || !r.Contains("example", netip.MustParseAddr("198.51.100.1")) {
+		t.Error("wanted the refresh to replace the ranges")
+	}
+
+	// A broken list keeps the old ranges.
+	for _, contents := range []string{"", "not-an-ip\n"} {
+		if err := os.WriteFile(fname, []byte(contents), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := r.refresh(r.tables["example"]); err == nil {
+			t.Errorf("wanted an error refreshing from %q", contents)
+		}
+
+		if !r.Contains("example", netip.MustParseAddr("198.51.100.1")) {
+			t.Errorf("lost the old ranges after refreshing from %q", contents)
+		}
+	}
+}
+
+func TestRegistryErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		sources []Source
+		err     error
+	}{
+		{
+			name:    "missing file",
+			sources: []Source{{Name: "example", File: "/nonexistent/example.txt", Parse: parseLines}},
+			err:     fs.ErrNotExist,
+		},
+		{
+			name:    "no source",
+			sources: []Source{{Name: "example", Parse: parseLines}},
+			err:     ErrNoSource,
+		},
+		{
+			name:    "empty seed",
+			sources: []Source{{Name: "example", URL: "https://example.com/", Seed: []byte("\n"), Parse: parseLines}},
+			err:     ErrEmpty,
+		},
+		{
+			name:    "bad seed",
+			sources: []Source{{Name: "example", URL: "https://example.com/", Seed: []byte("not-an-ip"), Parse: parseLines}},
+			err:     ErrBadPrefix,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(t.Context(), slog.Default(), testConfig(), tt.sources)
+			if !errors.Is(err, tt.err) {
+				t.Logf("want: %v", tt.err)
+				t.Logf("got:  %v", err)
+				t.Error("got wrong error")
+			}
+		})
+	}
+}
+
+func TestRegistryHas(t *testing.T) {
+	var r *Registry
+
+	if r.Has("example") || r.Contains("example", netip.MustParseAddr("192.0.2.1")) {
+		t.Error("wanted a nil registry to know nothing")
+	}
+
+	// A canceled context stops the refresh before it starts.
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	r, err := New(ctx, slog.Default(), testConfig(), []Source{{Name: "example", URL: "http://192.0.2.1/", Refresh: time.Hour, Parse: parseLines}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !r.Has("example") || r.Has("nonexistent") {
+		t.Error("wanted the registry to only know its sources")
+	}
+
+	if r.Contains("nonexistent", netip.MustParseAddr("192.0.2.1")) {
+		t.Error("wanted unknown tables to contain nothing")
+	}
+}
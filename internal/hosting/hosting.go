@@ -0,0 +1,125 @@
+// Package hosting classifies autonomous systems as belonging to hosting and
+// cloud providers, so that rules can treat traffic from datacenters
+// differently from traffic from homes and phones.
+package hosting
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sync"
+
+	"github.com/TecharoHQ/anubis/data"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	ErrNoName        = errors.New("hosting: provider has no name")
+	ErrDuplicateName = errors.New("hosting: provider is listed more than once")
+	ErrDuplicateASN  = errors.New("hosting: ASN is listed for more than one provider")
+	ErrBadMatch      = errors.New("hosting: match is not a valid regular expression")
+)
+
+// Provider is a hosting or cloud provider and the autonomous systems it
+// announces its networks from.
+type Provider struct {
+	// Name is what rules call the provider, such as amazon-aws.
+	Name string `json:"name" yaml:"name"`
+
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+
+	// Match is a regular expression for the organization names of the
+	// provider's autonomous systems. utils/cmd/hostingasns uses it to sort
+	// ASNs from a feed into providers.
+	Match string `json:"match,omitempty" yaml:"match,omitempty"`
+
+	ASNs []uint32 `json:"asns" yaml:"asns"`
+}
+
+// Dataset is a list of hosting providers.
+type Dataset struct {
+	Providers []Provider `json:"providers" yaml:"providers"`
+
+	byASN map[uint32]string
+}
+
+// Parse reads a dataset in the format of data/hosting/providers.yaml.
+func Parse(buf []byte) (*Dataset, error) {
+	var result Dataset
+	if err := yaml.Unmarshal(buf, &result); err != nil {
+		return nil, fmt.Errorf("hosting: can't parse dataset: %w", err)
+	}
+
+	if err := result.index(); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (d *Dataset) index() error {
+	var errs []error
+	names := map[string]struct{}{}
+	d.byASN = map[uint32]string{}
+
+	for _, p := range d.Providers {
+		if p.Name == "" {
+			errs = append(errs, ErrNoName)
+			continue
+		}
+
+		if _, ok := names[p.Name]; ok {
+			errs = append(errs, fmt.Errorf("%w: %s", ErrDuplicateName, p.Name))
+		}
+		names[p.Name] = struct{}{}
+
+		if p.Match != "" {
+			if _, err := regexp.Compile(p.Match); err != nil {
+				errs = append(errs, fmt.Errorf("%w: %s: %w", ErrBadMatch, p.Name, err))
+			}
+		}
+
+		for _, asn := range p.ASNs {
+			if other, ok := d.byASN[asn]; ok {
+				errs = append(errs, fmt.Errorf("%w: AS%d is listed for %s and %s", ErrDuplicateASN, asn, other, p.Name))
+				continue
+			}
+			d.byASN[asn] = p.Name
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// ProviderFor returns the name of the provider that announces asn, if any.
+func (d *Dataset) ProviderFor(asn uint32) (string, bool) {
+	name, ok := d.byASN[asn]
+	return name, ok
+}
+
+// Has reports whether the dataset lists a provider with this name.
+func (d *Dataset) Has(name string) bool {
+	return slices.ContainsFunc(d.Providers, func(p Provider) bool { return p.Name == name })
+}
+
+// Names returns the names of every provider in the dataset.
+func (d *Dataset) Names() []string {
+	result := make([]string, 0, len(d.Providers))
+	for _, p := range d.Providers {
+		result = append(result, p.Name)
+	}
+
+	return result
+}
+
+// Default returns the dataset that ships with Anubis in
+// data/hosting/providers.yaml.
+var Default = sync.OnceValue(func() *Dataset {
+	result, err := Parse(data.HostingProviders)
+	if err != nil {
+		panic(fmt.Sprintf("[unexpected] built-in hosting provider dataset is invalid: %v", err))
+	}
+
+	return result
+})
@@ -0,0 +1,91 @@
+package hosting
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDefault(t *testing.T) {
+	d := Default()
+
+	for _, tt := range []struct {
+		asn      uint32
+		provider string
+		ok       bool
+	}{
+		{asn: 16509, provider: "amazon-aws", ok: true},
+		{asn: 24940, provider: "hetzner", ok: true},
+		{asn: 45102, provider: "alibaba-cloud", ok: true},
+		{asn: 7922}, // Comcast
+	} {
+		provider, ok := d.ProviderFor(tt.asn)
+		if provider != tt.provider || ok != tt.ok {
+			t.Errorf("ProviderFor(%d): wanted %q, %v, got: %q, %v", tt.asn, tt.provider, tt.ok, provider, ok)
+		}
+	}
+
+	if !d.Has("other") {
+		t.Error("wanted the dataset to have an other provider")
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		input string
+		err   error
+	}{
+		{
+			name: "valid",
+			input: `providers:
+  - name: examplecloud
+    match: (?i)example
+    asns: [64496, 64497]
+`,
+		},
+		{
+			name: "no name",
+			input: `providers:
+  - asns: [64496]
+`,
+			err: ErrNoName,
+		},
+		{
+			name: "duplicate name",
+			input: `providers:
+  - name: examplecloud
+    asns: [64496]
+  - name: examplecloud
+    asns: [64497]
+`,
+			err: ErrDuplicateName,
+		},
+		{
+			name: "duplicate asn",
+			input: `providers:
+  - name: examplecloud
+    asns: [64496]
+  - name: otherexamplecloud
+    asns: [64496]
+`,
+			err: ErrDuplicateASN,
+		},
+		{
+			name: "bad match",
+			input: `providers:
+  - name: examplecloud
+    match: "(unclosed"
+    asns: [64496]
+`,
+			err: ErrBadMatch,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse([]byte(tt.input)); !errors.Is(err, tt.err) {
+				t.Logf("want: %v", tt.err)
+				t.Logf("got:  %v", err)
+				t.Error("got wrong error")
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+// Package iplist keeps named lists of IP ranges, such as Tor exit nodes or
+// residential proxies, up to date from feeds and files so that rules can
+// check requests against them.
+package iplist
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/TecharoHQ/anubis/internal/feed"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	refreshes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "anubis_ip_list_refreshes_total",
+		Help: "The total number of IP list refreshes by result",
+	}, []string{"list", "result"})
+
+	prefixes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "anubis_ip_list_prefixes",
+		Help: "The number of IP ranges in each IP list",
+	}, []string{"list"})
+)
+
+const (
+	// DefaultRefresh is how often lists are fetched again if a Source doesn't
+	// set its own Refresh.
+	DefaultRefresh = time.Hour
+
+	// FetchTimeout is how long fetching a feed may take.
+	FetchTimeout = time.Minute
+
+	// MaxFeedSize is the largest feed that will be read, in bytes.
+	MaxFeedSize = 64 << 20
+)
+
+// Source is where the IP ranges of a list come from.
+type Source struct {
+	// Name is what rules call the list, such as tor-exits.
+	Name string
+
+	// URL is the feed to fetch the ranges from.
+	URL string
+
+	// File is a local file to read the ranges from instead of URL.
+	File string
+
+	// Format is how the feed or file is written down. It defaults to
+	// FormatText.
+	Format Format
+
+	// Column is the column of a CSV feed that holds the ranges, see Parse.
+	Column string
+
+	// Refresh is how often the ranges are fetched or read again.
+	Refresh time.Duration
+}
+
+var builtins = []Source{
+	{Name: "tor-exits", URL: "https://check.torproject.org/torbulkexitlist"},
+}
+
+// Builtin returns the built-in source for the list with the given name.
+func Builtin(name string) (Source, bool) {
+	i := slices.IndexFunc(builtins, func(s Source) bool { return s.Name == name })
+	if i == -1 {
+		return Source{}, false
+	}
+
+	return builtins[i], true
+}
+
+// BuiltinNames returns the names of the built-in lists.
+func BuiltinNames() []string {
+	result := make([]string, len(builtins))
+	for i, s := range builtins {
+		result[i] = s.Name
+	}
+
+	return result
+}
+
+// Registry holds the IP ranges of every known list. The ranges of a list
+// are refreshed in the background from when the policy file is loaded if a
+// rule uses it, until the Registry's context is done.
+type Registry = feed.Registry
+
+// New creates a Registry with the built-in lists and sources. Sources
+// replace built-in lists with the same name. A source without a URL or File
+// keeps the built-in list's URL and format, which lets it change only
+// Refresh. Files are read right away, so a missing file is an error.
+func New(ctx context.Context, lg *slog.Logger, sources []Source) (*Registry, error) {
+	all := map[string]Source{}
+	for _, src := range builtins {
+		all[src.Name] = src
+	}
+
+	for _, src := range sources {
+		if b, ok := all[src.Name]; ok && src.URL == "" && src.File == "" {
+			src.URL, src.Format, src.Column = b.URL, b.Format, b.Column
+		}
+
+		all[src.Name] = src
+	}
+
+	var feeds []feed.Source
+	for _, name := range slices.Sorted(maps.Keys(all)) {
+		src := all[name]
+		if src.Refresh <= 0 {
+			src.Refresh = DefaultRefresh
+		}
+
+		feeds = append(feeds, feed.Source{
+			Name:    src.Name,
+			URL:     src.URL,
+			File:    src.File,
+			Refresh: src.Refresh,
+			Parse: func(data []byte) ([]netip.Prefix, error) {
+				return Parse(data, src.Format, src.Column)
+			},
+		})
+	}
+
+	return feed.New(ctx, lg, feed.Config{
+		Subsystem:    "ip-lists",
+		Kind:         "list",
+		UserAgent:    "Anubis-IP-List-Fetcher/1.0",
+		FetchTimeout: FetchTimeout,
+		MaxSize:      MaxFeedSize,
+		Refreshes:    refreshes,
+		Prefixes:     prefixes,
+	}, feeds)
+}
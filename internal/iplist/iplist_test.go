@@ -0,0 +1,85 @@
+package iplist
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/TecharoHQ/anubis/internal/feed"
+)
+
+func TestBuiltins(t *testing.T) {
+	// A canceled context keeps the registry from fetching feeds.
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	r, err := New(ctx, slog.Default(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range BuiltinNames() {
+		if !r.Has(name) {
+			t.Errorf("registry doesn't have built-in list %s", name)
+		}
+	}
+
+	if r.Contains("tor-exits", netip.MustParseAddr("192.0.2.1")) {
+		t.Error("wanted a list that hasn't been fetched to contain nothing")
+	}
+
+	if r.Contains("nonexistent", netip.MustParseAddr("192.0.2.1")) {
+		t.Error("wanted unknown lists to contain nothing")
+	}
+}
+
+func TestRegistryCSV(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ip,provider\n192.0.2.1,example\n"))
+	}))
+	defer srv.Close()
+
+	fname := filepath.Join(t.TempDir(), "proxies.txt")
+	if err := os.WriteFile(fname, []byte("198.51.100.0/24 # a comment\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := New(t.Context(), slog.Default(), []Source{
+		{Name: "csv-proxies", URL: srv.URL, Format: FormatCSV, Column: "ip"},
+		{Name: "text-proxies", File: fname},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each list is parsed in its own format.
+	r.Start("csv-proxies")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !r.Contains("csv-proxies", netip.MustParseAddr("192.0.2.1")) {
+		if time.Now().After(deadline) {
+			t.Fatal("wanted the CSV feed to contain 192.0.2.1")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if !r.Contains("text-proxies", netip.MustParseAddr("198.51.100.1")) {
+		t.Error("wanted the text file to contain 198.51.100.1")
+	}
+}
+
+func TestRegistryNoSource(t *testing.T) {
+	_, err := New(t.Context(), slog.Default(), []Source{{Name: "proxies"}})
+	if !errors.Is(err, feed.ErrNoSource) {
+		t.Logf("want: %v", feed.ErrNoSource)
+		t.Logf("got:  %v", err)
+		t.Error("got wrong error")
+	}
+}
@@ -0,0 +1,143 @@
+package iplist
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/TecharoHQ/anubis/internal/feed"
+)
+
+var (
+	ErrUnknownFormat = errors.New("iplist: format must be text or csv")
+	ErrNoColumn      = errors.New("iplist: CSV feed has no such column")
+)
+
+// Format is how a list is written down.
+type Format string
+
+const (
+	// FormatText is one IP address or CIDR range per line. Everything after
+	// the first whitespace, # or ; on a line is ignored, which covers the Tor
+	// bulk exit list, plain CIDR files and lists like Spamhaus DROP.
+	FormatText Format = "text"
+
+	// FormatCSV is comma-separated values with the address or range in one
+	// of the columns.
+	FormatCSV Format = "csv"
+)
+
+func (f Format) Valid() error {
+	switch f {
+	case "", FormatText, FormatCSV:
+		return nil
+	default:
+		return fmt.Errorf("%w, not %q", ErrUnknownFormat, f)
+	}
+}
+
+// Parse reads a list of IP ranges in the given format. The column is only
+// used for CSV feeds. It is either a column number counting from 1 or the
+// name of a column in the header row. If it is empty, the first column is
+// used.
+func Parse(data []byte, format Format, column string) ([]netip.Prefix, error) {
+	switch format {
+	case "", FormatText:
+		return parseText(data)
+	case FormatCSV:
+		return parseCSV(data, column)
+	default:
+		return nil, fmt.Errorf("%w, not %q", ErrUnknownFormat, format)
+	}
+}
+
+func parseText(data []byte) ([]netip.Prefix, error) {
+	var result []netip.Prefix
+
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; sc.Scan(); line++ {
+		text, _, _ := strings.Cut(sc.Text(), "#")
+		text, _, _ = strings.Cut(text, ";")
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+
+		prefix, err := feed.ParsePrefix(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		result = append(result, prefix)
+	}
+
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("iplist: can't read list: %w", err)
+	}
+
+	return result, nil
+}
+
+func parseCSV(data []byte, column string) ([]netip.Prefix, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	// A column name means the first row is the header. Otherwise, a first
+	// row that isn't an address is skipped as a header.
+	idx, err := strconv.Atoi(column)
+	skipHeader := true
+	switch {
+	case column == "":
+		idx = 0
+	case err == nil && idx >= 1:
+		idx--
+	case err == nil:
+		return nil, fmt.Errorf("%w: %d", ErrNoColumn, idx)
+	default:
+		header, err := r.Read()
+		if err != nil {
+			return nil, fmt.Errorf("iplist: can't read CSV header: %w", err)
+		}
+
+		idx = slices.Index(header, column)
+		if idx == -1 {
+			return nil, fmt.Errorf("%w: %q", ErrNoColumn, column)
+		}
+		skipHeader = false
+	}
+
+	var result []netip.Prefix
+	for first := true; ; first = false {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("iplist: can't read CSV feed: %w", err)
+		}
+
+		line, _ := r.FieldPos(0)
+		if idx >= len(record) {
+			return nil, fmt.Errorf("line %d: %w: %d", line, ErrNoColumn, idx+1)
+		}
+
+		prefix, err := feed.ParsePrefix(strings.TrimSpace(record[idx]))
+		if err != nil {
+			if first && skipHeader {
+				continue
+			}
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		result = append(result, prefix)
+	}
+
+	return result, nil
+}
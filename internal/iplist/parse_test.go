@@ -0,0 +1,113 @@
+package iplist
+
+import (
+	"errors"
+	"net/netip"
+	"slices"
+	"testing"
+
+	"github.com/TecharoHQ/anubis/internal/feed"
+)
+
+func TestParse(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		input  string
+		format Format
+		column string
+		want   []string
+		err    error
+	}{
+		{
+			name:  "tor bulk exit list",
+			input: "185.220.100.240\n185.220.100.241\n2001:db8::1\n",
+			want:  []string{"185.220.100.240/32", "185.220.100.241/32", "2001:db8::1/128"},
+		},
+		{
+			name:   "cidr file",
+			input:  "# proxies\n192.0.2.0/24\n\n198.51.100.7/24 # unmasked\n",
+			format: FormatText,
+			want:   []string{"192.0.2.0/24", "198.51.100.0/24"},
+		},
+		{
+			name:  "drop list",
+			input: "; Spamhaus DROP List\n192.0.2.0/24 ; SBL000001\n198.51.100.0/24\tSBL000002\n",
+			want:  []string{"192.0.2.0/24", "198.51.100.0/24"},
+		},
+		{
+			name:  "empty",
+			input: "",
+		},
+		{
+			name:  "bad text",
+			input: "192.0.2.0/24\nnot-an-ip\n",
+			err:   feed.ErrBadPrefix,
+		},
+		{
+			name:   "csv first column",
+			input:  "192.0.2.1,residential,US\n198.51.100.0/24,residential,CA\n",
+			format: FormatCSV,
+			want:   []string{"192.0.2.1/32", "198.51.100.0/24"},
+		},
+		{
+			name:   "csv column number with header",
+			input:  "provider,ip\nexample,192.0.2.1\n# comment\nexample,192.0.2.2\n",
+			format: FormatCSV,
+			column: "2",
+			want:   []string{"192.0.2.1/32", "192.0.2.2/32"},
+		},
+		{
+			name:   "csv column name",
+			input:  "provider,ip,asn\nexample, 192.0.2.1,64496\n",
+			format: FormatCSV,
+			column: "ip",
+			want:   []string{"192.0.2.1/32"},
+		},
+		{
+			name:   "csv unknown column name",
+			input:  "provider,ip\nexample,192.0.2.1\n",
+			format: FormatCSV,
+			column: "address",
+			err:    ErrNoColumn,
+		},
+		{
+			name:   "csv short row",
+			input:  "example,192.0.2.1\nexample\n",
+			format: FormatCSV,
+			column: "2",
+			err:    ErrNoColumn,
+		},
+		{
+			name:   "csv bad address",
+			input:  "192.0.2.1\nnot-an-ip\n",
+			format: FormatCSV,
+			err:    feed.ErrBadPrefix,
+		},
+		{
+			name:   "unknown format",
+			input:  "192.0.2.1\n",
+			format: "json",
+			err:    ErrUnknownFormat,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse([]byte(tt.input), tt.format, tt.column)
+			if !errors.Is(err, tt.err) {
+				t.Logf("want: %v", tt.err)
+				t.Logf("got:  %v", err)
+				t.Fatal("got wrong error")
+			}
+
+			var want []netip.Prefix
+			for _, s := range tt.want {
+				want = append(want, netip.MustParsePrefix(s))
+			}
+
+			if !slices.Equal(got, want) {
+				t.Logf("want: %v", want)
+				t.Logf("got:  %v", got)
+				t.Error("got wrong prefixes")
+			}
+		})
+	}
+}
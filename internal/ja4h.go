@@ -8,7 +8,18 @@ import (
 
 func JA4H(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		r.Header.Add("X-Http-Fingerprint-JA4H", ja4h.JA4H(r))
+		r.Header.Add("X-Http-Fingerprint-JA4H", ja4hFingerprint(r))
 		next.ServeHTTP(w, r)
 	})
 }
+
+// ja4hFingerprint computes the JA4H fingerprint of r. go-ja4h only knows about
+// HTTP/1.1 and HTTP/2, so fix up the version field for HTTP/3 requests.
+func ja4hFingerprint(r *http.Request) string {
+	result := ja4h.JA4H(r)
+	if r.ProtoMajor == 3 && len(result) >= 4 {
+		result = result[:2] + "30" + result[4:]
+	}
+
+	return result
+}
@@ -0,0 +1,119 @@
+package internal
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+func TestJA4HVersion(t *testing.T) {
+	for _, tt := range []struct {
+		proto string
+		major int
+		want  string
+	}{
+		{"HTTP/1.1", 1, "ge11"},
+		{"HTTP/2.0", 2, "ge20"},
+		{"HTTP/3.0", 3, "ge30"},
+	} {
+		t.Run(tt.proto, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Proto, req.ProtoMajor = tt.proto, tt.major
+
+			got := ja4hFingerprint(req)
+			if !strings.HasPrefix(got, tt.want) {
+				t.Logf("want: %s", tt.want)
+				t.Logf("got:  %s", got)
+				t.Error("wrong HTTP version in fingerprint")
+			}
+		})
+	}
+}
+
+func selfSignedTLSConfig(t *testing.T) (*tls.Config, *x509.CertPool) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	}, pool
+}
+
+func TestHTTP3Middleware(t *testing.T) {
+	tlsConf, roots := selfSignedTLSConfig(t)
+
+	got := make(chan http.Header, 1)
+	var h http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got <- r.Header.Clone()
+	})
+	h = RemoteXRealIP(true, "udp", h)
+	h = XForwardedForToXRealIP(h)
+	h = JA4H(h)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &http3.Server{Handler: h, TLSConfig: http3.ConfigureTLSConfig(tlsConf)}
+	go srv.Serve(conn)
+	t.Cleanup(func() { srv.Shutdown(context.Background()) })
+
+	tr := &http3.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, ServerName: "localhost"}}
+	t.Cleanup(func() { tr.Close() })
+
+	_, port, _ := net.SplitHostPort(conn.LocalAddr().String())
+	resp, err := (&http.Client{Transport: tr}).Get("https://localhost:" + port + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	hdr := <-got
+
+	if ip := hdr.Get("X-Real-Ip"); ip != "127.0.0.1" {
+		t.Errorf("wanted X-Real-Ip to be 127.0.0.1, got: %q", ip)
+	}
+
+	if fp := hdr.Get("X-Http-Fingerprint-JA4H"); !strings.HasPrefix(fp, "ge30") {
+		t.Errorf("wanted JA4H fingerprint for an HTTP/3 GET, got: %q", fp)
+	}
+}
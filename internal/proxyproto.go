@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/netip"
+
+	"github.com/pires/go-proxyproto"
+)
+
+type proxyConnKey struct{}
+
+// ProxyProtocolListener wraps l so that connections from the trusted prefixes
+// may start with a PROXY protocol v1 or v2 header. Connections from anywhere
+// else that send one are dropped. Unix socket peers are always trusted because
+// only local processes can connect to them.
+func ProxyProtocolListener(l net.Listener, trusted []netip.Prefix) net.Listener {
+	return &proxyproto.Listener{
+		Listener: l,
+		ConnPolicy: func(opts proxyproto.ConnPolicyOptions) (proxyproto.Policy, error) {
+			return proxyProtocolPolicy(opts.Upstream, trusted), nil
+		},
+	}
+}
+
+func proxyProtocolPolicy(upstream net.Addr, trusted []netip.Prefix) proxyproto.Policy {
+	tcpAddr, ok := upstream.(*net.TCPAddr)
+	if !ok {
+		return proxyproto.USE
+	}
+
+	addr := tcpAddr.AddrPort().Addr().Unmap()
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return proxyproto.USE
+		}
+	}
+
+	return proxyproto.REJECT
+}
+
+// ProxyProtocolConnContext remembers the PROXY protocol connection a request
+// came in on. Use it as the ConnContext of an http.Server that serves a
+// listener made with ProxyProtocolListener.
+func ProxyProtocolConnContext(ctx context.Context, c net.Conn) context.Context {
+	if tlsConn, ok := c.(*tls.Conn); ok {
+		c = tlsConn.NetConn()
+	}
+
+	// Don't read the header here, this runs in the server's accept loop.
+	if pc, ok := c.(*proxyproto.Conn); ok {
+		return context.WithValue(ctx, proxyConnKey{}, pc)
+	}
+
+	return ctx
+}
+
+// ProxyProtocolXRealIP sets the X-Real-Ip header to the client address in the
+// PROXY protocol header of the request's connection, if it had one.
+func ProxyProtocolXRealIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if pc, ok := r.Context().Value(proxyConnKey{}).(*proxyproto.Conn); ok {
+			if hdr := pc.ProxyHeader(); hdr != nil && !hdr.Command.IsLocal() {
+				if addrPort, err := netip.ParseAddrPort(hdr.SourceAddr.String()); err == nil {
+					addr := addrPort.Addr().Unmap()
+					r.Header.Set("X-Real-Ip", addr.String())
+					r = r.WithContext(context.WithValue(r.Context(), realIPKey{}, addr))
+				}
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
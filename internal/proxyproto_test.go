@@ -0,0 +1,130 @@
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"testing"
+
+	"github.com/pires/go-proxyproto"
+)
+
+func startProxyProtocolServer(t *testing.T, trusted []netip.Prefix) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var h http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		realIP, _ := RealIP(r)
+		fmt.Fprintf(w, "%s %s", r.Header.Get("X-Real-Ip"), realIP)
+	})
+	h = ProxyProtocolXRealIP(h)
+
+	srv := &http.Server{Handler: h, ConnContext: ProxyProtocolConnContext}
+	go srv.Serve(ProxyProtocolListener(ln, trusted))
+	t.Cleanup(func() { srv.Close() })
+
+	return ln.Addr().String()
+}
+
+// sendRequest writes preamble and a plain HTTP request to addr and returns
+// the response body.
+func sendRequest(t *testing.T, addr string, preamble func(net.Conn) error) (string, error) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if preamble != nil {
+		if err := preamble(conn); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := io.WriteString(conn, "GET / HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\n\r\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	return string(body), err
+}
+
+func TestProxyProtocol(t *testing.T) {
+	v2Header := func(src string) func(net.Conn) error {
+		return func(conn net.Conn) error {
+			hdr := proxyproto.HeaderProxyFromAddrs(2, &net.TCPAddr{IP: net.ParseIP(src), Port: 1234}, conn.LocalAddr())
+			_, err := hdr.WriteTo(conn)
+			return err
+		}
+	}
+
+	for _, tt := range []struct {
+		name     string
+		trusted  []netip.Prefix
+		preamble func(net.Conn) error
+		want     string
+		err      bool
+	}{
+		{
+			name:    "v1",
+			trusted: []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")},
+			preamble: func(conn net.Conn) error {
+				_, err := io.WriteString(conn, "PROXY TCP4 192.0.2.1 127.0.0.1 1234 80\r\n")
+				return err
+			},
+			want: "192.0.2.1 192.0.2.1",
+		},
+		{
+			name:     "v2",
+			trusted:  []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")},
+			preamble: v2Header("2001:db8::1"),
+			want:     "2001:db8::1 2001:db8::1",
+		},
+		{
+			name:    "trusted-without-header",
+			trusted: []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")},
+			want:    " invalid IP",
+		},
+		{
+			name:     "untrusted-with-header",
+			trusted:  []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+			preamble: v2Header("192.0.2.1"),
+			err:      true,
+		},
+		{
+			name:    "untrusted-without-header",
+			trusted: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+			want:    " invalid IP",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := startProxyProtocolServer(t, tt.trusted)
+
+			got, err := sendRequest(t, addr, tt.preamble)
+			if (err != nil) != tt.err {
+				t.Fatalf("wanted error: %v, got: %v", tt.err, err)
+			}
+
+			if got != tt.want {
+				t.Logf("want: %q", tt.want)
+				t.Logf("got:  %q", got)
+				t.Error("wrong client address")
+			}
+		})
+	}
+}
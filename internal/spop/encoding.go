@@ -0,0 +1,217 @@
+package spop
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+)
+
+var (
+	ErrTruncated       = errors.New("spop: data is truncated")
+	ErrVarintTooLong   = errors.New("spop: varint is too long")
+	ErrUnknownDataType = errors.New("spop: unknown data type")
+)
+
+// Data types of typed data, see section 3.1 of the SPOE documentation.
+const (
+	typeNull   byte = 0
+	typeBool   byte = 1
+	typeInt32  byte = 2
+	typeUint32 byte = 3
+	typeInt64  byte = 4
+	typeUint64 byte = 5
+	typeIPv4   byte = 6
+	typeIPv6   byte = 7
+	typeString byte = 8
+	typeBinary byte = 9
+
+	flagTrue byte = 0x10
+)
+
+// appendVarint appends v in the variable-length integer encoding used by
+// HAProxy. Values below 240 take one byte, larger values take up to 10.
+func appendVarint(buf []byte, v uint64) []byte {
+	if v < 240 {
+		return append(buf, byte(v))
+	}
+
+	buf = append(buf, byte(v)|240)
+	v = (v - 240) >> 4
+	for v >= 128 {
+		buf = append(buf, byte(v)|128)
+		v = (v - 128) >> 7
+	}
+
+	return append(buf, byte(v))
+}
+
+// readVarint decodes a varint from the start of buf and returns it and the
+// number of bytes it used.
+func readVarint(buf []byte) (uint64, int, error) {
+	if len(buf) == 0 {
+		return 0, 0, ErrTruncated
+	}
+
+	v := uint64(buf[0])
+	if v < 240 {
+		return v, 1, nil
+	}
+
+	shift := 4
+	for i := 1; i < len(buf); i++ {
+		if i > 10 {
+			return 0, 0, ErrVarintTooLong
+		}
+
+		b := uint64(buf[i])
+		v += b << shift
+		shift += 7
+
+		if b < 128 {
+			return v, i + 1, nil
+		}
+	}
+
+	return 0, 0, ErrTruncated
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = appendVarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+func readString(buf []byte) (string, int, error) {
+	l, n, err := readVarint(buf)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if uint64(len(buf)-n) < l {
+		return "", 0, ErrTruncated
+	}
+
+	return string(buf[n : n+int(l)]), n + int(l), nil
+}
+
+// appendTypedData appends v as typed data. Supported types are nil, bool,
+// int32, uint32, int, int64, uint64, netip.Addr, string and []byte.
+func appendTypedData(buf []byte, v any) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(buf, typeNull), nil
+	case bool:
+		if v {
+			return append(buf, typeBool|flagTrue), nil
+		}
+		return append(buf, typeBool), nil
+	case int32:
+		return appendVarint(append(buf, typeInt32), uint64(v)), nil
+	case uint32:
+		return appendVarint(append(buf, typeUint32), uint64(v)), nil
+	case int:
+		return appendVarint(append(buf, typeInt64), uint64(v)), nil
+	case int64:
+		return appendVarint(append(buf, typeInt64), uint64(v)), nil
+	case uint64:
+		return appendVarint(append(buf, typeUint64), v), nil
+	case netip.Addr:
+		if v.Is4() {
+			b := v.As4()
+			return append(append(buf, typeIPv4), b[:]...), nil
+		}
+		b := v.As16()
+		return append(append(buf, typeIPv6), b[:]...), nil
+	case string:
+		return appendString(append(buf, typeString), v), nil
+	case []byte:
+		buf = appendVarint(append(buf, typeBinary), uint64(len(v)))
+		return append(buf, v...), nil
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnknownDataType, v)
+	}
+}
+
+// readTypedData decodes typed data from the start of buf. See appendTypedData
+// for the Go types it returns.
+func readTypedData(buf []byte) (any, int, error) {
+	if len(buf) == 0 {
+		return nil, 0, ErrTruncated
+	}
+
+	typ, flags := buf[0]&0x0f, buf[0]&0xf0
+	rest := buf[1:]
+
+	switch typ {
+	case typeNull:
+		return nil, 1, nil
+	case typeBool:
+		return flags&flagTrue != 0, 1, nil
+	case typeInt32, typeUint32, typeInt64, typeUint64:
+		v, n, err := readVarint(rest)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		switch typ {
+		case typeInt32:
+			return int32(v), n + 1, nil
+		case typeUint32:
+			return uint32(v), n + 1, nil
+		case typeInt64:
+			return int64(v), n + 1, nil
+		default:
+			return v, n + 1, nil
+		}
+	case typeIPv4:
+		if len(rest) < 4 {
+			return nil, 0, ErrTruncated
+		}
+		return netip.AddrFrom4([4]byte(rest[:4])), 5, nil
+	case typeIPv6:
+		if len(rest) < 16 {
+			return nil, 0, ErrTruncated
+		}
+		return netip.AddrFrom16([16]byte(rest[:16])), 17, nil
+	case typeString:
+		s, n, err := readString(rest)
+		if err != nil {
+			return nil, 0, err
+		}
+		return s, n + 1, nil
+	case typeBinary:
+		s, n, err := readString(rest)
+		if err != nil {
+			return nil, 0, err
+		}
+		return []byte(s), n + 1, nil
+	default:
+		return nil, 0, fmt.Errorf("%w: %d", ErrUnknownDataType, typ)
+	}
+}
+
+// readKVList decodes a list of key/value pairs that fills the rest of buf.
+func readKVList(buf []byte) (map[string]any, error) {
+	result := map[string]any{}
+
+	for len(buf) != 0 {
+		key, n, err := readString(buf)
+		if err != nil {
+			return nil, err
+		}
+		buf = buf[n:]
+
+		val, n, err := readTypedData(buf)
+		if err != nil {
+			return nil, fmt.Errorf("value of %q: %w", key, err)
+		}
+		buf = buf[n:]
+
+		result[key] = val
+	}
+
+	return result, nil
+}
+
+func appendKV(buf []byte, key string, val any) ([]byte, error) {
+	return appendTypedData(appendString(buf, key), val)
+}
@@ -0,0 +1,82 @@
+package spop
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestVarint(t *testing.T) {
+	for _, cs := range []struct {
+		val  uint64
+		want []byte
+	}{
+		{val: 0, want: []byte{0x00}},
+		{val: 239, want: []byte{0xef}},
+		{val: 240, want: []byte{0xf0, 0x00}},
+		{val: 2287, want: []byte{0xff, 0x7f}},
+		{val: 2288, want: []byte{0xf0, 0x80, 0x00}},
+		{val: 16380, want: []byte{0xfc, 0xf0, 0x06}},
+		{val: math.MaxUint64},
+	} {
+		got := appendVarint(nil, cs.val)
+		if cs.want != nil && !bytes.Equal(got, cs.want) {
+			t.Logf("want: %x", cs.want)
+			t.Logf("got:  %x", got)
+			t.Errorf("wrong encoding for %d", cs.val)
+		}
+
+		val, n, err := readVarint(got)
+		if err != nil {
+			t.Fatalf("can't decode %d: %v", cs.val, err)
+		}
+
+		if val != cs.val || n != len(got) {
+			t.Errorf("wanted %d in %d bytes, got %d in %d bytes", cs.val, len(got), val, n)
+		}
+	}
+
+	if _, _, err := readVarint([]byte{0xf0, 0x80}); !errors.Is(err, ErrTruncated) {
+		t.Errorf("wanted %v for a truncated varint, got: %v", ErrTruncated, err)
+	}
+}
+
+func TestTypedData(t *testing.T) {
+	for _, val := range []any{
+		nil,
+		true,
+		false,
+		int32(-5),
+		uint32(16380),
+		int64(1 << 40),
+		uint64(math.MaxUint64),
+		netip.MustParseAddr("192.0.2.1"),
+		netip.MustParseAddr("2001:db8::1"),
+		"",
+		"hello",
+		[]byte{0, 1, 2},
+	} {
+		buf, err := appendTypedData(nil, val)
+		if err != nil {
+			t.Fatalf("can't encode %v: %v", val, err)
+		}
+
+		got, n, err := readTypedData(buf)
+		if err != nil {
+			t.Fatalf("can't decode %v: %v", val, err)
+		}
+
+		if n != len(buf) || !reflect.DeepEqual(got, val) {
+			t.Logf("want: %#v", val)
+			t.Logf("got:  %#v", got)
+			t.Error("value changed in round trip")
+		}
+	}
+
+	if _, err := appendTypedData(nil, 1.5); !errors.Is(err, ErrUnknownDataType) {
+		t.Errorf("wanted %v for a float, got: %v", ErrUnknownDataType, err)
+	}
+}
@@ -0,0 +1,107 @@
+package spop
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	ErrFrameTooBig     = errors.New("spop: frame is bigger than the negotiated maximum size")
+	ErrFragmented      = errors.New("spop: fragmented frames are not supported")
+	ErrUnexpectedFrame = errors.New("spop: unexpected frame type")
+)
+
+type frameType byte
+
+// Frame types, see section 3.2.4 of the SPOE documentation.
+const (
+	frameHAProxyHello      frameType = 1
+	frameHAProxyDisconnect frameType = 2
+	frameNotify            frameType = 3
+	frameAgentHello        frameType = 101
+	frameAgentDisconnect   frameType = 102
+	frameAck               frameType = 103
+)
+
+const (
+	flagFin   uint32 = 1
+	flagAbort uint32 = 2
+)
+
+// Status codes sent in disconnect frames.
+const (
+	statusNormal             = 0
+	statusIO                 = 1
+	statusTimeout            = 2
+	statusFrameTooBig        = 3
+	statusInvalidFrame       = 4
+	statusNoVersion          = 5
+	statusNoMaxFrameSize     = 6
+	statusNoCapabilities     = 7
+	statusUnsupportedVersion = 8
+	statusUnknown            = 99
+)
+
+type frame struct {
+	typ      frameType
+	flags    uint32
+	streamID uint64
+	frameID  uint64
+	payload  []byte
+}
+
+// readFrame reads one frame from r, rejecting frames bigger than maxSize.
+func readFrame(r io.Reader, maxSize uint32) (*frame, error) {
+	var hdr [4]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(hdr[:])
+	if size > maxSize {
+		return nil, fmt.Errorf("%w: %d > %d", ErrFrameTooBig, size, maxSize)
+	}
+
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+
+	if len(buf) < 5 {
+		return nil, ErrTruncated
+	}
+
+	result := &frame{
+		typ:   frameType(buf[0]),
+		flags: binary.BigEndian.Uint32(buf[1:5]),
+	}
+	buf = buf[5:]
+
+	var n int
+	var err error
+	if result.streamID, n, err = readVarint(buf); err != nil {
+		return nil, err
+	}
+	buf = buf[n:]
+
+	if result.frameID, n, err = readVarint(buf); err != nil {
+		return nil, err
+	}
+	result.payload = buf[n:]
+
+	return result, nil
+}
+
+// encode returns f in its wire format, including the length prefix.
+func (f *frame) encode() []byte {
+	buf := make([]byte, 4, 4+5+20+len(f.payload))
+	buf = append(buf, byte(f.typ))
+	buf = binary.BigEndian.AppendUint32(buf, f.flags)
+	buf = appendVarint(buf, f.streamID)
+	buf = appendVarint(buf, f.frameID)
+	buf = append(buf, f.payload...)
+	binary.BigEndian.PutUint32(buf, uint32(len(buf)-4))
+	return buf
+}
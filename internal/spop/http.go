@@ -0,0 +1,179 @@
+package spop
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/textproto"
+	"net/url"
+	"strings"
+
+	"github.com/TecharoHQ/anubis/internal/authcheck"
+)
+
+var (
+	ErrNoMessage = errors.New("spop: no message to check")
+	ErrNoSource  = errors.New("spop: message has no ip argument")
+)
+
+// MessageName is the name of the SPOE message HTTPHandler answers.
+const MessageName = "anubis"
+
+// UpstreamHeaders are the request headers the check handler sets that are
+// returned to HAProxy as variables, named after the header without the
+// X-Anubis- prefix in lower case.
+var UpstreamHeaders = []string{"X-Anubis-Rule", "X-Anubis-Action", "X-Anubis-Status"}
+
+// HTTPHandler returns a Handler that turns the arguments of the message
+// named MessageName into an *http.Request and passes it to next. It sets
+// these variables:
+//
+//   - allowed: true if next called authcheck.Allow.
+//   - rule, action, status: the X-Anubis-* headers next set on the request.
+//   - code: the status code of the response next wrote, if not allowed.
+//   - redirect: the Location header of that response, if any.
+func HTTPHandler(next http.Handler) Handler {
+	return func(ctx context.Context, messages []Message) []Action {
+		var msg *Message
+		for i := range messages {
+			if messages[i].Name == MessageName {
+				msg = &messages[i]
+				break
+			}
+		}
+
+		if msg == nil {
+			slog.Debug("SPOE frame has no message to check", "err", ErrNoMessage)
+			return nil
+		}
+
+		r, err := NewRequest(ctx, *msg)
+		if err != nil {
+			slog.Error("can't convert SPOE message to a request", "err", err)
+			return []Action{SetVar("allowed", false), SetVar("code", http.StatusBadRequest)}
+		}
+
+		allowed, rec := authcheck.Run(next, r)
+
+		actions := []Action{SetVar("allowed", allowed)}
+		for _, name := range UpstreamHeaders {
+			if val := r.Header.Get(name); val != "" {
+				actions = append(actions, SetVar(strings.ToLower(strings.TrimPrefix(name, "X-Anubis-")), val))
+			}
+		}
+
+		if allowed {
+			return actions
+		}
+
+		actions = append(actions, SetVar("code", rec.Code))
+		if loc := rec.Header().Get("Location"); loc != "" {
+			actions = append(actions, SetVar("redirect", loc))
+		}
+
+		return actions
+	}
+}
+
+// NewRequest converts the arguments of msg into the request HAProxy
+// received. These arguments are used:
+//
+//   - method: the request method, GET if missing.
+//   - path: the request path, / if missing.
+//   - query: the query string without the leading question mark.
+//   - ver: the HTTP version, such as "1.1" or "2.0".
+//   - ssl: true if the client connected over TLS.
+//   - ip: the client's IP address. This is required.
+//   - hdrs: all request headers, as returned by HAProxy's req.hdrs.
+//
+// X-Forwarded-Proto, X-Forwarded-Host and X-Forwarded-Uri are set from the
+// request so that challenges can redirect back to it.
+func NewRequest(ctx context.Context, msg Message) (*http.Request, error) {
+	method := argString(msg, "method")
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	path := argString(msg, "path")
+	if path == "" {
+		path = "/"
+	}
+
+	if query := argString(msg, "query"); query != "" {
+		path += "?" + query
+	}
+
+	u, err := url.ParseRequestURI(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	r.RequestURI = path
+
+	if ver := argString(msg, "ver"); ver != "" {
+		if major, minor, ok := http.ParseHTTPVersion("HTTP/" + ver); ok {
+			r.Proto, r.ProtoMajor, r.ProtoMinor = "HTTP/"+ver, major, minor
+		}
+	}
+
+	if hdrs := argString(msg, "hdrs"); hdrs != "" {
+		// req.hdrs ends with the empty line after the headers, but add one in
+		// case it was cut off.
+		tr := textproto.NewReader(bufio.NewReader(strings.NewReader(hdrs + "\r\n")))
+		h, err := tr.ReadMIMEHeader()
+		if err != nil {
+			return nil, fmt.Errorf("hdrs: %w", err)
+		}
+		r.Header = http.Header(h)
+	}
+
+	r.Host = r.Header.Get("Host")
+	r.Header.Del("Host")
+
+	ipVal, _ := msg.Get("ip")
+	var ip netip.Addr
+	switch v := ipVal.(type) {
+	case netip.Addr:
+		ip = v
+	case string:
+		ip, err = netip.ParseAddr(v)
+		if err != nil {
+			return nil, fmt.Errorf("ip: %w", err)
+		}
+	default:
+		return nil, ErrNoSource
+	}
+	r.RemoteAddr = net.JoinHostPort(ip.Unmap().String(), "0")
+
+	scheme := "http"
+	if ssl, _ := msg.Get("ssl"); ssl == true {
+		scheme = "https"
+	}
+
+	r.Header.Set("X-Forwarded-Proto", scheme)
+	r.Header.Set("X-Forwarded-Host", r.Host)
+	r.Header.Set("X-Forwarded-Uri", path)
+
+	return r, nil
+}
+
+func argString(msg Message, name string) string {
+	val, _ := msg.Get(name)
+	switch v := val.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return ""
+	}
+}
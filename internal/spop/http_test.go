@@ -0,0 +1,100 @@
+package spop
+
+import (
+	"errors"
+	"net/http"
+	"net/netip"
+	"testing"
+
+	"github.com/TecharoHQ/anubis/internal/authcheck"
+)
+
+func TestNewRequest(t *testing.T) {
+	msg := Message{
+		Name: MessageName,
+		Args: []Arg{
+			{Name: "method", Value: "POST"},
+			{Name: "path", Value: "/foo"},
+			{Name: "query", Value: "bar=baz"},
+			{Name: "ver", Value: "2.0"},
+			{Name: "ssl", Value: true},
+			{Name: "ip", Value: netip.MustParseAddr("::ffff:192.0.2.1")},
+			{Name: "hdrs", Value: "host: example.com\r\nuser-agent: Mozilla/5.0\r\naccept: text/html\r\n\r\n"},
+		},
+	}
+
+	r, err := NewRequest(t.Context(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, cs := range []struct {
+		name, want, got string
+	}{
+		{name: "method", want: http.MethodPost, got: r.Method},
+		{name: "request URI", want: "/foo?bar=baz", got: r.RequestURI},
+		{name: "host", want: "example.com", got: r.Host},
+		{name: "proto", want: "HTTP/2.0", got: r.Proto},
+		{name: "remote address", want: "192.0.2.1:0", got: r.RemoteAddr},
+		{name: "user agent", want: "Mozilla/5.0", got: r.UserAgent()},
+		{name: "X-Forwarded-Proto", want: "https", got: r.Header.Get("X-Forwarded-Proto")},
+		{name: "X-Forwarded-Uri", want: "/foo?bar=baz", got: r.Header.Get("X-Forwarded-Uri")},
+	} {
+		if cs.want != cs.got {
+			t.Logf("want: %s", cs.want)
+			t.Logf("got:  %s", cs.got)
+			t.Errorf("wrong %s", cs.name)
+		}
+	}
+
+	if _, err := NewRequest(t.Context(), Message{Name: MessageName}); !errors.Is(err, ErrNoSource) {
+		t.Errorf("wanted %v without an ip argument, got: %v", ErrNoSource, err)
+	}
+}
+
+func TestHTTPHandler(t *testing.T) {
+	msg := Message{
+		Name: MessageName,
+		Args: []Arg{{Name: "ip", Value: netip.MustParseAddr("192.0.2.1")}},
+	}
+
+	for _, cs := range []struct {
+		name    string
+		handler http.HandlerFunc
+		want    map[string]any
+	}{
+		{
+			name: "allowed",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				r.Header.Set("X-Anubis-Rule", "bot/allow")
+				authcheck.Allow(r)
+			},
+			want: map[string]any{"allowed": true, "rule": "bot/allow"},
+		},
+		{
+			name: "redirect",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Redirect(w, r, "https://anubis.example.com/", http.StatusTemporaryRedirect)
+			},
+			want: map[string]any{"allowed": false, "code": int64(http.StatusTemporaryRedirect), "redirect": "https://anubis.example.com/"},
+		},
+	} {
+		t.Run(cs.name, func(t *testing.T) {
+			actions := HTTPHandler(cs.handler)(t.Context(), []Message{msg})
+
+			buf, err := appendActions(nil, actions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := decodeActions(t, buf)
+
+			for name, want := range cs.want {
+				if got[name] != want {
+					t.Logf("want: %#v", want)
+					t.Logf("got:  %#v", got[name])
+					t.Errorf("wrong value for %s", name)
+				}
+			}
+		})
+	}
+}
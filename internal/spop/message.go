@@ -0,0 +1,120 @@
+package spop
+
+import (
+	"fmt"
+)
+
+// Scope is the scope HAProxy stores a variable set by an agent in.
+type Scope byte
+
+const (
+	ScopeProcess     Scope = 0
+	ScopeSession     Scope = 1
+	ScopeTransaction Scope = 2
+	ScopeRequest     Scope = 3
+	ScopeResponse    Scope = 4
+)
+
+const (
+	actionSetVar   byte = 1
+	actionUnsetVar byte = 2
+)
+
+// Message is one SPOE message sent by HAProxy in a NOTIFY frame.
+type Message struct {
+	Name string
+	Args []Arg
+}
+
+// Arg is a named argument of a Message. Value is one of nil, bool, int32,
+// uint32, int64, uint64, netip.Addr, string or []byte.
+type Arg struct {
+	Name  string
+	Value any
+}
+
+// Get returns the value of the first argument named name.
+func (m Message) Get(name string) (any, bool) {
+	for _, a := range m.Args {
+		if a.Name == name {
+			return a.Value, true
+		}
+	}
+
+	return nil, false
+}
+
+// Action is an action returned to HAProxy in an ACK frame.
+type Action struct {
+	// Unset removes the variable instead of setting it.
+	Unset bool
+	Scope Scope
+	Name  string
+	// Value has the same types as Arg.Value, plus int.
+	Value any
+}
+
+// SetVar returns an action that sets the variable name in the transaction
+// scope, which HAProxy exposes as txn.<spoe-scope>.<name>.
+func SetVar(name string, value any) Action {
+	return Action{Scope: ScopeTransaction, Name: name, Value: value}
+}
+
+func readMessages(buf []byte) ([]Message, error) {
+	var result []Message
+
+	for len(buf) != 0 {
+		name, n, err := readString(buf)
+		if err != nil {
+			return nil, err
+		}
+		buf = buf[n:]
+
+		if len(buf) == 0 {
+			return nil, ErrTruncated
+		}
+		count := int(buf[0])
+		buf = buf[1:]
+
+		msg := Message{Name: name, Args: make([]Arg, 0, count)}
+		for range count {
+			argName, n, err := readString(buf)
+			if err != nil {
+				return nil, err
+			}
+			buf = buf[n:]
+
+			val, n, err := readTypedData(buf)
+			if err != nil {
+				return nil, fmt.Errorf("message %s argument %q: %w", name, argName, err)
+			}
+			buf = buf[n:]
+
+			msg.Args = append(msg.Args, Arg{Name: argName, Value: val})
+		}
+
+		result = append(result, msg)
+	}
+
+	return result, nil
+}
+
+func appendActions(buf []byte, actions []Action) ([]byte, error) {
+	var err error
+
+	for _, a := range actions {
+		if a.Unset {
+			buf = append(buf, actionUnsetVar, 2, byte(a.Scope))
+			buf = appendString(buf, a.Name)
+			continue
+		}
+
+		buf = append(buf, actionSetVar, 3, byte(a.Scope))
+		buf = appendString(buf, a.Name)
+		if buf, err = appendTypedData(buf, a.Value); err != nil {
+			return nil, fmt.Errorf("variable %s: %w", a.Name, err)
+		}
+	}
+
+	return buf, nil
+}
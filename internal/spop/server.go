@@ -0,0 +1,294 @@
+// Package spop implements the agent side of HAProxy's Stream Processing
+// Offload Protocol (SPOP), which is used by the SPOE filter to ask external
+// agents about requests. See
+// https://www.haproxy.org/download/3.0/doc/SPOE.txt for the specification.
+package spop
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrUnsupportedVersion = errors.New("spop: no supported protocol version offered")
+	ErrNoMaxFrameSize     = errors.New("spop: max-frame-size is missing")
+)
+
+const (
+	// Version is the protocol version this package speaks.
+	Version = "2.0"
+
+	// DefaultMaxFrameSize is the biggest frame accepted by default. It matches
+	// HAProxy's default of tune.bufsize minus the length prefix.
+	DefaultMaxFrameSize = 16380
+
+	// DefaultMaxInFlight is how many NOTIFY frames of one connection are
+	// handled at the same time by default.
+	DefaultMaxInFlight = 64
+
+	helloTimeout = 10 * time.Second
+)
+
+// Handler answers the messages of one NOTIFY frame with the actions HAProxy
+// should take. It is called concurrently for pipelined frames.
+type Handler func(ctx context.Context, messages []Message) []Action
+
+// Server is an SPOE agent.
+type Server struct {
+	Handler Handler
+
+	// MaxFrameSize caps the frame size negotiated with HAProxy. Zero means
+	// DefaultMaxFrameSize.
+	MaxFrameSize uint32
+
+	// MaxInFlight caps how many NOTIFY frames of one connection are handled
+	// at the same time. Once it is reached, no more frames are read from the
+	// connection until a handler returns, which makes HAProxy queue them.
+	// Zero means DefaultMaxInFlight.
+	MaxInFlight int
+
+	Logger *slog.Logger
+}
+
+// Serve accepts connections from HAProxy on ln until ctx is cancelled or ln
+// fails. Open connections are closed when ctx is cancelled.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.serveConn(ctx, conn)
+		}()
+	}
+}
+
+func (s *Server) logger() *slog.Logger {
+	if s.Logger == nil {
+		return slog.Default()
+	}
+	return s.Logger
+}
+
+type conn struct {
+	srv     *Server
+	lg      *slog.Logger
+	nc      net.Conn
+	r       *bufio.Reader
+	maxSize uint32
+
+	writeLock sync.Mutex
+}
+
+func (s *Server) serveConn(ctx context.Context, nc net.Conn) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		<-ctx.Done()
+		nc.Close()
+	}()
+
+	c := &conn{
+		srv:     s,
+		lg:      s.logger().With("remote_addr", nc.RemoteAddr().String()),
+		nc:      nc,
+		r:       bufio.NewReader(nc),
+		maxSize: s.MaxFrameSize,
+	}
+
+	if c.maxSize == 0 {
+		c.maxSize = DefaultMaxFrameSize
+	}
+
+	if err := c.serve(ctx); err != nil && ctx.Err() == nil && !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+		c.lg.Debug("SPOE connection failed", "err", err)
+	}
+}
+
+func (c *conn) serve(ctx context.Context) error {
+	c.nc.SetReadDeadline(time.Now().Add(helloTimeout))
+	healthcheck, err := c.hello()
+	if err != nil {
+		return err
+	}
+	c.nc.SetReadDeadline(time.Time{})
+
+	if healthcheck {
+		return nil
+	}
+
+	limit := c.srv.MaxInFlight
+	if limit <= 0 {
+		limit = DefaultMaxInFlight
+	}
+	sem := make(chan struct{}, limit)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		f, err := readFrame(c.r, c.maxSize)
+		if err != nil {
+			if errors.Is(err, ErrFrameTooBig) {
+				c.disconnect(statusFrameTooBig, err.Error())
+			}
+			return err
+		}
+
+		switch f.typ {
+		case frameNotify:
+			if f.flags&flagFin == 0 {
+				c.disconnect(statusInvalidFrame, ErrFragmented.Error())
+				return ErrFragmented
+			}
+
+			msgs, err := readMessages(f.payload)
+			if err != nil {
+				c.disconnect(statusInvalidFrame, err.Error())
+				return err
+			}
+
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+				c.notify(ctx, f, msgs)
+			}()
+		case frameHAProxyDisconnect:
+			c.disconnect(statusNormal, "")
+			return nil
+		default:
+			err := fmt.Errorf("%w: %d", ErrUnexpectedFrame, f.typ)
+			c.disconnect(statusInvalidFrame, err.Error())
+			return err
+		}
+	}
+}
+
+// hello handles the HAPROXY-HELLO frame. It returns true if HAProxy is only
+// checking that the agent is up.
+func (c *conn) hello() (bool, error) {
+	f, err := readFrame(c.r, c.maxSize)
+	if err != nil {
+		return false, err
+	}
+
+	if f.typ != frameHAProxyHello {
+		err := fmt.Errorf("%w: %d, wanted HAPROXY-HELLO", ErrUnexpectedFrame, f.typ)
+		c.disconnect(statusInvalidFrame, err.Error())
+		return false, err
+	}
+
+	kv, err := readKVList(f.payload)
+	if err != nil {
+		c.disconnect(statusInvalidFrame, err.Error())
+		return false, err
+	}
+
+	versions, _ := kv["supported-versions"].(string)
+	if !supportsVersion(versions) {
+		c.disconnect(statusUnsupportedVersion, ErrUnsupportedVersion.Error())
+		return false, fmt.Errorf("%w: %q", ErrUnsupportedVersion, versions)
+	}
+
+	maxSize, ok := kv["max-frame-size"].(uint32)
+	if !ok {
+		c.disconnect(statusNoMaxFrameSize, ErrNoMaxFrameSize.Error())
+		return false, ErrNoMaxFrameSize
+	}
+	c.maxSize = min(c.maxSize, maxSize)
+
+	var payload []byte
+	payload, _ = appendKV(payload, "version", Version)
+	payload, _ = appendKV(payload, "max-frame-size", c.maxSize)
+	payload, _ = appendKV(payload, "capabilities", "pipelining")
+
+	if err := c.write(&frame{typ: frameAgentHello, flags: flagFin, payload: payload}); err != nil {
+		return false, err
+	}
+
+	healthcheck, _ := kv["healthcheck"].(bool)
+	return healthcheck, nil
+}
+
+func supportsVersion(versions string) bool {
+	for v := range strings.SplitSeq(versions, ",") {
+		if major, _, _ := strings.Cut(strings.TrimSpace(v), "."); major == "2" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *conn) notify(ctx context.Context, f *frame, msgs []Message) {
+	actions := c.srv.Handler(ctx, msgs)
+
+	payload, err := appendActions(nil, actions)
+	if err != nil {
+		c.lg.Error("can't encode SPOE actions", "err", err)
+		payload = nil
+	}
+
+	if uint32(len(payload)+5+20) > c.maxSize {
+		c.lg.Error("SPOE actions don't fit in a frame", "size", len(payload), "max_frame_size", c.maxSize)
+		payload = nil
+	}
+
+	if err := c.write(&frame{
+		typ:      frameAck,
+		flags:    flagFin,
+		streamID: f.streamID,
+		frameID:  f.frameID,
+		payload:  payload,
+	}); err != nil {
+		c.lg.Debug("can't write SPOE ACK frame", "err", err)
+		c.nc.Close()
+	}
+}
+
+func (c *conn) disconnect(status uint32, message string) {
+	var payload []byte
+	payload, _ = appendKV(payload, "status-code", status)
+	payload, _ = appendKV(payload, "message", message)
+
+	c.write(&frame{typ: frameAgentDisconnect, flags: flagFin, payload: payload})
+}
+
+func (c *conn) write(f *frame) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	_, err := c.nc.Write(f.encode())
+	return err
+}
@@ -0,0 +1,284 @@
+package spop
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testClient speaks the HAProxy side of SPOP.
+type testClient struct {
+	t    *testing.T
+	conn net.Conn
+}
+
+func newTestClient(t *testing.T, h Handler) *testClient {
+	t.Helper()
+	return dialServer(t, &Server{Handler: h})
+}
+
+// dialServer starts srv and connects to it.
+func dialServer(t *testing.T, srv *Server) *testClient {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		srv.Serve(ctx, ln)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	t.Cleanup(func() { conn.Close() })
+
+	return &testClient{t: t, conn: conn}
+}
+
+func (c *testClient) send(f *frame) {
+	c.t.Helper()
+
+	if _, err := c.conn.Write(f.encode()); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *testClient) recv() *frame {
+	c.t.Helper()
+
+	f, err := readFrame(c.conn, DefaultMaxFrameSize)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return f
+}
+
+func (c *testClient) hello(versions string, healthcheck bool) map[string]any {
+	c.t.Helper()
+
+	var payload []byte
+	payload, _ = appendKV(payload, "supported-versions", versions)
+	payload, _ = appendKV(payload, "max-frame-size", uint32(1024))
+	payload, _ = appendKV(payload, "capabilities", "pipelining")
+	payload, _ = appendKV(payload, "healthcheck", healthcheck)
+	c.send(&frame{typ: frameHAProxyHello, flags: flagFin, payload: payload})
+
+	f := c.recv()
+	kv, err := readKVList(f.payload)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	if f.typ != frameAgentHello {
+		c.t.Fatalf("wanted AGENT-HELLO, got frame type %d: %v", f.typ, kv)
+	}
+
+	return kv
+}
+
+func encodeMessages(t *testing.T, msgs ...Message) []byte {
+	t.Helper()
+
+	var buf []byte
+	for _, msg := range msgs {
+		buf = appendString(buf, msg.Name)
+		buf = append(buf, byte(len(msg.Args)))
+		for _, arg := range msg.Args {
+			var err error
+			if buf, err = appendKV(buf, arg.Name, arg.Value); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	return buf
+}
+
+func decodeActions(t *testing.T, buf []byte) map[string]any {
+	t.Helper()
+
+	result := map[string]any{}
+	for len(buf) != 0 {
+		if len(buf) < 3 || buf[0] != actionSetVar || buf[1] != 3 || Scope(buf[2]) != ScopeTransaction {
+			t.Fatalf("unexpected action: %x", buf)
+		}
+		buf = buf[3:]
+
+		name, n, err := readString(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf = buf[n:]
+
+		val, n, err := readTypedData(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf = buf[n:]
+
+		result[name] = val
+	}
+
+	return result
+}
+
+func TestServerHello(t *testing.T) {
+	c := newTestClient(t, func(context.Context, []Message) []Action { return nil })
+
+	kv := c.hello("1.0, 2.0", false)
+
+	if kv["version"] != Version {
+		t.Errorf("wanted version %s, got: %v", Version, kv["version"])
+	}
+
+	if kv["max-frame-size"] != uint32(1024) {
+		t.Errorf("wanted max-frame-size to be lowered to HAProxy's, got: %v", kv["max-frame-size"])
+	}
+
+	c.send(&frame{typ: frameHAProxyDisconnect, flags: flagFin})
+	if f := c.recv(); f.typ != frameAgentDisconnect {
+		t.Errorf("wanted AGENT-DISCONNECT, got frame type %d", f.typ)
+	}
+}
+
+func TestServerUnsupportedVersion(t *testing.T) {
+	c := newTestClient(t, func(context.Context, []Message) []Action { return nil })
+
+	var payload []byte
+	payload, _ = appendKV(payload, "supported-versions", "1.0")
+	payload, _ = appendKV(payload, "max-frame-size", uint32(1024))
+	c.send(&frame{typ: frameHAProxyHello, flags: flagFin, payload: payload})
+
+	f := c.recv()
+	if f.typ != frameAgentDisconnect {
+		t.Fatalf("wanted AGENT-DISCONNECT, got frame type %d", f.typ)
+	}
+
+	kv, err := readKVList(f.payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if kv["status-code"] != uint32(statusUnsupportedVersion) {
+		t.Errorf("wanted status code %d, got: %v", statusUnsupportedVersion, kv["status-code"])
+	}
+}
+
+func TestServerNotify(t *testing.T) {
+	c := newTestClient(t, func(ctx context.Context, msgs []Message) []Action {
+		var result []Action
+		for _, msg := range msgs {
+			ip, _ := msg.Get("ip")
+			result = append(result, SetVar(msg.Name, ip.(netip.Addr).String()))
+		}
+		return result
+	})
+	c.hello("2.0", false)
+
+	// pipeline two frames and match the ACKs by stream and frame ID
+	for i, ip := range []string{"192.0.2.1", "2001:db8::1"} {
+		c.send(&frame{
+			typ:      frameNotify,
+			flags:    flagFin,
+			streamID: uint64(i + 1),
+			frameID:  1,
+			payload: encodeMessages(t, Message{
+				Name: "check",
+				Args: []Arg{{Name: "ip", Value: netip.MustParseAddr(ip)}},
+			}),
+		})
+	}
+
+	got := map[uint64]any{}
+	for range 2 {
+		f := c.recv()
+		if f.typ != frameAck {
+			t.Fatalf("wanted ACK, got frame type %d", f.typ)
+		}
+		got[f.streamID] = decodeActions(t, f.payload)["check"]
+	}
+
+	if got[1] != "192.0.2.1" || got[2] != "2001:db8::1" {
+		t.Errorf("ACKs don't match their NOTIFY frames: %v", got)
+	}
+}
+
+func TestServerHealthcheck(t *testing.T) {
+	c := newTestClient(t, func(context.Context, []Message) []Action { return nil })
+	c.hello("2.0", true)
+
+	if _, err := readFrame(c.conn, DefaultMaxFrameSize); err == nil {
+		t.Error("wanted connection to be closed after a health check")
+	}
+}
+
+func TestServerMaxInFlight(t *testing.T) {
+	const limit = 2
+
+	var (
+		running, peak atomic.Int32
+		release       = make(chan struct{})
+	)
+
+	c := dialServer(t, &Server{
+		MaxInFlight: limit,
+		Handler: func(ctx context.Context, msgs []Message) []Action {
+			n := running.Add(1)
+			defer running.Add(-1)
+
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+
+			<-release
+			return nil
+		},
+	})
+	c.hello("2.0", false)
+
+	const frames = 5
+	for i := range frames {
+		c.send(&frame{
+			typ:      frameNotify,
+			flags:    flagFin,
+			streamID: uint64(i + 1),
+			frameID:  1,
+			payload:  encodeMessages(t, Message{Name: "check"}),
+		})
+	}
+
+	// give the server time to start handlers for every frame it would read
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+
+	for range frames {
+		if f := c.recv(); f.typ != frameAck {
+			t.Fatalf("wanted ACK, got frame type %d", f.typ)
+		}
+	}
+
+	t.Logf("want: <= %d", limit)
+	t.Logf("got:  %d", peak.Load())
+
+	if peak.Load() > limit {
+		t.Error("too many NOTIFY frames were handled at the same time")
+	}
+}
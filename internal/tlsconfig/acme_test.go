@@ -0,0 +1,196 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/TecharoHQ/anubis/lib/store/memory"
+	"github.com/letsencrypt/pebble/v2/ca"
+	"github.com/letsencrypt/pebble/v2/db"
+	"github.com/letsencrypt/pebble/v2/va"
+	"github.com/letsencrypt/pebble/v2/wfe"
+	"github.com/miekg/dns"
+)
+
+func listenerPort(t *testing.T, l net.Listener) int {
+	t.Helper()
+
+	_, portStr, err := net.SplitHostPort(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return port
+}
+
+// testDomain is the name certificates are issued for. autocert refuses names
+// without a dot, so this is resolved to 127.0.0.1 by startDNS.
+const testDomain = "anubis.test"
+
+// startDNS runs a DNS server that answers every A query with 127.0.0.1 and
+// returns its address.
+func startDNS(t *testing.T) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &dns.Server{
+		Listener: l,
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+			resp := new(dns.Msg)
+			resp.SetReply(req)
+
+			for _, q := range req.Question {
+				if q.Qtype != dns.TypeA {
+					continue
+				}
+
+				resp.Answer = append(resp.Answer, &dns.A{
+					Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+					A:   net.ParseIP("127.0.0.1"),
+				})
+			}
+
+			w.WriteMsg(resp)
+		}),
+	}
+
+	go srv.ActivateAndServe()
+	t.Cleanup(func() { srv.Shutdown() })
+
+	return l.Addr().String()
+}
+
+// startPebble runs an in-process Pebble ACME server whose validation
+// authority connects to httpPort and tlsPort on 127.0.0.1. It returns the
+// directory URL and the path to a CA bundle that trusts the ACME API.
+func startPebble(t *testing.T, httpPort, tlsPort int) (string, string) {
+	t.Helper()
+
+	t.Setenv("PEBBLE_VA_NOSLEEP", "1")
+	t.Setenv("PEBBLE_WFE_NONCEREJECT", "0")
+	t.Setenv("PEBBLE_AUTHZREUSE", "0")
+
+	logger := log.New(io.Discard, "", 0)
+	pebbleDB := db.NewMemoryStore()
+	pebbleCA := ca.New(logger, pebbleDB, "", "ecdsa", 0, 1, map[string]ca.Profile{
+		"default": {Description: "The default profile"},
+	})
+	pebbleVA := va.New(logger, httpPort, tlsPort, false, startDNS(t), pebbleDB)
+	pebbleWFE := wfe.New(logger, pebbleDB, pebbleVA, pebbleCA, []string{"pebble.letsencrypt.org"}, false, false, 0, 0)
+
+	h := pebbleWFE.Handler()
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// x/crypto/acme finds the order to poll after finalizing it with the
+		// Location header, which Pebble leaves out but Let's Encrypt sends.
+		if id, ok := strings.CutPrefix(r.URL.Path, "/finalize-order/"); ok {
+			w.Header().Set("Location", "https://"+r.Host+"/my-order/"+id)
+		}
+
+		h.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	caFile := filepath.Join(t.TempDir(), "pebble.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return srv.URL + wfe.DirectoryPath, caFile
+}
+
+func TestACME(t *testing.T) {
+	if testing.Short() {
+		t.Skip("ACME issuance is slow")
+	}
+
+	for _, tt := range []struct {
+		name      string
+		serveTLS  bool
+		serveHTTP bool
+	}{
+		{name: "tls-alpn-01", serveTLS: true},
+		{name: "http-01", serveHTTP: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tlsListener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { tlsListener.Close() })
+
+			httpListener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { httpListener.Close() })
+
+			directoryURL, caFile := startPebble(t, listenerPort(t, httpListener), listenerPort(t, tlsListener))
+
+			st := memory.New(t.Context())
+			conf, err := New(Options{
+				ACME: ACME{
+					Domains:      []string{testDomain},
+					Email:        "admin@example.com",
+					DirectoryURL: directoryURL,
+					CAFile:       caFile,
+				},
+				Store: st,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Only serve the challenge type under test so that the other one
+			// fails and the certificate can only come from this one.
+			if tt.serveTLS {
+				go http.Serve(tls.NewListener(tlsListener, conf.TLSConfig()), http.NotFoundHandler())
+			} else {
+				tlsListener.Close()
+			}
+
+			if tt.serveHTTP {
+				// autocert only offers HTTP-01 once its handler is in use
+				go http.Serve(httpListener, conf.HTTPHandler())
+			} else {
+				httpListener.Close()
+			}
+
+			cert, err := conf.GetCertificate(&tls.ClientHelloInfo{
+				ServerName:        testDomain,
+				SupportedVersions: []uint16{tls.VersionTLS13},
+				SignatureSchemes:  []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256},
+				CipherSuites:      []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+			})
+			if err != nil {
+				t.Fatalf("can't get certificate from ACME: %v", err)
+			}
+
+			if got := cert.Leaf.DNSNames; len(got) != 1 || got[0] != testDomain {
+				t.Errorf("wanted certificate for %s, got: %v", testDomain, got)
+			}
+
+			if _, err := st.Get(t.Context(), "acme:"+testDomain); err != nil {
+				t.Errorf("certificate was not cached in the store: %v", err)
+			}
+		})
+	}
+}
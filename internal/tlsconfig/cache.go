@@ -0,0 +1,44 @@
+package tlsconfig
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/TecharoHQ/anubis/lib/store"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// cacheTTL is how long ACME account keys and certificates are kept in the
+// store. Certificates are renewed well before this, so this only bounds how
+// long stale data stays around.
+const cacheTTL = 365 * 24 * time.Hour
+
+// storeCache is an autocert.Cache backed by the Anubis store so that every
+// replica sharing a store also shares its ACME account and certificates.
+type storeCache struct {
+	store store.Interface
+}
+
+var _ autocert.Cache = storeCache{}
+
+func (sc storeCache) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := sc.store.Get(ctx, "acme:"+key)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, autocert.ErrCacheMiss
+	}
+
+	return data, err
+}
+
+func (sc storeCache) Put(ctx context.Context, key string, data []byte) error {
+	return sc.store.Set(ctx, "acme:"+key, data, cacheTTL)
+}
+
+func (sc storeCache) Delete(ctx context.Context, key string) error {
+	if err := sc.store.Delete(ctx, "acme:"+key); err != nil && !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+
+	return nil
+}
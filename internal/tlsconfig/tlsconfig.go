@@ -0,0 +1,224 @@
+// Package tlsconfig builds the TLS configuration Anubis uses to terminate
+// HTTPS itself, either with static certificates or with certificates issued
+// by an ACME certificate authority.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/TecharoHQ/anubis/lib/store"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+var (
+	ErrCertKeyMismatch = errors.New("tlsconfig: every certificate file needs a matching key file")
+	ErrNoCertificates  = errors.New("tlsconfig: no certificate files or ACME domains are configured")
+	ErrACMENoStore     = errors.New("tlsconfig: ACME needs a store to cache certificates in")
+	ErrBadCA           = errors.New("tlsconfig: ACME CA file does not contain any PEM certificates")
+	ErrNoCertificate   = errors.New("tlsconfig: no certificate for server name")
+)
+
+// Options configures HTTPS termination.
+type Options struct {
+	// CertFiles and KeyFiles are pairs of PEM encoded certificates and private
+	// keys. The certificate is picked by the server name the client asks for.
+	CertFiles []string
+	KeyFiles  []string
+
+	// ACME configures automatic certificate issuance. It is disabled if no
+	// domains are set.
+	ACME ACME
+
+	// Store is where ACME account keys and certificates are cached.
+	Store store.Interface
+
+	// HTTPSPort is the port HTTPHandler redirects plain HTTP requests to. It
+	// defaults to 443.
+	HTTPSPort int
+}
+
+// ACME configures automatic certificate issuance and renewal.
+type ACME struct {
+	// Domains is the list of host names certificates will be requested for.
+	Domains []string
+
+	// Email is the contact address for the ACME account.
+	Email string
+
+	// DirectoryURL is the ACME directory of the certificate authority. It
+	// defaults to Let's Encrypt.
+	DirectoryURL string
+
+	// CAFile, if set, is a PEM bundle used to verify the certificate authority's
+	// API instead of the system roots. This is useful for testing against a
+	// local certificate authority such as Pebble.
+	CAFile string
+}
+
+// Config selects certificates for incoming TLS connections.
+type Config struct {
+	certs     []tls.Certificate
+	acme      *autocert.Manager
+	httpsPort int
+}
+
+// New loads the static certificates in opts and sets up ACME if it is
+// configured.
+func New(opts Options) (*Config, error) {
+	if len(opts.CertFiles) != len(opts.KeyFiles) {
+		return nil, fmt.Errorf("%w: got %d certificates and %d keys", ErrCertKeyMismatch, len(opts.CertFiles), len(opts.KeyFiles))
+	}
+
+	if len(opts.CertFiles) == 0 && len(opts.ACME.Domains) == 0 {
+		return nil, ErrNoCertificates
+	}
+
+	result := &Config{httpsPort: opts.HTTPSPort}
+
+	for i := range opts.CertFiles {
+		cert, err := tls.LoadX509KeyPair(opts.CertFiles[i], opts.KeyFiles[i])
+		if err != nil {
+			return nil, fmt.Errorf("can't load certificate %s: %w", opts.CertFiles[i], err)
+		}
+
+		result.certs = append(result.certs, cert)
+	}
+
+	if len(opts.ACME.Domains) != 0 {
+		if opts.Store == nil {
+			return nil, ErrACMENoStore
+		}
+
+		if !opts.Store.IsPersistent() {
+			slog.Warn("ACME certificates are cached in a storage backend that is not persistent, certificates will be requested again every time Anubis restarts and may hit certificate authority rate limits")
+		}
+
+		client := &acme.Client{
+			DirectoryURL: opts.ACME.DirectoryURL,
+		}
+
+		if client.DirectoryURL == "" {
+			client.DirectoryURL = autocert.DefaultACMEDirectory
+		}
+
+		if opts.ACME.CAFile != "" {
+			data, err := os.ReadFile(opts.ACME.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("can't read ACME CA file %s: %w", opts.ACME.CAFile, err)
+			}
+
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(data) {
+				return nil, fmt.Errorf("%w: %s", ErrBadCA, opts.ACME.CAFile)
+			}
+
+			transport := http.DefaultTransport.(*http.Transport).Clone()
+			transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+			client.HTTPClient = &http.Client{Transport: transport}
+		}
+
+		result.acme = &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			Cache:      storeCache{store: opts.Store},
+			HostPolicy: autocert.HostWhitelist(opts.ACME.Domains...),
+			Client:     client,
+			Email:      opts.ACME.Email,
+		}
+	}
+
+	return result, nil
+}
+
+// TLSConfig returns a tls.Config for the HTTPS listener.
+func (c *Config) TLSConfig() *tls.Config {
+	result := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: c.GetCertificate,
+		NextProtos:     []string{"h2", "http/1.1"},
+	}
+
+	if c.acme != nil {
+		result.NextProtos = append(result.NextProtos, acme.ALPNProto)
+	}
+
+	return result
+}
+
+// GetCertificate picks a certificate for the server name in hello. Static
+// certificates that match the server name are preferred over ACME. If nothing
+// matches, the first static certificate is used.
+func (c *Config) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	// TLS-ALPN-01 challenges must always be answered by ACME.
+	if c.acme != nil && slices.Contains(hello.SupportedProtos, acme.ALPNProto) {
+		return c.acme.GetCertificate(hello)
+	}
+
+	for i := range c.certs {
+		if hello.SupportsCertificate(&c.certs[i]) == nil {
+			return &c.certs[i], nil
+		}
+	}
+
+	if c.acme != nil && c.acme.HostPolicy(hello.Context(), hello.ServerName) == nil {
+		return c.acme.GetCertificate(hello)
+	}
+
+	if len(c.certs) != 0 {
+		return &c.certs[0], nil
+	}
+
+	return nil, fmt.Errorf("%w: %q", ErrNoCertificate, hello.ServerName)
+}
+
+// HTTPHandler answers ACME HTTP-01 challenges and redirects every other
+// request to HTTPS. If ACME is not configured, it only redirects.
+func (c *Config) HTTPHandler() http.Handler {
+	if c.acme == nil {
+		return http.HandlerFunc(c.redirectHTTPS)
+	}
+
+	h := c.acme.HTTPHandler(http.HandlerFunc(c.redirectHTTPS))
+
+	// autocert checks the Host header against the allowed domains including
+	// its port, which breaks challenges served on a port other than 80.
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Host = stripPort(r.Host)
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (c *Config) redirectHTTPS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Use HTTPS", http.StatusBadRequest)
+		return
+	}
+
+	host := strings.Trim(stripPort(r.Host), "[]")
+	if c.httpsPort != 0 && c.httpsPort != 443 {
+		host = net.JoinHostPort(host, strconv.Itoa(c.httpsPort))
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+
+	http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusFound)
+}
+
+func stripPort(hostport string) string {
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return hostport
+	}
+
+	return host
+}
@@ -0,0 +1,268 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/TecharoHQ/anubis/lib/store"
+	"github.com/TecharoHQ/anubis/lib/store/memory"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// writeCert creates a self-signed certificate for names and returns the paths
+// to the certificate and key files.
+func writeCert(t *testing.T, names ...string) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: names[0]},
+		DNSNames:     names,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return certFile, keyFile
+}
+
+func TestNew(t *testing.T) {
+	certFile, keyFile := writeCert(t, "example.com")
+
+	for _, tt := range []struct {
+		name string
+		opts Options
+		err  error
+	}{
+		{
+			name: "static certificate",
+			opts: Options{CertFiles: []string{certFile}, KeyFiles: []string{keyFile}},
+		},
+		{
+			name: "acme",
+			opts: Options{
+				ACME:  ACME{Domains: []string{"example.com"}},
+				Store: memory.New(t.Context()),
+			},
+		},
+		{
+			name: "nothing configured",
+			opts: Options{},
+			err:  ErrNoCertificates,
+		},
+		{
+			name: "certificate without key",
+			opts: Options{CertFiles: []string{certFile}},
+			err:  ErrCertKeyMismatch,
+		},
+		{
+			name: "acme without store",
+			opts: Options{ACME: ACME{Domains: []string{"example.com"}}},
+			err:  ErrACMENoStore,
+		},
+		{
+			name: "acme CA file is not PEM",
+			opts: Options{
+				ACME:  ACME{Domains: []string{"example.com"}, CAFile: keyFile},
+				Store: memory.New(t.Context()),
+			},
+			err: ErrBadCA,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.opts)
+			if !errors.Is(err, tt.err) {
+				t.Logf("want: %v", tt.err)
+				t.Logf("got:  %v", err)
+				t.Error("got wrong error from New")
+			}
+		})
+	}
+}
+
+func TestGetCertificate(t *testing.T) {
+	aCert, aKey := writeCert(t, "a.example.com")
+	bCert, bKey := writeCert(t, "b.example.com", "*.b.example.com")
+
+	conf, err := New(Options{
+		CertFiles: []string{aCert, bCert},
+		KeyFiles:  []string{aKey, bKey},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		serverName string
+		want       string
+	}{
+		{serverName: "a.example.com", want: "a.example.com"},
+		{serverName: "b.example.com", want: "b.example.com"},
+		{serverName: "www.b.example.com", want: "b.example.com"},
+		{serverName: "unknown.example.com", want: "a.example.com"},
+		{serverName: "", want: "a.example.com"},
+	} {
+		t.Run(tt.serverName, func(t *testing.T) {
+			cert, err := conf.GetCertificate(&tls.ClientHelloInfo{
+				ServerName:        tt.serverName,
+				SupportedVersions: []uint16{tls.VersionTLS13},
+				SignatureSchemes:  []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := cert.Leaf.Subject.CommonName; got != tt.want {
+				t.Logf("want: %s", tt.want)
+				t.Logf("got:  %s", got)
+				t.Error("wrong certificate was picked")
+			}
+		})
+	}
+}
+
+func TestStoreCache(t *testing.T) {
+	st := memory.New(t.Context())
+	cache := storeCache{store: st}
+
+	if _, err := cache.Get(t.Context(), "example.com"); !errors.Is(err, autocert.ErrCacheMiss) {
+		t.Fatalf("wanted cache miss, got: %v", err)
+	}
+
+	if err := cache.Put(t.Context(), "example.com", []byte("hunter2")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := st.Get(t.Context(), "acme:example.com"); err != nil {
+		t.Errorf("value was not written with the acme: prefix: %v", err)
+	}
+
+	data, err := cache.Get(t.Context(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != "hunter2" {
+		t.Errorf("wanted hunter2, got: %q", data)
+	}
+
+	if err := cache.Delete(t.Context(), "example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cache.Delete(t.Context(), "example.com"); err != nil {
+		t.Errorf("deleting a missing key should not fail: %v", err)
+	}
+
+	if _, err := st.Get(t.Context(), "acme:example.com"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("value was not deleted: %v", err)
+	}
+}
+
+func TestHTTPHandlerRedirects(t *testing.T) {
+	certFile, keyFile := writeCert(t, "example.com")
+
+	for _, tt := range []struct {
+		name      string
+		httpsPort int
+		url       string
+		want      string
+	}{
+		{
+			name: "default port",
+			url:  "http://example.com:80/foo?bar=baz",
+			want: "https://example.com/foo?bar=baz",
+		},
+		{
+			name:      "port 443",
+			httpsPort: 443,
+			url:       "http://example.com/foo",
+			want:      "https://example.com/foo",
+		},
+		{
+			name:      "other port",
+			httpsPort: 8443,
+			url:       "http://example.com:8080/foo",
+			want:      "https://example.com:8443/foo",
+		},
+		{
+			name: "IPv6 address",
+			url:  "http://[2001:db8::1]:80/foo",
+			want: "https://[2001:db8::1]/foo",
+		},
+		{
+			name:      "IPv6 address and other port",
+			httpsPort: 8443,
+			url:       "http://[2001:db8::1]/foo",
+			want:      "https://[2001:db8::1]:8443/foo",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			conf, err := New(Options{
+				CertFiles: []string{certFile},
+				KeyFiles:  []string{keyFile},
+				HTTPSPort: tt.httpsPort,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			rec := httptest.NewRecorder()
+			conf.HTTPHandler().ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusFound {
+				t.Fatalf("wanted status %d, got: %d", http.StatusFound, rec.Code)
+			}
+
+			got := rec.Header().Get("Location")
+			t.Logf("want: %s", tt.want)
+			t.Logf("got:  %s", got)
+
+			if got != tt.want {
+				t.Error("redirect location is wrong")
+			}
+		})
+	}
+}
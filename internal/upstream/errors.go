@@ -0,0 +1,37 @@
+package upstream
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+)
+
+// ErrorHandler is called when a request can't be proxied to the upstream.
+type ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+
+type errorHandlerKey struct{}
+
+type routeKey struct{}
+
+// WithErrorHandler returns a context that makes the proxies in this package
+// report upstream failures to fn instead of writing a bare 502 response.
+func WithErrorHandler(ctx context.Context, fn ErrorHandler) context.Context {
+	return context.WithValue(ctx, errorHandlerKey{}, fn)
+}
+
+// RouteName returns the name of the route whose pool is handling the request
+// with the given context, or an empty string if it isn't handled by a route.
+func RouteName(ctx context.Context) string {
+	name, _ := ctx.Value(routeKey{}).(string)
+	return name
+}
+
+func handleError(w http.ResponseWriter, r *http.Request, err error) {
+	if fn, ok := r.Context().Value(errorHandlerKey{}).(ErrorHandler); ok && fn != nil {
+		fn(w, r, err)
+		return
+	}
+
+	slog.Error("can't reach upstream", "host", r.Host, "err", err)
+	w.WriteHeader(http.StatusBadGateway)
+}
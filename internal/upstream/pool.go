@@ -0,0 +1,365 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/TecharoHQ/anubis/internal"
+	"github.com/TecharoHQ/anubis/lib/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	healthv1 "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+var (
+	ErrNoHealthyMembers = errors.New("upstream: no healthy members")
+
+	memberHealthy = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "anubis_upstream_member_healthy",
+		Help: "Whether a member of an upstream pool is taking requests (1) or not (0)",
+	}, []string{"route", "url"})
+
+	memberEjections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "anubis_upstream_member_ejections_total",
+		Help: "The number of times a member of an upstream pool was ejected after failed requests",
+	}, []string{"route", "url"})
+)
+
+const (
+	defaultHealthCheckPath     = "/"
+	defaultHealthCheckInterval = 10 * time.Second
+	defaultHealthCheckTimeout  = 2 * time.Second
+	defaultEjectionDuration    = 30 * time.Second
+)
+
+// HealthService returns the name of the health service a pool for the route
+// named name reports to.
+func HealthService(name string) string {
+	return "upstream:" + name
+}
+
+type member struct {
+	url      string
+	proxy    *httputil.ReverseProxy
+	inflight atomic.Int64
+	healthy  atomic.Bool
+
+	lock         sync.Mutex
+	failures     int
+	ejectedUntil time.Time
+}
+
+func (m *member) available(now time.Time) bool {
+	if !m.healthy.Load() {
+		return false
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return !now.Before(m.ejectedUntil)
+}
+
+// Pool spreads requests across a set of equivalent upstreams, skipping
+// members that fail health checks or were ejected after failed requests.
+type Pool struct {
+	name    string
+	balance config.Balance
+	members []*member
+	next    atomic.Uint64
+
+	checkPath     string
+	checkInterval time.Duration
+	checkTimeout  time.Duration
+
+	maxFailures int
+	ejectFor    time.Duration
+}
+
+// NewPool creates a reverse proxy for every member of target. Call Start to
+// begin active health checks.
+func NewPool(name string, target config.Target) (*Pool, error) {
+	result := &Pool{
+		name:    name,
+		balance: target.Balance,
+	}
+
+	if result.balance == "" {
+		result.balance = config.BalanceRoundRobin
+	}
+
+	if hc := target.HealthCheck; hc != nil {
+		result.checkPath = defaultHealthCheckPath
+		if hc.Path != "" {
+			result.checkPath = hc.Path
+		}
+
+		// XXX: already validated in Valid()
+		result.checkInterval = defaultHealthCheckInterval
+		if hc.Interval != "" {
+			result.checkInterval, _ = time.ParseDuration(hc.Interval)
+		}
+
+		result.checkTimeout = defaultHealthCheckTimeout
+		if hc.Timeout != "" {
+			result.checkTimeout, _ = time.ParseDuration(hc.Timeout)
+		}
+	}
+
+	if pe := target.PassiveEjection; pe != nil {
+		result.maxFailures = pe.MaxFailures
+
+		result.ejectFor = defaultEjectionDuration
+		if pe.Duration != "" {
+			result.ejectFor, _ = time.ParseDuration(pe.Duration)
+		}
+	}
+
+	for _, u := range target.Members() {
+		rp, err := NewReverseProxy(u, Options{
+			Host:               target.Host,
+			SNI:                target.SNI,
+			InsecureSkipVerify: target.InsecureSkipVerify,
+			DisableKeepAlive:   target.DisableKeepAlive,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("member %s: %w", u, err)
+		}
+
+		m := &member{url: u, proxy: rp}
+		m.healthy.Store(true)
+		memberHealthy.WithLabelValues(name, u).Set(1)
+
+		if result.maxFailures != 0 {
+			rp.ModifyResponse = func(resp *http.Response) error {
+				result.observe(m, resp.StatusCode < http.StatusInternalServerError)
+				return nil
+			}
+
+			rp.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+				// The client going away says nothing about the member.
+				if !errors.Is(err, context.Canceled) && r.Context().Err() == nil {
+					result.observe(m, false)
+					slog.Error("upstream request failed", "route", name, "url", u, "err", err)
+				}
+				handleError(w, r, err)
+			}
+		}
+
+		result.members = append(result.members, m)
+	}
+
+	result.updateHealth()
+
+	return result, nil
+}
+
+// Start runs active health checks until ctx is cancelled. It does nothing if
+// the target has no health check configured.
+func (p *Pool) Start(ctx context.Context) {
+	if p.checkInterval == 0 {
+		return
+	}
+
+	go func() {
+		p.checkAll(ctx)
+
+		t := time.NewTicker(p.checkInterval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				p.checkAll(ctx)
+			}
+		}
+	}()
+}
+
+func (p *Pool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r = r.WithContext(context.WithValue(r.Context(), routeKey{}, p.name))
+
+	m := p.pick(r)
+	if m == nil {
+		handleError(w, r, fmt.Errorf("%w in route %s", ErrNoHealthyMembers, p.name))
+		return
+	}
+
+	m.inflight.Add(1)
+	defer m.inflight.Add(-1)
+
+	m.proxy.ServeHTTP(w, r)
+}
+
+// pick returns the member to send r to, or nil if no member is available.
+func (p *Pool) pick(r *http.Request) *member {
+	now := time.Now()
+
+	available := make([]*member, 0, len(p.members))
+	for _, m := range p.members {
+		if m.available(now) {
+			available = append(available, m)
+		}
+	}
+
+	if len(available) == 0 {
+		return nil
+	}
+
+	switch p.balance {
+	case config.BalanceLeastConnections:
+		best := available[0]
+		for _, m := range available[1:] {
+			if m.inflight.Load() < best.inflight.Load() {
+				best = m
+			}
+		}
+		return best
+	case config.BalanceConsistentHash:
+		// rendezvous hashing keeps clients on the same member as long as that
+		// member is available, and only moves the clients of a member that
+		// leaves the pool.
+		key := clientKey(r)
+		var best *member
+		var bestScore uint64
+		for _, m := range available {
+			h := fnv.New64a()
+			h.Write([]byte(key))
+			h.Write([]byte(m.url))
+			if score := h.Sum64(); best == nil || score > bestScore {
+				best, bestScore = m, score
+			}
+		}
+		return best
+	default:
+		return available[p.next.Add(1)%uint64(len(available))]
+	}
+}
+
+func clientKey(r *http.Request) string {
+	if addr, ok := internal.RealIP(r); ok {
+		return addr.String()
+	}
+
+	if ip := r.Header.Get("X-Real-Ip"); ip != "" {
+		return ip
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// observe records the result of a proxied request for passive ejection.
+func (p *Pool) observe(m *member, ok bool) {
+	m.lock.Lock()
+	if ok {
+		m.failures = 0
+		m.lock.Unlock()
+		return
+	}
+
+	m.failures++
+	ejected := m.failures >= p.maxFailures
+	if ejected {
+		m.failures = 0
+		m.ejectedUntil = time.Now().Add(p.ejectFor)
+	}
+	m.lock.Unlock()
+
+	if ejected {
+		slog.Warn("ejecting upstream member after failed requests", "route", p.name, "url", m.url, "for", p.ejectFor)
+		memberEjections.WithLabelValues(p.name, m.url).Inc()
+		memberHealthy.WithLabelValues(p.name, m.url).Set(0)
+		p.updateHealth()
+
+		time.AfterFunc(p.ejectFor, func() {
+			if m.available(time.Now()) {
+				memberHealthy.WithLabelValues(p.name, m.url).Set(1)
+			}
+			p.updateHealth()
+		})
+	}
+}
+
+func (p *Pool) checkAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, m := range p.members {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := p.check(ctx, m)
+			wasHealthy := m.healthy.Swap(err == nil)
+
+			switch {
+			case err != nil && wasHealthy:
+				slog.Warn("upstream member failed health check", "route", p.name, "url", m.url, "err", err)
+			case err == nil && !wasHealthy:
+				slog.Info("upstream member passed health check", "route", p.name, "url", m.url)
+			}
+
+			if m.available(time.Now()) {
+				memberHealthy.WithLabelValues(p.name, m.url).Set(1)
+			} else {
+				memberHealthy.WithLabelValues(p.name, m.url).Set(0)
+			}
+		}()
+	}
+	wg.Wait()
+
+	p.updateHealth()
+}
+
+// check sends a health check request to m through the same transport and
+// director that proxied requests use.
+func (p *Pool) check(ctx context.Context, m *member) error {
+	ctx, cancel := context.WithTimeout(ctx, p.checkTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost"+p.checkPath, nil)
+	if err != nil {
+		return err
+	}
+	m.proxy.Director(req)
+
+	resp, err := m.proxy.Transport.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("health check returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// updateHealth reports the pool as serving if any member is available.
+func (p *Pool) updateHealth() {
+	status := healthv1.HealthCheckResponse_NOT_SERVING
+
+	now := time.Now()
+	for _, m := range p.members {
+		if m.available(now) {
+			status = healthv1.HealthCheckResponse_SERVING
+			break
+		}
+	}
+
+	internal.SetHealth(HealthService(p.name), status)
+}
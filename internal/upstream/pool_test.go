@@ -0,0 +1,265 @@
+package upstream
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/TecharoHQ/anubis/internal"
+	"github.com/TecharoHQ/anubis/lib/config"
+	healthv1 "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+type testBackend struct {
+	*httptest.Server
+	hits   atomic.Int64
+	status atomic.Int64
+}
+
+func newTestBackend(t *testing.T, name string) *testBackend {
+	t.Helper()
+
+	result := &testBackend{}
+	result.status.Store(http.StatusOK)
+	result.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			result.hits.Add(1)
+		}
+		w.Header().Set("X-Upstream", name)
+		w.WriteHeader(int(result.status.Load()))
+	}))
+	t.Cleanup(result.Close)
+
+	return result
+}
+
+func doRequest(t *testing.T, h http.Handler, remoteAddr string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = remoteAddr
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestPoolRoundRobin(t *testing.T) {
+	a := newTestBackend(t, "a")
+	b := newTestBackend(t, "b")
+
+	pool, err := NewPool("rr", config.Target{URLs: []string{a.URL, b.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for range 10 {
+		doRequest(t, pool, "192.0.2.1:1234")
+	}
+
+	if a.hits.Load() != 5 || b.hits.Load() != 5 {
+		t.Errorf("wanted requests to be spread evenly, got a=%d b=%d", a.hits.Load(), b.hits.Load())
+	}
+}
+
+func TestPoolLeastConnections(t *testing.T) {
+	a := newTestBackend(t, "a")
+	b := newTestBackend(t, "b")
+
+	pool, err := NewPool("lc", config.Target{
+		URLs:    []string{a.URL, b.URL},
+		Balance: config.BalanceLeastConnections,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// pretend a is busy
+	pool.members[0].inflight.Add(5)
+
+	for range 4 {
+		doRequest(t, pool, "192.0.2.1:1234")
+	}
+
+	if a.hits.Load() != 0 || b.hits.Load() != 4 {
+		t.Errorf("wanted all requests to go to the idle member, got a=%d b=%d", a.hits.Load(), b.hits.Load())
+	}
+}
+
+func TestPoolConsistentHash(t *testing.T) {
+	a := newTestBackend(t, "a")
+	b := newTestBackend(t, "b")
+	c := newTestBackend(t, "c")
+
+	pool, err := NewPool("ch", config.Target{
+		URLs:    []string{a.URL, b.URL, c.URL},
+		Balance: config.BalanceConsistentHash,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, addr := range []string{"192.0.2.1:1", "192.0.2.2:2", "198.51.100.7:3", "[2001:db8::1]:4"} {
+		want := doRequest(t, pool, addr).Header().Get("X-Upstream")
+		for range 5 {
+			if got := doRequest(t, pool, addr).Header().Get("X-Upstream"); got != want {
+				t.Errorf("client %s moved from %s to %s", addr, want, got)
+			}
+		}
+	}
+}
+
+func TestPoolPassiveEjection(t *testing.T) {
+	a := newTestBackend(t, "a")
+	b := newTestBackend(t, "b")
+	a.status.Store(http.StatusServiceUnavailable)
+
+	pool, err := NewPool("passive", config.Target{
+		URLs: []string{a.URL, b.URL},
+		PassiveEjection: &config.PassiveEjection{
+			MaxFailures: 2,
+			Duration:    "1h",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for range 10 {
+		doRequest(t, pool, "192.0.2.1:1234")
+	}
+
+	if got := a.hits.Load(); got != 2 {
+		t.Errorf("wanted failing member to get 2 requests before ejection, got: %d", got)
+	}
+
+	if got := b.hits.Load(); got != 8 {
+		t.Errorf("wanted healthy member to get the remaining 8 requests, got: %d", got)
+	}
+
+	// connection errors count as failures too
+	b.Close()
+	for range 2 {
+		doRequest(t, pool, "192.0.2.1:1234")
+	}
+
+	if rec := doRequest(t, pool, "192.0.2.1:1234"); rec.Code != http.StatusBadGateway {
+		t.Errorf("wanted %d with every member ejected, got: %d", http.StatusBadGateway, rec.Code)
+	}
+
+	if st, _ := internal.GetHealth(HealthService("passive")); st != healthv1.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("wanted pool to be reported as not serving, got: %s", st)
+	}
+}
+
+func TestPoolHealthCheck(t *testing.T) {
+	a := newTestBackend(t, "a")
+	b := newTestBackend(t, "b")
+	a.status.Store(http.StatusInternalServerError)
+
+	pool, err := NewPool("active", config.Target{
+		URLs: []string{a.URL, b.URL},
+		HealthCheck: &config.HealthCheck{
+			Path:     "/healthz",
+			Interval: "10ms",
+			Timeout:  "1s",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.Start(t.Context())
+
+	deadline := time.Now().Add(5 * time.Second)
+	for pool.members[0].healthy.Load() {
+		if time.Now().After(deadline) {
+			t.Fatal("failing member was never marked unhealthy")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	for range 4 {
+		doRequest(t, pool, "192.0.2.1:1234")
+	}
+
+	if a.hits.Load() != 0 {
+		t.Errorf("wanted unhealthy member to get no requests, got: %d", a.hits.Load())
+	}
+
+	if st, _ := internal.GetHealth(HealthService("active")); st != healthv1.HealthCheckResponse_SERVING {
+		t.Errorf("wanted pool to be reported as serving, got: %s", st)
+	}
+
+	a.status.Store(http.StatusOK)
+	b.status.Store(http.StatusInternalServerError)
+
+	deadline = time.Now().Add(5 * time.Second)
+	for !pool.members[0].healthy.Load() || pool.members[1].healthy.Load() {
+		if time.Now().After(deadline) {
+			t.Fatal("members did not change health")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPoolClientCancel(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(slow.Close)
+	t.Cleanup(func() { close(release) })
+
+	pool, err := NewPool("cancel", config.Target{
+		URLs: []string{slow.URL},
+		PassiveEjection: &config.PassiveEjection{
+			MaxFailures: 1,
+			Duration:    "1h",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for range 3 {
+		ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+		req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+		pool.ServeHTTP(httptest.NewRecorder(), req)
+		cancel()
+	}
+
+	if !pool.members[0].available(time.Now()) {
+		t.Error("wanted clients that went away to not eject the member")
+	}
+}
+
+func TestPoolRouteName(t *testing.T) {
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+
+	pool, err := NewPool("api", config.Target{URLs: []string{dead.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got string
+	ctx := WithErrorHandler(t.Context(), func(w http.ResponseWriter, r *http.Request, err error) {
+		got = RouteName(r.Context())
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	pool.ServeHTTP(httptest.NewRecorder(), req)
+
+	t.Logf("want: %q", "api")
+	t.Logf("got:  %q", got)
+
+	if got != "api" {
+		t.Error("wanted the error handler to see the name of the route")
+	}
+}
@@ -0,0 +1,96 @@
+package upstream
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/TecharoHQ/anubis/internal/glob"
+	"github.com/TecharoHQ/anubis/lib/config"
+)
+
+type route struct {
+	name       string
+	hosts      []string
+	pathPrefix string
+	next       http.Handler
+}
+
+func (r route) matches(req *http.Request) bool {
+	if r.pathPrefix != "" && !strings.HasPrefix(req.URL.Path, r.pathPrefix) {
+		return false
+	}
+
+	if len(r.hosts) == 0 {
+		return true
+	}
+
+	host := strings.ToLower(req.Host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	for _, pattern := range r.hosts {
+		if glob.Glob(pattern, host) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Router sends each request to the first route that matches it, falling back
+// to the default upstream if no route matches.
+type Router struct {
+	routes   []route
+	fallback http.Handler
+}
+
+// NewRouter creates an upstream pool for every route and starts their health
+// checks, which stop when ctx is cancelled. If fallback is nil, requests that
+// don't match any route get a 404 response.
+func NewRouter(ctx context.Context, routes []config.Route, fallback http.Handler) (*Router, error) {
+	result := &Router{
+		fallback: fallback,
+	}
+
+	for _, r := range routes {
+		pool, err := NewPool(r.Name, r.Target)
+		if err != nil {
+			return nil, fmt.Errorf("route %s: %w", r.Name, err)
+		}
+		pool.Start(ctx)
+
+		hosts := make([]string, 0, len(r.Match.Hosts))
+		for _, h := range r.Match.Hosts {
+			hosts = append(hosts, strings.ToLower(h))
+		}
+
+		result.routes = append(result.routes, route{
+			name:       r.Name,
+			hosts:      hosts,
+			pathPrefix: r.Match.PathPrefix,
+			next:       pool,
+		})
+	}
+
+	return result, nil
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for _, route := range rt.routes {
+		if route.matches(r) {
+			route.next.ServeHTTP(w, r)
+			return
+		}
+	}
+
+	if rt.fallback == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	rt.fallback.ServeHTTP(w, r)
+}
@@ -0,0 +1,141 @@
+package upstream
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/TecharoHQ/anubis/lib/config"
+)
+
+func named(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Upstream", name)
+		w.Header().Set("X-Upstream-Host", r.Host)
+		io.WriteString(w, name)
+	})
+}
+
+func TestRouter(t *testing.T) {
+	git := httptest.NewServer(named("git"))
+	defer git.Close()
+	api := httptest.NewServer(named("api"))
+	defer api.Close()
+	wiki := httptest.NewServer(named("wiki"))
+	defer wiki.Close()
+
+	routes := []config.Route{
+		{
+			Name:   "git",
+			Match:  config.RouteMatch{Hosts: []string{"Git.example.com"}},
+			Target: config.Target{URL: git.URL},
+		},
+		{
+			Name:   "api",
+			Match:  config.RouteMatch{Hosts: []string{"*.example.com"}, PathPrefix: "/api/"},
+			Target: config.Target{URL: api.URL, Host: "api.internal"},
+		},
+		{
+			Name:   "wiki",
+			Match:  config.RouteMatch{PathPrefix: "/wiki/"},
+			Target: config.Target{URL: wiki.URL},
+		},
+	}
+
+	for _, tt := range []struct {
+		name     string
+		host     string
+		path     string
+		fallback http.Handler
+		want     string
+		wantHost string
+		status   int
+	}{
+		{
+			name:   "exact host",
+			host:   "git.example.com",
+			path:   "/",
+			want:   "git",
+			status: http.StatusOK,
+		},
+		{
+			name:   "host with port",
+			host:   "GIT.example.com:8443",
+			path:   "/repo",
+			want:   "git",
+			status: http.StatusOK,
+		},
+		{
+			name:   "first match wins",
+			host:   "git.example.com",
+			path:   "/api/v1",
+			want:   "git",
+			status: http.StatusOK,
+		},
+		{
+			name:     "glob host and path prefix",
+			host:     "docs.example.com",
+			path:     "/api/v1",
+			want:     "api",
+			wantHost: "api.internal",
+			status:   http.StatusOK,
+		},
+		{
+			name:   "path prefix on any host",
+			host:   "other.test",
+			path:   "/wiki/Main_Page",
+			want:   "wiki",
+			status: http.StatusOK,
+		},
+		{
+			name:     "falls back to default target",
+			host:     "docs.example.com",
+			path:     "/",
+			fallback: named("default"),
+			want:     "default",
+			status:   http.StatusOK,
+		},
+		{
+			name:   "no fallback is a 404",
+			host:   "docs.example.com",
+			path:   "/",
+			status: http.StatusNotFound,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rt, err := NewRouter(t.Context(), routes, tt.fallback)
+			if err != nil {
+				t.Fatalf("can't make router: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Host = tt.host
+			rec := httptest.NewRecorder()
+
+			rt.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("wanted status %d, got: %d", tt.status, rec.Code)
+			}
+
+			if tt.want == "" {
+				return
+			}
+
+			if got := rec.Header().Get("X-Upstream"); got != tt.want {
+				t.Logf("want: %s", tt.want)
+				t.Logf("got:  %s", got)
+				t.Error("request was sent to the wrong upstream")
+			}
+
+			if tt.wantHost != "" {
+				if got := rec.Header().Get("X-Upstream-Host"); got != tt.wantHost {
+					t.Logf("want: %s", tt.wantHost)
+					t.Logf("got:  %s", got)
+					t.Error("host header was not overridden")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+// Package upstream builds the reverse proxies Anubis forwards allowed requests
+// to and routes requests between them.
+package upstream
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+)
+
+// Options configures how a reverse proxy connects to its target.
+type Options struct {
+	// Host, if set, overrides the Host header sent to the target.
+	Host string
+
+	// SNI, if set, is the TLS handshake hostname. If set to "auto", the Host
+	// header of the request is used.
+	SNI string
+
+	// InsecureSkipVerify disables TLS certificate validation.
+	InsecureSkipVerify bool
+
+	// DisableKeepAlive disables HTTP keep-alive to the target.
+	DisableKeepAlive bool
+}
+
+// NewReverseProxy creates a reverse proxy to target, which may be an HTTP(S)
+// URL or a unix:// socket path.
+func NewReverseProxy(target string, opts Options) (*httputil.ReverseProxy, error) {
+	targetUri, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse target URL: %w", err)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if opts.DisableKeepAlive {
+		transport.DisableKeepAlives = true
+	}
+
+	// https://github.com/oauth2-proxy/oauth2-proxy/blob/4e2100a2879ef06aea1411790327019c1a09217c/pkg/upstream/http.go#L124
+	if targetUri.Scheme == "unix" {
+		// clean path up so we don't use the socket path in proxied requests
+		addr := targetUri.Path
+		targetUri.Path = ""
+		// tell transport how to dial unix sockets
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			dialer := net.Dialer{}
+			return dialer.DialContext(ctx, "unix", addr)
+		}
+		// tell transport how to handle the unix url scheme
+		transport.RegisterProtocol("unix", UnixRoundTripper{Transport: transport})
+	}
+
+	if opts.InsecureSkipVerify || opts.SNI != "" {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	if opts.InsecureSkipVerify {
+		slog.Warn("TARGET_INSECURE_SKIP_VERIFY is set to true, TLS certificate validation will not be performed", "target", target)
+		transport.TLSClientConfig.InsecureSkipVerify = true
+	}
+	if opts.SNI != "" && opts.SNI != "auto" {
+		transport.TLSClientConfig.ServerName = opts.SNI
+	}
+
+	rp := httputil.NewSingleHostReverseProxy(targetUri)
+	rp.Transport = transport
+	rp.ErrorHandler = handleError
+
+	if opts.SNI == "auto" {
+		rp.Transport = &sniTransport{base: transport, hosts: map[string]*http.Transport{}}
+	}
+
+	if opts.Host != "" {
+		originalDirector := rp.Director
+		rp.Director = func(req *http.Request) {
+			originalDirector(req)
+			req.Host = opts.Host
+		}
+	}
+
+	return rp, nil
+}
+
+// maxSNIHosts is how many per-host transports an sniTransport keeps before it
+// starts closing old ones.
+const maxSNIHosts = 256
+
+// sniTransport sends the Host header of each request as the TLS handshake
+// hostname. The transport is shared by concurrent requests and pools its
+// connections by address, not hostname, so every hostname gets a transport of
+// its own instead of changing the TLS config in place.
+type sniTransport struct {
+	base *http.Transport
+
+	lock  sync.Mutex
+	hosts map[string]*http.Transport
+}
+
+func (t *sniTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.forHost(req.Host).RoundTrip(req)
+}
+
+func (t *sniTransport) forHost(host string) *http.Transport {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if result, ok := t.hosts[host]; ok {
+		return result
+	}
+
+	// The Host header comes from the client, so don't keep a transport for
+	// every hostname anyone ever sent.
+	if len(t.hosts) >= maxSNIHosts {
+		for name, old := range t.hosts {
+			old.CloseIdleConnections()
+			delete(t.hosts, name)
+			break
+		}
+	}
+
+	result := t.base.Clone()
+	result.TLSClientConfig.ServerName = host
+	t.hosts[host] = result
+
+	return result
+}
+
+// https://github.com/oauth2-proxy/oauth2-proxy/blob/master/pkg/upstream/http.go#L124
+type UnixRoundTripper struct {
+	Transport *http.Transport
+}
+
+// set bare minimum stuff
+func (t UnixRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	if req.Host == "" {
+		req.Host = "localhost"
+	}
+	req.URL.Host = req.Host // proxy error: no Host in request URL
+	req.URL.Scheme = "http" // make http.Transport happy and avoid an infinite recursion
+	return t.Transport.RoundTrip(req)
+}
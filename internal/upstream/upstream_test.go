@@ -0,0 +1,45 @@
+package upstream
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestSNITransport(t *testing.T) {
+	rp, err := NewReverseProxy("https://192.0.2.1", Options{SNI: "auto"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st, ok := rp.Transport.(*sniTransport)
+	if !ok {
+		t.Fatalf("wanted an sniTransport, got %T", rp.Transport)
+	}
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			host := fmt.Sprintf("site%d.example", i%2)
+			if got := st.forHost(host + ":443").TLSClientConfig.ServerName; got != host {
+				t.Errorf("wanted ServerName %s, got %s", host, got)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if st.base.TLSClientConfig.ServerName != "" {
+		t.Error("the shared transport's TLS config was changed")
+	}
+
+	for i := range maxSNIHosts + 10 {
+		st.forHost(fmt.Sprintf("host%d.example", i))
+	}
+
+	if len(st.hosts) > maxSNIHosts {
+		t.Errorf("wanted at most %d transports, got %d", maxSNIHosts, len(st.hosts))
+	}
+
+}
@@ -0,0 +1,84 @@
+package verifiedcrawler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/TecharoHQ/anubis/internal/feed"
+)
+
+// jsonFeed is the format that Google, Bing, Apple, OpenAI and others publish
+// their crawler IP ranges in.
+type jsonFeed struct {
+	Prefixes []struct {
+		IPv4Prefix string `json:"ipv4Prefix"`
+		IPv6Prefix string `json:"ipv6Prefix"`
+	} `json:"prefixes"`
+}
+
+// Parse reads a list of IP ranges. It accepts the JSON format the big
+// crawler operators publish, such as
+// https://developers.google.com/static/search/apis/ipranges/googlebot.json,
+// or plain text with one address or CIDR range per line and # comments.
+func Parse(data []byte) ([]netip.Prefix, error) {
+	data = bytes.TrimSpace(data)
+
+	if bytes.HasPrefix(data, []byte("{")) {
+		return parseJSON(data)
+	}
+
+	return parseText(data)
+}
+
+func parseJSON(data []byte) ([]netip.Prefix, error) {
+	var f jsonFeed
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("verifiedcrawler: can't parse JSON feed: %w", err)
+	}
+
+	result := make([]netip.Prefix, 0, len(f.Prefixes))
+	for _, p := range f.Prefixes {
+		for _, s := range []string{p.IPv4Prefix, p.IPv6Prefix} {
+			if s == "" {
+				continue
+			}
+
+			prefix, err := feed.ParsePrefix(s)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, prefix)
+		}
+	}
+
+	return result, nil
+}
+
+func parseText(data []byte) ([]netip.Prefix, error) {
+	var result []netip.Prefix
+
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; sc.Scan(); line++ {
+		text, _, _ := strings.Cut(sc.Text(), "#")
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+
+		prefix, err := feed.ParsePrefix(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		result = append(result, prefix)
+	}
+
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("verifiedcrawler: can't read list: %w", err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,75 @@
+package verifiedcrawler
+
+import (
+	"errors"
+	"net/netip"
+	"slices"
+	"testing"
+
+	"github.com/TecharoHQ/anubis/internal/feed"
+)
+
+func TestParse(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		input string
+		want  []string
+		err   error
+	}{
+		{
+			name: "json feed",
+			input: `{
+  "creationTime": "2025-06-01T00:00:00.000000",
+  "prefixes": [
+    {"ipv6Prefix": "2001:4860:4801:10::/64"},
+    {"ipv4Prefix": "66.249.64.0/27"}
+  ]
+}`,
+			want: []string{"2001:4860:4801:10::/64", "66.249.64.0/27"},
+		},
+		{
+			name:  "text list",
+			input: "# crawler ranges\n192.0.2.0/24\n\n198.51.100.7 # single host\n2001:db8::1\n",
+			want:  []string{"192.0.2.0/24", "198.51.100.7/32", "2001:db8::1/128"},
+		},
+		{
+			name:  "unmasked range",
+			input: "192.0.2.7/24",
+			want:  []string{"192.0.2.0/24"},
+		},
+		{
+			name:  "empty",
+			input: "",
+		},
+		{
+			name:  "bad text",
+			input: "192.0.2.0/24\nnot-an-ip\n",
+			err:   feed.ErrBadPrefix,
+		},
+		{
+			name:  "bad json prefix",
+			input: `{"prefixes": [{"ipv4Prefix": "192.0.2.0/33"}]}`,
+			err:   feed.ErrBadPrefix,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse([]byte(tt.input))
+			if !errors.Is(err, tt.err) {
+				t.Logf("want: %v", tt.err)
+				t.Logf("got:  %v", err)
+				t.Fatal("got wrong error")
+			}
+
+			var want []netip.Prefix
+			for _, s := range tt.want {
+				want = append(want, netip.MustParsePrefix(s))
+			}
+
+			if !slices.Equal(got, want) {
+				t.Logf("want: %v", want)
+				t.Logf("got:  %v", got)
+				t.Error("got wrong prefixes")
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+// Package verifiedcrawler keeps track of the IP ranges that well-known
+// crawlers such as Googlebot publish, so that rules can check if a request
+// really comes from the crawler its User-Agent claims to be.
+package verifiedcrawler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"path"
+	"slices"
+	"time"
+
+	"github.com/TecharoHQ/anubis/data"
+	"github.com/TecharoHQ/anubis/internal/feed"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	refreshes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "anubis_verified_crawler_refreshes_total",
+		Help: "The total number of verified crawler IP range refreshes by result",
+	}, []string{"crawler", "result"})
+
+	prefixes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "anubis_verified_crawler_prefixes",
+		Help: "The number of IP ranges known for each verified crawler",
+	}, []string{"crawler"})
+)
+
+const (
+	// DefaultRefresh is how often IP ranges are fetched again if a Source
+	// doesn't set its own Refresh.
+	DefaultRefresh = 24 * time.Hour
+
+	// FetchTimeout is how long fetching a feed may take.
+	FetchTimeout = 30 * time.Second
+
+	// MaxFeedSize is the largest feed that will be read, in bytes.
+	MaxFeedSize = 16 << 20
+)
+
+// Source is where the IP ranges of a crawler come from.
+type Source struct {
+	// Name is what rules call the crawler, such as googlebot.
+	Name string
+
+	// URL is the feed to fetch the ranges from.
+	URL string
+
+	// File is a local file to read the ranges from instead of URL.
+	File string
+
+	// Refresh is how often the ranges are fetched or read again.
+	Refresh time.Duration
+
+	// Seed is the name of a snapshot in data.CrawlerRanges that is used
+	// until the first refresh succeeds.
+	Seed string
+}
+
+var builtins = []Source{
+	{Name: "applebot", URL: "https://search.developer.apple.com/applebot.json", Seed: "applebot.json"},
+	{Name: "bingbot", URL: "https://www.bing.com/toolbox/bingbot.json", Seed: "bingbot.json"},
+	{Name: "common-crawl", URL: "https://index.commoncrawl.org/ccbot.json", Seed: "common-crawl.json"},
+	{Name: "google-special-crawlers", URL: "https://developers.google.com/static/search/apis/ipranges/special-crawlers.json"},
+	{Name: "google-user-triggered-fetchers", URL: "https://developers.google.com/static/search/apis/ipranges/user-triggered-fetchers.json"},
+	{Name: "googlebot", URL: "https://developers.google.com/static/search/apis/ipranges/googlebot.json", Seed: "googlebot.json"},
+	{Name: "openai-chatgpt-user", URL: "https://openai.com/chatgpt-user.json"},
+	{Name: "openai-gptbot", URL: "https://openai.com/gptbot.json", Seed: "openai-gptbot.json"},
+	{Name: "openai-searchbot", URL: "https://openai.com/searchbot.json", Seed: "openai-searchbot.json"},
+	{Name: "perplexity-user", URL: "https://www.perplexity.ai/perplexity-user.json"},
+	{Name: "perplexitybot", URL: "https://www.perplexity.ai/perplexitybot.json"},
+	{Name: "qwantbot", URL: "https://help.qwant.com/wp-content/uploads/sites/2/2025/01/qwantbot.json", Seed: "qwantbot.json"},
+}
+
+// Builtin returns the built-in source for the crawler with the given name.
+func Builtin(name string) (Source, bool) {
+	i := slices.IndexFunc(builtins, func(s Source) bool { return s.Name == name })
+	if i == -1 {
+		return Source{}, false
+	}
+
+	return builtins[i], true
+}
+
+// BuiltinNames returns the names of the built-in crawlers.
+func BuiltinNames() []string {
+	result := make([]string, len(builtins))
+	for i, s := range builtins {
+		result[i] = s.Name
+	}
+
+	return result
+}
+
+// Registry holds the IP ranges of every known crawler. The ranges of a
+// crawler are refreshed in the background from when the policy file is
+// loaded if a rule uses it, until the Registry's context is done.
+type Registry = feed.Registry
+
+type offlineKey struct{}
+
+// WithOffline returns a context that makes registries created with it never
+// fetch feeds. Crawlers with a seed keep using it, crawlers with a file still
+// read it, and every other crawler contains no addresses.
+func WithOffline(ctx context.Context) context.Context {
+	return context.WithValue(ctx, offlineKey{}, true)
+}
+
+// New creates a Registry with the built-in crawlers and sources. Sources
+// replace built-in crawlers with the same name. A source without a URL or
+// File keeps the built-in crawler's URL, which lets it change only Refresh.
+// Files and seeds are read right away, so a missing file is an error. See
+// WithOffline for turning off fetching feeds.
+func New(ctx context.Context, lg *slog.Logger, sources []Source) (*Registry, error) {
+	offline, _ := ctx.Value(offlineKey{}).(bool)
+
+	all := map[string]Source{}
+	for _, src := range builtins {
+		all[src.Name] = src
+	}
+
+	for _, src := range sources {
+		if b, ok := all[src.Name]; ok && src.URL == "" && src.File == "" {
+			src.URL, src.Seed = b.URL, b.Seed
+		}
+
+		all[src.Name] = src
+	}
+
+	var feeds []feed.Source
+	for _, name := range slices.Sorted(maps.Keys(all)) {
+		src := all[name]
+		if src.Refresh <= 0 {
+			src.Refresh = DefaultRefresh
+		}
+
+		var seed []byte
+		if src.Seed != "" && src.File == "" {
+			buf, err := data.CrawlerRanges.ReadFile(path.Join("crawler-ranges", src.Seed))
+			if err != nil {
+				return nil, fmt.Errorf("[unexpected] can't read seed for crawler %s: %w", name, err)
+			}
+			seed = buf
+		}
+
+		feeds = append(feeds, feed.Source{
+			Name:    src.Name,
+			URL:     src.URL,
+			File:    src.File,
+			Refresh: src.Refresh,
+			Seed:    seed,
+			Parse:   Parse,
+		})
+	}
+
+	return feed.New(ctx, lg, feed.Config{
+		Subsystem:    "verified-crawlers",
+		Kind:         "crawler",
+		UserAgent:    "Anubis-Verified-Crawler-Fetcher/1.0",
+		FetchTimeout: FetchTimeout,
+		MaxSize:      MaxFeedSize,
+		Offline:      offline,
+		Refreshes:    refreshes,
+		Prefixes:     prefixes,
+	}, feeds)
+}
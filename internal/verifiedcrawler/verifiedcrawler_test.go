@@ -0,0 +1,131 @@
+package verifiedcrawler
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/TecharoHQ/anubis/internal/feed"
+)
+
+func TestBuiltinSeeds(t *testing.T) {
+	// A canceled context keeps the registry from fetching feeds.
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	r, err := New(ctx, slog.Default(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range BuiltinNames() {
+		if !r.Has(name) {
+			t.Errorf("registry doesn't have built-in crawler %s", name)
+		}
+	}
+
+	if !r.Contains("googlebot", netip.MustParseAddr("66.249.64.1")) {
+		t.Error("wanted the googlebot seed to contain 66.249.64.1")
+	}
+
+	if !r.Contains("googlebot", netip.MustParseAddr("::ffff:66.249.64.1")) {
+		t.Error("wanted the googlebot seed to contain IPv4-mapped 66.249.64.1")
+	}
+
+	if r.Contains("bingbot", netip.MustParseAddr("66.249.64.1")) {
+		t.Error("wanted the bingbot seed to not contain 66.249.64.1")
+	}
+
+	if r.Contains("nonexistent", netip.MustParseAddr("66.249.64.1")) {
+		t.Error("wanted unknown crawlers to contain nothing")
+	}
+}
+
+func TestRegistryOverride(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"prefixes": [{"ipv4Prefix": "192.0.2.0/24"}]}`))
+	}))
+	defer srv.Close()
+
+	// A canceled context keeps the registry from fetching the built-in
+	// feeds.
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	r, err := New(ctx, slog.Default(), []Source{
+		{Name: "googlebot", Refresh: time.Hour},
+		{Name: "bingbot", URL: srv.URL},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Changing only the refresh keeps the seed.
+	if !r.Contains("googlebot", netip.MustParseAddr("66.249.64.1")) {
+		t.Error("wanted the googlebot seed to be kept")
+	}
+
+	// A new URL replaces the seed once it is fetched.
+	r, err = New(t.Context(), slog.Default(), []Source{{Name: "bingbot", URL: srv.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Start("bingbot")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !r.Contains("bingbot", netip.MustParseAddr("192.0.2.1")) {
+		if time.Now().After(deadline) {
+			t.Fatal("wanted bingbot to use the new feed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRegistryOffline(t *testing.T) {
+	var hits atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"prefixes": [{"ipv4Prefix": "192.0.2.0/24"}]}`))
+	}))
+	defer srv.Close()
+
+	r, err := New(WithOffline(t.Context()), slog.Default(), []Source{
+		{Name: "googlebot", URL: srv.URL, Seed: "googlebot.json"},
+		{Name: "examplebot", URL: srv.URL},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for range 3 {
+		if !r.Contains("googlebot", netip.MustParseAddr("66.249.64.1")) {
+			t.Error("wanted the googlebot seed to contain 66.249.64.1")
+		}
+
+		if r.Contains("examplebot", netip.MustParseAddr("192.0.2.1")) {
+			t.Error("wanted examplebot to contain nothing while offline")
+		}
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if n := hits.Load(); n != 0 {
+		t.Errorf("wanted no feeds to be fetched while offline, got %d requests", n)
+	}
+}
+
+func TestRegistryNoSource(t *testing.T) {
+	_, err := New(t.Context(), slog.Default(), []Source{{Name: "examplebot"}})
+	if !errors.Is(err, feed.ErrNoSource) {
+		t.Logf("want: %v", feed.ErrNoSource)
+		t.Logf("got:  %v", err)
+		t.Error("got wrong error")
+	}
+}
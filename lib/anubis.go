@@ -20,6 +20,7 @@ import (
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/sync/singleflight"
 
 	"github.com/TecharoHQ/anubis"
 	"github.com/TecharoHQ/anubis/decaymap"
@@ -32,6 +33,7 @@ import (
 	"github.com/TecharoHQ/anubis/lib/policy"
 	"github.com/TecharoHQ/anubis/lib/policy/checker"
 	"github.com/TecharoHQ/anubis/lib/store"
+	"github.com/TecharoHQ/anubis/lib/thoth"
 
 	// challenge implementations
 	_ "github.com/TecharoHQ/anubis/lib/challenge/metarefresh"
@@ -50,11 +52,6 @@ var (
 		Help: "The total number of challenges validated",
 	}, []string{"method"})
 
-	droneBLHits = promauto.NewCounterVec(prometheus.CounterOpts{
-		Name: "anubis_dronebl_hits",
-		Help: "The total number of hits from DroneBL",
-	}, []string{"status"})
-
 	failedValidations = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "anubis_failed_validations",
 		Help: "The total number of failed validations",
@@ -64,8 +61,17 @@ var (
 		Name: "anubis_proxied_requests_total",
 		Help: "Number of requests proxied through Anubis to upstream targets",
 	}, []string{"host"})
+
+	upstreamErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "anubis_upstream_errors_total",
+		Help: "Number of requests that could not be proxied because the upstream was unreachable",
+	}, []string{"host", "route"})
 )
 
+// defaultRoute is the route label of requests that go to the default upstream
+// instead of one of the configured routes.
+const defaultRoute = "default"
+
 type Server struct {
 	next        http.Handler
 	store       store.Interface
@@ -74,8 +80,24 @@ type Server struct {
 	OGTags      *ogtags.OGTagCache
 	logger      *slog.Logger
 	opts        Options
+	settings    *anubis.Settings
+	challenges  map[string]challenge.Impl
 	ed25519Priv ed25519.PrivateKey
 	hs512Secret []byte
+	resolver    dnsbl.Resolver
+	dnsblFlight singleflight.Group
+}
+
+// challenge returns the challenge method named name.
+func (s *Server) challenge(name string) (challenge.Impl, bool) {
+	result, ok := s.challenges[name]
+	return result, ok
+}
+
+// withSettings attaches the server's settings to r for templates and
+// challenge methods.
+func (s *Server) withSettings(r *http.Request) *http.Request {
+	return r.WithContext(anubis.WithSettings(r.Context(), s.settings))
 }
 
 func (s *Server) getTokenKeyfunc() jwt.Keyfunc {
@@ -181,6 +203,13 @@ func (s *Server) maybeReverseProxyHttpStatusOnly(w http.ResponseWriter, r *http.
 	s.maybeReverseProxy(w, r, true)
 }
 
+// ServeAuthCheck checks r against the policy like the /api/check endpoint
+// does. It is used by integrations such as Envoy ext_authz that don't send
+// requests through ServeHTTP.
+func (s *Server) ServeAuthCheck(w http.ResponseWriter, r *http.Request) {
+	s.maybeReverseProxyHttpStatusOnly(w, s.withSettings(r))
+}
+
 func (s *Server) maybeReverseProxyOrPage(w http.ResponseWriter, r *http.Request) {
 	s.maybeReverseProxy(w, r, false)
 }
@@ -196,10 +225,12 @@ func (s *Server) maybeReverseProxy(w http.ResponseWriter, r *http.Request, httpS
 
 	// Adjust cookie path if base prefix is not empty
 	cookiePath := "/"
-	if anubis.BasePrefix != "" {
-		cookiePath = strings.TrimSuffix(anubis.BasePrefix, "/") + "/"
+	if s.settings.BasePrefix != "" {
+		cookiePath = strings.TrimSuffix(s.settings.BasePrefix, "/") + "/"
 	}
 
+	r = s.withDNSBL(r, lg)
+
 	cr, rule, err := s.check(r, lg)
 	if err != nil {
 		lg.Error("check failed", "err", err)
@@ -213,9 +244,7 @@ func (s *Server) maybeReverseProxy(w http.ResponseWriter, r *http.Request, httpS
 	lg = lg.With("check_result", cr)
 	policy.Applications.WithLabelValues(cr.Name, string(cr.Rule)).Add(1)
 
-	ip := r.Header.Get("X-Real-Ip")
-
-	if s.handleDNSBL(w, r, ip, lg) {
+	if s.handleDNSBL(w, r, lg) {
 		return
 	}
 
@@ -223,7 +252,7 @@ func (s *Server) maybeReverseProxy(w http.ResponseWriter, r *http.Request, httpS
 		return
 	}
 
-	ckie, err := r.Cookie(anubis.CookieName)
+	ckie, err := r.Cookie(s.settings.CookieName)
 	if err != nil {
 		lg.Debug("cookie not found", "path", r.URL.Path)
 		s.ClearCookie(w, CookieOpts{Path: cookiePath, Host: r.Host})
@@ -285,14 +314,22 @@ func (s *Server) maybeReverseProxy(w http.ResponseWriter, r *http.Request, httpS
 	}
 
 	r.Header.Add("X-Anubis-Status", "PASS")
+
+	if s.opts.UpgradeEnforceJWTExpiry && isUpgrade(r) {
+		// jwt.WithExpirationRequired already made sure this is set
+		if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+			r = r.WithContext(withConnDeadline(r.Context(), exp.Time))
+		}
+	}
+
 	s.ServeHTTPNext(w, r)
 }
 
 func (s *Server) checkRules(w http.ResponseWriter, r *http.Request, cr policy.CheckResult, lg *slog.Logger, rule *policy.Bot) bool {
 	// Adjust cookie path if base prefix is not empty
 	cookiePath := "/"
-	if anubis.BasePrefix != "" {
-		cookiePath = strings.TrimSuffix(anubis.BasePrefix, "/") + "/"
+	if s.settings.BasePrefix != "" {
+		cookiePath = strings.TrimSuffix(s.settings.BasePrefix, "/") + "/"
 	}
 
 	localizer := localization.GetLocalizer(r)
@@ -330,34 +367,6 @@ func (s *Server) checkRules(w http.ResponseWriter, r *http.Request, cr policy.Ch
 	return false
 }
 
-func (s *Server) handleDNSBL(w http.ResponseWriter, r *http.Request, ip string, lg *slog.Logger) bool {
-	db := &store.JSON[dnsbl.DroneBLResponse]{Underlying: s.store, Prefix: "dronebl:"}
-	if s.policy.DNSBL && ip != "" {
-		resp, err := db.Get(r.Context(), ip)
-		if err != nil {
-			lg.Debug("looking up ip in dnsbl")
-			resp, err := dnsbl.Lookup(ip)
-			if err != nil {
-				lg.Error("can't look up ip in dnsbl", "err", err)
-			}
-			db.Set(r.Context(), ip, resp, 24*time.Hour)
-			droneBLHits.WithLabelValues(resp.String()).Inc()
-		}
-
-		if resp != dnsbl.AllGood {
-			lg.Info("DNSBL hit", "status", resp.String())
-			localizer := localization.GetLocalizer(r)
-			s.respondWithStatus(w, r, fmt.Sprintf("%s: %s, %s https://dronebl.org/lookup?ip=%s",
-				localizer.T("dronebl_entry"),
-				resp.String(),
-				localizer.T("see_dronebl_lookup"),
-				ip), "", s.policy.StatusCodes.Deny)
-			return true
-		}
-	}
-	return false
-}
-
 func (s *Server) MakeChallenge(w http.ResponseWriter, r *http.Request) {
 	lg := internal.GetRequestLogger(s.logger, r)
 	localizer := localization.GetLocalizer(r)
@@ -411,7 +420,7 @@ func (s *Server) MakeChallenge(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.SetCookie(w, CookieOpts{Host: r.Host, Name: anubis.TestCookieName, Value: chall.ID})
+	s.SetCookie(w, CookieOpts{Host: r.Host, Name: s.settings.TestCookieName, Value: chall.ID})
 
 	err = encoder.Encode(struct {
 		Rules     *config.ChallengeRules `json:"rules"`
@@ -454,13 +463,13 @@ func (s *Server) PassChallenge(w http.ResponseWriter, r *http.Request) {
 
 	// Adjust cookie path if base prefix is not empty
 	cookiePath := "/"
-	if anubis.BasePrefix != "" {
-		cookiePath = strings.TrimSuffix(anubis.BasePrefix, "/") + "/"
+	if s.settings.BasePrefix != "" {
+		cookiePath = strings.TrimSuffix(s.settings.BasePrefix, "/") + "/"
 	}
 
-	if _, err := r.Cookie(anubis.TestCookieName); errors.Is(err, http.ErrNoCookie) {
+	if _, err := r.Cookie(s.settings.TestCookieName); errors.Is(err, http.ErrNoCookie) {
 		s.ClearCookie(w, CookieOpts{Path: cookiePath, Host: r.Host})
-		s.ClearCookie(w, CookieOpts{Name: anubis.TestCookieName, Host: r.Host})
+		s.ClearCookie(w, CookieOpts{Name: s.settings.TestCookieName, Host: r.Host})
 		lg.Warn("user has cookies disabled, this is not an anubis bug")
 		s.respondWithError(w, r, localizer.T("cookies_disabled"), "")
 		return
@@ -503,7 +512,7 @@ func (s *Server) PassChallenge(w http.ResponseWriter, r *http.Request) {
 
 	rule = s.hydrateChallengeRule(rule, chall, lg)
 
-	impl, ok := challenge.Get(chall.Method)
+	impl, ok := s.challenge(chall.Method)
 	if !ok {
 		lg.Error("check failed", "err", err)
 		s.respondWithError(w, r, fmt.Sprintf("%s: %s", localizer.T("internal_server_error"), rule.Challenge.Algorithm), makeCode(ErrActualAnubisBug))
@@ -604,7 +613,11 @@ func (s *Server) check(r *http.Request, lg *slog.Logger) (policy.CheckResult, *p
 		return decaymap.Zilch[policy.CheckResult](), nil, fmt.Errorf("[misconfiguration] %q is not an IP address", host)
 	}
 
-	weight := 0
+	r = s.withDNSBL(r, lg)
+	weight := s.dnsblWeight(r, lg)
+
+	// Every rule that needs the client's ASN or country shares one lookup.
+	r = r.WithContext(thoth.WithLookupCache(r.Context()))
 
 	for _, b := range s.policy.Bots {
 		match, err := b.Rules.Check(r)
@@ -617,9 +630,10 @@ func (s *Server) check(r *http.Request, lg *slog.Logger) (policy.CheckResult, *p
 			case config.RuleDeny, config.RuleAllow, config.RuleBenchmark, config.RuleChallenge:
 				return cr("bot/"+b.Name, b.Action, weight), &b, nil
 			case config.RuleWeigh:
-				lg.Debug("adjusting weight", "name", b.Name, "delta", b.Weight.Adjust)
+				delta := b.WeightFor(r)
+				lg.Debug("adjusting weight", "name", b.Name, "delta", delta)
 				policy.Applications.WithLabelValues("bot/"+b.Name, "WEIGH").Add(1)
-				weight += b.Weight.Adjust
+				weight += delta
 			}
 		}
 	}
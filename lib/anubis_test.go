@@ -19,11 +19,13 @@ import (
 	"github.com/TecharoHQ/anubis"
 	"github.com/TecharoHQ/anubis/data"
 	"github.com/TecharoHQ/anubis/internal"
+	"github.com/TecharoHQ/anubis/internal/upstream"
 	"github.com/TecharoHQ/anubis/lib/challenge"
 	"github.com/TecharoHQ/anubis/lib/config"
 	"github.com/TecharoHQ/anubis/lib/policy"
 	"github.com/TecharoHQ/anubis/lib/store"
 	"github.com/TecharoHQ/anubis/lib/thoth/thothmock"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 // TLogWriter implements io.Writer by logging each line to t.Log.
@@ -501,9 +503,6 @@ func TestBasePrefix(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			// Reset the global BasePrefix before each test
-			anubis.BasePrefix = ""
-
 			pol := loadPolicies(t, "", 4)
 
 			srv := spawnAnubis(t, Options{
@@ -1141,3 +1140,102 @@ func TestXForwardedForNoDoubleComma(t *testing.T) {
 		t.Errorf("X-Forwarded-For has two leading commas: %q", xff)
 	}
 }
+
+func TestUpstreamErrorPage(t *testing.T) {
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+
+	for _, tt := range []struct {
+		name           string
+		upstreamError  *config.UpstreamError
+		wantBody       string
+		wantRetryAfter string
+	}{
+		{
+			name:     "default message",
+			wantBody: "This website is temporarily unavailable",
+		},
+		{
+			name: "custom message and retry after",
+			upstreamError: &config.UpstreamError{
+				Message:    "We are down for scheduled maintenance",
+				RetryAfter: "10m",
+			},
+			wantBody:       "We are down for scheduled maintenance",
+			wantRetryAfter: "600",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rp, err := upstream.NewReverseProxy(dead.URL, upstream.Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			pol := loadPolicies(t, "testdata/permissive.yaml", 4)
+			pol.UpstreamError = tt.upstreamError
+
+			srv := spawnAnubis(t, Options{
+				Next:   rp,
+				Policy: pol,
+			})
+			ts := httptest.NewServer(srv)
+			t.Cleanup(ts.Close)
+
+			req, err := http.NewRequest(http.MethodGet, ts.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("X-Real-Ip", "10.0.0.1")
+
+			before := testutil.ToFloat64(upstreamErrors.WithLabelValues(req.Host, defaultRoute))
+
+			resp, err := ts.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != http.StatusBadGateway {
+				t.Errorf("response status is wrong, wanted %d but got: %s", http.StatusBadGateway, resp.Status)
+			}
+
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !strings.Contains(string(body), tt.wantBody) {
+				t.Errorf("error page does not contain %q", tt.wantBody)
+			}
+
+			if got := resp.Header.Get("Retry-After"); got != tt.wantRetryAfter {
+				t.Errorf("wanted Retry-After %q, got: %q", tt.wantRetryAfter, got)
+			}
+
+			if after := testutil.ToFloat64(upstreamErrors.WithLabelValues(req.Host, defaultRoute)); after != before+1 {
+				t.Errorf("wanted upstream error metric to go up by one, went from %v to %v", before, after)
+			}
+		})
+	}
+}
+
+func TestUpstreamErrorClientCanceled(t *testing.T) {
+	srv := spawnAnubis(t, Options{
+		Next:   http.NotFoundHandler(),
+		Policy: loadPolicies(t, "testdata/permissive.yaml", 4),
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+
+	before := testutil.ToFloat64(upstreamErrors.WithLabelValues(req.Host, defaultRoute))
+	srv.respondWithUpstreamError(rec, req, context.Canceled)
+
+	if after := testutil.ToFloat64(upstreamErrors.WithLabelValues(req.Host, defaultRoute)); after != before {
+		t.Errorf("wanted client cancellations not to be counted, metric went from %v to %v", before, after)
+	}
+
+	if rec.Body.Len() != 0 {
+		t.Errorf("wanted no error page for a client that went away, got %d bytes", rec.Body.Len())
+	}
+}
@@ -2,6 +2,7 @@ package challenge
 
 import (
 	"log/slog"
+	"maps"
 	"net/http"
 	"sort"
 	"sync"
@@ -31,6 +32,14 @@ func Get(name string) (Impl, bool) {
 	return result, ok
 }
 
+// All returns a copy of the registry. It is the default for
+// lib.Options.Challenges.
+func All() map[string]Impl {
+	regLock.RLock()
+	defer regLock.RUnlock()
+	return maps.Clone(registry)
+}
+
 func Methods() []string {
 	regLock.RLock()
 	defer regLock.RUnlock()
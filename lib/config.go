@@ -8,8 +8,11 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"maps"
+	"net"
 	"net/http"
 	"os"
+	"slices"
 	"strings"
 	"time"
 
@@ -53,8 +56,29 @@ type Options struct {
 	PublicUrl                string
 	JWTRestrictionHeader     string
 	DifficultyInJWT          bool
+
+	// CookieName and TestCookieName default to anubis.CookieName and
+	// anubis.TestCookieName.
+	CookieName     string
+	TestCookieName string
+
+	// ForcedLanguage and UseSimplifiedExplanation default to the package
+	// variables of the same names in package anubis.
+	ForcedLanguage           string
+	UseSimplifiedExplanation bool
+
+	// UpgradeEnforceJWTExpiry closes upgraded connections, such as
+	// WebSockets, when the JWT of the client that opened them expires.
+	UpgradeEnforceJWTExpiry bool
+
+	// Challenges are the challenge methods this server can issue, by name.
+	// If nil, every method registered with challenge.Register is used.
+	Challenges map[string]challenge.Impl
 }
 
+// LoadPoliciesOrDefault parses the policy file fname, or the built-in policy
+// if fname is empty. The challenge methods the policy uses are checked by New,
+// against the methods in Options.Challenges.
 func LoadPoliciesOrDefault(ctx context.Context, fname string, defaultDifficulty int, logLevel string) (*policy.ParsedConfig, error) {
 	var fin io.ReadCloser
 	var err error
@@ -83,19 +107,8 @@ func LoadPoliciesOrDefault(ctx context.Context, fname string, defaultDifficulty
 	if err != nil {
 		return nil, fmt.Errorf("can't parse policy file %s: %w", fname, err)
 	}
-	var validationErrs []error
-
-	for _, b := range anubisPolicy.Bots {
-		if _, ok := challenge.Get(b.Challenge.Algorithm); !ok {
-			validationErrs = append(validationErrs, fmt.Errorf("%w %s", policy.ErrChallengeRuleHasWrongAlgorithm, b.Challenge.Algorithm))
-		}
-	}
 
-	if len(validationErrs) != 0 {
-		return nil, fmt.Errorf("can't do final validation of Anubis config: %w", errors.Join(validationErrs...))
-	}
-
-	return anubisPolicy, err
+	return anubisPolicy, nil
 }
 
 func New(opts Options) (*Server, error) {
@@ -112,8 +125,49 @@ func New(opts Options) (*Server, error) {
 		opts.ED25519PrivateKey = priv
 	}
 
-	anubis.BasePrefix = strings.TrimRight(opts.BasePrefix, "/")
-	anubis.PublicUrl = opts.PublicUrl
+	if opts.CookieName == "" {
+		opts.CookieName = anubis.CookieName
+	}
+
+	if opts.TestCookieName == "" {
+		opts.TestCookieName = anubis.TestCookieName
+	}
+
+	if opts.ForcedLanguage == "" {
+		opts.ForcedLanguage = anubis.ForcedLanguage
+	}
+
+	if !opts.UseSimplifiedExplanation {
+		opts.UseSimplifiedExplanation = anubis.UseSimplifiedExplanation
+	}
+
+	if opts.Challenges == nil {
+		opts.Challenges = challenge.All()
+	}
+
+	var validationErrs []error
+	for _, b := range opts.Policy.Bots {
+		if b.Challenge == nil {
+			continue
+		}
+
+		if _, ok := opts.Challenges[b.Challenge.Algorithm]; !ok {
+			validationErrs = append(validationErrs, fmt.Errorf("%w %s", policy.ErrChallengeRuleHasWrongAlgorithm, b.Challenge.Algorithm))
+		}
+	}
+
+	if len(validationErrs) != 0 {
+		return nil, fmt.Errorf("lib: can't use policy: %w", errors.Join(validationErrs...))
+	}
+
+	settings := &anubis.Settings{
+		BasePrefix:               strings.TrimRight(opts.BasePrefix, "/"),
+		PublicUrl:                opts.PublicUrl,
+		CookieName:               opts.CookieName,
+		TestCookieName:           opts.TestCookieName,
+		ForcedLanguage:           opts.ForcedLanguage,
+		UseSimplifiedExplanation: opts.UseSimplifiedExplanation,
+	}
 
 	result := &Server{
 		next:        opts.Next,
@@ -126,12 +180,20 @@ func New(opts Options) (*Server, error) {
 			SNI:                opts.TargetSNI,
 			InsecureSkipVerify: opts.TargetInsecureSkipVerify,
 		}),
-		store:  opts.Policy.Store,
-		logger: opts.Logger,
+		store:      opts.Policy.Store,
+		logger:     opts.Logger,
+		settings:   settings,
+		challenges: opts.Challenges,
+		resolver:   net.DefaultResolver,
+	}
+
+	// Look up DNSBLs with the resolver from the policy file's dns section.
+	if opts.Policy.Dns != nil {
+		result.resolver = opts.Policy.Dns
 	}
 
 	mux := http.NewServeMux()
-	xess.Mount(mux)
+	xess.MountAt(mux, settings.BasePrefix)
 
 	// Helper to add global prefix
 	registerWithPrefix := func(pattern string, handler http.Handler, method string) {
@@ -140,7 +202,7 @@ func New(opts Options) (*Server, error) {
 		}
 
 		// Ensure there's no double slash when concatenating BasePrefix and pattern
-		basePrefix := strings.TrimSuffix(anubis.BasePrefix, "/")
+		basePrefix := strings.TrimSuffix(settings.BasePrefix, "/")
 		prefix := method + basePrefix
 
 		// If pattern doesn't start with a slash, add one
@@ -152,7 +214,7 @@ func New(opts Options) (*Server, error) {
 	}
 
 	// Ensure there's no double slash when concatenating BasePrefix and StaticPath
-	stripPrefix := strings.TrimSuffix(anubis.BasePrefix, "/") + anubis.StaticPath
+	stripPrefix := strings.TrimSuffix(settings.BasePrefix, "/") + anubis.StaticPath
 	registerWithPrefix(anubis.StaticPath, internal.UnchangingCache(internal.NoBrowsing(http.StripPrefix(stripPrefix, http.FileServerFS(web.Static)))), "")
 
 	if opts.ServeRobotsTXT {
@@ -209,9 +271,8 @@ func New(opts Options) (*Server, error) {
 		registerWithPrefix(anubis.APIPrefix+"make-challenge", http.HandlerFunc(result.MakeChallenge), "POST")
 	}
 
-	for _, implKind := range challenge.Methods() {
-		impl, _ := challenge.Get(implKind)
-		impl.Setup(mux)
+	for _, name := range slices.Sorted(maps.Keys(opts.Challenges)) {
+		opts.Challenges[name].Setup(mux)
 	}
 
 	result.mux = mux
@@ -6,11 +6,36 @@ import (
 )
 
 var (
-	ErrPrivateASN = errors.New("bot.ASNs: you have specified a private use ASN")
+	ErrPrivateASN         = errors.New("bot.ASNs: you have specified a private use ASN")
+	ErrUnknownFailureMode = errors.New("config.Bot: failure_mode must be open or closed")
 )
 
+// FailureMode is what an asns or geoip rule does when the lookup it needs
+// fails, for example because Thoth is down.
+type FailureMode string
+
+const (
+	// FailureModeOpen makes the rule not match, so the request goes on to
+	// the next rule. This is the default.
+	FailureModeOpen FailureMode = "open"
+
+	// FailureModeClosed makes the rule match, as if the client was in the
+	// listed networks or countries.
+	FailureModeClosed FailureMode = "closed"
+)
+
+func (f FailureMode) Valid() error {
+	switch f {
+	case "", FailureModeOpen, FailureModeClosed:
+		return nil
+	default:
+		return fmt.Errorf("%w, got %q", ErrUnknownFailureMode, f)
+	}
+}
+
 type ASNs struct {
-	Match []uint32 `json:"match"`
+	Match       []uint32    `json:"match"`
+	FailureMode FailureMode `json:"failure_mode,omitempty"`
 }
 
 func (a *ASNs) Valid() error {
@@ -22,6 +47,10 @@ func (a *ASNs) Valid() error {
 		}
 	}
 
+	if err := a.FailureMode.Valid(); err != nil {
+		errs = append(errs, err)
+	}
+
 	if len(errs) != 0 {
 		return fmt.Errorf("bot.ASNs: invalid ASN settings: %w", errors.Join(errs...))
 	}
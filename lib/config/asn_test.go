@@ -25,6 +25,21 @@ func TestASNsValid(t *testing.T) {
 			},
 			err: ErrPrivateASN,
 		},
+		{
+			name: "fail closed",
+			input: &ASNs{
+				Match:       []uint32{13335},
+				FailureMode: FailureModeClosed,
+			},
+		},
+		{
+			name: "unknown failure mode",
+			input: &ASNs{
+				Match:       []uint32{13335},
+				FailureMode: "sideways",
+			},
+			err: ErrUnknownFailureMode,
+		},
 	} {
 		t.Run(tt.name, func(t *testing.T) {
 			if err := tt.input.Valid(); !errors.Is(err, tt.err) {
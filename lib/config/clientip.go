@@ -0,0 +1,100 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+var (
+	ErrClientIPNoTrustedProxies = errors.New("config.ClientIP: trusted_proxies must have at least one entry")
+	ErrClientIPBadTrustedProxy  = errors.New("config.ClientIP: trusted proxy is not a valid IP address or CIDR range")
+	ErrClientIPBadHeader        = errors.New("config.ClientIP: header name is not valid")
+)
+
+// DefaultClientIPHeaders is the list of headers read when ClientIP.Headers is
+// empty. X-Forwarded-For is the only header that common reverse proxies append
+// to instead of passing through from the client.
+var DefaultClientIPHeaders = []string{"X-Forwarded-For"}
+
+// ClientIP controls how Anubis works out the client's IP address when it is
+// behind one or more reverse proxies.
+type ClientIP struct {
+	// TrustedProxies is the list of IP addresses and CIDR ranges of reverse
+	// proxies that are allowed to tell Anubis the client's IP address.
+	TrustedProxies []string `json:"trusted_proxies" yaml:"trusted_proxies"`
+
+	// Headers is the list of headers to read the client's IP address from, in
+	// order. X-Forwarded-For and Forwarded are walked from the right, every
+	// other header must contain a single IP address.
+	Headers []string `json:"headers,omitempty" yaml:"headers,omitempty"`
+}
+
+func (ci ClientIP) Valid() error {
+	var errs []error
+
+	if len(ci.TrustedProxies) == 0 {
+		errs = append(errs, ErrClientIPNoTrustedProxies)
+	}
+
+	for _, tp := range ci.TrustedProxies {
+		if _, err := parsePrefix(tp); err != nil {
+			errs = append(errs, fmt.Errorf("%w %q: %w", ErrClientIPBadTrustedProxy, tp, err))
+		}
+	}
+
+	for _, hdr := range ci.Headers {
+		if hdr == "" || strings.ContainsAny(hdr, " \t\r\n:") {
+			errs = append(errs, fmt.Errorf("%w: %q", ErrClientIPBadHeader, hdr))
+		}
+	}
+
+	if len(errs) != 0 {
+		return fmt.Errorf("client IP config not valid:\n%w", errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// Prefixes returns the trusted proxies as CIDR ranges. Bare IP addresses are
+// turned into single-address ranges.
+func (ci ClientIP) Prefixes() []netip.Prefix {
+	result := make([]netip.Prefix, 0, len(ci.TrustedProxies))
+	for _, tp := range ci.TrustedProxies {
+		// XXX: already validated in Valid()
+		prefix, _ := parsePrefix(tp)
+		result = append(result, prefix)
+	}
+	return result
+}
+
+// HeaderNames returns the canonical names of the headers to read the client's
+// IP address from.
+func (ci ClientIP) HeaderNames() []string {
+	headers := ci.Headers
+	if len(headers) == 0 {
+		headers = DefaultClientIPHeaders
+	}
+
+	result := make([]string, 0, len(headers))
+	for _, hdr := range headers {
+		result = append(result, http.CanonicalHeaderKey(hdr))
+	}
+	return result
+}
+
+func parsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		return prefix.Masked(), err
+	}
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"errors"
+	"net/netip"
+	"slices"
+	"testing"
+)
+
+func TestClientIPValid(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		input ClientIP
+		err   error
+	}{
+		{
+			name: "cidrs and addresses",
+			input: ClientIP{
+				TrustedProxies: []string{"10.0.0.0/8", "192.0.2.1", "2001:db8::/32"},
+				Headers:        []string{"Forwarded", "x-forwarded-for", "CF-Connecting-IP"},
+			},
+		},
+		{
+			name:  "no trusted proxies",
+			input: ClientIP{Headers: []string{"X-Forwarded-For"}},
+			err:   ErrClientIPNoTrustedProxies,
+		},
+		{
+			name:  "bad trusted proxy",
+			input: ClientIP{TrustedProxies: []string{"10.0.0.0/33"}},
+			err:   ErrClientIPBadTrustedProxy,
+		},
+		{
+			name:  "hostname as trusted proxy",
+			input: ClientIP{TrustedProxies: []string{"proxy.example.com"}},
+			err:   ErrClientIPBadTrustedProxy,
+		},
+		{
+			name:  "empty header",
+			input: ClientIP{TrustedProxies: []string{"10.0.0.0/8"}, Headers: []string{""}},
+			err:   ErrClientIPBadHeader,
+		},
+		{
+			name:  "header with colon",
+			input: ClientIP{TrustedProxies: []string{"10.0.0.0/8"}, Headers: []string{"X-Forwarded-For:"}},
+			err:   ErrClientIPBadHeader,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.input.Valid(); !errors.Is(err, tt.err) {
+				t.Logf("want: %v", tt.err)
+				t.Logf("got:  %v", err)
+				t.Fatal("got wrong validation error")
+			}
+		})
+	}
+}
+
+func TestClientIPPrefixesAndHeaders(t *testing.T) {
+	ci := ClientIP{TrustedProxies: []string{"10.1.2.3/8", "192.0.2.1", "2001:db8::1"}}
+
+	wantPrefixes := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.0.2.1/32"),
+		netip.MustParsePrefix("2001:db8::1/128"),
+	}
+	if got := ci.Prefixes(); !slices.Equal(got, wantPrefixes) {
+		t.Logf("want: %v", wantPrefixes)
+		t.Logf("got:  %v", got)
+		t.Error("wrong trusted proxy prefixes")
+	}
+
+	if got := ci.HeaderNames(); !slices.Equal(got, DefaultClientIPHeaders) {
+		t.Errorf("wanted default headers %v, got: %v", DefaultClientIPHeaders, got)
+	}
+
+	ci.Headers = []string{"cf-connecting-ip", "forwarded"}
+	want := []string{"Cf-Connecting-Ip", "Forwarded"}
+	if got := ci.HeaderNames(); !slices.Equal(got, want) {
+		t.Logf("want: %v", want)
+		t.Logf("got:  %v", got)
+		t.Error("wrong header names")
+	}
+}
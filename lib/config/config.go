@@ -9,10 +9,14 @@ import (
 	"net/http"
 	"os"
 	"regexp"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/TecharoHQ/anubis/data"
+	"github.com/TecharoHQ/anubis/internal/dnsbl"
+	"github.com/TecharoHQ/anubis/internal/iplist"
+	"github.com/TecharoHQ/anubis/internal/verifiedcrawler"
 	"k8s.io/apimachinery/pkg/util/yaml"
 )
 
@@ -64,12 +68,21 @@ type BotConfig struct {
 	Weight         *Weight           `json:"weight,omitempty" yaml:"weight,omitempty"`
 
 	// Thoth features
-	GeoIP *GeoIP `json:"geoip,omitempty"`
-	ASNs  *ASNs  `json:"asns,omitempty"`
+	GeoIP   *GeoIP   `json:"geoip,omitempty"`
+	ASNs    *ASNs    `json:"asns,omitempty"`
+	Hosting *Hosting `json:"hosting,omitempty"`
 
 	Name       string   `json:"name" yaml:"name"`
 	Action     Rule     `json:"action" yaml:"action"`
 	RemoteAddr []string `json:"remote_addresses,omitempty" yaml:"remote_addresses,omitempty"`
+
+	// VerifiedCrawler matches requests from the published IP ranges of the
+	// crawler with this name, such as googlebot.
+	VerifiedCrawler string `json:"verified_crawler,omitempty" yaml:"verified_crawler,omitempty"`
+
+	// IPLists matches requests from any of the IP lists with these names,
+	// such as tor-exits.
+	IPLists []string `json:"ip_lists,omitempty" yaml:"ip_lists,omitempty"`
 }
 
 func (b BotConfig) Zero() bool {
@@ -80,9 +93,12 @@ func (b BotConfig) Zero() bool {
 		len(b.HeadersRegex) != 0,
 		b.Action != "",
 		len(b.RemoteAddr) != 0,
+		b.VerifiedCrawler != "",
+		len(b.IPLists) != 0,
 		b.Challenge != nil,
 		b.GeoIP != nil,
 		b.ASNs != nil,
+		b.Hosting != nil,
 	} {
 		if cond {
 			return false
@@ -102,9 +118,12 @@ func (b *BotConfig) Valid() error {
 	allFieldsEmpty := b.UserAgentRegex == nil &&
 		b.PathRegex == nil &&
 		len(b.RemoteAddr) == 0 &&
+		b.VerifiedCrawler == "" &&
+		len(b.IPLists) == 0 &&
 		len(b.HeadersRegex) == 0 &&
 		b.ASNs == nil &&
-		b.GeoIP == nil
+		b.GeoIP == nil &&
+		b.Hosting == nil
 
 	if allFieldsEmpty && b.Expression == nil {
 		errs = append(errs, ErrBotMustHaveUserAgentOrPath)
@@ -158,12 +177,44 @@ func (b *BotConfig) Valid() error {
 		}
 	}
 
+	if b.VerifiedCrawler != "" && !feedNameRegex.MatchString(b.VerifiedCrawler) {
+		errs = append(errs, fmt.Errorf("%w: %q", ErrVerifiedCrawlerBadName, b.VerifiedCrawler))
+	}
+
+	for _, name := range b.IPLists {
+		if !feedNameRegex.MatchString(name) {
+			errs = append(errs, fmt.Errorf("%w: %q", ErrIPListBadName, name))
+		}
+	}
+
 	if b.Expression != nil {
 		if err := b.Expression.Valid(); err != nil {
 			errs = append(errs, err)
 		}
 	}
 
+	if b.ASNs != nil {
+		if err := b.ASNs.Valid(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if b.GeoIP != nil {
+		if err := b.GeoIP.Valid(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if b.Hosting != nil {
+		if err := b.Hosting.Valid(); err != nil {
+			errs = append(errs, err)
+		}
+
+		if len(b.Hosting.Weights) != 0 && b.Action != RuleWeigh {
+			errs = append(errs, ErrHostingWeightsNeedWeigh)
+		}
+	}
+
 	switch b.Action {
 	case RuleAllow, RuleBenchmark, RuleChallenge, RuleDeny, RuleWeigh:
 		// okay
@@ -325,15 +376,22 @@ func (sc StatusCodes) Valid() error {
 }
 
 type fileConfig struct {
-	OpenGraph   openGraphFileConfig `json:"openGraph,omitempty"`
-	Impressum   *Impressum          `json:"impressum,omitempty"`
-	Store       *Store              `json:"store"`
-	Bots        []BotOrImport       `json:"bots"`
-	Thresholds  []Threshold         `json:"thresholds"`
-	StatusCodes StatusCodes         `json:"status_codes"`
-	DNSBL       bool                `json:"dnsbl"`
-	DNSTTL      DnsTTL              `json:"dns_ttl"`
-	Logging     *Logging            `json:"logging"`
+	OpenGraph        openGraphFileConfig `json:"openGraph,omitempty"`
+	Impressum        *Impressum          `json:"impressum,omitempty"`
+	Store            *Store              `json:"store"`
+	Bots             []BotOrImport       `json:"bots"`
+	Thresholds       []Threshold         `json:"thresholds"`
+	StatusCodes      StatusCodes         `json:"status_codes"`
+	DNSBL            bool                `json:"dnsbl"`
+	DNSBLs           []DNSBL             `json:"dnsbls,omitempty"`
+	DNSTTL           DnsTTL              `json:"dns_ttl"`
+	DNS              *DNS                `json:"dns,omitempty"`
+	VerifiedCrawlers []VerifiedCrawler   `json:"verified_crawlers,omitempty"`
+	IPListFeeds      []IPList            `json:"ip_list_feeds,omitempty"`
+	Logging          *Logging            `json:"logging"`
+	Routes           []Route             `json:"routes,omitempty"`
+	UpstreamError    *UpstreamError      `json:"upstream_error,omitempty"`
+	ClientIP         *ClientIP           `json:"client_ip,omitempty"`
 }
 
 func (c *fileConfig) Valid() error {
@@ -375,6 +433,73 @@ func (c *fileConfig) Valid() error {
 		}
 	}
 
+	if c.UpstreamError != nil {
+		if err := c.UpstreamError.Valid(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if c.ClientIP != nil {
+		if err := c.ClientIP.Valid(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if c.DNS != nil {
+		if err := c.DNS.Valid(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	dnsblZones := map[string]struct{}{}
+	for i, d := range c.DNSBLs {
+		if err := d.Valid(); err != nil {
+			errs = append(errs, fmt.Errorf("dnsbl %d: %w", i, err))
+		}
+
+		zone := d.normalize().Zone
+		if _, ok := dnsblZones[zone]; ok {
+			errs = append(errs, fmt.Errorf("%w: %q", ErrDNSBLDuplicateZone, zone))
+		}
+		dnsblZones[zone] = struct{}{}
+	}
+
+	crawlerNames := map[string]struct{}{}
+	for i, v := range c.VerifiedCrawlers {
+		if err := v.Valid(); err != nil {
+			errs = append(errs, fmt.Errorf("verified crawler %d: %w", i, err))
+		}
+
+		if _, ok := crawlerNames[v.Name]; ok {
+			errs = append(errs, fmt.Errorf("%w: %q", ErrVerifiedCrawlerDuplicateName, v.Name))
+		}
+		crawlerNames[v.Name] = struct{}{}
+	}
+
+	ipListNames := map[string]struct{}{}
+	for i, l := range c.IPListFeeds {
+		if err := l.Valid(); err != nil {
+			errs = append(errs, fmt.Errorf("IP list %d: %w", i, err))
+		}
+
+		if _, ok := ipListNames[l.Name]; ok {
+			errs = append(errs, fmt.Errorf("%w: %q", ErrIPListDuplicateName, l.Name))
+		}
+		ipListNames[l.Name] = struct{}{}
+	}
+
+	routeNames := map[string]struct{}{}
+	for i, r := range c.Routes {
+		if err := r.Valid(); err != nil {
+			errs = append(errs, fmt.Errorf("route %d: %w", i, err))
+		}
+
+		if _, ok := routeNames[r.Name]; ok && r.Name != "" {
+			errs = append(errs, fmt.Errorf("%w: %q", ErrRouteDuplicateName, r.Name))
+		}
+		routeNames[r.Name] = struct{}{}
+	}
+
 	if len(errs) != 0 {
 		return fmt.Errorf("config is not valid:\n%w", errors.Join(errs...))
 	}
@@ -407,16 +532,40 @@ func Load(fin io.Reader, fname string) (*Config, error) {
 	}
 
 	result := &Config{
-		DNSBL:  c.DNSBL,
 		DNSTTL: c.DNSTTL,
 		OpenGraph: OpenGraph{
 			Enabled:      c.OpenGraph.Enabled,
 			ConsiderHost: c.OpenGraph.ConsiderHost,
 			Override:     c.OpenGraph.Override,
 		},
-		StatusCodes: c.StatusCodes,
-		Store:       c.Store,
-		Logging:     c.Logging,
+		StatusCodes:   c.StatusCodes,
+		Store:         c.Store,
+		Logging:       c.Logging,
+		Routes:        c.Routes,
+		UpstreamError: c.UpstreamError,
+		ClientIP:      c.ClientIP,
+
+		VerifiedCrawlers: c.VerifiedCrawlers,
+		IPLists:          c.IPListFeeds,
+	}
+
+	if c.DNS != nil {
+		result.DNS = *c.DNS
+
+		if c.DNS.TTL != nil {
+			result.DNSTTL = *c.DNS.TTL
+		}
+	}
+
+	for _, d := range c.DNSBLs {
+		result.DNSBLs = append(result.DNSBLs, d.normalize())
+	}
+
+	// dnsbl: true is shorthand for denying clients listed in DroneBL.
+	result.DNSBL = slices.ContainsFunc(result.DNSBLs, func(d DNSBL) bool { return d.Zone == dnsbl.DroneBLZone })
+	if c.DNSBL && !result.DNSBL {
+		result.DNSBLs = append(result.DNSBLs, DroneBL())
+		result.DNSBL = true
 	}
 
 	if c.OpenGraph.TimeToLive != "" {
@@ -447,6 +596,30 @@ func Load(fin io.Reader, fname string) (*Config, error) {
 		}
 	}
 
+	// Rules may only use crawlers that are built in or in verified_crawlers.
+	for _, b := range result.Bots {
+		if b.VerifiedCrawler == "" {
+			continue
+		}
+
+		_, isBuiltin := verifiedcrawler.Builtin(b.VerifiedCrawler)
+		isConfigured := slices.ContainsFunc(c.VerifiedCrawlers, func(v VerifiedCrawler) bool { return v.Name == b.VerifiedCrawler })
+		if !isBuiltin && !isConfigured {
+			validationErrs = append(validationErrs, fmt.Errorf("bot %s: %w: %q", b.Name, ErrUnknownVerifiedCrawler, b.VerifiedCrawler))
+		}
+	}
+
+	// Rules may only use IP lists that are built in or in ip_list_feeds.
+	for _, b := range result.Bots {
+		for _, name := range b.IPLists {
+			_, isBuiltin := iplist.Builtin(name)
+			isConfigured := slices.ContainsFunc(c.IPListFeeds, func(l IPList) bool { return l.Name == name })
+			if !isBuiltin && !isConfigured {
+				validationErrs = append(validationErrs, fmt.Errorf("bot %s: %w: %q", b.Name, ErrUnknownIPList, name))
+			}
+		}
+	}
+
 	if c.Impressum != nil {
 		if err := c.Impressum.Valid(); err != nil {
 			validationErrs = append(validationErrs, err)
@@ -499,15 +672,25 @@ func (sc DnsTTL) Valid() error {
 }
 
 type Config struct {
-	Impressum   *Impressum
-	Store       *Store
-	OpenGraph   OpenGraph
-	Bots        []BotConfig
-	Thresholds  []Threshold
-	StatusCodes StatusCodes
-	Logging     *Logging
-	DNSBL       bool
-	DNSTTL      DnsTTL
+	Impressum     *Impressum
+	Store         *Store
+	OpenGraph     OpenGraph
+	Bots          []BotConfig
+	Thresholds    []Threshold
+	StatusCodes   StatusCodes
+	Logging       *Logging
+	Routes        []Route
+	UpstreamError *UpstreamError
+	ClientIP      *ClientIP
+	DNSBLs        []DNSBL
+	DNSTTL        DnsTTL
+	DNS           DNS
+
+	// Deprecated: use DNSBLs. DNSBL is true if DroneBL is one of them.
+	DNSBL bool
+
+	VerifiedCrawlers []VerifiedCrawler
+	IPLists          []IPList
 }
 
 func (c Config) Valid() error {
@@ -0,0 +1,204 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	ErrDNSBadResolver    = errors.New("config.DNS: resolver address is not valid, use udp://host:port, tcp://host:port, tls://host:port, or an https:// URL")
+	ErrDNSBadTimeout     = errors.New("config.DNS: timeout does not parse as a positive Duration, see https://pkg.go.dev/time#ParseDuration (formatted like 500ms -> half a second, 2s -> 2 seconds, etc)")
+	ErrDNSBadAttempts    = errors.New("config.DNS: attempts must not be negative")
+	ErrDNSBadNegativeTTL = errors.New("config.DNS: negative_ttl must not be negative")
+	ErrDNSBadServerName  = errors.New("config.DNS: server_name can only be set for tls:// resolvers")
+	ErrDNSBadMaxLookups  = errors.New("config.DNS: max_concurrent and max_queued must not be negative")
+	ErrDNSBadFallback    = errors.New("config.DNS: fallback must be fail or pass")
+)
+
+// DNSFallback is the answer verifyFCrDNS gives when its lookups are dropped
+// because too many are in flight.
+type DNSFallback string
+
+const (
+	DNSFallbackFail DNSFallback = "fail"
+	DNSFallbackPass DNSFallback = "pass"
+)
+
+// DefaultDNSNegativeTTL is how long names without records are cached, in
+// seconds, if negative_ttl is not set.
+const DefaultDNSNegativeTTL = 60
+
+// DNS configures how Anubis resolves DNS names for expressions such as
+// verifyFCrDNS and for DNSBL lookups.
+type DNS struct {
+	// TTL is how long answers are cached. It replaces the top-level dns_ttl
+	// setting.
+	TTL *DnsTTL `json:"ttl,omitempty" yaml:"ttl,omitempty"`
+
+	// NegativeTTL is how long names without records are cached, in seconds.
+	// Set it to 0 to not cache them.
+	NegativeTTL *int `json:"negative_ttl,omitempty" yaml:"negative_ttl,omitempty"`
+
+	// Resolvers is the list of upstream resolvers to send queries to. If it is
+	// empty, the host's resolver is used.
+	Resolvers []DNSResolver `json:"resolvers,omitempty" yaml:"resolvers,omitempty"`
+
+	// Timeout is how long to wait for an answer to one query, in
+	// time.ParseDuration format.
+	Timeout string `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+
+	// Attempts is how many times a query is sent before giving up. Each
+	// attempt goes to the next resolver in the list.
+	Attempts int `json:"attempts,omitempty" yaml:"attempts,omitempty"`
+
+	// DNSSEC asks the resolvers to validate answers with DNSSEC and rejects
+	// answers they don't mark as authenticated.
+	DNSSEC bool `json:"dnssec,omitempty" yaml:"dnssec,omitempty"`
+
+	// MaxConcurrent is how many lookups may run at once. 0 means the default.
+	MaxConcurrent int `json:"max_concurrent,omitempty" yaml:"max_concurrent,omitempty"`
+
+	// MaxQueued is how many lookups may wait for a free slot before new ones
+	// are dropped. 0 means the default.
+	MaxQueued int `json:"max_queued,omitempty" yaml:"max_queued,omitempty"`
+
+	// Fallback is what verifyFCrDNS returns when its lookups are dropped.
+	// It defaults to fail.
+	Fallback DNSFallback `json:"fallback,omitempty" yaml:"fallback,omitempty"`
+}
+
+func (d DNS) Valid() error {
+	var errs []error
+
+	if d.TTL != nil {
+		if err := d.TTL.Valid(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if d.NegativeTTL != nil && *d.NegativeTTL < 0 {
+		errs = append(errs, fmt.Errorf("%w, got %d", ErrDNSBadNegativeTTL, *d.NegativeTTL))
+	}
+
+	for _, r := range d.Resolvers {
+		if err := r.Valid(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if d.Timeout != "" {
+		if timeout, err := time.ParseDuration(d.Timeout); err != nil || timeout <= 0 {
+			errs = append(errs, fmt.Errorf("%w: %q", ErrDNSBadTimeout, d.Timeout))
+		}
+	}
+
+	if d.Attempts < 0 {
+		errs = append(errs, fmt.Errorf("%w, got %d", ErrDNSBadAttempts, d.Attempts))
+	}
+
+	if d.MaxConcurrent < 0 || d.MaxQueued < 0 {
+		errs = append(errs, fmt.Errorf("%w, got %d and %d", ErrDNSBadMaxLookups, d.MaxConcurrent, d.MaxQueued))
+	}
+
+	switch d.Fallback {
+	case "", DNSFallbackFail, DNSFallbackPass:
+	default:
+		errs = append(errs, fmt.Errorf("%w, got %q", ErrDNSBadFallback, d.Fallback))
+	}
+
+	if len(errs) != 0 {
+		return fmt.Errorf("dns config not valid:\n%w", errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// NegativeTTLSeconds returns how long names without records are cached.
+func (d DNS) NegativeTTLSeconds() int {
+	if d.NegativeTTL == nil {
+		return DefaultDNSNegativeTTL
+	}
+
+	return *d.NegativeTTL
+}
+
+// TimeoutDuration returns how long to wait for an answer to one query, or 0
+// if the default should be used.
+func (d DNS) TimeoutDuration() time.Duration {
+	// XXX: already validated in Valid()
+	timeout, _ := time.ParseDuration(d.Timeout)
+	return timeout
+}
+
+// DNSResolver is an upstream DNS resolver.
+type DNSResolver struct {
+	// Address is where the resolver is, such as udp://9.9.9.9:53,
+	// tcp://9.9.9.9:53, tls://9.9.9.9:853 or
+	// https://dns.quad9.net/dns-query. A bare host or host:port means UDP.
+	Address string `json:"address" yaml:"address"`
+
+	// ServerName is the name to check the TLS certificate of tls://
+	// resolvers against. It defaults to the host in Address.
+	ServerName string `json:"server_name,omitempty" yaml:"server_name,omitempty"`
+}
+
+func (r DNSResolver) Valid() error {
+	protocol, addr, err := r.Parse()
+	if err != nil {
+		return fmt.Errorf("%w: %q: %w", ErrDNSBadResolver, r.Address, err)
+	}
+
+	if r.ServerName != "" && protocol != "tls" {
+		return fmt.Errorf("%w: %q", ErrDNSBadServerName, addr)
+	}
+
+	return nil
+}
+
+// Parse splits the resolver address into its protocol (udp, tcp, tls or
+// https) and the address to connect to. UDP, TCP and TLS addresses are
+// host:port with the default port filled in, HTTPS addresses are URLs.
+func (r DNSResolver) Parse() (protocol string, addr string, err error) {
+	protocol, rest, ok := strings.Cut(r.Address, "://")
+	if !ok {
+		protocol, rest = "udp", r.Address
+	}
+
+	switch protocol {
+	case "https":
+		u, err := url.Parse(r.Address)
+		if err != nil {
+			return "", "", err
+		}
+
+		if u.Host == "" {
+			return "", "", errors.New("URL has no host")
+		}
+
+		return protocol, u.String(), nil
+	case "udp", "tcp", "tls":
+		port := "53"
+		if protocol == "tls" {
+			port = "853"
+		}
+
+		host, p, err := net.SplitHostPort(rest)
+		if err != nil {
+			host = strings.TrimSuffix(strings.TrimPrefix(rest, "["), "]")
+		} else {
+			port = p
+		}
+
+		if host == "" || strings.ContainsAny(host, "/ ") {
+			return "", "", errors.New("host is not valid")
+		}
+
+		return protocol, net.JoinHostPort(host, port), nil
+	default:
+		return "", "", fmt.Errorf("unknown protocol %q", protocol)
+	}
+}
@@ -0,0 +1,157 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDNSValid(t *testing.T) {
+	negative := -1
+
+	for _, tt := range []struct {
+		name  string
+		input DNS
+		err   error
+	}{
+		{
+			name:  "empty",
+			input: DNS{},
+		},
+		{
+			name: "everything",
+			input: DNS{
+				TTL:      &DnsTTL{Forward: 600, Reverse: 600},
+				Timeout:  "500ms",
+				Attempts: 3,
+				DNSSEC:   true,
+
+				MaxConcurrent: 16,
+				MaxQueued:     64,
+				Fallback:      DNSFallbackPass,
+				Resolvers: []DNSResolver{
+					{Address: "9.9.9.9"},
+					{Address: "udp://[2620:fe::fe]:53"},
+					{Address: "tcp://9.9.9.9"},
+					{Address: "tls://9.9.9.9:853", ServerName: "dns.quad9.net"},
+					{Address: "https://dns.quad9.net/dns-query"},
+				},
+			},
+		},
+		{
+			name:  "negative TTL",
+			input: DNS{NegativeTTL: &negative},
+			err:   ErrDNSBadNegativeTTL,
+		},
+		{
+			name:  "bad timeout",
+			input: DNS{Timeout: "soon"},
+			err:   ErrDNSBadTimeout,
+		},
+		{
+			name:  "negative attempts",
+			input: DNS{Attempts: -1},
+			err:   ErrDNSBadAttempts,
+		},
+		{
+			name:  "negative max_concurrent",
+			input: DNS{MaxConcurrent: -1},
+			err:   ErrDNSBadMaxLookups,
+		},
+		{
+			name:  "negative max_queued",
+			input: DNS{MaxQueued: -1},
+			err:   ErrDNSBadMaxLookups,
+		},
+		{
+			name:  "bad fallback",
+			input: DNS{Fallback: "maybe"},
+			err:   ErrDNSBadFallback,
+		},
+		{
+			name:  "unknown protocol",
+			input: DNS{Resolvers: []DNSResolver{{Address: "quic://9.9.9.9"}}},
+			err:   ErrDNSBadResolver,
+		},
+		{
+			name:  "https without host",
+			input: DNS{Resolvers: []DNSResolver{{Address: "https:///dns-query"}}},
+			err:   ErrDNSBadResolver,
+		},
+		{
+			name:  "server name on udp",
+			input: DNS{Resolvers: []DNSResolver{{Address: "9.9.9.9", ServerName: "dns.quad9.net"}}},
+			err:   ErrDNSBadServerName,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.input.Valid(); !errors.Is(err, tt.err) {
+				t.Logf("want: %v", tt.err)
+				t.Logf("got:  %v", err)
+				t.Fatal("got wrong validation error")
+			}
+		})
+	}
+}
+
+func TestDNSResolverParse(t *testing.T) {
+	for _, tt := range []struct {
+		input    string
+		protocol string
+		addr     string
+	}{
+		{input: "9.9.9.9", protocol: "udp", addr: "9.9.9.9:53"},
+		{input: "9.9.9.9:5353", protocol: "udp", addr: "9.9.9.9:5353"},
+		{input: "tcp://9.9.9.9", protocol: "tcp", addr: "9.9.9.9:53"},
+		{input: "tls://dns.quad9.net", protocol: "tls", addr: "dns.quad9.net:853"},
+		{input: "udp://[2620:fe::fe]", protocol: "udp", addr: "[2620:fe::fe]:53"},
+		{input: "https://dns.quad9.net/dns-query", protocol: "https", addr: "https://dns.quad9.net/dns-query"},
+	} {
+		t.Run(tt.input, func(t *testing.T) {
+			protocol, addr, err := DNSResolver{Address: tt.input}.Parse()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if protocol != tt.protocol || addr != tt.addr {
+				t.Logf("want: %s %s", tt.protocol, tt.addr)
+				t.Logf("got:  %s %s", protocol, addr)
+				t.Error("wrong parse result")
+			}
+		})
+	}
+}
+
+func TestLoadDNS(t *testing.T) {
+	fin, err := os.Open("testdata/good/dns.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fin.Close()
+
+	c, err := Load(fin, fin.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.DNSTTL.Forward != 600 || c.DNSTTL.Reverse != 900 {
+		t.Errorf("wanted dns.ttl to replace dns_ttl, got: %+v", c.DNSTTL)
+	}
+
+	if got := c.DNS.NegativeTTLSeconds(); got != 30 {
+		t.Errorf("wanted negative TTL 30, got: %d", got)
+	}
+
+	if got := c.DNS.TimeoutDuration(); got != 500*time.Millisecond {
+		t.Errorf("wanted timeout 500ms, got: %s", got)
+	}
+
+	if c.DNS.MaxConcurrent != 16 || c.DNS.MaxQueued != 64 || c.DNS.Fallback != DNSFallbackPass {
+		t.Errorf("wanted lookup limits 16/64/pass, got: %d/%d/%s", c.DNS.MaxConcurrent, c.DNS.MaxQueued, c.DNS.Fallback)
+	}
+
+	if got := (DNS{}).NegativeTTLSeconds(); got != DefaultDNSNegativeTTL {
+		t.Errorf("wanted default negative TTL %d, got: %d", DefaultDNSNegativeTTL, got)
+	}
+}
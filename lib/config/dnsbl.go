@@ -0,0 +1,198 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/TecharoHQ/anubis/internal/dnsbl"
+)
+
+var (
+	ErrDNSBLBadZone       = errors.New("config.DNSBL: zone is not a valid DNS name")
+	ErrDNSBLBadAction     = errors.New("config.DNSBL: action must be DENY or WEIGH")
+	ErrDNSBLBadResponse   = errors.New("config.DNSBL: response code is not an IPv4 address")
+	ErrDNSBLBadTTL        = errors.New("config.DNSBL: ttl does not parse as a positive Duration, see https://pkg.go.dev/time#ParseDuration (formatted like 5m -> 5 minutes, 2h -> 2 hours, etc)")
+	ErrDNSBLBadTimeout    = errors.New("config.DNSBL: timeout does not parse as a positive Duration, see https://pkg.go.dev/time#ParseDuration (formatted like 500ms -> half a second, 2s -> 2 seconds, etc)")
+	ErrDNSBLDuplicateZone = errors.New("config.DNSBL: zone is listed more than once")
+	ErrDNSBLBadUnknown    = errors.New("config.DNSBL: unknown must be not_listed, listed, or wait")
+)
+
+// DNSBLUnknown is what Anubis assumes about a client while it looks the
+// client up in a DNSBL for the first time.
+type DNSBLUnknown string
+
+const (
+	// DNSBLUnknownNotListed lets the request through as if the client is not
+	// listed. This is the default.
+	DNSBLUnknownNotListed DNSBLUnknown = "not_listed"
+
+	// DNSBLUnknownListed treats the client as listed until the lookup says
+	// otherwise.
+	DNSBLUnknownListed DNSBLUnknown = "listed"
+
+	// DNSBLUnknownWait holds the request until the lookup finishes or times
+	// out.
+	DNSBLUnknownWait DNSBLUnknown = "wait"
+)
+
+// DefaultDNSBLTTL is how long DNSBL results are cached if a list doesn't set
+// its own TTL.
+const DefaultDNSBLTTL = 24 * time.Hour
+
+// DNSBLFailureTTL is how long a failed DNSBL lookup is cached, so that a list
+// that is down isn't asked again for every request.
+const DNSBLFailureTTL = time.Minute
+
+// DNSBL is a DNS blocklist that client IP addresses are looked up in.
+type DNSBL struct {
+	// Zone is the DNS zone of the list, such as dnsbl.dronebl.org.
+	Zone string `json:"zone" yaml:"zone"`
+
+	// Responses maps the addresses the list answers with, such as 127.0.0.3,
+	// to what they mean. If it is empty, any answer in 127.0.0.0/8 means the
+	// client is listed. If it is not, answers that aren't in it are ignored.
+	Responses map[string]string `json:"responses,omitempty" yaml:"responses,omitempty"`
+
+	// Action is what happens to listed clients: DENY (the default) blocks
+	// them, WEIGH adds Weight to their weight.
+	Action Rule `json:"action,omitempty" yaml:"action,omitempty"`
+
+	// Weight is how much weight a listed client gets when Action is WEIGH.
+	Weight *Weight `json:"weight,omitempty" yaml:"weight,omitempty"`
+
+	// TTL is how long lookup results are cached, in time.ParseDuration format.
+	TTL string `json:"ttl,omitempty" yaml:"ttl,omitempty"`
+
+	// Timeout is how long a lookup may take, in time.ParseDuration format.
+	Timeout string `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+
+	// Unknown is what happens to requests from clients whose lookup hasn't
+	// finished yet. Lookups run in the background unless it is wait.
+	Unknown DNSBLUnknown `json:"unknown,omitempty" yaml:"unknown,omitempty"`
+}
+
+// DroneBL is the list that the legacy `dnsbl: true` setting turns on.
+func DroneBL() DNSBL {
+	return DNSBL{
+		Zone:      dnsbl.DroneBLZone,
+		Responses: dnsbl.DroneBL().Responses,
+		Action:    RuleDeny,
+		Unknown:   DNSBLUnknownNotListed,
+	}
+}
+
+func (d DNSBL) Valid() error {
+	var errs []error
+
+	if !validZone(d.Zone) {
+		errs = append(errs, fmt.Errorf("%w: %q", ErrDNSBLBadZone, d.Zone))
+	}
+
+	for code := range d.Responses {
+		if addr, err := netip.ParseAddr(code); err != nil || !addr.Is4() {
+			errs = append(errs, fmt.Errorf("%w: %q", ErrDNSBLBadResponse, code))
+		}
+	}
+
+	switch d.Action {
+	case "", RuleDeny, RuleWeigh:
+	default:
+		errs = append(errs, fmt.Errorf("%w, got %q", ErrDNSBLBadAction, d.Action))
+	}
+
+	switch d.Unknown {
+	case "", DNSBLUnknownNotListed, DNSBLUnknownListed, DNSBLUnknownWait:
+	default:
+		errs = append(errs, fmt.Errorf("%w, got %q", ErrDNSBLBadUnknown, d.Unknown))
+	}
+
+	if d.TTL != "" {
+		if ttl, err := time.ParseDuration(d.TTL); err != nil || ttl <= 0 {
+			errs = append(errs, fmt.Errorf("%w: %q", ErrDNSBLBadTTL, d.TTL))
+		}
+	}
+
+	if d.Timeout != "" {
+		if timeout, err := time.ParseDuration(d.Timeout); err != nil || timeout <= 0 {
+			errs = append(errs, fmt.Errorf("%w: %q", ErrDNSBLBadTimeout, d.Timeout))
+		}
+	}
+
+	if len(errs) != 0 {
+		return fmt.Errorf("dnsbl %q not valid:\n%w", d.Zone, errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// normalize fills in defaults and makes the zone lowercase without a trailing
+// dot, so that it matches what CEL expressions pass to dnsblListed.
+func (d DNSBL) normalize() DNSBL {
+	d.Zone = strings.ToLower(strings.TrimSuffix(d.Zone, "."))
+
+	if d.Action == "" {
+		d.Action = RuleDeny
+	}
+
+	if d.Unknown == "" {
+		d.Unknown = DNSBLUnknownNotListed
+	}
+
+	if d.Action == RuleWeigh && d.Weight == nil {
+		d.Weight = &Weight{Adjust: 5}
+	}
+
+	return d
+}
+
+// TTLDuration returns how long lookup results are cached.
+func (d DNSBL) TTLDuration() time.Duration {
+	// XXX: already validated in Valid()
+	if ttl, err := time.ParseDuration(d.TTL); err == nil {
+		return ttl
+	}
+
+	return DefaultDNSBLTTL
+}
+
+// List returns the list in the form internal/dnsbl looks addresses up in.
+func (d DNSBL) List() dnsbl.List {
+	// XXX: already validated in Valid()
+	timeout, _ := time.ParseDuration(d.Timeout)
+
+	return dnsbl.List{
+		Zone:      d.Zone,
+		Responses: d.Responses,
+		Timeout:   timeout,
+	}
+}
+
+func validZone(zone string) bool {
+	zone = strings.TrimSuffix(zone, ".")
+	if zone == "" || len(zone) > 253 {
+		return false
+	}
+
+	for label := range strings.SplitSeq(zone, ".") {
+		if label == "" || len(label) > 63 {
+			return false
+		}
+
+		if strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return false
+		}
+
+		for _, r := range label {
+			switch {
+			case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			default:
+				return false
+			}
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,180 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/TecharoHQ/anubis/internal/dnsbl"
+)
+
+func TestDNSBLValid(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		input DNSBL
+		err   error
+	}{
+		{
+			name:  "zone only",
+			input: DNSBL{Zone: "dnsbl.dronebl.org"},
+		},
+		{
+			name: "everything",
+			input: DNSBL{
+				Zone:      "zen.spamhaus.org.",
+				Responses: map[string]string{"127.0.0.2": "SBL", "127.0.0.4": "XBL"},
+				Action:    RuleWeigh,
+				Weight:    &Weight{Adjust: 10},
+				TTL:       "1h",
+				Timeout:   "500ms",
+				Unknown:   DNSBLUnknownWait,
+			},
+		},
+		{
+			name:  "no zone",
+			input: DNSBL{},
+			err:   ErrDNSBLBadZone,
+		},
+		{
+			name:  "zone with spaces",
+			input: DNSBL{Zone: "dnsbl dronebl org"},
+			err:   ErrDNSBLBadZone,
+		},
+		{
+			name:  "empty label",
+			input: DNSBL{Zone: "dnsbl..org"},
+			err:   ErrDNSBLBadZone,
+		},
+		{
+			name:  "response is not an address",
+			input: DNSBL{Zone: "dnsbl.dronebl.org", Responses: map[string]string{"3": "IRC drone"}},
+			err:   ErrDNSBLBadResponse,
+		},
+		{
+			name:  "response is IPv6",
+			input: DNSBL{Zone: "dnsbl.dronebl.org", Responses: map[string]string{"::1": "IRC drone"}},
+			err:   ErrDNSBLBadResponse,
+		},
+		{
+			name:  "challenge action",
+			input: DNSBL{Zone: "dnsbl.dronebl.org", Action: RuleChallenge},
+			err:   ErrDNSBLBadAction,
+		},
+		{
+			name:  "bad unknown policy",
+			input: DNSBL{Zone: "dnsbl.dronebl.org", Unknown: "DENY"},
+			err:   ErrDNSBLBadUnknown,
+		},
+		{
+			name:  "bad ttl",
+			input: DNSBL{Zone: "dnsbl.dronebl.org", TTL: "a day"},
+			err:   ErrDNSBLBadTTL,
+		},
+		{
+			name:  "negative timeout",
+			input: DNSBL{Zone: "dnsbl.dronebl.org", Timeout: "-1s"},
+			err:   ErrDNSBLBadTimeout,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.input.Valid(); !errors.Is(err, tt.err) {
+				t.Logf("want: %v", tt.err)
+				t.Logf("got:  %v", err)
+				t.Fatal("got wrong validation error")
+			}
+		})
+	}
+}
+
+func TestDNSBLDefaults(t *testing.T) {
+	d := DNSBL{Zone: "DNSBL.Example.", Action: RuleWeigh}.normalize()
+
+	if d.Zone != "dnsbl.example" {
+		t.Errorf("wanted zone to be normalized, got: %q", d.Zone)
+	}
+
+	if d.Unknown != DNSBLUnknownNotListed {
+		t.Errorf("wanted default unknown policy %s, got: %s", DNSBLUnknownNotListed, d.Unknown)
+	}
+
+	if d.Weight == nil || d.Weight.Adjust != 5 {
+		t.Errorf("wanted default weight of 5, got: %v", d.Weight)
+	}
+
+	if ttl := d.TTLDuration(); ttl != DefaultDNSBLTTL {
+		t.Errorf("wanted default TTL %s, got: %s", DefaultDNSBLTTL, ttl)
+	}
+
+	if timeout := d.List().Timeout; timeout != 0 {
+		t.Errorf("wanted timeout to be left to internal/dnsbl, got: %s", timeout)
+	}
+
+	d = DNSBL{Zone: "dnsbl.example", TTL: "1h", Timeout: "250ms"}.normalize()
+
+	if d.Action != RuleDeny {
+		t.Errorf("wanted default action %s, got: %s", RuleDeny, d.Action)
+	}
+
+	if ttl := d.TTLDuration(); ttl != time.Hour {
+		t.Errorf("wanted TTL 1h, got: %s", ttl)
+	}
+
+	if timeout := d.List().Timeout; timeout != 250*time.Millisecond {
+		t.Errorf("wanted timeout 250ms, got: %s", timeout)
+	}
+}
+
+func TestLoadDNSBLs(t *testing.T) {
+	for _, tt := range []struct {
+		fname string
+		zones []string
+		dnsbl bool
+	}{
+		{
+			fname: "testdata/good/dnsbls.yaml",
+			zones: []string{"zen.spamhaus.org", "dnsbl.dronebl.org"},
+			dnsbl: true,
+		},
+		{
+			fname: "testdata/good/dnsbl-legacy.yaml",
+			zones: []string{dnsbl.DroneBLZone},
+			dnsbl: true,
+		},
+		{
+			fname: "testdata/good/allow_everyone.yaml",
+		},
+	} {
+		t.Run(tt.fname, func(t *testing.T) {
+			fin, err := os.Open(tt.fname)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer fin.Close()
+
+			c, err := Load(fin, tt.fname)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var zones []string
+			for _, d := range c.DNSBLs {
+				zones = append(zones, d.Zone)
+			}
+
+			if len(zones) != len(tt.zones) {
+				t.Fatalf("wanted zones %v, got: %v", tt.zones, zones)
+			}
+
+			for i := range zones {
+				if zones[i] != tt.zones[i] {
+					t.Errorf("wanted zones %v, got: %v", tt.zones, zones)
+				}
+			}
+
+			if c.DNSBL != tt.dnsbl {
+				t.Errorf("wanted deprecated DNSBL field to be %v, got: %v", tt.dnsbl, c.DNSBL)
+			}
+		})
+	}
+}
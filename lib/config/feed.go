@@ -0,0 +1,16 @@
+package config
+
+import (
+	"net/url"
+	"regexp"
+)
+
+// feedNameRegex matches the names of verified crawlers and IP lists.
+var feedNameRegex = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// validFeedURL returns true if u is an http:// or https:// URL with a host,
+// so that a feed can be fetched from it.
+func validFeedURL(u string) bool {
+	parsed, err := url.Parse(u)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
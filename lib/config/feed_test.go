@@ -0,0 +1,25 @@
+package config
+
+import "testing"
+
+func TestValidFeedURL(t *testing.T) {
+	for _, tt := range []struct {
+		url  string
+		want bool
+	}{
+		{url: "https://example.com/feed.json", want: true},
+		{url: "http://192.0.2.1:8080/list.txt", want: true},
+		{url: "ftp://example.com/list.txt"},
+		{url: "https:///list.txt"},
+		{url: "/etc/anubis/list.txt"},
+		{url: "://"},
+	} {
+		t.Run(tt.url, func(t *testing.T) {
+			if got := validFeedURL(tt.url); got != tt.want {
+				t.Logf("want: %v", tt.want)
+				t.Logf("got:  %v", got)
+				t.Error("got wrong result")
+			}
+		})
+	}
+}
@@ -14,7 +14,8 @@ var (
 )
 
 type GeoIP struct {
-	Countries []string `json:"countries"`
+	Countries   []string    `json:"countries"`
+	FailureMode FailureMode `json:"failure_mode,omitempty"`
 }
 
 func (g *GeoIP) Valid() error {
@@ -28,6 +29,10 @@ func (g *GeoIP) Valid() error {
 		g.Countries[i] = strings.ToLower(cc)
 	}
 
+	if err := g.FailureMode.Valid(); err != nil {
+		errs = append(errs, err)
+	}
+
 	if len(errs) != 0 {
 		return fmt.Errorf("bot.GeoIP: invalid GeoIP settings: %w", errors.Join(errs...))
 	}
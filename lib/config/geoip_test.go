@@ -24,6 +24,21 @@ func TestGeoIPValid(t *testing.T) {
 			},
 			err: ErrNotCountryCode,
 		},
+		{
+			name: "fail closed",
+			input: &GeoIP{
+				Countries:   []string{"CA"},
+				FailureMode: FailureModeClosed,
+			},
+		},
+		{
+			name: "unknown failure mode",
+			input: &GeoIP{
+				Countries:   []string{"CA"},
+				FailureMode: "sideways",
+			},
+			err: ErrUnknownFailureMode,
+		},
 	} {
 		t.Run(tt.name, func(t *testing.T) {
 			if err := tt.input.Valid(); !errors.Is(err, tt.err) {
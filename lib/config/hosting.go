@@ -0,0 +1,81 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/TecharoHQ/anubis/internal/hosting"
+)
+
+var (
+	ErrHostingMustBeTrueOrObject = errors.New("config.Hosting: hosting must be true or an object with a list of providers")
+	ErrUnknownHostingProvider    = errors.New("config.Hosting: provider is not in the hosting provider dataset")
+	ErrHostingWeightsNeedWeigh   = errors.New("config.Hosting: weights can only be set on rules with the WEIGH action")
+)
+
+// Hosting matches clients whose autonomous system belongs to a hosting or
+// cloud provider in data/hosting/providers.yaml. In the policy file,
+// `hosting: true` matches any provider.
+type Hosting struct {
+	// Providers limits the match to these providers, such as amazon-aws. If
+	// it is empty, any provider matches.
+	Providers []string `json:"providers,omitempty"`
+
+	// Weights maps providers to the weight a WEIGH rule adds for their
+	// clients instead of the rule's weight. Clients of other providers the
+	// rule matches get the rule's weight.
+	Weights     map[string]int `json:"weights,omitempty"`
+	FailureMode FailureMode    `json:"failure_mode,omitempty"`
+}
+
+func (h *Hosting) UnmarshalJSON(data []byte) error {
+	switch string(data) {
+	case "true":
+		*h = Hosting{}
+		return nil
+	case "false", "null":
+		return ErrHostingMustBeTrueOrObject
+	}
+
+	if data[0] != '{' {
+		return ErrHostingMustBeTrueOrObject
+	}
+
+	type RawHosting Hosting
+	var val RawHosting
+	if err := json.Unmarshal(data, &val); err != nil {
+		return err
+	}
+
+	*h = Hosting(val)
+	return nil
+}
+
+func (h *Hosting) Valid() error {
+	var errs []error
+
+	for _, name := range h.Providers {
+		if !hosting.Default().Has(name) {
+			errs = append(errs, fmt.Errorf("%w: %q", ErrUnknownHostingProvider, name))
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(h.Weights)) {
+		if !hosting.Default().Has(name) {
+			errs = append(errs, fmt.Errorf("%w: %q", ErrUnknownHostingProvider, name))
+		}
+	}
+
+	if err := h.FailureMode.Valid(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if len(errs) != 0 {
+		return fmt.Errorf("bot.Hosting: invalid hosting settings: %w", errors.Join(errs...))
+	}
+
+	return nil
+}
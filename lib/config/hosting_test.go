@@ -0,0 +1,101 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestHostingUnmarshalJSON(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		input string
+		want  Hosting
+		err   error
+	}{
+		{
+			name:  "true",
+			input: `true`,
+		},
+		{
+			name:  "object",
+			input: `{"providers": ["amazon-aws", "hetzner"], "failure_mode": "closed"}`,
+			want:  Hosting{Providers: []string{"amazon-aws", "hetzner"}, FailureMode: FailureModeClosed},
+		},
+		{
+			name:  "weights",
+			input: `{"weights": {"contabo": 10, "m247": 7}}`,
+			want:  Hosting{Weights: map[string]int{"contabo": 10, "m247": 7}},
+		},
+		{
+			name:  "false",
+			input: `false`,
+			err:   ErrHostingMustBeTrueOrObject,
+		},
+		{
+			name:  "string",
+			input: `"amazon-aws"`,
+			err:   ErrHostingMustBeTrueOrObject,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Hosting
+			err := json.Unmarshal([]byte(tt.input), &got)
+			if !errors.Is(err, tt.err) {
+				t.Logf("want: %v", tt.err)
+				t.Logf("got:  %v", err)
+				t.Fatal("got wrong error")
+			}
+
+			if !slices.Equal(got.Providers, tt.want.Providers) || !maps.Equal(got.Weights, tt.want.Weights) || got.FailureMode != tt.want.FailureMode {
+				t.Errorf("wanted %+v, got: %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestHostingValid(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		input *Hosting
+		err   error
+	}{
+		{
+			name:  "any provider",
+			input: &Hosting{},
+		},
+		{
+			name:  "known providers",
+			input: &Hosting{Providers: []string{"amazon-aws", "other"}},
+		},
+		{
+			name:  "unknown provider",
+			input: &Hosting{Providers: []string{"examplecloud"}},
+			err:   ErrUnknownHostingProvider,
+		},
+		{
+			name:  "known weights",
+			input: &Hosting{Weights: map[string]int{"contabo": 10, "other": 3}},
+		},
+		{
+			name:  "unknown provider in weights",
+			input: &Hosting{Weights: map[string]int{"examplecloud": 10}},
+			err:   ErrUnknownHostingProvider,
+		},
+		{
+			name:  "unknown failure mode",
+			input: &Hosting{FailureMode: "sideways"},
+			err:   ErrUnknownFailureMode,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.input.Valid(); !errors.Is(err, tt.err) {
+				t.Logf("want: %v", tt.err)
+				t.Logf("got:  %v", err)
+				t.Error("got wrong validation error")
+			}
+		})
+	}
+}
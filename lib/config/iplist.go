@@ -0,0 +1,101 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/TecharoHQ/anubis/internal/iplist"
+)
+
+var (
+	ErrIPListBadName       = errors.New("config.IPList: name must only contain lowercase letters, numbers, and dashes")
+	ErrIPListNoSource      = errors.New("config.IPList: url or file must be set for lists that are not built in")
+	ErrIPListURLAndFile    = errors.New("config.IPList: url and file can't both be set")
+	ErrIPListBadURL        = errors.New("config.IPList: url must be an http:// or https:// URL")
+	ErrIPListBadRefresh    = errors.New("config.IPList: refresh does not parse as a positive Duration, see https://pkg.go.dev/time#ParseDuration (formatted like 5m -> 5 minutes, 2h -> 2 hours, etc)")
+	ErrIPListColumnNotCSV  = errors.New("config.IPList: column can only be set when format is csv")
+	ErrIPListDuplicateName = errors.New("config.IPList: name is listed more than once")
+	ErrUnknownIPList       = errors.New("config.Bot: ip_lists has a list that is not built in or listed in ip_list_feeds")
+)
+
+// IPList adds a named list of IP ranges that rules can check requests
+// against, or changes where a built-in list comes from.
+type IPList struct {
+	// Name is what rules call the list, such as tor-exits.
+	Name string `json:"name" yaml:"name"`
+
+	// URL is a feed of the list's IP ranges.
+	URL string `json:"url,omitempty" yaml:"url,omitempty"`
+
+	// File is a local file with the list's IP ranges.
+	File string `json:"file,omitempty" yaml:"file,omitempty"`
+
+	// Format is text (the default) or csv.
+	Format iplist.Format `json:"format,omitempty" yaml:"format,omitempty"`
+
+	// Column is the number or header name of the CSV column with the IP
+	// ranges.
+	Column string `json:"column,omitempty" yaml:"column,omitempty"`
+
+	// Refresh is how often the list is fetched or read again, in
+	// time.ParseDuration format.
+	Refresh string `json:"refresh,omitempty" yaml:"refresh,omitempty"`
+}
+
+func (l IPList) Valid() error {
+	var errs []error
+
+	if !feedNameRegex.MatchString(l.Name) {
+		errs = append(errs, fmt.Errorf("%w: %q", ErrIPListBadName, l.Name))
+	}
+
+	if _, ok := iplist.Builtin(l.Name); !ok && l.URL == "" && l.File == "" {
+		errs = append(errs, ErrIPListNoSource)
+	}
+
+	if l.URL != "" && l.File != "" {
+		errs = append(errs, ErrIPListURLAndFile)
+	}
+
+	if l.URL != "" {
+		if !validFeedURL(l.URL) {
+			errs = append(errs, fmt.Errorf("%w: %q", ErrIPListBadURL, l.URL))
+		}
+	}
+
+	if err := l.Format.Valid(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if l.Column != "" && l.Format != iplist.FormatCSV {
+		errs = append(errs, ErrIPListColumnNotCSV)
+	}
+
+	if l.Refresh != "" {
+		if refresh, err := time.ParseDuration(l.Refresh); err != nil || refresh <= 0 {
+			errs = append(errs, fmt.Errorf("%w: %q", ErrIPListBadRefresh, l.Refresh))
+		}
+	}
+
+	if len(errs) != 0 {
+		return fmt.Errorf("IP list %q not valid:\n%w", l.Name, errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// Source returns the list in the form internal/iplist uses.
+func (l IPList) Source() iplist.Source {
+	// XXX: already validated in Valid()
+	refresh, _ := time.ParseDuration(l.Refresh)
+
+	return iplist.Source{
+		Name:    l.Name,
+		URL:     l.URL,
+		File:    l.File,
+		Format:  l.Format,
+		Column:  l.Column,
+		Refresh: refresh,
+	}
+}
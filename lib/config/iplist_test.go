@@ -0,0 +1,85 @@
+package config
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/TecharoHQ/anubis/internal/iplist"
+)
+
+func TestIPListValid(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		input IPList
+		err   error
+	}{
+		{
+			name:  "built-in",
+			input: IPList{Name: "tor-exits"},
+		},
+		{
+			name:  "built-in with refresh",
+			input: IPList{Name: "tor-exits", Refresh: "30m"},
+		},
+		{
+			name:  "url",
+			input: IPList{Name: "proxies", URL: "https://example.com/proxies.txt"},
+		},
+		{
+			name:  "csv file",
+			input: IPList{Name: "proxies", File: "/etc/anubis/proxies.csv", Format: iplist.FormatCSV, Column: "ip"},
+		},
+		{
+			name:  "bad name",
+			input: IPList{Name: "Residential Proxies", URL: "https://example.com/proxies.txt"},
+			err:   ErrIPListBadName,
+		},
+		{
+			name:  "no source",
+			input: IPList{Name: "proxies"},
+			err:   ErrIPListNoSource,
+		},
+		{
+			name:  "url and file",
+			input: IPList{Name: "proxies", URL: "https://example.com/proxies.txt", File: "/etc/anubis/proxies.txt"},
+			err:   ErrIPListURLAndFile,
+		},
+		{
+			name:  "bad url",
+			input: IPList{Name: "proxies", URL: "ftp://example.com/proxies.txt"},
+			err:   ErrIPListBadURL,
+		},
+		{
+			name:  "bad format",
+			input: IPList{Name: "proxies", URL: "https://example.com/proxies.json", Format: "json"},
+			err:   iplist.ErrUnknownFormat,
+		},
+		{
+			name:  "column without csv",
+			input: IPList{Name: "proxies", URL: "https://example.com/proxies.txt", Column: "2"},
+			err:   ErrIPListColumnNotCSV,
+		},
+		{
+			name:  "bad refresh",
+			input: IPList{Name: "tor-exits", Refresh: "-1h"},
+			err:   ErrIPListBadRefresh,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.input.Valid(); !errors.Is(err, tt.err) {
+				t.Logf("want: %v", tt.err)
+				t.Logf("got:  %v", err)
+				t.Fatal("got wrong validation error")
+			}
+		})
+	}
+}
+
+func TestIPListSource(t *testing.T) {
+	src := IPList{Name: "proxies", URL: "https://example.com/proxies.csv", Format: iplist.FormatCSV, Column: "ip", Refresh: "1h"}.Source()
+
+	if src.Name != "proxies" || src.URL != "https://example.com/proxies.csv" || src.Format != iplist.FormatCSV || src.Column != "ip" || src.Refresh != time.Hour {
+		t.Errorf("wrong source: %+v", src)
+	}
+}
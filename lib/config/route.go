@@ -0,0 +1,295 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	ErrRouteMustHaveName         = errors.New("config.Route: must set name")
+	ErrRoutePathPrefixNoSlash    = errors.New("config.Route: path_prefix must start with a slash")
+	ErrRouteTargetMissingURL     = errors.New("config.Target: must set url")
+	ErrRouteTargetInvalidURL     = errors.New("config.Target: url is invalid")
+	ErrRouteTargetUnknownScheme  = errors.New("config.Target: url scheme must be http, https, or unix")
+	ErrRouteDuplicateName        = errors.New("config.Route: name is used more than once")
+	ErrRouteMatchHostHasPort     = errors.New("config.RouteMatch: hosts must not contain a port")
+	ErrRouteMatchHostHasSlash    = errors.New("config.RouteMatch: hosts must be host names, not URLs")
+	ErrRouteMatchEmptyHostString = errors.New("config.RouteMatch: hosts must not contain empty strings")
+	ErrRouteTargetURLAndURLs     = errors.New("config.Target: url and urls must not be set together")
+	ErrRouteTargetUnknownBalance = errors.New("config.Target: balance must be round_robin, least_connections, or consistent_hash")
+	ErrHealthCheckBadPath        = errors.New("config.HealthCheck: path must start with a slash")
+	ErrHealthCheckBadInterval    = errors.New("config.HealthCheck: interval is invalid")
+	ErrHealthCheckBadTimeout     = errors.New("config.HealthCheck: timeout is invalid")
+	ErrPassiveEjectionBadFailure = errors.New("config.PassiveEjection: max_failures must be at least 1")
+	ErrPassiveEjectionBadTime    = errors.New("config.PassiveEjection: duration is invalid")
+)
+
+// Balance is the method used to pick a member of a target's pool of URLs.
+type Balance string
+
+const (
+	BalanceRoundRobin       Balance = "round_robin"
+	BalanceLeastConnections Balance = "least_connections"
+	BalanceConsistentHash   Balance = "consistent_hash"
+)
+
+// Route sends requests that match its Match rules to a Target. Routes are
+// checked in order and the first matching route wins.
+type Route struct {
+	Name   string     `json:"name" yaml:"name"`
+	Match  RouteMatch `json:"match" yaml:"match"`
+	Target Target     `json:"target" yaml:"target"`
+}
+
+func (r Route) Valid() error {
+	var errs []error
+
+	if r.Name == "" {
+		errs = append(errs, ErrRouteMustHaveName)
+	}
+
+	if err := r.Match.Valid(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := r.Target.Valid(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if len(errs) != 0 {
+		return fmt.Errorf("config: route %q is not valid:\n%w", r.Name, errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// RouteMatch is the set of conditions a request must match for a route to be
+// used. Every set condition must match. A RouteMatch with no conditions
+// matches every request.
+type RouteMatch struct {
+	// Hosts is the list of Host header values this route applies to. Entries
+	// may contain a glob such as "*.example.com".
+	Hosts []string `json:"hosts,omitempty" yaml:"hosts,omitempty"`
+
+	// PathPrefix is the prefix the request path must start with.
+	PathPrefix string `json:"path_prefix,omitempty" yaml:"path_prefix,omitempty"`
+}
+
+func (rm RouteMatch) Valid() error {
+	var errs []error
+
+	for _, host := range rm.Hosts {
+		switch {
+		case host == "":
+			errs = append(errs, ErrRouteMatchEmptyHostString)
+		case strings.Contains(host, "/"):
+			errs = append(errs, fmt.Errorf("%w: %q", ErrRouteMatchHostHasSlash, host))
+		case strings.Contains(host, ":"):
+			errs = append(errs, fmt.Errorf("%w: %q", ErrRouteMatchHostHasPort, host))
+		}
+	}
+
+	if rm.PathPrefix != "" && !strings.HasPrefix(rm.PathPrefix, "/") {
+		errs = append(errs, fmt.Errorf("%w: %q", ErrRoutePathPrefixNoSlash, rm.PathPrefix))
+	}
+
+	if len(errs) != 0 {
+		return errors.Join(errs...)
+	}
+
+	return nil
+}
+
+// Target is an upstream that Anubis reverse proxies to. The options mirror
+// the -target-* flags.
+type Target struct {
+	// URL is the upstream to proxy to, such as http://localhost:3000 or
+	// unix:///run/app.sock.
+	URL string `json:"url,omitempty" yaml:"url,omitempty"`
+
+	// URLs is a pool of equivalent upstreams to spread requests across. Only
+	// one of URL and URLs may be set.
+	URLs []string `json:"urls,omitempty" yaml:"urls,omitempty"`
+
+	// Balance is how a member of URLs is picked for each request. It defaults
+	// to round_robin.
+	Balance Balance `json:"balance,omitempty" yaml:"balance,omitempty"`
+
+	// HealthCheck, if set, actively probes every member and stops sending
+	// requests to members that fail.
+	HealthCheck *HealthCheck `json:"health_check,omitempty" yaml:"health_check,omitempty"`
+
+	// PassiveEjection, if set, stops sending requests to members that return
+	// server errors or can't be connected to.
+	PassiveEjection *PassiveEjection `json:"passive_ejection,omitempty" yaml:"passive_ejection,omitempty"`
+
+	// Host, if set, overrides the Host header sent to the upstream.
+	Host string `json:"host,omitempty" yaml:"host,omitempty"`
+
+	// SNI, if set, is the TLS handshake hostname. If set to "auto", the Host
+	// header is used.
+	SNI string `json:"sni,omitempty" yaml:"sni,omitempty"`
+
+	// InsecureSkipVerify disables TLS validation for the upstream.
+	InsecureSkipVerify bool `json:"insecure_skip_verify,omitempty" yaml:"insecure_skip_verify,omitempty"`
+
+	// DisableKeepAlive disables HTTP keep-alive for the upstream.
+	DisableKeepAlive bool `json:"disable_keepalive,omitempty" yaml:"disable_keepalive,omitempty"`
+}
+
+func (t Target) Valid() error {
+	var errs []error
+
+	switch {
+	case t.URL == "" && len(t.URLs) == 0:
+		errs = append(errs, ErrRouteTargetMissingURL)
+	case t.URL != "" && len(t.URLs) != 0:
+		errs = append(errs, ErrRouteTargetURLAndURLs)
+	}
+
+	for _, u := range t.Members() {
+		if err := validTargetURL(u); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	switch t.Balance {
+	case "", BalanceRoundRobin, BalanceLeastConnections, BalanceConsistentHash:
+	default:
+		errs = append(errs, fmt.Errorf("%w, got: %q", ErrRouteTargetUnknownBalance, t.Balance))
+	}
+
+	if t.HealthCheck != nil {
+		if err := t.HealthCheck.Valid(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if t.PassiveEjection != nil {
+		if err := t.PassiveEjection.Valid(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) != 0 {
+		return errors.Join(errs...)
+	}
+
+	return nil
+}
+
+// Members returns every URL requests can be sent to.
+func (t Target) Members() []string {
+	if t.URL != "" {
+		return []string{t.URL}
+	}
+
+	return t.URLs
+}
+
+func validTargetURL(target string) error {
+	if target == "" {
+		return ErrRouteTargetMissingURL
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRouteTargetInvalidURL, err)
+	}
+
+	switch u.Scheme {
+	case "http", "https", "unix":
+	default:
+		return fmt.Errorf("%w: %q", ErrRouteTargetUnknownScheme, target)
+	}
+
+	return nil
+}
+
+// HealthCheck configures active health checks for every member of a target.
+// A member is healthy when a GET request to Path returns a 2xx or 3xx status.
+type HealthCheck struct {
+	// Path is the path to request, such as /healthz. It defaults to /.
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+
+	// Interval is how often each member is checked, in time.ParseDuration
+	// format. It defaults to 10s.
+	Interval string `json:"interval,omitempty" yaml:"interval,omitempty"`
+
+	// Timeout is how long a check may take, in time.ParseDuration format. It
+	// defaults to 2s.
+	Timeout string `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+}
+
+func (hc HealthCheck) Valid() error {
+	var errs []error
+
+	if hc.Path != "" && !strings.HasPrefix(hc.Path, "/") {
+		errs = append(errs, fmt.Errorf("%w: %q", ErrHealthCheckBadPath, hc.Path))
+	}
+
+	if err := validPositiveDuration(hc.Interval); err != nil {
+		errs = append(errs, fmt.Errorf("%w: %w", ErrHealthCheckBadInterval, err))
+	}
+
+	if err := validPositiveDuration(hc.Timeout); err != nil {
+		errs = append(errs, fmt.Errorf("%w: %w", ErrHealthCheckBadTimeout, err))
+	}
+
+	if len(errs) != 0 {
+		return errors.Join(errs...)
+	}
+
+	return nil
+}
+
+// PassiveEjection configures when a member of a target is taken out of
+// rotation because of failed requests.
+type PassiveEjection struct {
+	// MaxFailures is how many 5xx responses or connection errors in a row eject
+	// a member.
+	MaxFailures int `json:"max_failures" yaml:"max_failures"`
+
+	// Duration is how long a member stays ejected, in time.ParseDuration
+	// format. It defaults to 30s.
+	Duration string `json:"duration,omitempty" yaml:"duration,omitempty"`
+}
+
+func (pe PassiveEjection) Valid() error {
+	var errs []error
+
+	if pe.MaxFailures < 1 {
+		errs = append(errs, fmt.Errorf("%w, got: %d", ErrPassiveEjectionBadFailure, pe.MaxFailures))
+	}
+
+	if err := validPositiveDuration(pe.Duration); err != nil {
+		errs = append(errs, fmt.Errorf("%w: %w", ErrPassiveEjectionBadTime, err))
+	}
+
+	if len(errs) != 0 {
+		return errors.Join(errs...)
+	}
+
+	return nil
+}
+
+// validPositiveDuration checks an optional duration string.
+func validPositiveDuration(s string) error {
+	if s == "" {
+		return nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	if d <= 0 {
+		return fmt.Errorf("must be positive, got %s", s)
+	}
+
+	return nil
+}
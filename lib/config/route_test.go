@@ -0,0 +1,189 @@
+package config
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRouteValid(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		input Route
+		err   error
+	}{
+		{
+			name: "basic host route",
+			input: Route{
+				Name:   "git",
+				Match:  RouteMatch{Hosts: []string{"git.example.com"}},
+				Target: Target{URL: "http://localhost:3000"},
+			},
+		},
+		{
+			name: "glob host and path prefix",
+			input: Route{
+				Name:   "api",
+				Match:  RouteMatch{Hosts: []string{"*.example.com"}, PathPrefix: "/api/"},
+				Target: Target{URL: "https://api.internal:8443", SNI: "auto"},
+			},
+		},
+		{
+			name: "unix socket",
+			input: Route{
+				Name:   "wiki",
+				Target: Target{URL: "unix:///run/wiki.sock"},
+			},
+		},
+		{
+			name: "no name",
+			input: Route{
+				Target: Target{URL: "http://localhost:3000"},
+			},
+			err: ErrRouteMustHaveName,
+		},
+		{
+			name: "no url",
+			input: Route{
+				Name: "app",
+			},
+			err: ErrRouteTargetMissingURL,
+		},
+		{
+			name: "unparseable url",
+			input: Route{
+				Name:   "app",
+				Target: Target{URL: "http://[::1"},
+			},
+			err: ErrRouteTargetInvalidURL,
+		},
+		{
+			name: "unknown scheme",
+			input: Route{
+				Name:   "app",
+				Target: Target{URL: "ftp://localhost"},
+			},
+			err: ErrRouteTargetUnknownScheme,
+		},
+		{
+			name: "path prefix without slash",
+			input: Route{
+				Name:   "app",
+				Match:  RouteMatch{PathPrefix: "api"},
+				Target: Target{URL: "http://localhost:3000"},
+			},
+			err: ErrRoutePathPrefixNoSlash,
+		},
+		{
+			name: "host with port",
+			input: Route{
+				Name:   "app",
+				Match:  RouteMatch{Hosts: []string{"example.com:8080"}},
+				Target: Target{URL: "http://localhost:3000"},
+			},
+			err: ErrRouteMatchHostHasPort,
+		},
+		{
+			name: "host is a url",
+			input: Route{
+				Name:   "app",
+				Match:  RouteMatch{Hosts: []string{"https://example.com/"}},
+				Target: Target{URL: "http://localhost:3000"},
+			},
+			err: ErrRouteMatchHostHasSlash,
+		},
+		{
+			name: "empty host",
+			input: Route{
+				Name:   "app",
+				Match:  RouteMatch{Hosts: []string{""}},
+				Target: Target{URL: "http://localhost:3000"},
+			},
+			err: ErrRouteMatchEmptyHostString,
+		},
+		{
+			name: "pool with health checks",
+			input: Route{
+				Name: "app",
+				Target: Target{
+					URLs:            []string{"http://10.0.0.1:3000", "http://10.0.0.2:3000"},
+					Balance:         BalanceLeastConnections,
+					HealthCheck:     &HealthCheck{Path: "/healthz", Interval: "5s", Timeout: "1s"},
+					PassiveEjection: &PassiveEjection{MaxFailures: 3, Duration: "30s"},
+				},
+			},
+		},
+		{
+			name: "url and urls",
+			input: Route{
+				Name:   "app",
+				Target: Target{URL: "http://10.0.0.1:3000", URLs: []string{"http://10.0.0.2:3000"}},
+			},
+			err: ErrRouteTargetURLAndURLs,
+		},
+		{
+			name: "bad pool member",
+			input: Route{
+				Name:   "app",
+				Target: Target{URLs: []string{"http://10.0.0.1:3000", "gopher://10.0.0.2"}},
+			},
+			err: ErrRouteTargetUnknownScheme,
+		},
+		{
+			name: "unknown balance",
+			input: Route{
+				Name:   "app",
+				Target: Target{URLs: []string{"http://10.0.0.1:3000"}, Balance: "random"},
+			},
+			err: ErrRouteTargetUnknownBalance,
+		},
+		{
+			name: "health check path without slash",
+			input: Route{
+				Name:   "app",
+				Target: Target{URL: "http://10.0.0.1:3000", HealthCheck: &HealthCheck{Path: "healthz"}},
+			},
+			err: ErrHealthCheckBadPath,
+		},
+		{
+			name: "health check bad interval",
+			input: Route{
+				Name:   "app",
+				Target: Target{URL: "http://10.0.0.1:3000", HealthCheck: &HealthCheck{Interval: "often"}},
+			},
+			err: ErrHealthCheckBadInterval,
+		},
+		{
+			name: "health check negative timeout",
+			input: Route{
+				Name:   "app",
+				Target: Target{URL: "http://10.0.0.1:3000", HealthCheck: &HealthCheck{Timeout: "-1s"}},
+			},
+			err: ErrHealthCheckBadTimeout,
+		},
+		{
+			name: "passive ejection without max failures",
+			input: Route{
+				Name:   "app",
+				Target: Target{URL: "http://10.0.0.1:3000", PassiveEjection: &PassiveEjection{}},
+			},
+			err: ErrPassiveEjectionBadFailure,
+		},
+		{
+			name: "passive ejection bad duration",
+			input: Route{
+				Name:   "app",
+				Target: Target{URL: "http://10.0.0.1:3000", PassiveEjection: &PassiveEjection{MaxFailures: 1, Duration: "soon"}},
+			},
+			err: ErrPassiveEjectionBadTime,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.input.Valid()
+			if !errors.Is(err, tt.err) {
+				t.Logf("want: %v", tt.err)
+				t.Logf("got:  %v", err)
+				t.Error("got wrong validation error")
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/TecharoHQ/anubis/lib/store"
 	_ "github.com/TecharoHQ/anubis/lib/store/all"
+	"github.com/TecharoHQ/anubis/lib/store/encrypted"
 )
 
 var (
@@ -17,6 +18,10 @@ var (
 type Store struct {
 	Backend    string          `json:"backend"`
 	Parameters json.RawMessage `json:"parameters"`
+
+	// Encryption optionally encrypts values before they are written to the
+	// backend.
+	Encryption *encrypted.Config `json:"encryption,omitempty"`
 }
 
 func (s *Store) Valid() error {
@@ -36,6 +41,12 @@ func (s *Store) Valid() error {
 		errs = append(errs, fmt.Errorf("%w: %q", ErrUnknownStoreBackend, s.Backend))
 	}
 
+	if s.Encryption != nil {
+		if err := s.Encryption.Valid(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
 	if len(errs) != 0 {
 		return errors.Join(errs...)
 	}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/TecharoHQ/anubis/lib/config"
 	"github.com/TecharoHQ/anubis/lib/store/bbolt"
+	"github.com/TecharoHQ/anubis/lib/store/encrypted"
 	"github.com/TecharoHQ/anubis/lib/store/valkey"
 )
 
@@ -65,6 +66,23 @@ func TestStoreValid(t *testing.T) {
 			},
 			err: bbolt.ErrMissingPath,
 		},
+		{
+			name: "encrypted memory backend",
+			input: config.Store{
+				Backend: "memory",
+				Encryption: &encrypted.Config{
+					Keys: []encrypted.Key{{ID: "2025", Env: "ANUBIS_STORE_KEY"}},
+				},
+			},
+		},
+		{
+			name: "encryption without keys",
+			input: config.Store{
+				Backend:    "memory",
+				Encryption: &encrypted.Config{},
+			},
+			err: encrypted.ErrNoKeys,
+		},
 		{
 			name: "unknown backend",
 			input: config.Store{
@@ -0,0 +1,45 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrUpstreamErrorBadRetryAfter = errors.New("config.UpstreamError: retry_after does not parse as a positive Duration, see https://pkg.go.dev/time#ParseDuration")
+)
+
+// UpstreamError customizes the page shown when the upstream can't be reached.
+type UpstreamError struct {
+	// Message replaces the default localized message on the error page.
+	Message string `json:"message,omitempty" yaml:"message,omitempty"`
+
+	// RetryAfter, if set, is sent to clients in the Retry-After header.
+	RetryAfter string `json:"retry_after,omitempty" yaml:"retry_after,omitempty"`
+}
+
+func (ue UpstreamError) Valid() error {
+	if ue.RetryAfter == "" {
+		return nil
+	}
+
+	d, err := time.ParseDuration(ue.RetryAfter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrUpstreamErrorBadRetryAfter, err)
+	}
+
+	if d < time.Second {
+		return fmt.Errorf("%w: must be at least 1s, got %s", ErrUpstreamErrorBadRetryAfter, ue.RetryAfter)
+	}
+
+	return nil
+}
+
+// RetryAfterSeconds returns the value of the Retry-After header, or 0 if it
+// should not be sent.
+func (ue UpstreamError) RetryAfterSeconds() int {
+	// XXX: already validated in Valid()
+	d, _ := time.ParseDuration(ue.RetryAfter)
+	return int(d / time.Second)
+}
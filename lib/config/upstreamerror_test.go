@@ -0,0 +1,51 @@
+package config
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestUpstreamErrorValid(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		input      UpstreamError
+		err        error
+		retryAfter int
+	}{
+		{
+			name:  "empty",
+			input: UpstreamError{},
+		},
+		{
+			name:       "message and retry after",
+			input:      UpstreamError{Message: "We are down for maintenance.", RetryAfter: "5m"},
+			retryAfter: 300,
+		},
+		{
+			name:  "retry after does not parse",
+			input: UpstreamError{RetryAfter: "later"},
+			err:   ErrUpstreamErrorBadRetryAfter,
+		},
+		{
+			name:  "retry after too short",
+			input: UpstreamError{RetryAfter: "500ms"},
+			err:   ErrUpstreamErrorBadRetryAfter,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.input.Valid(); !errors.Is(err, tt.err) {
+				t.Logf("want: %v", tt.err)
+				t.Logf("got:  %v", err)
+				t.Fatal("got wrong validation error")
+			}
+
+			if tt.err != nil {
+				return
+			}
+
+			if got := tt.input.RetryAfterSeconds(); got != tt.retryAfter {
+				t.Errorf("wanted Retry-After %d, got: %d", tt.retryAfter, got)
+			}
+		})
+	}
+}
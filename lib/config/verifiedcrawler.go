@@ -0,0 +1,83 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/TecharoHQ/anubis/internal/verifiedcrawler"
+)
+
+var (
+	ErrVerifiedCrawlerBadName       = errors.New("config.VerifiedCrawler: name must only contain lowercase letters, numbers, and dashes")
+	ErrVerifiedCrawlerNoSource      = errors.New("config.VerifiedCrawler: url or file must be set for crawlers that are not built in")
+	ErrVerifiedCrawlerURLAndFile    = errors.New("config.VerifiedCrawler: url and file can't both be set")
+	ErrVerifiedCrawlerBadURL        = errors.New("config.VerifiedCrawler: url must be an http:// or https:// URL")
+	ErrVerifiedCrawlerBadRefresh    = errors.New("config.VerifiedCrawler: refresh does not parse as a positive Duration, see https://pkg.go.dev/time#ParseDuration (formatted like 5m -> 5 minutes, 2h -> 2 hours, etc)")
+	ErrVerifiedCrawlerDuplicateName = errors.New("config.VerifiedCrawler: name is listed more than once")
+	ErrUnknownVerifiedCrawler       = errors.New("config.Bot: verified_crawler is not a built-in crawler or one listed in verified_crawlers")
+)
+
+// VerifiedCrawler adds a crawler whose IP ranges rules can check requests
+// against, or changes where a built-in crawler's ranges come from.
+type VerifiedCrawler struct {
+	// Name is what rules call the crawler, such as googlebot.
+	Name string `json:"name" yaml:"name"`
+
+	// URL is a feed of the crawler's IP ranges.
+	URL string `json:"url,omitempty" yaml:"url,omitempty"`
+
+	// File is a local file with the crawler's IP ranges.
+	File string `json:"file,omitempty" yaml:"file,omitempty"`
+
+	// Refresh is how often the ranges are fetched or read again, in
+	// time.ParseDuration format.
+	Refresh string `json:"refresh,omitempty" yaml:"refresh,omitempty"`
+}
+
+func (v VerifiedCrawler) Valid() error {
+	var errs []error
+
+	if !feedNameRegex.MatchString(v.Name) {
+		errs = append(errs, fmt.Errorf("%w: %q", ErrVerifiedCrawlerBadName, v.Name))
+	}
+
+	if _, ok := verifiedcrawler.Builtin(v.Name); !ok && v.URL == "" && v.File == "" {
+		errs = append(errs, ErrVerifiedCrawlerNoSource)
+	}
+
+	if v.URL != "" && v.File != "" {
+		errs = append(errs, ErrVerifiedCrawlerURLAndFile)
+	}
+
+	if v.URL != "" {
+		if !validFeedURL(v.URL) {
+			errs = append(errs, fmt.Errorf("%w: %q", ErrVerifiedCrawlerBadURL, v.URL))
+		}
+	}
+
+	if v.Refresh != "" {
+		if refresh, err := time.ParseDuration(v.Refresh); err != nil || refresh <= 0 {
+			errs = append(errs, fmt.Errorf("%w: %q", ErrVerifiedCrawlerBadRefresh, v.Refresh))
+		}
+	}
+
+	if len(errs) != 0 {
+		return fmt.Errorf("verified crawler %q not valid:\n%w", v.Name, errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// Source returns the crawler in the form internal/verifiedcrawler uses.
+func (v VerifiedCrawler) Source() verifiedcrawler.Source {
+	// XXX: already validated in Valid()
+	refresh, _ := time.ParseDuration(v.Refresh)
+
+	return verifiedcrawler.Source{
+		Name:    v.Name,
+		URL:     v.URL,
+		File:    v.File,
+		Refresh: refresh,
+	}
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestVerifiedCrawlerValid(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		input VerifiedCrawler
+		err   error
+	}{
+		{
+			name:  "built-in",
+			input: VerifiedCrawler{Name: "googlebot"},
+		},
+		{
+			name:  "built-in with refresh",
+			input: VerifiedCrawler{Name: "bingbot", Refresh: "6h"},
+		},
+		{
+			name:  "url",
+			input: VerifiedCrawler{Name: "examplebot", URL: "https://example.com/examplebot.json"},
+		},
+		{
+			name:  "file",
+			input: VerifiedCrawler{Name: "examplebot", File: "/etc/anubis/examplebot.txt"},
+		},
+		{
+			name:  "bad name",
+			input: VerifiedCrawler{Name: "Example Bot", URL: "https://example.com/examplebot.json"},
+			err:   ErrVerifiedCrawlerBadName,
+		},
+		{
+			name:  "no source",
+			input: VerifiedCrawler{Name: "examplebot"},
+			err:   ErrVerifiedCrawlerNoSource,
+		},
+		{
+			name:  "url and file",
+			input: VerifiedCrawler{Name: "examplebot", URL: "https://example.com/examplebot.json", File: "/etc/anubis/examplebot.txt"},
+			err:   ErrVerifiedCrawlerURLAndFile,
+		},
+		{
+			name:  "bad url",
+			input: VerifiedCrawler{Name: "examplebot", URL: "ftp://example.com/examplebot.json"},
+			err:   ErrVerifiedCrawlerBadURL,
+		},
+		{
+			name:  "bad refresh",
+			input: VerifiedCrawler{Name: "googlebot", Refresh: "-1h"},
+			err:   ErrVerifiedCrawlerBadRefresh,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.input.Valid(); !errors.Is(err, tt.err) {
+				t.Logf("want: %v", tt.err)
+				t.Logf("got:  %v", err)
+				t.Fatal("got wrong validation error")
+			}
+		})
+	}
+}
+
+func TestVerifiedCrawlerSource(t *testing.T) {
+	src := VerifiedCrawler{Name: "examplebot", URL: "https://example.com/examplebot.json", Refresh: "1h"}.Source()
+
+	if src.Name != "examplebot" || src.URL != "https://example.com/examplebot.json" || src.Refresh != time.Hour {
+		t.Errorf("wrong source: %+v", src)
+	}
+}
@@ -2,17 +2,28 @@ package lib
 
 import (
 	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/TecharoHQ/anubis"
+	"github.com/TecharoHQ/anubis/internal"
+	"github.com/TecharoHQ/anubis/lib/challenge"
 	"github.com/TecharoHQ/anubis/lib/policy"
 	"github.com/TecharoHQ/anubis/lib/thoth/thothmock"
 )
 
 func TestInvalidChallengeMethod(t *testing.T) {
-	if _, err := LoadPoliciesOrDefault(t.Context(), "testdata/invalid-challenge-method.yaml", 4, "info"); !errors.Is(err, policy.ErrChallengeRuleHasWrongAlgorithm) {
+	pol, err := LoadPoliciesOrDefault(t.Context(), "testdata/invalid-challenge-method.yaml", 4, "info")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := New(Options{Next: http.NewServeMux(), Policy: pol}); !errors.Is(err, policy.ErrChallengeRuleHasWrongAlgorithm) {
 		t.Fatalf("wanted error %v but got %v", policy.ErrChallengeRuleHasWrongAlgorithm, err)
 	}
 }
@@ -59,3 +70,102 @@ func TestGoodConfigs(t *testing.T) {
 		})
 	}
 }
+
+func TestServersWithDifferentSettings(t *testing.T) {
+	pol := loadPolicies(t, "./testdata/aggressive_403.yaml", 4)
+
+	for _, cs := range []struct {
+		basePrefix, testCookieName string
+	}{
+		{basePrefix: "/a", testCookieName: "a-cookie-verification"},
+		{basePrefix: "/b", testCookieName: "b-cookie-verification"},
+	} {
+		t.Run(cs.basePrefix, func(t *testing.T) {
+			srv := spawnAnubis(t, Options{
+				Next:           http.NewServeMux(),
+				Policy:         pol,
+				BasePrefix:     cs.basePrefix,
+				CookieName:     cs.basePrefix + "-auth",
+				TestCookieName: cs.testCookieName,
+			})
+
+			ts := httptest.NewServer(internal.RemoteXRealIP(true, "tcp", srv))
+			defer ts.Close()
+
+			req, err := http.NewRequest(http.MethodGet, ts.URL+"/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("User-Agent", "CHALLENGE")
+
+			resp, err := ts.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, want := range []string{
+				cs.basePrefix + "/.within.website/x/cmd/anubis/static/",
+				cs.basePrefix + "/.within.website/x/cmd/anubis/api/honeypot/",
+			} {
+				if !strings.Contains(string(body), want) {
+					t.Errorf("wanted challenge page to link to %s", want)
+				}
+			}
+
+			var found bool
+			for _, ckie := range resp.Cookies() {
+				if ckie.Name == cs.testCookieName {
+					found = true
+				}
+			}
+
+			if !found {
+				t.Errorf("wanted cookie %s to be set, got: %v", cs.testCookieName, resp.Cookies())
+			}
+		})
+	}
+}
+
+func TestChallengesOption(t *testing.T) {
+	pol := loadPolicies(t, "./testdata/aggressive_403.yaml", 4)
+
+	metarefresh, ok := challenge.Get("metarefresh")
+	if !ok {
+		t.Fatal("metarefresh is not registered")
+	}
+
+	_, err := New(Options{
+		Next:       http.NewServeMux(),
+		Policy:     pol,
+		Challenges: map[string]challenge.Impl{"metarefresh": metarefresh},
+	})
+	if !errors.Is(err, policy.ErrChallengeRuleHasWrongAlgorithm) {
+		t.Errorf("wanted %v for a policy using a method the server doesn't have, got: %v", policy.ErrChallengeRuleHasWrongAlgorithm, err)
+	}
+}
+
+func TestChallengesOptionCustomMethod(t *testing.T) {
+	pol, err := LoadPoliciesOrDefault(t.Context(), "testdata/invalid-challenge-method.yaml", 4, "info")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metarefresh, ok := challenge.Get("metarefresh")
+	if !ok {
+		t.Fatal("metarefresh is not registered")
+	}
+
+	if _, err := New(Options{
+		Next:       http.NewServeMux(),
+		Policy:     pol,
+		Challenges: map[string]challenge.Impl{"hunter2": metarefresh},
+	}); err != nil {
+		t.Errorf("wanted a method only registered in Options.Challenges to be accepted, got: %v", err)
+	}
+}
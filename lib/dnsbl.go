@@ -0,0 +1,213 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/TecharoHQ/anubis/internal/dnsbl"
+	"github.com/TecharoHQ/anubis/lib/config"
+	"github.com/TecharoHQ/anubis/lib/localization"
+	"github.com/TecharoHQ/anubis/lib/policy"
+	"github.com/TecharoHQ/anubis/lib/store"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/sync/singleflight"
+)
+
+var (
+	droneBLHits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "anubis_dronebl_hits",
+		Help: "The total number of hits from DroneBL",
+	}, []string{"status"})
+
+	dnsblLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "anubis_dnsbl_lookups_total",
+		Help: "The total number of DNSBL lookups by zone and result",
+	}, []string{"zone", "result"})
+
+	dnsblLookupDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "anubis_dnsbl_lookup_duration_seconds",
+		Help:    "How long DNSBL lookups take by zone and result",
+		Buckets: prometheus.ExponentialBuckets(0.005, 2, 12),
+	}, []string{"zone", "result"})
+
+	dnsblUnknown = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "anubis_dnsbl_unknown_total",
+		Help: "The total number of requests handled under a DNSBL's unknown policy while its lookup was running",
+	}, []string{"zone"})
+)
+
+// withDNSBL attaches the results of looking the client up in every DNSBL in
+// the policy to r, so that CEL expressions can use them with dnsblListed.
+// Results come from the store when they are cached. Otherwise a lookup is
+// started in the background, shared with every other request from the same
+// client, and the list's unknown policy decides the result for this request.
+func (s *Server) withDNSBL(r *http.Request, lg *slog.Logger) *http.Request {
+	if len(s.policy.DNSBLs) == 0 {
+		return r
+	}
+
+	if _, ok := dnsbl.ResultsFrom(r.Context()); ok {
+		return r
+	}
+
+	ip := net.ParseIP(r.Header.Get("X-Real-Ip"))
+	if ip == nil {
+		return r
+	}
+
+	ctx := r.Context()
+	results := make([]dnsbl.Result, len(s.policy.DNSBLs))
+	pending := map[int]<-chan singleflight.Result{}
+
+	for i, d := range s.policy.DNSBLs {
+		result, err := dnsblCache(s.store, d).Get(ctx, ip.String())
+		if err == nil {
+			// A lookup that failed recently is treated like one that is
+			// still running, without waiting for it.
+			if result.Failed && d.Unknown == config.DNSBLUnknownListed {
+				result.Listed = true
+				result.Reason = "lookup failed"
+			}
+
+			results[i] = result
+			continue
+		}
+
+		pending[i] = s.dnsblFlight.DoChan(d.Zone+":"+ip.String(), func() (any, error) {
+			return s.lookupDNSBL(d, ip, lg)
+		})
+	}
+
+	for i, ch := range pending {
+		d := s.policy.DNSBLs[i]
+		results[i] = dnsbl.Result{Zone: d.Zone}
+
+		switch d.Unknown {
+		case config.DNSBLUnknownWait:
+			select {
+			case res := <-ch:
+				if res.Err == nil && !res.Val.(dnsbl.Result).Failed {
+					results[i] = res.Val.(dnsbl.Result)
+				}
+			case <-ctx.Done():
+			}
+		case config.DNSBLUnknownListed:
+			dnsblUnknown.WithLabelValues(d.Zone).Inc()
+			results[i].Listed = true
+			results[i].Reason = "lookup pending"
+		default:
+			dnsblUnknown.WithLabelValues(d.Zone).Inc()
+		}
+	}
+
+	return r.WithContext(dnsbl.WithResults(ctx, results))
+}
+
+// dnsblCache stores the lookup results of d by client IP address.
+func dnsblCache(st store.Interface, d config.DNSBL) *store.JSON[dnsbl.Result] {
+	return &store.JSON[dnsbl.Result]{Underlying: st, Prefix: "dnsbl:" + d.Zone + ":"}
+}
+
+// lookupDNSBL looks ip up in d and caches the result. Failed lookups are
+// cached for config.DNSBLFailureTTL with Failed set. It doesn't use the
+// request's context so that it can outlive the request that started it; the
+// list's timeout bounds how long it takes.
+func (s *Server) lookupDNSBL(d config.DNSBL, ip net.IP, lg *slog.Logger) (dnsbl.Result, error) {
+	ctx := context.Background()
+	db := dnsblCache(s.store, d)
+
+	lg.Debug("looking up ip in dnsbl", "zone", d.Zone)
+	start := time.Now()
+	result, err := d.List().Lookup(ctx, s.resolver, ip)
+	elapsed := time.Since(start)
+
+	if err != nil {
+		lg.Error("can't look up ip in dnsbl", "zone", d.Zone, "err", err)
+		dnsblLookups.WithLabelValues(d.Zone, "error").Inc()
+		dnsblLookupDuration.WithLabelValues(d.Zone, "error").Observe(elapsed.Seconds())
+
+		result = dnsbl.Result{Zone: d.Zone, Failed: true}
+		if err := db.Set(ctx, ip.String(), result, config.DNSBLFailureTTL); err != nil {
+			lg.Error("can't cache dnsbl failure", "zone", d.Zone, "err", err)
+		}
+
+		return result, nil
+	}
+
+	status := "not_listed"
+	if result.Listed {
+		status = "listed"
+	}
+	dnsblLookups.WithLabelValues(d.Zone, status).Inc()
+	dnsblLookupDuration.WithLabelValues(d.Zone, status).Observe(elapsed.Seconds())
+
+	if d.Zone == dnsbl.DroneBLZone {
+		status := dnsbl.AllGood.String()
+		if result.Listed {
+			status = result.Reason
+		}
+		droneBLHits.WithLabelValues(status).Inc()
+	}
+
+	if err := db.Set(ctx, ip.String(), result, d.TTLDuration()); err != nil {
+		lg.Error("can't cache dnsbl result", "zone", d.Zone, "err", err)
+	}
+
+	return result, nil
+}
+
+// dnsblWeight returns the weight the client gets from DNSBLs with the WEIGH
+// action that it is listed in.
+func (s *Server) dnsblWeight(r *http.Request, lg *slog.Logger) int {
+	results, _ := dnsbl.ResultsFrom(r.Context())
+
+	weight := 0
+	for i, result := range results {
+		d := s.policy.DNSBLs[i]
+		if !result.Listed || d.Action != config.RuleWeigh {
+			continue
+		}
+
+		lg.Debug("adjusting weight", "dnsbl", d.Zone, "reason", result.Reason, "delta", d.Weight.Adjust)
+		policy.Applications.WithLabelValues("dnsbl/"+d.Zone, string(config.RuleWeigh)).Add(1)
+		weight += d.Weight.Adjust
+	}
+
+	return weight
+}
+
+// handleDNSBL denies the request if the client is listed in a DNSBL with the
+// DENY action. It returns true if it responded.
+func (s *Server) handleDNSBL(w http.ResponseWriter, r *http.Request, lg *slog.Logger) bool {
+	results, _ := dnsbl.ResultsFrom(r.Context())
+
+	for i, result := range results {
+		d := s.policy.DNSBLs[i]
+		if !result.Listed || d.Action != config.RuleDeny {
+			continue
+		}
+
+		lg.Info("DNSBL hit", "zone", d.Zone, "status", result.Reason)
+		policy.Applications.WithLabelValues("dnsbl/"+d.Zone, string(config.RuleDeny)).Add(1)
+		localizer := localization.GetLocalizer(r)
+
+		msg := fmt.Sprintf("%s: %s (%s)", localizer.T("access_denied"), result.Reason, d.Zone)
+		if d.Zone == dnsbl.DroneBLZone {
+			msg = fmt.Sprintf("%s: %s, %s https://dronebl.org/lookup?ip=%s",
+				localizer.T("dronebl_entry"),
+				result.Reason,
+				localizer.T("see_dronebl_lookup"),
+				r.Header.Get("X-Real-Ip"))
+		}
+
+		s.respondWithStatus(w, r, msg, "", s.policy.StatusCodes.Deny)
+		return true
+	}
+
+	return false
+}
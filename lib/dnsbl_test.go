@@ -0,0 +1,270 @@
+package lib
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeDNSBL lists the addresses in it in every zone they are mapped to.
+type fakeDNSBL map[string][]string
+
+func (fd fakeDNSBL) LookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	for ip, zones := range fd {
+		for _, zone := range zones {
+			if host == reverseIP(ip)+"."+zone {
+				return []net.IP{net.ParseIP("127.0.0.2")}, nil
+			}
+		}
+	}
+
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func reverseIP(ip string) string {
+	p := net.ParseIP(ip).To4()
+	return net.IPv4(p[3], p[2], p[1], p[0]).String()
+}
+
+func TestDNSBL(t *testing.T) {
+	pol := loadPolicies(t, "./testdata/dnsbl.yaml", 4)
+
+	srv := spawnAnubis(t, Options{
+		Next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+		Policy: pol,
+	})
+	srv.resolver = fakeDNSBL{
+		"192.0.2.1": {"deny.example"},
+		"192.0.2.2": {"weigh.example"},
+		"192.0.2.3": {"cel.example"},
+	}
+
+	for _, tt := range []struct {
+		name string
+		ip   string
+		want int
+		rule string
+	}{
+		{
+			name: "not listed",
+			ip:   "192.0.2.10",
+			want: http.StatusOK,
+			rule: "threshold/everyone-else",
+		},
+		{
+			name: "deny list",
+			ip:   "192.0.2.1",
+			want: http.StatusForbidden,
+		},
+		{
+			name: "weigh list",
+			ip:   "192.0.2.2",
+			want: http.StatusUnauthorized,
+			rule: "threshold/suspicious",
+		},
+		{
+			name: "dnsblListed in CEL",
+			ip:   "192.0.2.3",
+			want: http.StatusForbidden,
+			rule: "bot/cel-listed",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			// run twice so the second request uses the cached results
+			for range 2 {
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				req.Header.Set("User-Agent", "Mozilla/5.0")
+				req.Header.Set("X-Real-Ip", tt.ip)
+
+				rec := httptest.NewRecorder()
+				srv.ServeAuthCheck(rec, req)
+
+				if rec.Code != tt.want {
+					t.Logf("want: %d", tt.want)
+					t.Logf("got:  %d", rec.Code)
+					t.Error("wrong status code")
+				}
+
+				if tt.rule != "" && req.Header.Get("X-Anubis-Rule") != tt.rule {
+					t.Logf("want: %s", tt.rule)
+					t.Logf("got:  %s", req.Header.Get("X-Anubis-Rule"))
+					t.Error("wrong rule")
+				}
+			}
+		})
+	}
+}
+
+// gatedDNSBL counts lookups and holds them until gate is closed.
+type gatedDNSBL struct {
+	fakeDNSBL
+	gate  chan struct{}
+	calls atomic.Int64
+}
+
+func (gd *gatedDNSBL) LookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	gd.calls.Add(1)
+
+	select {
+	case <-gd.gate:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	return gd.fakeDNSBL.LookupIP(ctx, network, host)
+}
+
+func dnsblStatus(t *testing.T, srv *Server, ip string) int {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("User-Agent", "Mozilla/5.0")
+	req.Header.Set("X-Real-Ip", ip)
+
+	rec := httptest.NewRecorder()
+	srv.ServeAuthCheck(rec, req)
+
+	return rec.Code
+}
+
+func waitForDNSBLCache(t *testing.T, srv *Server, zone, ip string) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := srv.store.Get(t.Context(), "dnsbl:"+zone+":"+ip); err == nil {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	t.Fatalf("result for %s in %s was never cached", ip, zone)
+}
+
+func TestDNSBLUnknown(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		fname  string
+		ip     string
+		first  int
+		second int
+	}{
+		{
+			name:   "not_listed lets the first request through",
+			fname:  "./testdata/dnsbl-unknown-not_listed.yaml",
+			ip:     "192.0.2.1",
+			first:  http.StatusOK,
+			second: http.StatusForbidden,
+		},
+		{
+			name:   "listed denies the first request",
+			fname:  "./testdata/dnsbl-unknown-listed.yaml",
+			ip:     "192.0.2.10",
+			first:  http.StatusForbidden,
+			second: http.StatusOK,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			pol := loadPolicies(t, tt.fname, 4)
+
+			srv := spawnAnubis(t, Options{
+				Next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusOK)
+				}),
+				Policy: pol,
+			})
+
+			res := &gatedDNSBL{
+				fakeDNSBL: fakeDNSBL{"192.0.2.1": {"deny.example"}},
+				gate:      make(chan struct{}),
+			}
+			srv.resolver = res
+
+			// every request before the lookup finishes shares it
+			for range 10 {
+				if got := dnsblStatus(t, srv, tt.ip); got != tt.first {
+					t.Logf("want: %d", tt.first)
+					t.Logf("got:  %d", got)
+					t.Fatal("wrong status code while the lookup is running")
+				}
+			}
+
+			close(res.gate)
+			waitForDNSBLCache(t, srv, "deny.example", tt.ip)
+
+			if got := dnsblStatus(t, srv, tt.ip); got != tt.second {
+				t.Logf("want: %d", tt.second)
+				t.Logf("got:  %d", got)
+				t.Error("wrong status code after the lookup finished")
+			}
+
+			if calls := res.calls.Load(); calls != 1 {
+				t.Errorf("wanted 1 lookup, got: %d", calls)
+			}
+		})
+	}
+}
+
+// brokenDNSBL counts lookups and fails all of them.
+type brokenDNSBL struct {
+	calls atomic.Int64
+}
+
+func (bd *brokenDNSBL) LookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	bd.calls.Add(1)
+	return nil, &net.DNSError{Err: "server misbehaving", Name: host, IsTemporary: true}
+}
+
+func TestDNSBLFailureCached(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		fname string
+		want  int
+	}{
+		{
+			name:  "not_listed lets requests through",
+			fname: "./testdata/dnsbl-unknown-not_listed.yaml",
+			want:  http.StatusOK,
+		},
+		{
+			name:  "listed denies requests",
+			fname: "./testdata/dnsbl-unknown-listed.yaml",
+			want:  http.StatusForbidden,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			pol := loadPolicies(t, tt.fname, 4)
+
+			srv := spawnAnubis(t, Options{
+				Next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusOK)
+				}),
+				Policy: pol,
+			})
+
+			res := &brokenDNSBL{}
+			srv.resolver = res
+
+			dnsblStatus(t, srv, "192.0.2.1")
+			waitForDNSBLCache(t, srv, "deny.example", "192.0.2.1")
+
+			for range 10 {
+				if got := dnsblStatus(t, srv, "192.0.2.1"); got != tt.want {
+					t.Logf("want: %d", tt.want)
+					t.Logf("got:  %d", got)
+					t.Fatal("wrong status code after the lookup failed")
+				}
+			}
+
+			if calls := res.calls.Load(); calls != 1 {
+				t.Errorf("wanted the failed lookup to be cached, got %d lookups", calls)
+			}
+		})
+	}
+}
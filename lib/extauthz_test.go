@@ -0,0 +1,124 @@
+package lib
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/TecharoHQ/anubis/internal"
+	"github.com/TecharoHQ/anubis/internal/extauthz"
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+)
+
+func extAuthzRequest(userAgent string) *authv3.CheckRequest {
+	return &authv3.CheckRequest{
+		Attributes: &authv3.AttributeContext{
+			Source: &authv3.AttributeContext_Peer{
+				Address: &corev3.Address{
+					Address: &corev3.Address_SocketAddress{
+						SocketAddress: &corev3.SocketAddress{
+							Address:       "192.0.2.1",
+							PortSpecifier: &corev3.SocketAddress_PortValue{PortValue: 1234},
+						},
+					},
+				},
+			},
+			Request: &authv3.AttributeContext_Request{
+				Http: &authv3.AttributeContext_HttpRequest{
+					Method:   http.MethodGet,
+					Scheme:   "https",
+					Host:     "example.com",
+					Path:     "/foo?bar=baz",
+					Protocol: "HTTP/2",
+					Headers: map[string]string{
+						":authority":      "example.com",
+						"user-agent":      userAgent,
+						"accept-encoding": "gzip",
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestExtAuthz(t *testing.T) {
+	pol := loadPolicies(t, "./testdata/aggressive_403.yaml", 4)
+
+	srv := spawnAnubis(t, Options{
+		Next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("ext_authz checks must not be proxied to the upstream")
+		}),
+		Policy:    pol,
+		PublicUrl: "https://anubis.example.com",
+	})
+
+	ea := extauthz.New(internal.RemoteXRealIP(true, "tcp", http.HandlerFunc(srv.ServeAuthCheck)))
+
+	t.Run("allow", func(t *testing.T) {
+		resp, err := ea.Check(t.Context(), extAuthzRequest("ALLOW"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ok := resp.GetOkResponse()
+		if ok == nil {
+			t.Fatalf("wanted request to be allowed, got: %v", resp)
+		}
+
+		headers := map[string]string{}
+		for _, hv := range ok.GetHeaders() {
+			headers[hv.GetHeader().GetKey()] = hv.GetHeader().GetValue()
+		}
+
+		if headers["X-Anubis-Action"] != "ALLOW" {
+			t.Errorf("wanted X-Anubis-Action to be ALLOW, got: %v", headers)
+		}
+	})
+
+	t.Run("deny", func(t *testing.T) {
+		resp, err := ea.Check(t.Context(), extAuthzRequest("DENY"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		denied := resp.GetDeniedResponse()
+		if denied == nil {
+			t.Fatalf("wanted request to be denied, got: %v", resp)
+		}
+
+		if code := int(denied.GetStatus().GetCode()); code != http.StatusForbidden {
+			t.Errorf("wanted status %d, got: %d", http.StatusForbidden, code)
+		}
+	})
+
+	t.Run("challenge", func(t *testing.T) {
+		resp, err := ea.Check(t.Context(), extAuthzRequest("CHALLENGE"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		denied := resp.GetDeniedResponse()
+		if denied == nil {
+			t.Fatalf("wanted request to be denied, got: %v", resp)
+		}
+
+		if code := int(denied.GetStatus().GetCode()); code != http.StatusTemporaryRedirect {
+			t.Errorf("wanted status %d, got: %d", http.StatusTemporaryRedirect, code)
+		}
+
+		var location string
+		for _, hv := range denied.GetHeaders() {
+			if hv.GetHeader().GetKey() == "Location" {
+				location = hv.GetHeader().GetValue()
+			}
+		}
+
+		want := "https://anubis.example.com/.within.website/?redir=https%3A%2F%2Fexample.com%2Ffoo%3Fbar%3Dbaz"
+		if !strings.HasPrefix(location, want) {
+			t.Logf("want: %s", want)
+			t.Logf("got:  %s", location)
+			t.Error("wrong redirect")
+		}
+	})
+}
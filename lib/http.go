@@ -3,6 +3,7 @@ package lib
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"encoding/base64"
 	"errors"
 	"fmt"
@@ -10,12 +11,15 @@ import (
 	"net/http"
 	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/TecharoHQ/anubis"
 	"github.com/TecharoHQ/anubis/internal"
+	"github.com/TecharoHQ/anubis/internal/authcheck"
 	"github.com/TecharoHQ/anubis/internal/glob"
+	"github.com/TecharoHQ/anubis/internal/upstream"
 	"github.com/TecharoHQ/anubis/lib/challenge"
 	"github.com/TecharoHQ/anubis/lib/localization"
 	"github.com/TecharoHQ/anubis/lib/policy"
@@ -62,7 +66,7 @@ type CookieOpts struct {
 
 func (s *Server) SetCookie(w http.ResponseWriter, cookieOpts CookieOpts) {
 	var domain = s.opts.CookieDomain
-	var name = anubis.CookieName
+	var name = s.settings.CookieName
 	var path = "/"
 	var sameSite = s.opts.CookieSameSite
 
@@ -100,7 +104,7 @@ func (s *Server) SetCookie(w http.ResponseWriter, cookieOpts CookieOpts) {
 
 func (s *Server) ClearCookie(w http.ResponseWriter, cookieOpts CookieOpts) {
 	var domain = s.opts.CookieDomain
-	var name = anubis.CookieName
+	var name = s.settings.CookieName
 	var path = "/"
 	var sameSite = s.opts.CookieSameSite
 
@@ -132,21 +136,8 @@ func (s *Server) ClearCookie(w http.ResponseWriter, cookieOpts CookieOpts) {
 	})
 }
 
-// https://github.com/oauth2-proxy/oauth2-proxy/blob/master/pkg/upstream/http.go#L124
-type UnixRoundTripper struct {
-	Transport *http.Transport
-}
-
-// set bare minimum stuff
-func (t UnixRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
-	req = req.Clone(req.Context())
-	if req.Host == "" {
-		req.Host = "localhost"
-	}
-	req.URL.Host = req.Host // proxy error: no Host in request URL
-	req.URL.Scheme = "http" // make http.Transport happy and avoid an infinite recursion
-	return t.Transport.RoundTrip(req)
-}
+// UnixRoundTripper is kept for API compatibility. Use upstream.UnixRoundTripper.
+type UnixRoundTripper = upstream.UnixRoundTripper
 
 func randomChance(n int) bool {
 	return rand.Intn(n) == 0
@@ -195,6 +186,11 @@ func makeCode(err error) string {
 func (s *Server) RenderIndex(w http.ResponseWriter, r *http.Request, cr policy.CheckResult, rule *policy.Bot, returnHTTPStatusOnly bool) {
 	localizer := localization.GetLocalizer(r)
 
+	if isUpgrade(r) {
+		respondToUpgrade(w, localizer.T("authorization_required"), http.StatusUnauthorized)
+		return
+	}
+
 	if returnHTTPStatusOnly {
 		if s.opts.PublicUrl == "" {
 			w.WriteHeader(http.StatusUnauthorized)
@@ -222,7 +218,7 @@ func (s *Server) RenderIndex(w http.ResponseWriter, r *http.Request, cr policy.C
 	chall, err := s.issueChallenge(r.Context(), r, lg, cr, rule)
 	if err != nil {
 		lg.Error("can't get challenge", "err", err)
-		s.ClearCookie(w, CookieOpts{Name: anubis.TestCookieName, Host: r.Host})
+		s.ClearCookie(w, CookieOpts{Name: s.settings.TestCookieName, Host: r.Host})
 		s.respondWithError(w, r, fmt.Sprintf("%s: %s", localizer.T("internal_server_error"), rule.Challenge.Algorithm), makeCode(err))
 		return
 	}
@@ -242,14 +238,14 @@ func (s *Server) RenderIndex(w http.ResponseWriter, r *http.Request, cr policy.C
 		Value:  chall.ID,
 		Host:   r.Host,
 		Path:   "/",
-		Name:   anubis.TestCookieName,
+		Name:   s.settings.TestCookieName,
 		Expiry: 30 * time.Minute,
 	})
 
-	impl, ok := challenge.Get(chall.Method)
+	impl, ok := s.challenge(chall.Method)
 	if !ok {
 		lg.Error("check failed", "err", "can't get algorithm", "algorithm", rule.Challenge.Algorithm)
-		s.ClearCookie(w, CookieOpts{Name: anubis.TestCookieName, Host: r.Host})
+		s.ClearCookie(w, CookieOpts{Name: s.settings.TestCookieName, Host: r.Host})
 		s.respondWithError(w, r, fmt.Sprintf("%s: %s", localizer.T("internal_server_error"), rule.Challenge.Algorithm), makeCode(err))
 		return
 	}
@@ -331,23 +327,63 @@ func (s *Server) respondWithError(w http.ResponseWriter, r *http.Request, messag
 }
 
 func (s *Server) respondWithStatus(w http.ResponseWriter, r *http.Request, msg, code string, status int) {
+	if isUpgrade(r) {
+		respondToUpgrade(w, msg, status)
+		return
+	}
+
 	localizer := localization.GetLocalizer(r)
 
 	templ.Handler(web.Base(localizer.T("oh_noes"), web.ErrorPage(msg, s.opts.WebmasterEmail, code, localizer), s.policy.Impressum, localizer), templ.WithStatus(status)).ServeHTTP(w, r)
 }
 
+// respondWithUpstreamError renders the error page when the upstream can't be
+// reached.
+func (s *Server) respondWithUpstreamError(w http.ResponseWriter, r *http.Request, err error) {
+	// The client went away, there is no one left to show the error page to.
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+
+	route := upstream.RouteName(r.Context())
+	if route == "" {
+		route = defaultRoute
+	}
+
+	lg := internal.GetRequestLogger(s.logger, r)
+	lg.Error("can't reach upstream", "route", route, "err", err)
+	upstreamErrors.WithLabelValues(r.Host, route).Inc()
+
+	localizer := localization.GetLocalizer(r)
+	msg := localizer.T("upstream_unavailable")
+
+	if ue := s.policy.UpstreamError; ue != nil {
+		if ue.Message != "" {
+			msg = ue.Message
+		}
+
+		if secs := ue.RetryAfterSeconds(); secs != 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(secs))
+		}
+	}
+
+	s.respondWithStatus(w, r, msg, "", http.StatusBadGateway)
+}
+
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if strings.HasPrefix(r.URL.Path, anubis.BasePrefix+anubis.StaticPath) {
+	r = s.withSettings(r)
+
+	if strings.HasPrefix(r.URL.Path, s.settings.BasePrefix+anubis.StaticPath) {
 		s.mux.ServeHTTP(w, r)
 		return
-	} else if strings.HasPrefix(r.URL.Path, anubis.BasePrefix+xess.BasePrefix) {
+	} else if strings.HasPrefix(r.URL.Path, s.settings.BasePrefix+xess.BasePrefix) {
 		s.mux.ServeHTTP(w, r)
 		return
 	}
 
 	// Forward robots.txt requests to mux when ServeRobotsTXT is enabled
 	if s.opts.ServeRobotsTXT {
-		path := strings.TrimPrefix(r.URL.Path, anubis.BasePrefix)
+		path := strings.TrimPrefix(r.URL.Path, s.settings.BasePrefix)
 		if path == "/robots.txt" || path == "/.well-known/robots.txt" {
 			s.mux.ServeHTTP(w, r)
 			return
@@ -384,6 +420,10 @@ func (s *Server) stripBasePrefixFromRequest(r *http.Request) *http.Request {
 }
 
 func (s *Server) ServeHTTPNext(w http.ResponseWriter, r *http.Request) {
+	if authcheck.Allow(r) {
+		return
+	}
+
 	if s.next == nil {
 		localizer := localization.GetLocalizer(r)
 
@@ -432,6 +472,10 @@ func (s *Server) ServeHTTPNext(w http.ResponseWriter, r *http.Request) {
 	} else {
 		requestsProxied.WithLabelValues(r.Host).Inc()
 		r = s.stripBasePrefixFromRequest(r)
+		r = r.WithContext(upstream.WithErrorHandler(r.Context(), s.respondWithUpstreamError))
+		if isUpgrade(r) {
+			w = trackUpgrade(w, r)
+		}
 		s.next.ServeHTTP(w, r)
 	}
 }
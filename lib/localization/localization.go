@@ -127,10 +127,10 @@ func (sl *SimpleLocalizer) GetLang() string {
 // GetLocalizer creates a localizer based on the request's Accept-Language header or forcedLanguage option
 func GetLocalizer(r *http.Request) *SimpleLocalizer {
 	var localizer *i18n.Localizer
-	if anubis.ForcedLanguage == "" {
+	if lang := anubis.SettingsFrom(r.Context()).ForcedLanguage; lang == "" {
 		localizer = NewLocalizationService().GetLocalizerFromRequest(r)
 	} else {
-		localizer = NewLocalizationService().GetLocalizer(anubis.ForcedLanguage)
+		localizer = NewLocalizationService().GetLocalizer(lang)
 	}
 	return &SimpleLocalizer{Localizer: localizer}
 }
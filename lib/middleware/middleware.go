@@ -0,0 +1,117 @@
+// Package middleware builds Anubis servers that run inside other web servers
+// instead of as a reverse proxy, such as the Caddy module and the Traefik
+// plugin.
+package middleware
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/TecharoHQ/anubis"
+	"github.com/TecharoHQ/anubis/internal"
+	libanubis "github.com/TecharoHQ/anubis/lib"
+)
+
+var (
+	ErrBadBasePrefix = errors.New("middleware: base prefix must start with a slash and must not end with one")
+	ErrBadPrivateKey = errors.New("middleware: ed25519 private key must be a hex-encoded 32 byte seed")
+)
+
+// Config is the part of the Anubis configuration that makes sense for a
+// middleware. Everything else comes from the policy file.
+type Config struct {
+	// PolicyFile is the path to the policy file. The built-in policy is used
+	// if it is empty.
+	PolicyFile string
+
+	// Difficulty is the default challenge difficulty, anubis.DefaultDifficulty
+	// if zero.
+	Difficulty int
+
+	BasePrefix      string
+	PublicUrl       string
+	RedirectDomains []string
+	ServeRobotsTXT  bool
+	ForcedLanguage  string
+
+	CookieDomain string
+	// CookiePrefix is the prefix of the cookie names, like the cookie-prefix
+	// flag. The package defaults are used if it is empty.
+	CookiePrefix string
+	// InsecureCookies stops setting the Secure flag on cookies.
+	InsecureCookies bool
+
+	// ED25519PrivateKeyHex is the hex-encoded seed of the key used to sign
+	// JWTs. A random key is generated if it is empty, which invalidates every
+	// client's cookie when the server restarts.
+	ED25519PrivateKeyHex string
+
+	Logger *slog.Logger
+}
+
+// New creates an Anubis server that sends allowed requests to next. The
+// client's IP address is taken from the request's remote address.
+func New(ctx context.Context, cfg Config, next http.Handler) (http.Handler, error) {
+	if cfg.Difficulty == 0 {
+		cfg.Difficulty = anubis.DefaultDifficulty
+	}
+
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+
+	if cfg.BasePrefix != "" && (!strings.HasPrefix(cfg.BasePrefix, "/") || strings.HasSuffix(cfg.BasePrefix, "/")) {
+		return nil, fmt.Errorf("%w: %q", ErrBadBasePrefix, cfg.BasePrefix)
+	}
+
+	var priv ed25519.PrivateKey
+	if cfg.ED25519PrivateKeyHex != "" {
+		seed, err := hex.DecodeString(cfg.ED25519PrivateKeyHex)
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, ErrBadPrivateKey
+		}
+		priv = ed25519.NewKeyFromSeed(seed)
+	} else {
+		cfg.Logger.Warn("no ed25519 private key set, generating a random one")
+	}
+
+	policy, err := libanubis.LoadPoliciesOrDefault(ctx, cfg.PolicyFile, cfg.Difficulty, "INFO")
+	if err != nil {
+		return nil, err
+	}
+
+	opts := libanubis.Options{
+		Next:              next,
+		Policy:            policy,
+		BasePrefix:        cfg.BasePrefix,
+		PublicUrl:         cfg.PublicUrl,
+		RedirectDomains:   cfg.RedirectDomains,
+		ServeRobotsTXT:    cfg.ServeRobotsTXT,
+		ForcedLanguage:    cfg.ForcedLanguage,
+		CookieDomain:      cfg.CookieDomain,
+		CookieExpiration:  anubis.CookieDefaultExpirationTime,
+		CookieSecure:      !cfg.InsecureCookies,
+		CookieSameSite:    http.SameSiteNoneMode,
+		ED25519PrivateKey: priv,
+		OpenGraph:         policy.OpenGraph,
+		Logger:            cfg.Logger,
+	}
+
+	if cfg.CookiePrefix != "" {
+		opts.CookieName = cfg.CookiePrefix + "-auth"
+		opts.TestCookieName = cfg.CookiePrefix + "-cookie-verification"
+	}
+
+	srv, err := libanubis.New(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return internal.RemoteXRealIP(true, "tcp", internal.JA4H(srv)), nil
+}
@@ -2,6 +2,7 @@ package policy
 
 import (
 	"fmt"
+	"net/http"
 
 	"github.com/TecharoHQ/anubis/internal"
 	"github.com/TecharoHQ/anubis/lib/config"
@@ -12,8 +13,29 @@ type Bot struct {
 	Rules     checker.Impl
 	Challenge *config.ChallengeRules
 	Weight    *config.Weight
-	Name      string
-	Action    config.Rule
+
+	// Weigher, if set, picks the weight of a WEIGH rule for each request.
+	// Requests it has no weight for get Weight.
+	Weigher Weigher
+	Name    string
+	Action  config.Rule
+}
+
+// Weigher picks the weight a WEIGH rule adds for a request. It returns false
+// if it has no weight for the request.
+type Weigher interface {
+	Weight(r *http.Request) (int, bool)
+}
+
+// WeightFor returns the weight b adds for r when its action is WEIGH.
+func (b Bot) WeightFor(r *http.Request) int {
+	if b.Weigher != nil {
+		if weight, ok := b.Weigher.Weight(r); ok {
+			return weight
+		}
+	}
+
+	return b.Weight.Adjust
 }
 
 func (b Bot) Hash() string {
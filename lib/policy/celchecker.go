@@ -3,11 +3,18 @@ package policy
 import (
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/TecharoHQ/anubis/internal"
 	"github.com/TecharoHQ/anubis/internal/dns"
+	"github.com/TecharoHQ/anubis/internal/dnsbl"
+	"github.com/TecharoHQ/anubis/internal/hosting"
+	"github.com/TecharoHQ/anubis/internal/iplist"
+	"github.com/TecharoHQ/anubis/internal/verifiedcrawler"
 	"github.com/TecharoHQ/anubis/lib/config"
 	"github.com/TecharoHQ/anubis/lib/policy/expressions"
+	"github.com/TecharoHQ/anubis/lib/thoth"
+	iptoasnv1 "github.com/TecharoHQ/thoth-proto/gen/techaro/thoth/iptoasn/v1"
 	"github.com/google/cel-go/cel"
 	"github.com/google/cel-go/common/types"
 )
@@ -15,10 +22,31 @@ import (
 type CELChecker struct {
 	program cel.Program
 	src     string
+	iptoasn iptoasnv1.IpToASNServiceClient
 }
 
-func NewCELChecker(cfg *config.ExpressionOrList, dnsObj *dns.Dns) (*CELChecker, error) {
-	env, err := expressions.BotEnvironment(dnsObj)
+// CELCheckerOptions are what the expressions of a CELChecker look things up
+// in. Every field may be nil.
+type CELCheckerOptions struct {
+	// DNS, Crawlers and IPLists are passed on to the expressions'
+	// environment, see expressions.BotOptions.
+	DNS      *dns.Dns
+	Crawlers *verifiedcrawler.Registry
+	IPLists  *iplist.Registry
+
+	// IPToASN answers the asn, asnOrg, country, announcedPrefix,
+	// hostingProvider and lookupFailed variables. If it is nil, they are
+	// always empty.
+	IPToASN iptoasnv1.IpToASNServiceClient
+}
+
+// NewCELChecker compiles an expression.
+func NewCELChecker(cfg *config.ExpressionOrList, opts CELCheckerOptions) (*CELChecker, error) {
+	env, err := expressions.BotEnvironment(expressions.BotOptions{
+		DNS:      opts.DNS,
+		Crawlers: opts.Crawlers,
+		IPLists:  opts.IPLists,
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -31,6 +59,7 @@ func NewCELChecker(cfg *config.ExpressionOrList, dnsObj *dns.Dns) (*CELChecker,
 	return &CELChecker{
 		src:     cfg.String(),
 		program: program,
+		iptoasn: opts.IPToASN,
 	}, nil
 }
 
@@ -39,7 +68,12 @@ func (cc *CELChecker) Hash() string {
 }
 
 func (cc *CELChecker) Check(r *http.Request) (bool, error) {
-	result, _, err := cc.program.ContextEval(r.Context(), &CELRequest{r})
+	// Share one IP to ASN lookup between every variable that needs it.
+	if cc.iptoasn != nil {
+		r = r.WithContext(thoth.WithLookupCache(r.Context()))
+	}
+
+	result, _, err := cc.program.ContextEval(r.Context(), &CELRequest{Request: r, IPToASN: cc.iptoasn})
 
 	if err != nil {
 		return false, err
@@ -54,6 +88,11 @@ func (cc *CELChecker) Check(r *http.Request) (bool, error) {
 
 type CELRequest struct {
 	*http.Request
+
+	// IPToASN answers the asn, asnOrg, country, announcedPrefix,
+	// hostingProvider and lookupFailed variables. If it is nil, they are
+	// empty.
+	IPToASN iptoasnv1.IpToASNServiceClient
 }
 
 func (cr *CELRequest) Parent() cel.Activation { return nil }
@@ -82,7 +121,56 @@ func (cr *CELRequest) ResolveName(name string) (any, bool) {
 		return expressions.Load5(), true
 	case "load_15m":
 		return expressions.Load15(), true
+	case "dnsblHits":
+		hits := map[string]string{}
+		results, _ := dnsbl.ResultsFrom(cr.Context())
+		for _, result := range results {
+			if result.Listed {
+				hits[result.Zone] = result.Reason
+			}
+		}
+		return hits, true
+	case "asn":
+		return int64(cr.ipInfo().GetAsNumber()), true
+	case "asnOrg":
+		return cr.ipInfo().GetDescription(), true
+	case "country":
+		return strings.ToUpper(cr.ipInfo().GetCountryCode()), true
+	case "announcedPrefix":
+		if cidrs := cr.ipInfo().GetCidr(); len(cidrs) != 0 {
+			return cidrs[0], true
+		}
+		return "", true
+	case "hostingProvider":
+		ipInfo := cr.ipInfo()
+		if ipInfo == nil {
+			return "", true
+		}
+		provider, _ := hosting.Default().ProviderFor(uint32(ipInfo.GetAsNumber()))
+		return provider, true
+	case "lookupFailed":
+		if cr.IPToASN == nil {
+			return false, true
+		}
+		_, err := thoth.Lookup(cr.Request, cr.IPToASN)
+		return err != nil, true
 	default:
 		return nil, false
 	}
 }
+
+// ipInfo looks up the client's address, or returns nil when there is no IP
+// to ASN client, the lookup fails or the address is not publicly announced.
+// Lookups are shared through the request context, see thoth.WithLookupCache.
+func (cr *CELRequest) ipInfo() *iptoasnv1.LookupResponse {
+	if cr.IPToASN == nil {
+		return nil
+	}
+
+	ipInfo, err := thoth.Lookup(cr.Request, cr.IPToASN)
+	if err != nil || !ipInfo.GetAnnounced() {
+		return nil
+	}
+
+	return ipInfo
+}
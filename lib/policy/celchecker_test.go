@@ -0,0 +1,150 @@
+package policy
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/TecharoHQ/anubis/lib/config"
+	"github.com/TecharoHQ/anubis/lib/thoth/thothmock"
+	iptoasnv1 "github.com/TecharoHQ/thoth-proto/gen/techaro/thoth/iptoasn/v1"
+	"google.golang.org/grpc"
+)
+
+// countingIPToASN counts how many lookups reach the wrapped service.
+type countingIPToASN struct {
+	next  iptoasnv1.IpToASNServiceClient
+	calls atomic.Int64
+}
+
+func (c *countingIPToASN) Lookup(ctx context.Context, lr *iptoasnv1.LookupRequest, opts ...grpc.CallOption) (*iptoasnv1.LookupResponse, error) {
+	c.calls.Add(1)
+	return c.next.Lookup(ctx, lr, opts...)
+}
+
+func TestCELCheckerIPToASN(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		expr    string
+		ip      string
+		noThoth bool
+		want    bool
+	}{
+		{
+			name: "asn",
+			expr: `asn == 13335`,
+			ip:   "1.1.1.1",
+			want: true,
+		},
+		{
+			name: "asnOrg",
+			expr: `asnOrg == "test canada"`,
+			ip:   "2.2.2.2",
+			want: true,
+		},
+		{
+			name: "country",
+			expr: `country == "CA" && path.startsWith("/api")`,
+			ip:   "2.2.2.2",
+			want: true,
+		},
+		{
+			name: "country or asn",
+			expr: `country == "CA" || asn in [13335, 16509]`,
+			ip:   "1.1.1.1",
+			want: true,
+		},
+		{
+			name: "announcedPrefix",
+			expr: `announcedPrefix == "1.1.1.0/24"`,
+			ip:   "1.1.1.1",
+			want: true,
+		},
+		{
+			name: "hostingProvider",
+			expr: `hostingProvider == "amazon-aws"`,
+			ip:   "3.3.3.3",
+			want: true,
+		},
+		{
+			name: "isHostingProvider",
+			expr: `isHostingProvider() && isHostingProvider("amazon-aws") && !isHostingProvider("hetzner")`,
+			ip:   "3.3.3.3",
+			want: true,
+		},
+		{
+			name: "not a hosting provider",
+			expr: `!isHostingProvider() && hostingProvider == ""`,
+			ip:   "2.2.2.2",
+			want: true,
+		},
+		{
+			name: "not announced",
+			expr: `asn == 0 && asnOrg == "" && country == "" && announcedPrefix == "" && hostingProvider == ""`,
+			ip:   "127.0.0.1",
+			want: true,
+		},
+		{
+			name: "lookup error",
+			expr: `asn == 0 && country == "" && lookupFailed`,
+			ip:   "9.9.9.9",
+			want: true,
+		},
+		{
+			name: "lookup error fails closed",
+			expr: `lookupFailed || country != "CA"`,
+			ip:   "9.9.9.9",
+			want: true,
+		},
+		{
+			name: "lookup succeeded",
+			expr: `!lookupFailed && asn == 13335`,
+			ip:   "1.1.1.1",
+			want: true,
+		},
+		{
+			name: "not announced is not a failure",
+			expr: `!lookupFailed && asn == 0`,
+			ip:   "127.0.0.1",
+			want: true,
+		},
+		{
+			name:    "no thoth",
+			expr:    `asn == 0 && country == "" && !lookupFailed`,
+			ip:      "1.1.1.1",
+			noThoth: true,
+			want:    true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			iptoasn := &countingIPToASN{next: thothmock.MockIpToASNService()}
+
+			var client iptoasnv1.IpToASNServiceClient = iptoasn
+			if tt.noThoth {
+				client = nil
+			}
+
+			cc, err := NewCELChecker(&config.ExpressionOrList{Expression: tt.expr}, CELCheckerOptions{IPToASN: client})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := httptest.NewRequest("GET", "/api/v1", nil)
+			r.Header.Set("X-Real-Ip", tt.ip)
+
+			got, err := cc.Check(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tt.want {
+				t.Errorf("wanted %v, got: %v", tt.want, got)
+			}
+
+			if calls := iptoasn.calls.Load(); calls > 1 {
+				t.Errorf("wanted at most one lookup per request, got: %d", calls)
+			}
+		})
+	}
+}
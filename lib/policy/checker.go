@@ -9,6 +9,8 @@ import (
 	"strings"
 
 	"github.com/TecharoHQ/anubis/internal"
+	"github.com/TecharoHQ/anubis/internal/iplist"
+	"github.com/TecharoHQ/anubis/internal/verifiedcrawler"
 	"github.com/TecharoHQ/anubis/lib/policy/checker"
 	"github.com/gaissmai/bart"
 )
@@ -63,6 +65,86 @@ func (rac *RemoteAddrChecker) Hash() string {
 	return rac.hash
 }
 
+// VerifiedCrawlerChecker matches requests from the published IP ranges of a
+// crawler in a verifiedcrawler.Registry.
+type VerifiedCrawlerChecker struct {
+	registry *verifiedcrawler.Registry
+	name     string
+}
+
+func NewVerifiedCrawlerChecker(registry *verifiedcrawler.Registry, name string) (checker.Impl, error) {
+	if !registry.Start(name) {
+		return nil, fmt.Errorf("%w: unknown verified crawler %s", ErrMisconfiguration, name)
+	}
+
+	return &VerifiedCrawlerChecker{
+		registry: registry,
+		name:     name,
+	}, nil
+}
+
+func (vcc *VerifiedCrawlerChecker) Check(r *http.Request) (bool, error) {
+	host := r.Header.Get("X-Real-Ip")
+	if host == "" {
+		return false, fmt.Errorf("%w: header X-Real-Ip is not set", ErrMisconfiguration)
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false, fmt.Errorf("%w: %s is not an IP address: %w", ErrMisconfiguration, host, err)
+	}
+
+	return vcc.registry.Contains(vcc.name, addr), nil
+}
+
+func (vcc *VerifiedCrawlerChecker) Hash() string {
+	return internal.FastHash("verified_crawler: " + vcc.name)
+}
+
+// IPListChecker matches requests from any of a set of lists in an
+// iplist.Registry.
+type IPListChecker struct {
+	registry *iplist.Registry
+	names    []string
+}
+
+func NewIPListChecker(registry *iplist.Registry, names []string) (checker.Impl, error) {
+	for _, name := range names {
+		if !registry.Start(name) {
+			return nil, fmt.Errorf("%w: unknown IP list %s", ErrMisconfiguration, name)
+		}
+	}
+
+	return &IPListChecker{
+		registry: registry,
+		names:    names,
+	}, nil
+}
+
+func (ilc *IPListChecker) Check(r *http.Request) (bool, error) {
+	host := r.Header.Get("X-Real-Ip")
+	if host == "" {
+		return false, fmt.Errorf("%w: header X-Real-Ip is not set", ErrMisconfiguration)
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false, fmt.Errorf("%w: %s is not an IP address: %w", ErrMisconfiguration, host, err)
+	}
+
+	for _, name := range ilc.names {
+		if ilc.registry.Contains(name, addr) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (ilc *IPListChecker) Hash() string {
+	return internal.FastHash("ip_lists: " + strings.Join(ilc.names, ","))
+}
+
 type HeaderMatchesChecker struct {
 	header string
 	regexp *regexp.Regexp
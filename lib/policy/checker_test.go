@@ -2,8 +2,13 @@ package policy
 
 import (
 	"errors"
+	"log/slog"
 	"net/http"
+	"os"
+	"path/filepath"
 	"testing"
+
+	"github.com/TecharoHQ/anubis/internal/iplist"
 )
 
 func TestRemoteAddrChecker(t *testing.T) {
@@ -98,6 +103,69 @@ func TestRemoteAddrChecker(t *testing.T) {
 	}
 }
 
+func TestIPListChecker(t *testing.T) {
+	dir := t.TempDir()
+	for name, contents := range map[string]string{
+		"proxies.txt": "192.0.2.0/24\n",
+		"vpns.txt":    "198.51.100.0/24\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	registry, err := iplist.New(t.Context(), slog.Default(), []iplist.Source{
+		{Name: "proxies", File: filepath.Join(dir, "proxies.txt")},
+		{Name: "vpns", File: filepath.Join(dir, "vpns.txt")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewIPListChecker(registry, []string{"nonexistent"}); !errors.Is(err, ErrMisconfiguration) {
+		t.Errorf("wanted ErrMisconfiguration for an unknown list, got: %v", err)
+	}
+
+	ilc, err := NewIPListChecker(registry, []string{"proxies", "vpns"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		ip   string
+		ok   bool
+		err  error
+	}{
+		{name: "first list", ip: "192.0.2.1", ok: true},
+		{name: "second list", ip: "198.51.100.1", ok: true},
+		{name: "ipv4 in ipv6", ip: "::ffff:192.0.2.1", ok: true},
+		{name: "not listed", ip: "203.0.113.1"},
+		{name: "no ip set", err: ErrMisconfiguration},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := http.NewRequest(http.MethodGet, "/", nil)
+			if err != nil {
+				t.Fatalf("can't make request: %v", err)
+			}
+
+			if tt.ip != "" {
+				r.Header.Add("X-Real-Ip", tt.ip)
+			}
+
+			ok, err := ilc.Check(r)
+
+			if tt.ok != ok {
+				t.Errorf("ok: %v, wanted: %v", ok, tt.ok)
+			}
+
+			if !errors.Is(err, tt.err) {
+				t.Errorf("err: %v, wanted: %v", err, tt.err)
+			}
+		})
+	}
+}
+
 func TestHeaderMatchesChecker(t *testing.T) {
 	for _, tt := range []struct {
 		err            error
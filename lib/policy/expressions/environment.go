@@ -2,22 +2,55 @@ package expressions
 
 import (
 	"math/rand/v2"
+	"net/netip"
 	"strings"
 
 	"github.com/TecharoHQ/anubis/internal/dns"
+	"github.com/TecharoHQ/anubis/internal/iplist"
+	"github.com/TecharoHQ/anubis/internal/verifiedcrawler"
 	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common"
+	"github.com/google/cel-go/common/ast"
+	"github.com/google/cel-go/common/operators"
 	"github.com/google/cel-go/common/types"
 	"github.com/google/cel-go/common/types/ref"
 	"github.com/google/cel-go/common/types/traits"
 	"github.com/google/cel-go/ext"
 )
 
+// BotOptions are what the functions in a BotEnvironment look things up in.
+// Every field may be nil.
+type BotOptions struct {
+	// DNS answers reverseDNS, lookupHost, verifyFCrDNS and arpaReverseIP.
+	DNS *dns.Dns
+
+	// Crawlers answers isVerifiedCrawler. If it is set, expressions that
+	// name a crawler it doesn't know don't compile.
+	Crawlers *verifiedcrawler.Registry
+
+	// IPLists answers inIPList. If it is set, expressions that name a list
+	// it doesn't know don't compile.
+	IPLists *iplist.Registry
+}
+
 // BotEnvironment creates a new CEL environment, this is the set of
 // variables and functions that are passed into the CEL scope so that
 // Anubis can fail loudly and early when something is invalid instead
 // of blowing up at runtime.
-func BotEnvironment(dnsObj *dns.Dns) (*cel.Env, error) {
+func BotEnvironment(opts BotOptions) (*cel.Env, error) {
+	dnsObj, crawlers, ipLists := opts.DNS, opts.Crawlers, opts.IPLists
+
+	var validators []cel.ASTValidator
+	if crawlers != nil {
+		validators = append(validators, nameValidator{function: "isVerifiedCrawler", kind: "verified crawler", start: crawlers.Start})
+	}
+	if ipLists != nil {
+		validators = append(validators, nameValidator{function: "inIPList", kind: "IP list", start: ipLists.Start})
+	}
+
 	return New(
+		cel.ASTValidators(validators...),
+
 		// Variables exposed to CEL programs:
 		cel.Variable("remoteAddress", cel.StringType),
 		cel.Variable("contentLength", cel.IntType),
@@ -30,6 +63,55 @@ func BotEnvironment(dnsObj *dns.Dns) (*cel.Env, error) {
 		cel.Variable("load_1m", cel.DoubleType),
 		cel.Variable("load_5m", cel.DoubleType),
 		cel.Variable("load_15m", cel.DoubleType),
+		cel.Variable("dnsblHits", cel.MapType(cel.StringType, cel.StringType)),
+		cel.Variable("asn", cel.IntType),
+		cel.Variable("asnOrg", cel.StringType),
+		cel.Variable("country", cel.StringType),
+		cel.Variable("announcedPrefix", cel.StringType),
+		cel.Variable("hostingProvider", cel.StringType),
+		cel.Variable("lookupFailed", cel.BoolType),
+
+		// dnsblListed(zone) is true when the client is listed in the DNSBL
+		// with that zone. It is shorthand for `zone in dnsblHits`.
+		cel.Macros(cel.GlobalMacro("dnsblListed", 1,
+			func(eh cel.MacroExprFactory, target ast.Expr, args []ast.Expr) (ast.Expr, *common.Error) {
+				return eh.NewCall(operators.In, args[0], eh.NewIdent("dnsblHits")), nil
+			},
+		)),
+
+		// isVerifiedCrawler(name) is true when the client is in the published
+		// IP ranges of the crawler with that name. It is shorthand for
+		// `isVerifiedCrawler(remoteAddress, name)`.
+		cel.Macros(cel.GlobalMacro("isVerifiedCrawler", 1,
+			func(eh cel.MacroExprFactory, target ast.Expr, args []ast.Expr) (ast.Expr, *common.Error) {
+				return eh.NewCall("isVerifiedCrawler", eh.NewIdent("remoteAddress"), args[0]), nil
+			},
+		)),
+
+		// inIPList(name) is true when the client is in the IP list with that
+		// name. It is shorthand for `inIPList(remoteAddress, name)`.
+		cel.Macros(cel.GlobalMacro("inIPList", 1,
+			func(eh cel.MacroExprFactory, target ast.Expr, args []ast.Expr) (ast.Expr, *common.Error) {
+				return eh.NewCall("inIPList", eh.NewIdent("remoteAddress"), args[0]), nil
+			},
+		)),
+
+		// isHostingProvider() is true when the client's ASN belongs to a
+		// hosting or cloud provider, and isHostingProvider(name) when it
+		// belongs to that one. They are shorthand for `hostingProvider != ""`
+		// and `hostingProvider == name`.
+		cel.Macros(
+			cel.GlobalMacro("isHostingProvider", 0,
+				func(eh cel.MacroExprFactory, target ast.Expr, args []ast.Expr) (ast.Expr, *common.Error) {
+					return eh.NewCall(operators.NotEquals, eh.NewIdent("hostingProvider"), eh.NewLiteral(types.String(""))), nil
+				},
+			),
+			cel.GlobalMacro("isHostingProvider", 1,
+				func(eh cel.MacroExprFactory, target ast.Expr, args []ast.Expr) (ast.Expr, *common.Error) {
+					return eh.NewCall(operators.Equals, eh.NewIdent("hostingProvider"), args[0]), nil
+				},
+			),
+		),
 
 		// Bot-specific functions:
 		cel.Function("missingHeader",
@@ -126,6 +208,52 @@ func BotEnvironment(dnsObj *dns.Dns) (*cel.Env, error) {
 			),
 		),
 
+		cel.Function("isVerifiedCrawler",
+			cel.Overload("isVerifiedCrawler_string_string_bool",
+				[]*cel.Type{cel.StringType, cel.StringType},
+				cel.BoolType,
+				cel.BinaryBinding(func(addr, name ref.Val) ref.Val {
+					addrStr, ok := addr.(types.String)
+					if !ok {
+						return types.ValOrErr(addr, "addr is not a string")
+					}
+					nameStr, ok := name.(types.String)
+					if !ok {
+						return types.ValOrErr(name, "name is not a string")
+					}
+
+					ip, err := netip.ParseAddr(string(addrStr))
+					if err != nil {
+						return types.Bool(false)
+					}
+					return types.Bool(crawlers.Contains(string(nameStr), ip))
+				}),
+			),
+		),
+
+		cel.Function("inIPList",
+			cel.Overload("inIPList_string_string_bool",
+				[]*cel.Type{cel.StringType, cel.StringType},
+				cel.BoolType,
+				cel.BinaryBinding(func(addr, name ref.Val) ref.Val {
+					addrStr, ok := addr.(types.String)
+					if !ok {
+						return types.ValOrErr(addr, "addr is not a string")
+					}
+					nameStr, ok := name.(types.String)
+					if !ok {
+						return types.ValOrErr(name, "name is not a string")
+					}
+
+					ip, err := netip.ParseAddr(string(addrStr))
+					if err != nil {
+						return types.Bool(false)
+					}
+					return types.Bool(ipLists.Contains(string(nameStr), ip))
+				}),
+			),
+		),
+
 		// arpaReverseIP transforms ip into arpa reverse notation like this
 		// 1.2.3.4		->	4.3.2.1
 		// 2001:db8::1  ->  1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2
@@ -194,6 +322,36 @@ func BotEnvironment(dnsObj *dns.Dns) (*cel.Env, error) {
 	)
 }
 
+// nameValidator rejects calls to function whose name argument is a literal
+// that start doesn't know, so that typos fail when the policy is loaded
+// instead of silently never matching. Known names are started, so that their
+// feeds are fetched before requests check them.
+type nameValidator struct {
+	function string
+	kind     string
+	start    func(name string) bool
+}
+
+func (v nameValidator) Name() string {
+	return "anubis.validator." + v.function
+}
+
+func (v nameValidator) Validate(_ *cel.Env, _ cel.ValidatorConfig, a *ast.AST, iss *cel.Issues) {
+	for _, call := range ast.MatchDescendants(ast.NavigateAST(a), ast.FunctionMatcher(v.function)) {
+		args := call.AsCall().Args()
+		if len(args) != 2 || args[1].Kind() != ast.LiteralKind {
+			continue
+		}
+
+		name, ok := args[1].AsLiteral().Value().(string)
+		if !ok || v.start(name) {
+			continue
+		}
+
+		iss.ReportErrorAtID(args[1].ID(), "unknown %s %q", v.kind, name)
+	}
+}
+
 // NewThreshold creates a new CEL environment for threshold checking.
 func ThresholdEnvironment() (*cel.Env, error) {
 	return New(
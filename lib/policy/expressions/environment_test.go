@@ -3,11 +3,16 @@ package expressions
 import (
 	"context"
 	"errors"
+	"log/slog"
 	"net"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/TecharoHQ/anubis/internal/dns"
+	"github.com/TecharoHQ/anubis/internal/iplist"
+	"github.com/TecharoHQ/anubis/internal/verifiedcrawler"
 	"github.com/TecharoHQ/anubis/lib/store/memory"
 	"github.com/google/cel-go/common/types"
 	"github.com/google/cel-go/common/types/ref"
@@ -17,13 +22,13 @@ import (
 func newTestDNS(forwardTTL int, reverseTTL int) *dns.Dns {
 	ctx := context.Background()
 	memStore := memory.New(ctx)
-	cache := dns.NewDNSCache(forwardTTL, reverseTTL, memStore)
-	return dns.New(ctx, cache)
+	cache := dns.NewDNSCache(forwardTTL, reverseTTL, 0, memStore)
+	return dns.New(ctx, cache, nil)
 }
 
 func TestBotEnvironment(t *testing.T) {
 	dnsObj := newTestDNS(300, 300)
-	env, err := BotEnvironment(dnsObj)
+	env, err := BotEnvironment(BotOptions{DNS: dnsObj})
 	if err != nil {
 		t.Fatalf("failed to create bot environment: %v", err)
 	}
@@ -125,6 +130,287 @@ func TestBotEnvironment(t *testing.T) {
 		})
 	})
 
+	t.Run("dnsblListed", func(t *testing.T) {
+		hits := map[string]string{"dnsbl.dronebl.org": "IRCDrone"}
+
+		for _, tt := range []struct {
+			name        string
+			description string
+			expression  string
+			expected    types.Bool
+		}{
+			{
+				name:        "listed",
+				description: "should be true for a zone the client is listed in",
+				expression:  `dnsblListed("dnsbl.dronebl.org")`,
+				expected:    types.Bool(true),
+			},
+			{
+				name:        "not-listed",
+				description: "should be false for a zone the client is not listed in",
+				expression:  `dnsblListed("zen.spamhaus.org")`,
+				expected:    types.Bool(false),
+			},
+			{
+				name:        "reason",
+				description: "dnsblHits should map zones to the reason the client is listed",
+				expression:  `dnsblHits["dnsbl.dronebl.org"] == "IRCDrone"`,
+				expected:    types.Bool(true),
+			},
+		} {
+			t.Run(tt.name, func(t *testing.T) {
+				prog, err := Compile(env, tt.expression)
+				if err != nil {
+					t.Fatalf("failed to compile expression %q: %v", tt.expression, err)
+				}
+
+				result, _, err := prog.Eval(map[string]interface{}{
+					"dnsblHits": hits,
+				})
+				if err != nil {
+					t.Fatalf("failed to evaluate expression %q: %v", tt.expression, err)
+				}
+
+				if result != tt.expected {
+					t.Errorf("%s: expected %v, got %v", tt.description, tt.expected, result)
+				}
+			})
+		}
+
+		t.Run("wrong-type", func(t *testing.T) {
+			if _, err := Compile(env, `dnsblListed(1)`); err == nil {
+				t.Error("should not compile dnsblListed with a non-string zone")
+			}
+		})
+	})
+
+	t.Run("isVerifiedCrawler", func(t *testing.T) {
+		fname := filepath.Join(t.TempDir(), "examplebot.txt")
+		if err := os.WriteFile(fname, []byte("192.0.2.0/24\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		crawlers, err := verifiedcrawler.New(t.Context(), slog.Default(), []verifiedcrawler.Source{{Name: "examplebot", File: fname}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		env, err := BotEnvironment(BotOptions{DNS: dnsObj, Crawlers: crawlers})
+		if err != nil {
+			t.Fatalf("failed to create bot environment: %v", err)
+		}
+
+		for _, tt := range []struct {
+			name        string
+			description string
+			expression  string
+			addr        string
+			expected    types.Bool
+		}{
+			{
+				name:        "verified",
+				description: "should be true for a client in the crawler's ranges",
+				expression:  `isVerifiedCrawler("examplebot")`,
+				addr:        "192.0.2.1",
+				expected:    types.Bool(true),
+			},
+			{
+				name:        "not-verified",
+				description: "should be false for a client outside the crawler's ranges",
+				expression:  `isVerifiedCrawler("examplebot")`,
+				addr:        "198.51.100.1",
+				expected:    types.Bool(false),
+			},
+			{
+				name:        "unknown-crawler",
+				description: "should be false for a crawler the registry doesn't know that is named at runtime",
+				expression:  `isVerifiedCrawler(remoteAddress, "nonexistent" + "bot")`,
+				addr:        "192.0.2.1",
+				expected:    types.Bool(false),
+			},
+			{
+				name:        "explicit-address",
+				description: "should check the given address instead of the client's",
+				expression:  `isVerifiedCrawler("192.0.2.7", "examplebot")`,
+				addr:        "198.51.100.1",
+				expected:    types.Bool(true),
+			},
+			{
+				name:        "not-an-ip",
+				description: "should be false when the address doesn't parse",
+				expression:  `isVerifiedCrawler("not-an-ip", "examplebot")`,
+				addr:        "192.0.2.1",
+				expected:    types.Bool(false),
+			},
+		} {
+			t.Run(tt.name, func(t *testing.T) {
+				prog, err := Compile(env, tt.expression)
+				if err != nil {
+					t.Fatalf("failed to compile expression %q: %v", tt.expression, err)
+				}
+
+				result, _, err := prog.Eval(map[string]interface{}{
+					"remoteAddress": tt.addr,
+				})
+				if err != nil {
+					t.Fatalf("failed to evaluate expression %q: %v", tt.expression, err)
+				}
+
+				if result != tt.expected {
+					t.Errorf("%s: expected %v, got %v", tt.description, tt.expected, result)
+				}
+			})
+		}
+	})
+
+	t.Run("inIPList", func(t *testing.T) {
+		fname := filepath.Join(t.TempDir(), "proxies.txt")
+		if err := os.WriteFile(fname, []byte("192.0.2.0/24\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		ipLists, err := iplist.New(t.Context(), slog.Default(), []iplist.Source{{Name: "proxies", File: fname}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		env, err := BotEnvironment(BotOptions{DNS: dnsObj, IPLists: ipLists})
+		if err != nil {
+			t.Fatalf("failed to create bot environment: %v", err)
+		}
+
+		for _, tt := range []struct {
+			name        string
+			description string
+			expression  string
+			addr        string
+			expected    types.Bool
+		}{
+			{
+				name:        "listed",
+				description: "should be true for a client in the list",
+				expression:  `inIPList("proxies")`,
+				addr:        "192.0.2.1",
+				expected:    types.Bool(true),
+			},
+			{
+				name:        "not-listed",
+				description: "should be false for a client outside the list",
+				expression:  `inIPList("proxies")`,
+				addr:        "198.51.100.1",
+				expected:    types.Bool(false),
+			},
+			{
+				name:        "unknown-list",
+				description: "should be false for a list the registry doesn't know that is named at runtime",
+				expression:  `inIPList(remoteAddress, "non" + "existent")`,
+				addr:        "192.0.2.1",
+				expected:    types.Bool(false),
+			},
+			{
+				name:        "explicit-address",
+				description: "should check the given address instead of the client's",
+				expression:  `inIPList("192.0.2.7", "proxies")`,
+				addr:        "198.51.100.1",
+				expected:    types.Bool(true),
+			},
+			{
+				name:        "not-an-ip",
+				description: "should be false when the address doesn't parse",
+				expression:  `inIPList("not-an-ip", "proxies")`,
+				addr:        "192.0.2.1",
+				expected:    types.Bool(false),
+			},
+		} {
+			t.Run(tt.name, func(t *testing.T) {
+				prog, err := Compile(env, tt.expression)
+				if err != nil {
+					t.Fatalf("failed to compile expression %q: %v", tt.expression, err)
+				}
+
+				result, _, err := prog.Eval(map[string]interface{}{
+					"remoteAddress": tt.addr,
+				})
+				if err != nil {
+					t.Fatalf("failed to evaluate expression %q: %v", tt.expression, err)
+				}
+
+				if result != tt.expected {
+					t.Errorf("%s: expected %v, got %v", tt.description, tt.expected, result)
+				}
+			})
+		}
+	})
+
+	t.Run("unknown-names", func(t *testing.T) {
+		fname := filepath.Join(t.TempDir(), "ranges.txt")
+		if err := os.WriteFile(fname, []byte("192.0.2.0/24\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		crawlers, err := verifiedcrawler.New(t.Context(), slog.Default(), []verifiedcrawler.Source{{Name: "examplebot", File: fname}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ipLists, err := iplist.New(t.Context(), slog.Default(), []iplist.Source{{Name: "proxies", File: fname}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		env, err := BotEnvironment(BotOptions{DNS: dnsObj, Crawlers: crawlers, IPLists: ipLists})
+		if err != nil {
+			t.Fatalf("failed to create bot environment: %v", err)
+		}
+
+		for _, tt := range []struct {
+			name       string
+			expression string
+			wantErr    string
+		}{
+			{
+				name:       "typo-crawler",
+				expression: `isVerifiedCrawler("typo")`,
+				wantErr:    `unknown verified crawler "typo"`,
+			},
+			{
+				name:       "typo-crawler-explicit-address",
+				expression: `isVerifiedCrawler("192.0.2.1", "typo")`,
+				wantErr:    `unknown verified crawler "typo"`,
+			},
+			{
+				name:       "typo-list",
+				expression: `inIPList("typo")`,
+				wantErr:    `unknown IP list "typo"`,
+			},
+			{
+				name:       "typo-list-nested",
+				expression: `userAgent.contains("bot") && (inIPList("proxies") || inIPList("typo"))`,
+				wantErr:    `unknown IP list "typo"`,
+			},
+			{
+				name:       "known-names",
+				expression: `isVerifiedCrawler("examplebot") || isVerifiedCrawler("googlebot") || inIPList("proxies")`,
+			},
+		} {
+			t.Run(tt.name, func(t *testing.T) {
+				_, err := Compile(env, tt.expression)
+
+				t.Logf("want: %q", tt.wantErr)
+				t.Logf("got:  %v", err)
+
+				switch {
+				case tt.wantErr == "" && err != nil:
+					t.Fatalf("failed to compile expression %q: %v", tt.expression, err)
+				case tt.wantErr != "" && err == nil:
+					t.Fatalf("wanted expression %q to fail to compile", tt.expression)
+				case tt.wantErr != "" && !strings.Contains(err.Error(), tt.wantErr):
+					t.Fatalf("wanted error to contain %q", tt.wantErr)
+				}
+			})
+		}
+	})
+
 	t.Run("segments", func(t *testing.T) {
 		for _, tt := range []struct {
 			name        string
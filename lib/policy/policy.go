@@ -12,10 +12,14 @@ import (
 
 	"github.com/TecharoHQ/anubis/internal"
 	"github.com/TecharoHQ/anubis/internal/dns"
+	"github.com/TecharoHQ/anubis/internal/iplist"
+	"github.com/TecharoHQ/anubis/internal/verifiedcrawler"
 	"github.com/TecharoHQ/anubis/lib/config"
 	"github.com/TecharoHQ/anubis/lib/policy/checker"
 	"github.com/TecharoHQ/anubis/lib/store"
+	"github.com/TecharoHQ/anubis/lib/store/encrypted"
 	"github.com/TecharoHQ/anubis/lib/thoth"
+	iptoasnv1 "github.com/TecharoHQ/thoth-proto/gen/techaro/thoth/iptoasn/v1"
 	"github.com/fahedouch/go-logrotate"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
@@ -41,18 +45,29 @@ type ParsedConfig struct {
 	Bots              []Bot
 	Thresholds        []*Threshold
 	StatusCodes       config.StatusCodes
+	Routes            []config.Route
+	UpstreamError     *config.UpstreamError
+	ClientIP          *config.ClientIP
 	DefaultDifficulty int
-	DNSBL             bool
+	DNSBLs            []config.DNSBL
 	DnsCache          *dns.DnsCache
 	Dns               *dns.Dns
+	Crawlers          *verifiedcrawler.Registry
+	IPLists           *iplist.Registry
 	Logger            *slog.Logger
+
+	// Deprecated: use DNSBLs. DNSBL is true if DroneBL is one of them.
+	DNSBL bool
 }
 
 func newParsedConfig(orig *config.Config) *ParsedConfig {
 	return &ParsedConfig{
-		orig:        orig,
-		OpenGraph:   orig.OpenGraph,
-		StatusCodes: orig.StatusCodes,
+		orig:          orig,
+		OpenGraph:     orig.OpenGraph,
+		StatusCodes:   orig.StatusCodes,
+		Routes:        orig.Routes,
+		UpstreamError: orig.UpstreamError,
+		ClientIP:      orig.ClientIP,
 	}
 }
 
@@ -98,15 +113,50 @@ func ParseConfig(ctx context.Context, fin io.Reader, fname string, defaultDiffic
 		store, err := stFac.Build(ctx, c.Store.Parameters)
 		if err != nil {
 			validationErrs = append(validationErrs, err)
-		} else {
-			result.Store = store
+			break
+		}
+
+		if c.Store.Encryption != nil {
+			encStore, err := encrypted.New(store, *c.Store.Encryption)
+			if err != nil {
+				validationErrs = append(validationErrs, err)
+				break
+			}
+			store = encStore
 		}
+
+		result.Store = store
 	case false:
 		validationErrs = append(validationErrs, config.ErrUnknownStoreBackend)
 	}
 
-	result.DnsCache = dns.NewDNSCache(result.orig.DNSTTL.Forward, result.orig.DNSTTL.Reverse, result.Store)
-	result.Dns = dns.New(ctx, result.DnsCache)
+	result.DnsCache = dns.NewDNSCache(result.orig.DNSTTL.Forward, result.orig.DNSTTL.Reverse, result.orig.DNS.NegativeTTLSeconds(), result.Store)
+	result.Dns = dns.New(ctx, result.DnsCache, newResolver(result.orig.DNS))
+	result.Dns.SetLimits(dns.Limits{
+		MaxConcurrent: result.orig.DNS.MaxConcurrent,
+		MaxQueued:     result.orig.DNS.MaxQueued,
+		FallbackPass:  result.orig.DNS.Fallback == config.DNSFallbackPass,
+	})
+
+	var crawlerSources []verifiedcrawler.Source
+	for _, v := range c.VerifiedCrawlers {
+		crawlerSources = append(crawlerSources, v.Source())
+	}
+
+	result.Crawlers, err = verifiedcrawler.New(ctx, result.Logger, crawlerSources)
+	if err != nil {
+		validationErrs = append(validationErrs, fmt.Errorf("can't load verified crawlers: %w", err))
+	}
+
+	var ipListSources []iplist.Source
+	for _, l := range c.IPLists {
+		ipListSources = append(ipListSources, l.Source())
+	}
+
+	result.IPLists, err = iplist.New(ctx, result.Logger, ipListSources)
+	if err != nil {
+		validationErrs = append(validationErrs, fmt.Errorf("can't load IP lists: %w", err))
+	}
 
 	for _, b := range c.Bots {
 		if berr := b.Valid(); berr != nil {
@@ -130,6 +180,24 @@ func ParseConfig(ctx context.Context, fin io.Reader, fname string, defaultDiffic
 			}
 		}
 
+		if b.VerifiedCrawler != "" {
+			c, err := NewVerifiedCrawlerChecker(result.Crawlers, b.VerifiedCrawler)
+			if err != nil {
+				validationErrs = append(validationErrs, fmt.Errorf("while processing rule %s verified crawler: %w", b.Name, err))
+			} else {
+				cl = append(cl, c)
+			}
+		}
+
+		if len(b.IPLists) > 0 {
+			c, err := NewIPListChecker(result.IPLists, b.IPLists)
+			if err != nil {
+				validationErrs = append(validationErrs, fmt.Errorf("while processing rule %s IP lists: %w", b.Name, err))
+			} else {
+				cl = append(cl, c)
+			}
+		}
+
 		if b.UserAgentRegex != nil {
 			c, err := NewUserAgentChecker(*b.UserAgentRegex)
 			if err != nil {
@@ -158,7 +226,17 @@ func ParseConfig(ctx context.Context, fin io.Reader, fname string, defaultDiffic
 		}
 
 		if b.Expression != nil {
-			c, err := NewCELChecker(b.Expression, result.Dns)
+			var iptoasn iptoasnv1.IpToASNServiceClient
+			if hasThothClient {
+				iptoasn = tc.IPToASN
+			}
+
+			c, err := NewCELChecker(b.Expression, CELCheckerOptions{
+				DNS:      result.Dns,
+				Crawlers: result.Crawlers,
+				IPLists:  result.IPLists,
+				IPToASN:  iptoasn,
+			})
 			if err != nil {
 				validationErrs = append(validationErrs, fmt.Errorf("while processing rule %s expressions: %w", b.Name, err))
 			} else {
@@ -168,20 +246,34 @@ func ParseConfig(ctx context.Context, fin io.Reader, fname string, defaultDiffic
 
 		if b.ASNs != nil {
 			if !hasThothClient {
-				lg.Warn("You have specified a Thoth specific check but you have no Thoth client configured. Please read https://anubis.techaro.lol/docs/admin/thoth for more information", "check", "asn", "settings", b.ASNs)
+				lg.Warn("You have specified a Thoth specific check but you have no Thoth client or MMDB files configured. Please read https://anubis.techaro.lol/docs/admin/thoth for more information", "check", "asn", "settings", b.ASNs)
 				continue
 			}
 
-			cl = append(cl, tc.ASNCheckerFor(b.ASNs.Match))
+			cl = append(cl, tc.ASNCheckerFor(b.ASNs.Match, b.ASNs.FailureMode == config.FailureModeClosed))
 		}
 
 		if b.GeoIP != nil {
 			if !hasThothClient {
-				lg.Warn("You have specified a Thoth specific check but you have no Thoth client configured. Please read https://anubis.techaro.lol/docs/admin/thoth for more information", "check", "geoip", "settings", b.GeoIP)
+				lg.Warn("You have specified a Thoth specific check but you have no Thoth client or MMDB files configured. Please read https://anubis.techaro.lol/docs/admin/thoth for more information", "check", "geoip", "settings", b.GeoIP)
 				continue
 			}
 
-			cl = append(cl, tc.GeoIPCheckerFor(b.GeoIP.Countries))
+			cl = append(cl, tc.GeoIPCheckerFor(b.GeoIP.Countries, b.GeoIP.FailureMode == config.FailureModeClosed))
+		}
+
+		if b.Hosting != nil {
+			if !hasThothClient {
+				lg.Warn("You have specified a Thoth specific check but you have no Thoth client or MMDB files configured. Please read https://anubis.techaro.lol/docs/admin/thoth for more information", "check", "hosting", "settings", b.Hosting)
+				continue
+			}
+
+			c := tc.HostingCheckerFor(b.Hosting.Providers, b.Hosting.Weights, b.Hosting.FailureMode == config.FailureModeClosed)
+			cl = append(cl, c)
+
+			if w, ok := c.(Weigher); ok && len(b.Hosting.Weights) != 0 {
+				parsedBot.Weigher = w
+			}
 		}
 
 		if b.Challenge == nil {
@@ -242,7 +334,34 @@ func ParseConfig(ctx context.Context, fin io.Reader, fname string, defaultDiffic
 		return nil, fmt.Errorf("errors validating policy config JSON %s: %w", fname, errors.Join(validationErrs...))
 	}
 
+	result.DNSBLs = c.DNSBLs
 	result.DNSBL = c.DNSBL
 
 	return result, nil
 }
+
+// newResolver returns the resolver configured in the dns section of the
+// policy file, or nil to use the host's resolver.
+func newResolver(c config.DNS) dns.Resolver {
+	if len(c.Resolvers) == 0 {
+		return nil
+	}
+
+	cli := &dns.Client{
+		Timeout:  c.TimeoutDuration(),
+		Attempts: c.Attempts,
+		DNSSEC:   c.DNSSEC,
+	}
+
+	for _, r := range c.Resolvers {
+		// XXX: already validated in Valid()
+		protocol, addr, _ := r.Parse()
+		cli.Upstreams = append(cli.Upstreams, dns.Upstream{
+			Protocol:   dns.Protocol(protocol),
+			Address:    addr,
+			ServerName: r.ServerName,
+		})
+	}
+
+	return cli
+}
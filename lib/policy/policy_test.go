@@ -1,12 +1,20 @@
 package policy
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/TecharoHQ/anubis"
 	"github.com/TecharoHQ/anubis/data"
+	"github.com/TecharoHQ/anubis/internal/dns"
+	"github.com/TecharoHQ/anubis/lib/config"
 	"github.com/TecharoHQ/anubis/lib/thoth/thothmock"
 )
 
@@ -87,3 +95,137 @@ func TestBadConfigs(t *testing.T) {
 		})
 	}
 }
+
+func TestHostingWeights(t *testing.T) {
+	ctx := thothmock.WithMockThoth(t)
+
+	fin, err := os.Open(filepath.Join("..", "config", "testdata", "good", "hosting.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fin.Close()
+
+	pol, err := ParseConfig(ctx, fin, fin.Name(), anubis.DefaultDifficulty, "info")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i := slices.IndexFunc(pol.Bots, func(b Bot) bool { return b.Name == "hosting-weights" })
+	if i == -1 {
+		t.Fatal("can't find the hosting-weights rule")
+	}
+	b := pol.Bots[i]
+
+	for _, tt := range []struct {
+		name       string
+		ipAddress  string
+		wantWeight int
+	}{
+		{name: "weighted provider", ipAddress: "3.3.3.3", wantWeight: 10},
+		{name: "not a hosting provider", ipAddress: "1.1.1.1", wantWeight: 3},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("X-Real-Ip", tt.ipAddress)
+
+			if got := b.WeightFor(req); got != tt.wantWeight {
+				t.Logf("want: %d", tt.wantWeight)
+				t.Logf("got:  %d", got)
+				t.Error("got wrong weight")
+			}
+		})
+	}
+}
+
+func TestIPListsStartedAtLoad(t *testing.T) {
+	var mu sync.Mutex
+	hits := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+		w.Write([]byte("192.0.2.0/24\n"))
+	}))
+	defer srv.Close()
+
+	pol := `bots:
+  - name: field
+    action: DENY
+    ip_lists:
+      - field
+  - name: expression
+    action: DENY
+    expression: inIPList("expression")
+
+ip_list_feeds:
+  - name: field
+    url: ` + srv.URL + `/field
+  - name: expression
+    url: ` + srv.URL + `/expression
+  - name: unused
+    url: ` + srv.URL + `/unused
+`
+
+	if _, err := ParseConfig(thothmock.WithMockThoth(t), strings.NewReader(pol), "ip-lists.yaml", anubis.DefaultDifficulty, "info"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The lists that rules use are fetched without any request checking
+	// them, the others aren't fetched at all.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		done := hits["/field"] == 1 && hits["/expression"] == 1
+		mu.Unlock()
+
+		if done {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("wanted the lists used by rules to be fetched when the policy is loaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if hits["/unused"] != 0 {
+		t.Error("wanted lists that no rule uses to not be fetched")
+	}
+}
+
+func TestNewResolver(t *testing.T) {
+	if r := newResolver(config.DNS{}); r != nil {
+		t.Errorf("wanted the host's resolver without resolvers, got: %T", r)
+	}
+
+	r := newResolver(config.DNS{
+		Timeout:  "500ms",
+		Attempts: 2,
+		Resolvers: []config.DNSResolver{
+			{Address: "tls://9.9.9.9", ServerName: "dns.quad9.net"},
+			{Address: "https://dns.quad9.net/dns-query"},
+		},
+	})
+
+	cli, ok := r.(*dns.Client)
+	if !ok {
+		t.Fatalf("wanted a *dns.Client, got: %T", r)
+	}
+
+	want := []dns.Upstream{
+		{Protocol: dns.ProtocolTLS, Address: "9.9.9.9:853", ServerName: "dns.quad9.net"},
+		{Protocol: dns.ProtocolHTTPS, Address: "https://dns.quad9.net/dns-query"},
+	}
+
+	if !slices.Equal(cli.Upstreams, want) {
+		t.Logf("want: %+v", want)
+		t.Logf("got:  %+v", cli.Upstreams)
+		t.Error("wrong upstreams")
+	}
+
+	if cli.Timeout != 500*time.Millisecond || cli.Attempts != 2 {
+		t.Errorf("wrong timeout or attempts: %s, %d", cli.Timeout, cli.Attempts)
+	}
+}
@@ -0,0 +1,80 @@
+package lib
+
+import (
+	"net/http"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/TecharoHQ/anubis/internal"
+	"github.com/TecharoHQ/anubis/internal/spop"
+)
+
+func spoeMessage(userAgent string) []spop.Message {
+	return []spop.Message{{
+		Name: spop.MessageName,
+		Args: []spop.Arg{
+			{Name: "method", Value: http.MethodGet},
+			{Name: "path", Value: "/foo"},
+			{Name: "query", Value: "bar=baz"},
+			{Name: "ver", Value: "1.1"},
+			{Name: "ssl", Value: true},
+			{Name: "ip", Value: netip.MustParseAddr("192.0.2.1")},
+			{Name: "hdrs", Value: "host: example.com\r\nuser-agent: " + userAgent + "\r\naccept-encoding: gzip\r\n\r\n"},
+		},
+	}}
+}
+
+func spoeVars(actions []spop.Action) map[string]any {
+	result := map[string]any{}
+	for _, a := range actions {
+		result[a.Name] = a.Value
+	}
+	return result
+}
+
+func TestSPOE(t *testing.T) {
+	pol := loadPolicies(t, "./testdata/aggressive_403.yaml", 4)
+
+	srv := spawnAnubis(t, Options{
+		Next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("SPOE checks must not be proxied to the upstream")
+		}),
+		Policy:    pol,
+		PublicUrl: "https://anubis.example.com",
+	})
+
+	h := spop.HTTPHandler(internal.RemoteXRealIP(true, "tcp", http.HandlerFunc(srv.ServeAuthCheck)))
+
+	t.Run("allow", func(t *testing.T) {
+		vars := spoeVars(h(t.Context(), spoeMessage("ALLOW")))
+
+		if vars["allowed"] != true || vars["action"] != "ALLOW" {
+			t.Errorf("wanted request to be allowed, got: %v", vars)
+		}
+	})
+
+	t.Run("deny", func(t *testing.T) {
+		vars := spoeVars(h(t.Context(), spoeMessage("DENY")))
+
+		if vars["allowed"] != false || vars["code"] != http.StatusForbidden {
+			t.Errorf("wanted request to be denied with %d, got: %v", http.StatusForbidden, vars)
+		}
+	})
+
+	t.Run("challenge", func(t *testing.T) {
+		vars := spoeVars(h(t.Context(), spoeMessage("CHALLENGE")))
+
+		if vars["allowed"] != false || vars["code"] != http.StatusTemporaryRedirect {
+			t.Errorf("wanted request to be redirected, got: %v", vars)
+		}
+
+		location, _ := vars["redirect"].(string)
+		want := "https://anubis.example.com/.within.website/?redir=https%3A%2F%2Fexample.com%2Ffoo%3Fbar%3Dbaz"
+		if !strings.HasPrefix(location, want) {
+			t.Logf("want: %s", want)
+			t.Logf("got:  %s", location)
+			t.Error("wrong redirect")
+		}
+	})
+}
@@ -80,3 +80,8 @@ func (a *ActorifiedStore) actorSet(ctx context.Context, req *actorSetReq) (unit,
 
 	return unit{}, nil
 }
+
+// Scan passes through to the underlying store if it implements Scanner.
+func (a *ActorifiedStore) Scan(ctx context.Context, prefix string, fn func(Entry) error) error {
+	return Scan(ctx, a.Interface, prefix, fn)
+}
@@ -1,6 +1,7 @@
 package bbolt
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -121,6 +122,62 @@ func (s *Store) Set(ctx context.Context, key string, value []byte, expiry time.D
 	})
 }
 
+// Scan calls fn for every unexpired value whose key starts with prefix.
+//
+// Values are collected in a read transaction before fn is called so that fn
+// can safely write back to this store.
+func (s *Store) Scan(ctx context.Context, prefix string, fn func(store.Entry) error) error {
+	var entries []store.Entry
+	now := time.Now()
+
+	if err := s.bdb.View(func(tx *bbolt.Tx) error {
+		c := tx.Cursor()
+
+		for key, _ := c.Seek([]byte(prefix)); key != nil && bytes.HasPrefix(key, []byte(prefix)); key, _ = c.Next() {
+			valueBkt := tx.Bucket(key)
+			if valueBkt == nil {
+				continue
+			}
+
+			expiryStr := valueBkt.Get([]byte("expiry"))
+			if expiryStr == nil {
+				continue
+			}
+
+			expiry, err := time.Parse(time.RFC3339Nano, string(expiryStr))
+			if err != nil {
+				return fmt.Errorf("[unexpected] %w in bucket %q: %w", store.ErrCantDecode, string(key), err)
+			}
+
+			if now.After(expiry) {
+				continue
+			}
+
+			entries = append(entries, store.Entry{
+				Key:   string(key),
+				Value: bytes.Clone(valueBkt.Get([]byte("data"))),
+				TTL:   expiry.Sub(now),
+			})
+		}
+
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (s *Store) cleanup(ctx context.Context) error {
 	now := time.Now()
 
@@ -0,0 +1,137 @@
+package encrypted
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+var (
+	ErrNoKeys          = errors.New("encrypted.Config: at least one key is required")
+	ErrKeyNoID         = errors.New("encrypted.Key: id is required")
+	ErrKeyIDTooLong    = errors.New("encrypted.Key: id must be at most 255 bytes")
+	ErrKeyDuplicateID  = errors.New("encrypted.Key: id is used more than once")
+	ErrKeyNoSource     = errors.New("encrypted.Key: one of env or file is required")
+	ErrKeyBothSources  = errors.New("encrypted.Key: only one of env or file can be set")
+	ErrKeyNotSet       = errors.New("encrypted.Key: key material is empty")
+	ErrKeyWrongLength  = fmt.Errorf("encrypted.Key: key must be %d bytes long", chacha20poly1305.KeySize)
+	ErrKeyCantBeParsed = errors.New("encrypted.Key: key must be hex or base64 encoded")
+)
+
+// Config is the encryption at rest configuration for a store.
+type Config struct {
+	// Keys is the list of keys that can decrypt values. The first key is used
+	// to encrypt new values. To rotate keys, add the new key to the top of the
+	// list and remove the old key once every value encrypted with it has expired.
+	Keys []Key `json:"keys"`
+
+	// AllowPlaintext allows reading values that were stored before encryption
+	// was enabled.
+	AllowPlaintext bool `json:"allowPlaintext,omitempty"`
+}
+
+func (c Config) Valid() error {
+	var errs []error
+
+	if len(c.Keys) == 0 {
+		errs = append(errs, ErrNoKeys)
+	}
+
+	seen := map[string]struct{}{}
+	for i, k := range c.Keys {
+		if err := k.Valid(); err != nil {
+			errs = append(errs, fmt.Errorf("key %d: %w", i, err))
+		}
+
+		if _, ok := seen[k.ID]; ok {
+			errs = append(errs, fmt.Errorf("%w: %q", ErrKeyDuplicateID, k.ID))
+		}
+		seen[k.ID] = struct{}{}
+	}
+
+	if len(errs) != 0 {
+		return fmt.Errorf("encrypted.Config: invalid config: %w", errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// Key is a single encryption key. The key material is 32 bytes encoded in hex
+// or base64 and is read from an environment variable or a file so that it
+// does not live in the policy file.
+type Key struct {
+	// ID is stored alongside every value encrypted with this key so that the
+	// right key can be found when decrypting it.
+	ID string `json:"id"`
+
+	// Env is the name of the environment variable containing the key.
+	Env string `json:"env,omitempty"`
+
+	// File is the path of the file containing the key.
+	File string `json:"file,omitempty"`
+}
+
+func (k Key) Valid() error {
+	var errs []error
+
+	if k.ID == "" {
+		errs = append(errs, ErrKeyNoID)
+	}
+
+	if len(k.ID) > 255 {
+		errs = append(errs, ErrKeyIDTooLong)
+	}
+
+	switch {
+	case k.Env == "" && k.File == "":
+		errs = append(errs, ErrKeyNoSource)
+	case k.Env != "" && k.File != "":
+		errs = append(errs, ErrKeyBothSources)
+	}
+
+	if len(errs) != 0 {
+		return errors.Join(errs...)
+	}
+
+	return nil
+}
+
+// Load reads and decodes the key material.
+func (k Key) Load() ([]byte, error) {
+	var encoded string
+
+	switch {
+	case k.Env != "":
+		encoded = os.Getenv(k.Env)
+	case k.File != "":
+		data, err := os.ReadFile(k.File)
+		if err != nil {
+			return nil, fmt.Errorf("can't read key %q from %s: %w", k.ID, k.File, err)
+		}
+		encoded = string(data)
+	}
+
+	encoded = strings.TrimSpace(encoded)
+	if encoded == "" {
+		return nil, fmt.Errorf("%w: %q", ErrKeyNotSet, k.ID)
+	}
+
+	key, err := hex.DecodeString(encoded)
+	if err != nil {
+		key, err = base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrKeyCantBeParsed, k.ID)
+		}
+	}
+
+	if len(key) != chacha20poly1305.KeySize {
+		return nil, fmt.Errorf("%w: %q is %d bytes", ErrKeyWrongLength, k.ID, len(key))
+	}
+
+	return key, nil
+}
@@ -0,0 +1,170 @@
+// Package encrypted implements a store.Interface wrapper that encrypts values
+// before they are written to the underlying storage backend.
+package encrypted
+
+import (
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/TecharoHQ/anubis/lib/store"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+var (
+	ErrUnknownKeyID = errors.New("encrypted: value was encrypted with an unknown key")
+	ErrNotEncrypted = errors.New("encrypted: value is not encrypted")
+)
+
+// magic prefixes every encrypted value. It starts with a NUL byte so that it
+// can't be confused with the JSON values Anubis stores in plaintext.
+var magic = []byte("\x00AE1")
+
+// Store encrypts values with XChaCha20-Poly1305 before passing them to the
+// underlying store and decrypts them when they are read back.
+//
+// Encrypted values are laid out as:
+//
+//	magic | len(key id) | key id | nonce | ciphertext
+//
+// The store key is used as additional authenticated data so that encrypted
+// values can't be moved between keys.
+type Store struct {
+	underlying     store.Interface
+	primary        string
+	aeads          map[string]cipher.AEAD
+	allowPlaintext bool
+}
+
+var (
+	_ store.Interface = (*Store)(nil)
+	_ store.Scanner   = (*Store)(nil)
+)
+
+// New loads the keys in config and wraps underlying with them.
+func New(underlying store.Interface, config Config) (*Store, error) {
+	if err := config.Valid(); err != nil {
+		return nil, fmt.Errorf("%w: %w", store.ErrBadConfig, err)
+	}
+
+	result := &Store{
+		underlying:     underlying,
+		primary:        config.Keys[0].ID,
+		aeads:          make(map[string]cipher.AEAD, len(config.Keys)),
+		allowPlaintext: config.AllowPlaintext,
+	}
+
+	for _, k := range config.Keys {
+		key, err := k.Load()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", store.ErrBadConfig, err)
+		}
+
+		aead, err := chacha20poly1305.NewX(key)
+		if err != nil {
+			return nil, fmt.Errorf("[unexpected] can't create cipher for key %q: %w", k.ID, err)
+		}
+
+		result.aeads[k.ID] = aead
+	}
+
+	return result, nil
+}
+
+func (s *Store) Delete(ctx context.Context, key string) error {
+	return s.underlying.Delete(ctx, key)
+}
+
+func (s *Store) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := s.underlying.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.open(key, data)
+}
+
+func (s *Store) Set(ctx context.Context, key string, value []byte, expiry time.Duration) error {
+	data, err := s.seal(key, value)
+	if err != nil {
+		return err
+	}
+
+	return s.underlying.Set(ctx, key, data, expiry)
+}
+
+func (s *Store) IsPersistent() bool {
+	return s.underlying.IsPersistent()
+}
+
+// Scan decrypts every value in the underlying store whose key starts with
+// prefix. It stops with an error at the first value that can't be decrypted,
+// so that an export can't silently leave values out.
+func (s *Store) Scan(ctx context.Context, prefix string, fn func(store.Entry) error) error {
+	return store.Scan(ctx, s.underlying, prefix, func(e store.Entry) error {
+		value, err := s.open(e.Key, e.Value)
+		if err != nil {
+			return err
+		}
+
+		e.Value = value
+		return fn(e)
+	})
+}
+
+func (s *Store) seal(key string, value []byte) ([]byte, error) {
+	aead := s.aeads[s.primary]
+
+	result := make([]byte, 0, len(magic)+1+len(s.primary)+aead.NonceSize()+len(value)+aead.Overhead())
+	result = append(result, magic...)
+	result = append(result, byte(len(s.primary)))
+	result = append(result, s.primary...)
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("%w: can't generate nonce: %w", store.ErrCantEncode, err)
+	}
+	result = append(result, nonce...)
+
+	return aead.Seal(result, nonce, value, []byte(key)), nil
+}
+
+func (s *Store) open(key string, data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, magic) {
+		if s.allowPlaintext {
+			return data, nil
+		}
+
+		return nil, fmt.Errorf("%w: %w: %q", store.ErrCantDecode, ErrNotEncrypted, key)
+	}
+
+	rest := data[len(magic):]
+	if len(rest) < 1 || len(rest) < 1+int(rest[0]) {
+		return nil, fmt.Errorf("%w: %q: truncated header", store.ErrCantDecode, key)
+	}
+
+	keyID := string(rest[1 : 1+int(rest[0])])
+	rest = rest[1+int(rest[0]):]
+
+	aead, ok := s.aeads[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %w: %q", store.ErrCantDecode, ErrUnknownKeyID, keyID)
+	}
+
+	if len(rest) < aead.NonceSize() {
+		return nil, fmt.Errorf("%w: %q: truncated nonce", store.ErrCantDecode, key)
+	}
+
+	nonce, ciphertext := rest[:aead.NonceSize()], rest[aead.NonceSize():]
+
+	result, err := aead.Open(nil, nonce, ciphertext, []byte(key))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q: %w", store.ErrCantDecode, key, err)
+	}
+
+	return result, nil
+}
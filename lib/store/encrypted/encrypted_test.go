@@ -0,0 +1,301 @@
+package encrypted
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/TecharoHQ/anubis/lib/store"
+	"github.com/TecharoHQ/anubis/lib/store/memory"
+	"github.com/TecharoHQ/anubis/lib/store/storetest"
+)
+
+const (
+	testKey1 = "0000000000000000000000000000000000000000000000000000000000000001"
+	testKey2 = "0000000000000000000000000000000000000000000000000000000000000002"
+)
+
+// factory wraps an in-memory store so that it can be run through the common
+// store tests.
+type factory struct{}
+
+func (factory) Build(ctx context.Context, data json.RawMessage) (store.Interface, error) {
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+
+	return New(memory.New(ctx), config)
+}
+
+func (factory) Valid(data json.RawMessage) error {
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return err
+	}
+
+	return config.Valid()
+}
+
+func TestImpl(t *testing.T) {
+	t.Setenv("ANUBIS_TEST_STORE_KEY", testKey1)
+
+	data, err := json.Marshal(Config{
+		Keys: []Key{{ID: "test", Env: "ANUBIS_TEST_STORE_KEY"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storetest.Common(t, factory{}, json.RawMessage(data))
+}
+
+func TestEncryptsValues(t *testing.T) {
+	t.Setenv("ANUBIS_TEST_STORE_KEY", testKey1)
+
+	underlying := memory.New(t.Context())
+	s, err := New(underlying, Config{
+		Keys: []Key{{ID: "test", Env: "ANUBIS_TEST_STORE_KEY"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret := []byte(`{"X-Real-Ip":"198.51.100.1"}`)
+	if err := s.Set(t.Context(), "challenge:foo", secret, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := underlying.Get(t.Context(), "challenge:foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Contains(raw, []byte("198.51.100.1")) {
+		t.Errorf("underlying store contains plaintext: %q", raw)
+	}
+
+	// Moving a value to another key must make it fail to decrypt.
+	if err := underlying.Set(t.Context(), "challenge:bar", raw, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Get(t.Context(), "challenge:bar"); !errors.Is(err, store.ErrCantDecode) {
+		t.Errorf("wanted ErrCantDecode for moved value, got: %v", err)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	t.Setenv("ANUBIS_TEST_STORE_KEY_1", testKey1)
+	t.Setenv("ANUBIS_TEST_STORE_KEY_2", testKey2)
+
+	underlying := memory.New(t.Context())
+
+	old, err := New(underlying, Config{
+		Keys: []Key{{ID: "one", Env: "ANUBIS_TEST_STORE_KEY_1"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := old.Set(t.Context(), "foo", []byte("bar"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := New(underlying, Config{
+		Keys: []Key{
+			{ID: "two", Env: "ANUBIS_TEST_STORE_KEY_2"},
+			{ID: "one", Env: "ANUBIS_TEST_STORE_KEY_1"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	val, err := rotated.Get(t.Context(), "foo")
+	if err != nil {
+		t.Fatalf("can't read value encrypted with old key: %v", err)
+	}
+
+	if string(val) != "bar" {
+		t.Errorf("wanted %q, got %q", "bar", val)
+	}
+
+	if err := rotated.Set(t.Context(), "baz", []byte("qux"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := old.Get(t.Context(), "baz"); !errors.Is(err, ErrUnknownKeyID) {
+		t.Errorf("wanted ErrUnknownKeyID, got: %v", err)
+	}
+}
+
+func TestScanUndecryptable(t *testing.T) {
+	t.Setenv("ANUBIS_TEST_STORE_KEY_1", testKey1)
+	t.Setenv("ANUBIS_TEST_STORE_KEY_2", testKey2)
+
+	underlying := memory.New(t.Context())
+
+	old, err := New(underlying, Config{
+		Keys: []Key{{ID: "one", Env: "ANUBIS_TEST_STORE_KEY_1"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := old.Set(t.Context(), "foo", []byte("bar"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	// The old key was removed, so the value can't be decrypted anymore.
+	rotated, err := New(underlying, Config{
+		Keys: []Key{{ID: "two", Env: "ANUBIS_TEST_STORE_KEY_2"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := store.Export(t.Context(), rotated, &buf, ""); !errors.Is(err, ErrUnknownKeyID) {
+		t.Errorf("wanted the export to fail with ErrUnknownKeyID, got: %v", err)
+	}
+}
+
+func TestPlaintext(t *testing.T) {
+	t.Setenv("ANUBIS_TEST_STORE_KEY", testKey1)
+
+	underlying := memory.New(t.Context())
+	if err := underlying.Set(t.Context(), "foo", []byte(`{"legacy":true}`), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		err            error
+		name           string
+		allowPlaintext bool
+	}{
+		{
+			name: "rejected by default",
+			err:  ErrNotEncrypted,
+		},
+		{
+			name:           "allowed",
+			allowPlaintext: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := New(underlying, Config{
+				Keys:           []Key{{ID: "test", Env: "ANUBIS_TEST_STORE_KEY"}},
+				AllowPlaintext: tt.allowPlaintext,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := s.Get(t.Context(), "foo"); !errors.Is(err, tt.err) {
+				t.Logf("want: %v", tt.err)
+				t.Logf("got:  %v", err)
+				t.Error("wrong error")
+			}
+		})
+	}
+}
+
+func TestConfigValid(t *testing.T) {
+	for _, tt := range []struct {
+		err   error
+		name  string
+		input Config
+	}{
+		{
+			name:  "no keys",
+			input: Config{},
+			err:   ErrNoKeys,
+		},
+		{
+			name:  "valid",
+			input: Config{Keys: []Key{{ID: "a", Env: "FOO"}}},
+		},
+		{
+			name:  "no id",
+			input: Config{Keys: []Key{{Env: "FOO"}}},
+			err:   ErrKeyNoID,
+		},
+		{
+			name:  "no source",
+			input: Config{Keys: []Key{{ID: "a"}}},
+			err:   ErrKeyNoSource,
+		},
+		{
+			name:  "both sources",
+			input: Config{Keys: []Key{{ID: "a", Env: "FOO", File: "/foo"}}},
+			err:   ErrKeyBothSources,
+		},
+		{
+			name:  "duplicate id",
+			input: Config{Keys: []Key{{ID: "a", Env: "FOO"}, {ID: "a", Env: "BAR"}}},
+			err:   ErrKeyDuplicateID,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.input.Valid(); !errors.Is(err, tt.err) {
+				t.Logf("want: %v", tt.err)
+				t.Logf("got:  %v", err)
+				t.Error("wrong error")
+			}
+		})
+	}
+}
+
+func TestKeyLoad(t *testing.T) {
+	key, _ := hex.DecodeString(testKey1)
+
+	for _, tt := range []struct {
+		err   error
+		name  string
+		value string
+	}{
+		{
+			name:  "hex",
+			value: testKey1,
+		},
+		{
+			name:  "base64",
+			value: "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAE=",
+		},
+		{
+			name:  "empty",
+			value: "",
+			err:   ErrKeyNotSet,
+		},
+		{
+			name:  "too short",
+			value: "0001",
+			err:   ErrKeyWrongLength,
+		},
+		{
+			name:  "garbage",
+			value: "hunter2!",
+			err:   ErrKeyCantBeParsed,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ANUBIS_TEST_STORE_KEY", tt.value)
+
+			got, err := Key{ID: "test", Env: "ANUBIS_TEST_STORE_KEY"}.Load()
+			if !errors.Is(err, tt.err) {
+				t.Logf("want: %v", tt.err)
+				t.Logf("got:  %v", err)
+				t.Fatal("wrong error")
+			}
+
+			if tt.err == nil && !bytes.Equal(got, key) {
+				t.Errorf("wrong key loaded: %x", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package store
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Record is the JSON lines representation of a single value used by Export
+// and Import.
+type Record struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+
+	// Expiry is the absolute time the value expires at. It is absolute so that
+	// the time between export and import is not added to each value's lifetime.
+	// If it is unset, the value does not expire.
+	Expiry *time.Time `json:"expiry,omitempty"`
+}
+
+// Export writes every value in s whose key starts with prefix to w as JSON
+// lines. It returns the number of values written.
+func Export(ctx context.Context, s Interface, w io.Writer, prefix string) (int, error) {
+	enc := json.NewEncoder(w)
+	now := time.Now()
+	count := 0
+
+	err := Scan(ctx, s, prefix, func(e Entry) error {
+		rec := Record{
+			Key:   e.Key,
+			Value: e.Value,
+		}
+
+		if e.TTL > 0 {
+			expiry := now.Add(e.TTL)
+			rec.Expiry = &expiry
+		}
+
+		if err := enc.Encode(rec); err != nil {
+			return fmt.Errorf("can't write record for %q: %w", e.Key, err)
+		}
+
+		count++
+		return nil
+	})
+
+	return count, err
+}
+
+// Import reads JSON lines written by Export from r and puts them into s. Values
+// that expired since they were exported are skipped. It returns the number of
+// values imported.
+func Import(ctx context.Context, s Interface, r io.Reader) (int, error) {
+	sc := bufio.NewScanner(r)
+	// Values can be much larger than bufio's default 64k line limit.
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	count := 0
+	line := 0
+
+	for sc.Scan() {
+		line++
+
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+
+		var rec Record
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			return count, fmt.Errorf("%w: line %d: %w", ErrCantDecode, line, err)
+		}
+
+		var ttl time.Duration
+		if rec.Expiry != nil {
+			ttl = time.Until(*rec.Expiry)
+			if ttl <= 0 {
+				continue
+			}
+		}
+
+		if err := s.Set(ctx, rec.Key, rec.Value, ttl); err != nil {
+			return count, fmt.Errorf("can't import %q: %w", rec.Key, err)
+		}
+
+		count++
+	}
+
+	if err := sc.Err(); err != nil {
+		return count, fmt.Errorf("can't read records: %w", err)
+	}
+
+	return count, nil
+}
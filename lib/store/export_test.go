@@ -0,0 +1,91 @@
+package store_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/TecharoHQ/anubis/lib/store"
+	"github.com/TecharoHQ/anubis/lib/store/memory"
+)
+
+func TestExportImport(t *testing.T) {
+	src := memory.New(t.Context())
+	dst := memory.New(t.Context())
+
+	for _, key := range []string{"challenge:foo", "challenge:bar", "dronebl:1.1.1.1"} {
+		if err := src.Set(t.Context(), key, []byte(key), time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	n, err := store.Export(t.Context(), src, &buf, "challenge:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 2 {
+		t.Errorf("wanted 2 records exported, got %d", n)
+	}
+
+	n, err = store.Import(t.Context(), dst, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 2 {
+		t.Errorf("wanted 2 records imported, got %d", n)
+	}
+
+	for _, key := range []string{"challenge:foo", "challenge:bar"} {
+		val, err := dst.Get(t.Context(), key)
+		if err != nil {
+			t.Errorf("can't get %q: %v", key, err)
+			continue
+		}
+
+		if string(val) != key {
+			t.Errorf("key %q: want %q, got %q", key, key, val)
+		}
+	}
+
+	if _, err := dst.Get(t.Context(), "dronebl:1.1.1.1"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("key outside of prefix was imported: %v", err)
+	}
+}
+
+func TestImportSkipsExpired(t *testing.T) {
+	dst := memory.New(t.Context())
+
+	input := `{"key":"old","value":"b2xk","expiry":"2006-01-02T15:04:05Z"}
+{"key":"new","value":"bmV3","expiry":"` + time.Now().Add(time.Hour).Format(time.RFC3339) + `"}
+`
+
+	n, err := store.Import(t.Context(), dst, bytes.NewBufferString(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 1 {
+		t.Errorf("wanted 1 record imported, got %d", n)
+	}
+
+	if _, err := dst.Get(t.Context(), "old"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("expired record was imported: %v", err)
+	}
+
+	if val, err := dst.Get(t.Context(), "new"); err != nil || string(val) != "new" {
+		t.Errorf("wanted new record to be imported, got %q: %v", val, err)
+	}
+}
+
+func TestExportUnsupported(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := store.Export(t.Context(), noScan{}, &buf, ""); !errors.Is(err, store.ErrScanNotSupported) {
+		t.Errorf("wanted ErrScanNotSupported, got: %v", err)
+	}
+}
+
+type noScan struct{ store.Interface }
@@ -23,6 +23,10 @@ var (
 
 	// ErrBadConfig is returned when a store adaptor's configuration is invalid.
 	ErrBadConfig = errors.New("store: configuration is invalid")
+
+	// ErrScanNotSupported is returned when a store adaptor cannot enumerate
+	// its keys.
+	ErrScanNotSupported = errors.New("store: backend does not support scanning")
 )
 
 // Interface defines the calls that Anubis uses for storage in a local or remote
@@ -44,6 +48,39 @@ type Interface interface {
 	IsPersistent() bool
 }
 
+// Entry is a single value found while scanning a store.
+type Entry struct {
+	// Key is the key the value is stored under.
+	Key string
+
+	// Value is the raw value.
+	Value []byte
+
+	// TTL is the remaining time before the value expires. A zero TTL means
+	// that the value does not expire.
+	TTL time.Duration
+}
+
+// Scanner is an optional interface that storage backends can implement to
+// enumerate the values they contain. This is used to migrate data between
+// backends.
+type Scanner interface {
+	// Scan calls fn for every unexpired value whose key starts with prefix. If
+	// fn returns an error, scanning stops and that error is returned.
+	Scan(ctx context.Context, prefix string, fn func(Entry) error) error
+}
+
+// Scan enumerates the values in s whose key starts with prefix. If s does not
+// implement Scanner, it returns ErrScanNotSupported.
+func Scan(ctx context.Context, s Interface, prefix string, fn func(Entry) error) error {
+	sc, ok := s.(Scanner)
+	if !ok {
+		return ErrScanNotSupported
+	}
+
+	return sc.Scan(ctx, prefix, fn)
+}
+
 func z[T any]() T { return *new(T) }
 
 type JSON[T any] struct {
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/TecharoHQ/anubis/decaymap"
@@ -48,6 +49,26 @@ func (i *impl) Set(_ context.Context, key string, value []byte, expiry time.Dura
 	return nil
 }
 
+func (i *impl) Scan(_ context.Context, prefix string, fn func(store.Entry) error) error {
+	var err error
+
+	i.store.Range(func(key string, value []byte, expiry time.Time) bool {
+		if !strings.HasPrefix(key, prefix) {
+			return true
+		}
+
+		err = fn(store.Entry{
+			Key:   key,
+			Value: value,
+			TTL:   time.Until(expiry),
+		})
+
+		return err == nil
+	})
+
+	return err
+}
+
 func (i *impl) IsPersistent() bool {
 	return false
 }
@@ -28,6 +28,9 @@ type S3API interface {
 	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
 	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
 	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	GetBucketLifecycleConfiguration(ctx context.Context, params *s3.GetBucketLifecycleConfigurationInput, optFns ...func(*s3.Options)) (*s3.GetBucketLifecycleConfigurationOutput, error)
+	PutBucketLifecycleConfiguration(ctx context.Context, params *s3.PutBucketLifecycleConfigurationInput, optFns ...func(*s3.Options)) (*s3.PutBucketLifecycleConfigurationOutput, error)
 }
 
 // Factory builds an S3-backed store. Tests can inject a Mock via Client.
@@ -51,27 +54,39 @@ func (f Factory) Build(ctx context.Context, data json.RawMessage) (store.Interfa
 		return nil, fmt.Errorf("%w: %s", store.ErrBadConfig, ErrNoBucketName)
 	}
 
-	// If a client was injected (e.g., tests), use it directly.
-	if f.Client != nil {
-		return &Store{
-			s3:     f.Client,
-			bucket: config.BucketName,
-		}, nil
+	result := &Store{
+		s3:     f.Client,
+		bucket: config.BucketName,
 	}
 
-	cfg, err := awsConfig.LoadDefaultConfig(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("can't load AWS config from environment: %w", err)
+	// If a client was not injected (e.g., tests), build one from the environment.
+	if result.s3 == nil {
+		cfg, err := awsConfig.LoadDefaultConfig(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("can't load AWS config from environment: %w", err)
+		}
+
+		result.s3 = s3.NewFromConfig(cfg, func(o *s3.Options) {
+			o.UsePathStyle = config.PathStyle
+		})
 	}
 
-	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
-		o.UsePathStyle = config.PathStyle
-	})
+	if config.LifecycleExpirationDays != 0 {
+		prefix := DefaultLifecyclePrefix
+		if config.LifecyclePrefix != nil {
+			prefix = *config.LifecyclePrefix
+		}
 
-	return &Store{
-		s3:     client,
-		bucket: config.BucketName,
-	}, nil
+		if err := result.setLifecycle(ctx, prefix, config.LifecycleExpirationDays); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.Reaper != nil {
+		go result.reaperThread(ctx, *config.Reaper)
+	}
+
+	return result, nil
 }
 
 func (Factory) Valid(data json.RawMessage) error {
@@ -90,6 +105,17 @@ func (Factory) Valid(data json.RawMessage) error {
 type Config struct {
 	BucketName string `json:"bucketName"`
 	PathStyle  bool   `json:"pathStyle"`
+
+	// Reaper, if set, periodically removes expired objects from the bucket.
+	Reaper *Reaper `json:"reaper,omitempty"`
+
+	// LifecycleExpirationDays, if set, installs a bucket lifecycle rule at
+	// startup that expires objects under LifecyclePrefix after this many days.
+	LifecycleExpirationDays int32 `json:"lifecycleExpirationDays,omitempty"`
+
+	// LifecyclePrefix is the key prefix the lifecycle rule applies to. It
+	// defaults to DefaultLifecyclePrefix.
+	LifecyclePrefix *string `json:"lifecyclePrefix,omitempty"`
 }
 
 func (c Config) Valid() error {
@@ -99,6 +125,20 @@ func (c Config) Valid() error {
 		errs = append(errs, ErrNoBucketName)
 	}
 
+	if c.Reaper != nil {
+		if err := c.Reaper.Valid(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if c.LifecycleExpirationDays < 0 {
+		errs = append(errs, ErrBadLifecycleDays)
+	}
+
+	if c.LifecyclePrefix != nil && *c.LifecyclePrefix == "" {
+		errs = append(errs, ErrNoLifecyclePrefix)
+	}
+
 	if len(errs) != 0 {
 		return fmt.Errorf("s3api.Config: invalid config: %w", errors.Join(errs...))
 	}
@@ -0,0 +1,223 @@
+package s3api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	ErrBadReaperInterval = errors.New("s3api.Reaper: interval is invalid")
+	ErrBadReaperPageSize = errors.New("s3api.Reaper: pageSize must be between 1 and 1000")
+	ErrBadReaperRate     = errors.New("s3api.Reaper: requestsPerSecond must not be negative")
+	ErrBadLifecycleDays  = errors.New("s3api.Config: lifecycleExpirationDays must not be negative")
+	ErrNoLifecyclePrefix = errors.New("s3api.Config: lifecyclePrefix must not be empty, or the lifecycle rule would expire every object in the bucket")
+
+	reapedObjects = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "anubis_s3api_reaped_objects_total",
+		Help: "The total number of expired objects removed from S3 by the background reaper",
+	})
+)
+
+// expiryMetadataKey is the object metadata key that holds the time an object
+// expires at in milliseconds since the Unix epoch.
+const expiryMetadataKey = "x-anubis-expiry-ms"
+
+// lifecycleRuleID is the ID of the bucket lifecycle rule Anubis manages.
+const lifecycleRuleID = "anubis-expiry"
+
+// DefaultLifecyclePrefix is the key prefix the lifecycle rule applies to if
+// the config doesn't set one. Challenges are the objects Anubis creates the
+// most of, and they all expire after 30 minutes.
+const DefaultLifecyclePrefix = "challenge:"
+
+// Reaper configures the background removal of expired objects.
+type Reaper struct {
+	// Interval is how often the bucket is swept, in time.ParseDuration format.
+	Interval string `json:"interval"`
+
+	// PageSize is how many objects are listed at once.
+	PageSize int32 `json:"pageSize,omitempty"`
+
+	// RequestsPerSecond limits how many S3 requests the reaper makes per second
+	// so that it does not compete with requests for live traffic. Zero means
+	// unlimited.
+	RequestsPerSecond float64 `json:"requestsPerSecond,omitempty"`
+}
+
+func (r Reaper) Valid() error {
+	var errs []error
+
+	if d, err := time.ParseDuration(r.Interval); err != nil {
+		errs = append(errs, fmt.Errorf("%w: %w", ErrBadReaperInterval, err))
+	} else if d <= 0 {
+		errs = append(errs, fmt.Errorf("%w: must be positive, got %s", ErrBadReaperInterval, r.Interval))
+	}
+
+	if r.PageSize < 0 || r.PageSize > 1000 {
+		errs = append(errs, fmt.Errorf("%w, got %d", ErrBadReaperPageSize, r.PageSize))
+	}
+
+	if r.RequestsPerSecond < 0 {
+		errs = append(errs, ErrBadReaperRate)
+	}
+
+	if len(errs) != 0 {
+		return errors.Join(errs...)
+	}
+
+	return nil
+}
+
+// reap removes every object in the bucket whose expiry metadata is in the
+// past. It returns the number of objects removed.
+func (s *Store) reap(ctx context.Context, pageSize int32, requestsPerSecond float64) (int, error) {
+	if pageSize == 0 {
+		pageSize = 1000
+	}
+
+	wait := func() error { return nil }
+	if requestsPerSecond > 0 {
+		t := time.NewTicker(time.Duration(float64(time.Second) / requestsPerSecond))
+		defer t.Stop()
+
+		wait = func() error {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-t.C:
+				return nil
+			}
+		}
+	}
+
+	pages := s3.NewListObjectsV2Paginator(s.s3, &s3.ListObjectsV2Input{
+		Bucket:  &s.bucket,
+		MaxKeys: aws.Int32(pageSize),
+	})
+
+	count := 0
+	now := time.Now()
+
+	for pages.HasMorePages() {
+		if err := wait(); err != nil {
+			return count, err
+		}
+
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return count, fmt.Errorf("can't list s3 objects: %w", err)
+		}
+
+		for _, obj := range page.Contents {
+			if err := wait(); err != nil {
+				return count, err
+			}
+
+			head, err := s.s3.HeadObject(ctx, &s3.HeadObjectInput{Bucket: &s.bucket, Key: obj.Key})
+			if isNotFound(err) {
+				// deleted between listing and probing
+				continue
+			}
+			if err != nil {
+				return count, fmt.Errorf("can't probe s3 object %s: %w", aws.ToString(obj.Key), err)
+			}
+
+			msStr, ok := head.Metadata[expiryMetadataKey]
+			if !ok {
+				continue
+			}
+
+			ms, err := strconv.ParseInt(msStr, 10, 64)
+			if err != nil || now.UnixMilli() < ms {
+				continue
+			}
+
+			if err := wait(); err != nil {
+				return count, err
+			}
+
+			if _, err := s.s3.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: &s.bucket, Key: obj.Key}); err != nil {
+				return count, fmt.Errorf("can't delete from s3: %w", err)
+			}
+
+			count++
+			reapedObjects.Inc()
+		}
+	}
+
+	return count, nil
+}
+
+func (s *Store) reaperThread(ctx context.Context, config Reaper) {
+	// already validated in Valid()
+	interval, _ := time.ParseDuration(config.Interval)
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			n, err := s.reap(ctx, config.PageSize, config.RequestsPerSecond)
+			if err != nil && !errors.Is(err, context.Canceled) {
+				slog.Error("error during s3api reaping", "err", err, "bucket", s.bucket)
+			}
+			slog.Debug("s3api reaper finished", "bucket", s.bucket, "removed", n)
+		}
+	}
+}
+
+// setLifecycle installs a bucket lifecycle rule that expires the objects
+// whose keys start with prefix after days days. Other lifecycle rules on the
+// bucket are kept, and the rule Anubis installed before is replaced.
+func (s *Store) setLifecycle(ctx context.Context, prefix string, days int32) error {
+	var rules []types.LifecycleRule
+
+	existing, err := s.s3.GetBucketLifecycleConfiguration(ctx, &s3.GetBucketLifecycleConfigurationInput{Bucket: &s.bucket})
+	var apiErr smithy.APIError
+	switch {
+	case errors.As(err, &apiErr) && apiErr.ErrorCode() == "NoSuchLifecycleConfiguration":
+		// no rules yet
+	case err != nil:
+		return fmt.Errorf("can't read lifecycle rules of bucket %s: %w", s.bucket, err)
+	default:
+		for _, rule := range existing.Rules {
+			if aws.ToString(rule.ID) != lifecycleRuleID {
+				rules = append(rules, rule)
+			}
+		}
+	}
+
+	rules = append(rules, types.LifecycleRule{
+		ID:     aws.String(lifecycleRuleID),
+		Status: types.ExpirationStatusEnabled,
+		Filter: &types.LifecycleRuleFilter{Prefix: aws.String(strings.ReplaceAll(prefix, ":", "/"))},
+		Expiration: &types.LifecycleExpiration{
+			Days: aws.Int32(days),
+		},
+	})
+
+	_, err = s.s3.PutBucketLifecycleConfiguration(ctx, &s3.PutBucketLifecycleConfigurationInput{
+		Bucket:                 &s.bucket,
+		LifecycleConfiguration: &types.BucketLifecycleConfiguration{Rules: rules},
+	})
+	if err != nil {
+		return fmt.Errorf("can't set lifecycle rule on bucket %s: %w", s.bucket, err)
+	}
+
+	return nil
+}
@@ -3,6 +3,7 @@ package s3api
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"strconv"
@@ -10,7 +11,9 @@ import (
 	"time"
 
 	"github.com/TecharoHQ/anubis/lib/store"
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
 type Store struct {
@@ -40,7 +43,7 @@ func (s *Store) Get(ctx context.Context, key string) ([]byte, error) {
 		return nil, fmt.Errorf("%w: %w", store.ErrNotFound, err)
 	}
 	defer out.Body.Close()
-	if msStr, ok := out.Metadata["x-anubis-expiry-ms"]; ok && msStr != "" {
+	if msStr, ok := out.Metadata[expiryMetadataKey]; ok && msStr != "" {
 		if ms, err := strconv.ParseInt(msStr, 10, 64); err == nil {
 			if time.Now().UnixMilli() >= ms {
 				_, _ = s.s3.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: &s.bucket, Key: &normKey})
@@ -57,11 +60,12 @@ func (s *Store) Get(ctx context.Context, key string) ([]byte, error) {
 
 func (s *Store) Set(ctx context.Context, key string, value []byte, expiry time.Duration) error {
 	normKey := strings.ReplaceAll(key, ":", "/")
-	// S3 has no native TTL; we store object with metadata X-Anubis-Expiry as epoch seconds.
+	// S3 has no native TTL; we store the expiry time as object metadata so that
+	// reads and the reaper can tell when it has passed.
 	var meta map[string]string
 	if expiry > 0 {
 		exp := time.Now().Add(expiry).UnixMilli()
-		meta = map[string]string{"x-anubis-expiry-ms": fmt.Sprintf("%d", exp)}
+		meta = map[string]string{expiryMetadataKey: fmt.Sprintf("%d", exp)}
 	}
 	_, err := s.s3.PutObject(ctx, &s3.PutObjectInput{
 		Bucket:   &s.bucket,
@@ -75,4 +79,70 @@ func (s *Store) Set(ctx context.Context, key string, value []byte, expiry time.D
 	return nil
 }
 
+// Scan calls fn for every unexpired object whose key starts with prefix.
+//
+// Object keys are reported with slashes turned back into colons. This is lossy
+// for keys that contained slashes before they were stored (such as Open Graph
+// cache keys), but those are only caches.
+func (s *Store) Scan(ctx context.Context, prefix string, fn func(store.Entry) error) error {
+	normPrefix := strings.ReplaceAll(prefix, ":", "/")
+	pages := s3.NewListObjectsV2Paginator(s.s3, &s3.ListObjectsV2Input{
+		Bucket: &s.bucket,
+		Prefix: &normPrefix,
+	})
+
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("can't list s3 objects: %w", err)
+		}
+
+		for _, obj := range page.Contents {
+			key := strings.ReplaceAll(aws.ToString(obj.Key), "/", ":")
+
+			out, err := s.s3.GetObject(ctx, &s3.GetObjectInput{
+				Bucket: &s.bucket,
+				Key:    obj.Key,
+			})
+			if isNotFound(err) {
+				// deleted between listing and fetching
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("can't fetch s3 object %s: %w", aws.ToString(obj.Key), err)
+			}
+
+			var ttl time.Duration
+			if msStr, ok := out.Metadata[expiryMetadataKey]; ok && msStr != "" {
+				if ms, err := strconv.ParseInt(msStr, 10, 64); err == nil {
+					ttl = time.Until(time.UnixMilli(ms))
+					if ttl <= 0 {
+						out.Body.Close()
+						continue
+					}
+				}
+			}
+
+			b, err := io.ReadAll(out.Body)
+			out.Body.Close()
+			if err != nil {
+				return fmt.Errorf("can't read s3 object: %w", err)
+			}
+
+			if err := fn(store.Entry{Key: key, Value: b, TTL: ttl}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
 func (Store) IsPersistent() bool { return true }
+
+// isNotFound reports whether err means the object does not exist.
+func isNotFound(err error) bool {
+	var noSuchKey *types.NoSuchKey
+	var notFound *types.NotFound
+	return errors.As(err, &noSuchKey) || errors.As(err, &notFound)
+}
@@ -4,23 +4,32 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"slices"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/TecharoHQ/anubis/lib/store"
 	"github.com/TecharoHQ/anubis/lib/store/storetest"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
 )
 
 // mockS3 is an in-memory mock of the methods we use.
 type mockS3 struct {
-	data   map[string][]byte
-	meta   map[string]map[string]string
-	bucket string
-	mu     sync.RWMutex
+	data      map[string][]byte
+	meta      map[string]map[string]string
+	lifecycle *types.BucketLifecycleConfiguration
+	getErr    error
+	headErr   error
+	bucket    string
+	mu        sync.RWMutex
 }
 
 func (m *mockS3) PutObject(ctx context.Context, in *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
@@ -47,9 +56,12 @@ func (m *mockS3) PutObject(ctx context.Context, in *s3.PutObjectInput, _ ...func
 func (m *mockS3) GetObject(ctx context.Context, in *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
+	if m.getErr != nil {
+		return nil, m.getErr
+	}
 	b, ok := m.data[aws.ToString(in.Key)]
 	if !ok {
-		return nil, fmt.Errorf("not found")
+		return nil, &types.NoSuchKey{}
 	}
 	out := &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(b))}
 	if md, ok := m.meta[aws.ToString(in.Key)]; ok {
@@ -69,10 +81,51 @@ func (m *mockS3) DeleteObject(ctx context.Context, in *s3.DeleteObjectInput, _ .
 func (m *mockS3) HeadObject(ctx context.Context, in *s3.HeadObjectInput, _ ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
+	if m.headErr != nil {
+		return nil, m.headErr
+	}
 	if _, ok := m.data[aws.ToString(in.Key)]; !ok {
-		return nil, fmt.Errorf("not found")
+		return nil, &types.NotFound{}
 	}
-	return &s3.HeadObjectOutput{}, nil
+	return &s3.HeadObjectOutput{Metadata: m.meta[aws.ToString(in.Key)]}, nil
+}
+
+func (m *mockS3) ListObjectsV2(ctx context.Context, in *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var keys []string
+	for k := range m.data {
+		if strings.HasPrefix(k, aws.ToString(in.Prefix)) && k > aws.ToString(in.ContinuationToken) {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+	out := &s3.ListObjectsV2Output{}
+	if maxKeys := int(aws.ToInt32(in.MaxKeys)); maxKeys > 0 && len(keys) > maxKeys {
+		keys = keys[:maxKeys]
+		out.IsTruncated = aws.Bool(true)
+		out.NextContinuationToken = aws.String(keys[len(keys)-1])
+	}
+	for _, k := range keys {
+		out.Contents = append(out.Contents, types.Object{Key: aws.String(k)})
+	}
+	return out, nil
+}
+
+func (m *mockS3) GetBucketLifecycleConfiguration(ctx context.Context, in *s3.GetBucketLifecycleConfigurationInput, _ ...func(*s3.Options)) (*s3.GetBucketLifecycleConfigurationOutput, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.lifecycle == nil {
+		return nil, &smithy.GenericAPIError{Code: "NoSuchLifecycleConfiguration"}
+	}
+	return &s3.GetBucketLifecycleConfigurationOutput{Rules: m.lifecycle.Rules}, nil
+}
+
+func (m *mockS3) PutBucketLifecycleConfiguration(ctx context.Context, in *s3.PutBucketLifecycleConfigurationInput, _ ...func(*s3.Options)) (*s3.PutBucketLifecycleConfigurationOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lifecycle = in.LifecycleConfiguration
+	return &s3.PutBucketLifecycleConfigurationOutput{}, nil
 }
 
 func TestImpl(t *testing.T) {
@@ -138,3 +191,243 @@ func TestKeyNormalization(t *testing.T) {
 		t.Fatalf("normalized key still exists after Delete")
 	}
 }
+
+func TestScanFetchError(t *testing.T) {
+	mock := &mockS3{}
+	s := &Store{s3: mock, bucket: "anubis"}
+
+	if err := s.Set(t.Context(), "challenge:a", []byte("a"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	// A throttled or failed fetch must fail the scan instead of leaving the
+	// object out.
+	errThrottled := errors.New("SlowDown: please reduce your request rate")
+	mock.getErr = errThrottled
+
+	err := s.Scan(t.Context(), "", func(store.Entry) error { return nil })
+	if !errors.Is(err, errThrottled) {
+		t.Errorf("wanted the fetch error, got: %v", err)
+	}
+}
+
+func TestReap(t *testing.T) {
+	mock := &mockS3{}
+	s := &Store{s3: mock, bucket: "anubis"}
+
+	if err := s.Set(t.Context(), "challenge:live", []byte("live"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set(t.Context(), "challenge:forever", []byte("forever"), 0); err != nil {
+		t.Fatal(err)
+	}
+	for i := range 5 {
+		if err := s.Set(t.Context(), fmt.Sprintf("challenge:dead%d", i), []byte("dead"), time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	time.Sleep(5 * time.Millisecond)
+
+	n, err := s.reap(t.Context(), 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 5 {
+		t.Errorf("wanted 5 objects reaped, got %d", n)
+	}
+
+	mock.mu.RLock()
+	defer mock.mu.RUnlock()
+
+	if len(mock.data) != 2 {
+		t.Errorf("wanted 2 objects left, got %d", len(mock.data))
+	}
+
+	for _, key := range []string{"challenge/live", "challenge/forever"} {
+		if _, ok := mock.data[key]; !ok {
+			t.Errorf("object %q was reaped but has not expired", key)
+		}
+	}
+}
+
+func TestReapProbeError(t *testing.T) {
+	mock := &mockS3{}
+	s := &Store{s3: mock, bucket: "anubis"}
+
+	if err := s.Set(t.Context(), "challenge:dead", []byte("dead"), time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	errThrottled := errors.New("SlowDown: please reduce your request rate")
+	mock.headErr = errThrottled
+
+	if _, err := s.reap(t.Context(), 0, 0); !errors.Is(err, errThrottled) {
+		t.Errorf("wanted the probe error, got: %v", err)
+	}
+}
+
+func TestReapRateLimit(t *testing.T) {
+	mock := &mockS3{}
+	s := &Store{s3: mock, bucket: "anubis"}
+
+	if err := s.Set(t.Context(), "challenge:live", []byte("live"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+
+	// One request per second can't finish listing and probing in time.
+	if _, err := s.reap(ctx, 0, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("wanted context.DeadlineExceeded, got: %v", err)
+	}
+}
+
+func TestLifecycle(t *testing.T) {
+	t.Run("new", func(t *testing.T) {
+		mock := &mockS3{}
+		f := Factory{Client: mock}
+
+		data, _ := json.Marshal(Config{
+			BucketName:              "anubis",
+			LifecycleExpirationDays: 7,
+		})
+
+		if _, err := f.Build(t.Context(), json.RawMessage(data)); err != nil {
+			t.Fatal(err)
+		}
+
+		mock.mu.RLock()
+		defer mock.mu.RUnlock()
+
+		if mock.lifecycle == nil || len(mock.lifecycle.Rules) != 1 {
+			t.Fatalf("wanted one lifecycle rule, got: %#v", mock.lifecycle)
+		}
+
+		rule := mock.lifecycle.Rules[0]
+		if days := aws.ToInt32(rule.Expiration.Days); days != 7 {
+			t.Errorf("wanted expiration after 7 days, got %d", days)
+		}
+
+		if prefix := aws.ToString(rule.Filter.Prefix); prefix != "challenge/" {
+			t.Errorf("wanted the rule to only cover challenge/, got %q", prefix)
+		}
+	})
+
+	t.Run("merge", func(t *testing.T) {
+		mock := &mockS3{
+			lifecycle: &types.BucketLifecycleConfiguration{
+				Rules: []types.LifecycleRule{
+					{ID: aws.String("logs"), Status: types.ExpirationStatusEnabled, Filter: &types.LifecycleRuleFilter{Prefix: aws.String("logs/")}},
+					{ID: aws.String(lifecycleRuleID), Status: types.ExpirationStatusEnabled, Filter: &types.LifecycleRuleFilter{Prefix: aws.String("")}},
+				},
+			},
+		}
+		f := Factory{Client: mock}
+
+		data, _ := json.Marshal(Config{
+			BucketName:              "anubis",
+			LifecycleExpirationDays: 1,
+			LifecyclePrefix:         aws.String("anubis:"),
+		})
+
+		if _, err := f.Build(t.Context(), json.RawMessage(data)); err != nil {
+			t.Fatal(err)
+		}
+
+		mock.mu.RLock()
+		defer mock.mu.RUnlock()
+
+		if len(mock.lifecycle.Rules) != 2 {
+			t.Fatalf("wanted the other rule to be kept and ours replaced, got: %#v", mock.lifecycle.Rules)
+		}
+
+		if id := aws.ToString(mock.lifecycle.Rules[0].ID); id != "logs" {
+			t.Errorf("wanted the logs rule to be kept, got %q", id)
+		}
+
+		if prefix := aws.ToString(mock.lifecycle.Rules[1].Filter.Prefix); prefix != "anubis/" {
+			t.Errorf("wanted the rule to only cover anubis/, got %q", prefix)
+		}
+	})
+}
+
+func TestConfigValid(t *testing.T) {
+	for _, tt := range []struct {
+		err   error
+		name  string
+		input Config
+	}{
+		{
+			name:  "no bucket",
+			input: Config{},
+			err:   ErrNoBucketName,
+		},
+		{
+			name: "reaper",
+			input: Config{
+				BucketName: "anubis",
+				Reaper:     &Reaper{Interval: "1h", PageSize: 100, RequestsPerSecond: 10},
+			},
+		},
+		{
+			name: "reaper bad interval",
+			input: Config{
+				BucketName: "anubis",
+				Reaper:     &Reaper{Interval: "whenever"},
+			},
+			err: ErrBadReaperInterval,
+		},
+		{
+			name: "reaper negative interval",
+			input: Config{
+				BucketName: "anubis",
+				Reaper:     &Reaper{Interval: "-1h"},
+			},
+			err: ErrBadReaperInterval,
+		},
+		{
+			name: "reaper page too big",
+			input: Config{
+				BucketName: "anubis",
+				Reaper:     &Reaper{Interval: "1h", PageSize: 5000},
+			},
+			err: ErrBadReaperPageSize,
+		},
+		{
+			name: "reaper negative rate",
+			input: Config{
+				BucketName: "anubis",
+				Reaper:     &Reaper{Interval: "1h", RequestsPerSecond: -1},
+			},
+			err: ErrBadReaperRate,
+		},
+		{
+			name: "empty lifecycle prefix",
+			input: Config{
+				BucketName:              "anubis",
+				LifecycleExpirationDays: 7,
+				LifecyclePrefix:         aws.String(""),
+			},
+			err: ErrNoLifecyclePrefix,
+		},
+		{
+			name: "negative lifecycle",
+			input: Config{
+				BucketName:              "anubis",
+				LifecycleExpirationDays: -1,
+			},
+			err: ErrBadLifecycleDays,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.input.Valid(); !errors.Is(err, tt.err) {
+				t.Logf("want: %v", tt.err)
+				t.Logf("got:  %v", err)
+				t.Error("wrong error")
+			}
+		})
+	}
+}
@@ -78,6 +78,53 @@ func Common(t *testing.T, f store.Factory, config json.RawMessage) {
 					t.Errorf("wanted %s to not exist in store but it exists anyways", t.Name())
 				}
 
+				return nil
+			},
+		},
+		{
+			name: "scan",
+			doer: func(t *testing.T, s store.Interface) error {
+				if _, ok := s.(store.Scanner); !ok {
+					t.Skip("store does not implement store.Scanner")
+				}
+
+				prefix := "storetest-scan:"
+				want := map[string][]byte{
+					prefix + "a": []byte("a"),
+					prefix + "b": []byte("b"),
+				}
+
+				for k, v := range want {
+					if err := s.Set(t.Context(), k, v, 5*time.Minute); err != nil {
+						return err
+					}
+				}
+
+				if err := s.Set(t.Context(), "not"+prefix, []byte("nope"), 5*time.Minute); err != nil {
+					return err
+				}
+
+				got := map[string][]byte{}
+				if err := store.Scan(t.Context(), s, prefix, func(e store.Entry) error {
+					if e.TTL <= 0 || e.TTL > 5*time.Minute {
+						t.Errorf("key %q has wrong TTL: %s", e.Key, e.TTL)
+					}
+					got[e.Key] = e.Value
+					return nil
+				}); err != nil {
+					return err
+				}
+
+				if len(got) != len(want) {
+					t.Errorf("wanted %d entries, got %d: %v", len(want), len(got), got)
+				}
+
+				for k, v := range want {
+					if !bytes.Equal(got[k], v) {
+						t.Errorf("key %q: want %q, got %q", k, v, got[k])
+					}
+				}
+
 				return nil
 			},
 		},
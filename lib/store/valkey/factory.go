@@ -2,6 +2,7 @@ package valkey
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -25,6 +26,9 @@ var (
 	ErrSentinelMasterNameRequired = errors.New("valkey.Sentinel: masterName is required")
 	ErrSentinelAddrRequired       = errors.New("valkey.Sentinel: addr is required")
 	ErrSentinelAddrEmpty          = errors.New("valkey.Sentinel: addr cannot be empty")
+
+	ErrReplicaURLNotStandalone = errors.New("valkey.Config: replicaURL can only be used without cluster or sentinel, use readFromReplicas instead")
+	ErrReadFromReplicasNoHA    = errors.New("valkey.Config: readFromReplicas requires cluster or sentinel, use replicaURL instead")
 )
 
 // Config is what Anubis unmarshals from the "parameters" JSON.
@@ -33,6 +37,21 @@ type Config struct {
 	Cluster bool   `json:"cluster,omitempty"`
 
 	Sentinel *Sentinel `json:"sentinel,omitempty"`
+
+	// TLS configures TLS and client certificates for every connection.
+	TLS *TLS `json:"tls,omitempty"`
+
+	// UsernameFile and PasswordFile are paths to files containing the ACL
+	// username and password. They override any credentials in URL or Sentinel.
+	UsernameFile string `json:"usernameFile,omitempty"`
+	PasswordFile string `json:"passwordFile,omitempty"`
+
+	// ReplicaURL is the URL of a read replica (or a load balancer in front of
+	// several). If set, reads go to it and writes go to URL.
+	ReplicaURL string `json:"replicaURL,omitempty"`
+
+	// ReadFromReplicas routes reads to replicas in cluster or sentinel mode.
+	ReadFromReplicas bool `json:"readFromReplicas,omitempty"`
 }
 
 func (c Config) Valid() error {
@@ -55,6 +74,26 @@ func (c Config) Valid() error {
 		}
 	}
 
+	if c.TLS != nil {
+		if err := c.TLS.Valid(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if c.ReplicaURL != "" {
+		if c.Cluster || c.Sentinel != nil {
+			errs = append(errs, ErrReplicaURLNotStandalone)
+		}
+
+		if _, err := valkey.ParseURL(c.ReplicaURL); err != nil {
+			errs = append(errs, fmt.Errorf("%w: replicaURL: %v", ErrBadURL, err))
+		}
+	}
+
+	if c.ReadFromReplicas && !c.Cluster && c.Sentinel == nil {
+		errs = append(errs, ErrReadFromReplicasNoHA)
+	}
+
 	if len(errs) > 0 {
 		return errors.Join(errs...)
 	}
@@ -62,6 +101,58 @@ func (c Config) Valid() error {
 	return nil
 }
 
+// credentials returns the username and password from UsernameFile and
+// PasswordFile, or the passed defaults if they are not set.
+func (c Config) credentials(username, password string) (string, string, error) {
+	if c.UsernameFile != "" {
+		var err error
+		if username, err = readSecretFile(c.UsernameFile); err != nil {
+			return "", "", err
+		}
+	}
+
+	if c.PasswordFile != "" {
+		var err error
+		if password, err = readSecretFile(c.PasswordFile); err != nil {
+			return "", "", err
+		}
+	}
+
+	return username, password, nil
+}
+
+// tlsConfig returns the TLS configuration for connections, starting from base
+// (which is set by ParseURL for rediss:// URLs).
+func (c Config) tlsConfig(base *tls.Config) (*tls.Config, error) {
+	if c.TLS == nil {
+		return base, nil
+	}
+
+	return c.TLS.Config(base)
+}
+
+// clientOptions parses url and applies the TLS and credential settings to it.
+func (c Config) clientOptions(url string) (*valkey.Options, error) {
+	opts, err := valkey.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("valkey.Factory: %w", err)
+	}
+
+	if opts.Username, opts.Password, err = c.credentials(opts.Username, opts.Password); err != nil {
+		return nil, fmt.Errorf("valkey.Factory: %w", err)
+	}
+
+	if opts.TLSConfig, err = c.tlsConfig(opts.TLSConfig); err != nil {
+		return nil, fmt.Errorf("valkey.Factory: %w", err)
+	}
+
+	opts.MaintNotificationsConfig = &maintnotifications.Config{
+		Mode: maintnotifications.ModeDisabled,
+	}
+
+	return opts, nil
+}
+
 type Sentinel struct {
 	MasterName string                  `json:"masterName"`
 	Addr       internal.ListOr[string] `json:"addr"`
@@ -106,6 +197,8 @@ type redisClient interface {
 	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *valkey.StatusCmd
 	Del(ctx context.Context, keys ...string) *valkey.IntCmd
 	Ping(ctx context.Context) *valkey.StatusCmd
+	Scan(ctx context.Context, cursor uint64, match string, count int64) *valkey.ScanCmd
+	PTTL(ctx context.Context, key string) *valkey.DurationCmd
 }
 
 type Factory struct{}
@@ -128,17 +221,23 @@ func (Factory) Build(ctx context.Context, data json.RawMessage) (store.Interface
 	}
 
 	var client redisClient
+	var reader redisClient
 
 	switch {
 	case cfg.Cluster:
-		opts, err := valkey.ParseURL(cfg.URL)
+		opts, err := cfg.clientOptions(cfg.URL)
 		if err != nil {
-			return nil, fmt.Errorf("valkey.Factory: %w", err)
+			return nil, err
 		}
 
 		// Cluster mode: use the parsed Addr as the seed node.
 		clusterOpts := &valkey.ClusterOptions{
-			Addrs: []string{opts.Addr},
+			Addrs:     []string{opts.Addr},
+			Username:  opts.Username,
+			Password:  opts.Password,
+			TLSConfig: opts.TLSConfig,
+			// Reads are sent to replicas, writes always go to the primary.
+			ReadOnly: cfg.ReadFromReplicas,
 			// Explicitly disable maintenance notifications
 			// This prevents the client from sending CLIENT MAINT_NOTIFICATIONS ON
 			MaintNotificationsConfig: &maintnotifications.Config{
@@ -147,26 +246,44 @@ func (Factory) Build(ctx context.Context, data json.RawMessage) (store.Interface
 		}
 		client = valkey.NewClusterClient(clusterOpts)
 	case cfg.Sentinel != nil:
+		username, password, err := cfg.credentials(cfg.Sentinel.Username, cfg.Sentinel.Password)
+		if err != nil {
+			return nil, fmt.Errorf("valkey.Factory: %w", err)
+		}
+
+		tlsConfig, err := cfg.tlsConfig(nil)
+		if err != nil {
+			return nil, fmt.Errorf("valkey.Factory: %w", err)
+		}
+
 		opts := &valkey.FailoverOptions{
 			MasterName:       cfg.Sentinel.MasterName,
 			SentinelAddrs:    cfg.Sentinel.Addr,
-			SentinelUsername: cfg.Sentinel.Username,
-			SentinelPassword: cfg.Sentinel.Password,
-			Username:         cfg.Sentinel.Username,
-			Password:         cfg.Sentinel.Password,
+			SentinelUsername: username,
+			SentinelPassword: password,
+			Username:         username,
+			Password:         password,
 			ClientName:       cfg.Sentinel.ClientName,
+			TLSConfig:        tlsConfig,
+			// With the failover cluster client, this routes reads to replicas
+			// while writes go to the primary.
+			ReplicaOnly: cfg.ReadFromReplicas,
 		}
 		client = valkey.NewFailoverClusterClient(opts)
 	default:
-		opts, err := valkey.ParseURL(cfg.URL)
+		opts, err := cfg.clientOptions(cfg.URL)
 		if err != nil {
-			return nil, fmt.Errorf("valkey.Factory: %w", err)
+			return nil, err
 		}
+		client = valkey.NewClient(opts)
 
-		opts.MaintNotificationsConfig = &maintnotifications.Config{
-			Mode: maintnotifications.ModeDisabled,
+		if cfg.ReplicaURL != "" {
+			replicaOpts, err := cfg.clientOptions(cfg.ReplicaURL)
+			if err != nil {
+				return nil, err
+			}
+			reader = valkey.NewClient(replicaOpts)
 		}
-		client = valkey.NewClient(opts)
 	}
 
 	// Optional but nice: fail fast if the cluster/single node is unreachable.
@@ -174,5 +291,11 @@ func (Factory) Build(ctx context.Context, data json.RawMessage) (store.Interface
 		return nil, fmt.Errorf("valkey.Factory: ping failed: %w", err)
 	}
 
-	return &Store{client: client}, nil
+	if reader != nil {
+		if err := reader.Ping(ctx).Err(); err != nil {
+			return nil, fmt.Errorf("valkey.Factory: replica ping failed: %w", err)
+		}
+	}
+
+	return &Store{client: client, reader: reader}, nil
 }
@@ -0,0 +1,93 @@
+package valkey
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var (
+	ErrTLSCertWithoutKey = errors.New("valkey.TLS: certFile and keyFile must be set together")
+	ErrTLSBadCA          = errors.New("valkey.TLS: caFile does not contain any PEM certificates")
+)
+
+// TLS configures the TLS connection to Valkey, including client certificates
+// for mutual TLS.
+type TLS struct {
+	// CAFile is the path to a PEM bundle of certificate authorities used to
+	// verify the server. If unset, the system roots are used.
+	CAFile string `json:"caFile,omitempty"`
+
+	// CertFile and KeyFile are the paths to the PEM encoded client certificate
+	// and private key.
+	CertFile string `json:"certFile,omitempty"`
+	KeyFile  string `json:"keyFile,omitempty"`
+
+	// ServerName overrides the name used to verify the server certificate.
+	ServerName string `json:"serverName,omitempty"`
+
+	// InsecureSkipVerify disables server certificate verification.
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+}
+
+func (t TLS) Valid() error {
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return ErrTLSCertWithoutKey
+	}
+
+	return nil
+}
+
+// Config loads the certificates and returns a tls.Config. If base is not nil,
+// its ServerName is kept unless it is overridden.
+func (t TLS) Config(base *tls.Config) (*tls.Config, error) {
+	result := &tls.Config{MinVersion: tls.VersionTLS12}
+	if base != nil {
+		result = base.Clone()
+	}
+
+	if t.ServerName != "" {
+		result.ServerName = t.ServerName
+	}
+
+	if t.InsecureSkipVerify {
+		result.InsecureSkipVerify = true
+	}
+
+	if t.CAFile != "" {
+		data, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't read caFile %s: %w", t.CAFile, err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("%w: %s", ErrTLSBadCA, t.CAFile)
+		}
+		result.RootCAs = pool
+	}
+
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't load client certificate %s: %w", t.CertFile, err)
+		}
+		result.Certificates = []tls.Certificate{cert}
+	}
+
+	return result, nil
+}
+
+// readSecretFile reads a secret such as a password from a file, trimming the
+// trailing newline most tools add.
+func readSecretFile(fname string) (string, error) {
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		return "", fmt.Errorf("can't read secret file %s: %w", fname, err)
+	}
+
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
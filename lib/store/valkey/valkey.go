@@ -2,6 +2,9 @@ package valkey
 
 import (
 	"context"
+	"errors"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/TecharoHQ/anubis/lib/store"
@@ -11,12 +14,20 @@ import (
 // Store implements store.Interface on top of Redis/Valkey.
 type Store struct {
 	client redisClient
+
+	// reader, if set, serves Get calls from a read replica.
+	reader redisClient
 }
 
 var _ store.Interface = (*Store)(nil)
 
 func (s *Store) Get(ctx context.Context, key string) ([]byte, error) {
-	cmd := s.client.Get(ctx, key)
+	client := s.client
+	if s.reader != nil {
+		client = s.reader
+	}
+
+	cmd := client.Get(ctx, key)
 	if err := cmd.Err(); err != nil {
 		if err == valkey.Nil {
 			return nil, store.ErrNotFound
@@ -41,6 +52,79 @@ func (s *Store) Delete(ctx context.Context, key string) error {
 	return nil
 }
 
+// Scan calls fn for every value whose key starts with prefix. In cluster mode
+// every master node is scanned.
+func (s *Store) Scan(ctx context.Context, prefix string, fn func(store.Entry) error) error {
+	cc, ok := s.client.(*valkey.ClusterClient)
+	if !ok {
+		return scanNode(ctx, s.client, prefix, fn)
+	}
+
+	// ForEachMaster scans nodes concurrently, but callers expect fn to be called
+	// serially.
+	var lock sync.Mutex
+	return cc.ForEachMaster(ctx, func(ctx context.Context, node *valkey.Client) error {
+		return scanNode(ctx, node, prefix, func(e store.Entry) error {
+			lock.Lock()
+			defer lock.Unlock()
+			return fn(e)
+		})
+	})
+}
+
+func scanNode(ctx context.Context, client redisClient, prefix string, fn func(store.Entry) error) error {
+	match := globEscaper.Replace(prefix) + "*"
+	var cursor uint64
+
+	for {
+		keys, next, err := client.Scan(ctx, cursor, match, 100).Result()
+		if err != nil {
+			return err
+		}
+
+		for _, key := range keys {
+			value, err := client.Get(ctx, key).Bytes()
+			if errors.Is(err, valkey.Nil) {
+				// expired between SCAN and GET
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			ttl, err := client.PTTL(ctx, key).Result()
+			if err != nil {
+				return err
+			}
+
+			switch {
+			case ttl == -2:
+				continue
+			case ttl < 0:
+				ttl = 0
+			}
+
+			if err := fn(store.Entry{Key: key, Value: value, TTL: ttl}); err != nil {
+				return err
+			}
+		}
+
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// globEscaper escapes the characters that SCAN MATCH treats as glob syntax.
+var globEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"*", `\*`,
+	"?", `\?`,
+	"[", `\[`,
+	"]", `\]`,
+)
+
 // IsPersistent tells Anubis this backend is “real” storage, not in-memory.
 func (s *Store) IsPersistent() bool {
 	return true
@@ -1,20 +1,18 @@
 package thoth
 
 import (
-	"context"
-	"errors"
 	"fmt"
-	"log/slog"
 	"net/http"
 	"strings"
-	"time"
 
 	"github.com/TecharoHQ/anubis/internal"
 	"github.com/TecharoHQ/anubis/lib/policy/checker"
 	iptoasnv1 "github.com/TecharoHQ/thoth-proto/gen/techaro/thoth/iptoasn/v1"
 )
 
-func (c *Client) ASNCheckerFor(asns []uint32) checker.Impl {
+// ASNCheckerFor matches clients in any of asns. If failClosed is set, it
+// also matches when the lookup fails.
+func (c *Client) ASNCheckerFor(asns []uint32, failClosed bool) checker.Impl {
 	asnMap := map[uint32]struct{}{}
 	var sb strings.Builder
 	fmt.Fprintln(&sb, "ASNChecker")
@@ -22,36 +20,30 @@ func (c *Client) ASNCheckerFor(asns []uint32) checker.Impl {
 		asnMap[asn] = struct{}{}
 		fmt.Fprintln(&sb, "AS", asn)
 	}
+	if failClosed {
+		fmt.Fprintln(&sb, "fail closed")
+	}
 
 	return &ASNChecker{
-		iptoasn: c.IPToASN,
-		asns:    asnMap,
-		hash:    internal.FastHash(sb.String()),
+		iptoasn:    c.IPToASN,
+		asns:       asnMap,
+		failClosed: failClosed,
+		hash:       internal.FastHash(sb.String()),
 	}
 }
 
 type ASNChecker struct {
-	iptoasn iptoasnv1.IpToASNServiceClient
-	asns    map[uint32]struct{}
-	hash    string
+	iptoasn    iptoasnv1.IpToASNServiceClient
+	asns       map[uint32]struct{}
+	failClosed bool
+	hash       string
 }
 
 func (asnc *ASNChecker) Check(r *http.Request) (bool, error) {
-	ctx, cancel := context.WithTimeout(r.Context(), 500*time.Millisecond)
-	defer cancel()
-
-	ipInfo, err := asnc.iptoasn.Lookup(ctx, &iptoasnv1.LookupRequest{
-		IpAddress: r.Header.Get("X-Real-Ip"),
-	})
+	ipInfo, err := Lookup(r, asnc.iptoasn)
 	if err != nil {
-		switch {
-		case errors.Is(err, context.DeadlineExceeded):
-			slog.Debug("error contacting thoth", "err", err, "actionable", false)
-			return false, nil
-		default:
-			slog.Error("error contacting thoth, please contact support", "err", err, "actionable", true)
-			return false, nil
-		}
+		// Lookup logged the error
+		return asnc.failClosed, nil
 	}
 
 	// If IP is not publicly announced, return false
@@ -8,6 +8,8 @@ import (
 	"github.com/TecharoHQ/anubis/lib/policy/checker"
 	"github.com/TecharoHQ/anubis/lib/thoth"
 	iptoasnv1 "github.com/TecharoHQ/thoth-proto/gen/techaro/thoth/iptoasn/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 var _ checker.Impl = &thoth.ASNChecker{}
@@ -15,7 +17,7 @@ var _ checker.Impl = &thoth.ASNChecker{}
 func TestASNChecker(t *testing.T) {
 	cli := loadSecrets(t)
 
-	asnc := cli.ASNCheckerFor([]uint32{13335})
+	asnc := cli.ASNCheckerFor([]uint32{13335}, false)
 
 	for _, cs := range []struct {
 		ipAddress string
@@ -79,3 +81,104 @@ func BenchmarkWithCache(b *testing.B) {
 		}
 	}
 }
+
+func TestASNCheckerFailureMode(t *testing.T) {
+	next := &flakyIPToASN{}
+	next.fail(status.Error(codes.Unavailable, "thoth is down"))
+
+	cli := &thoth.Client{}
+	cli.WithIPToASNService(next)
+
+	for _, failClosed := range []bool{false, true} {
+		t.Run(fmt.Sprint("failClosed=", failClosed), func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("X-Real-Ip", "1.1.1.1")
+
+			for _, c := range []checker.Impl{
+				cli.ASNCheckerFor([]uint32{13335}, failClosed),
+				cli.GeoIPCheckerFor([]string{"us"}, failClosed),
+			} {
+				match, err := c.Check(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if match != failClosed {
+					t.Errorf("%T: wanted match: %v, got: %v", c, failClosed, match)
+				}
+			}
+		})
+	}
+}
+
+func TestHostingChecker(t *testing.T) {
+	cli := loadSecrets(t)
+
+	for _, tt := range []struct {
+		name      string
+		providers []string
+		ipAddress string
+		wantMatch bool
+	}{
+		{name: "any provider", ipAddress: "1.1.1.1"}, // Cloudflare is not in the dataset
+		{name: "hosting", ipAddress: "3.3.3.3", wantMatch: true},
+		{name: "listed provider", providers: []string{"amazon-aws"}, ipAddress: "3.3.3.3", wantMatch: true},
+		{name: "other provider", providers: []string{"hetzner"}, ipAddress: "3.3.3.3"},
+		{name: "private", ipAddress: "127.0.0.1"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("X-Real-Ip", tt.ipAddress)
+
+			match, err := cli.HostingCheckerFor(tt.providers, nil, false).Check(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if match != tt.wantMatch {
+				t.Errorf("Wanted match: %v, got: %v", tt.wantMatch, match)
+			}
+		})
+	}
+}
+
+func TestHostingCheckerWeight(t *testing.T) {
+	cli := loadSecrets(t)
+
+	hc, ok := cli.HostingCheckerFor(nil, map[string]int{"amazon-aws": 10}, false).(*thoth.HostingChecker)
+	if !ok {
+		t.Fatal("HostingCheckerFor didn't return a *thoth.HostingChecker")
+	}
+
+	for _, tt := range []struct {
+		name       string
+		ipAddress  string
+		wantWeight int
+		wantOK     bool
+	}{
+		{name: "weighted provider", ipAddress: "3.3.3.3", wantWeight: 10, wantOK: true},
+		{name: "not a hosting provider", ipAddress: "1.1.1.1"},
+		{name: "private", ipAddress: "127.0.0.1"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("X-Real-Ip", tt.ipAddress)
+
+			weight, ok := hc.Weight(req)
+			if weight != tt.wantWeight || ok != tt.wantOK {
+				t.Logf("want: %d, %v", tt.wantWeight, tt.wantOK)
+				t.Logf("got:  %d, %v", weight, ok)
+				t.Error("got wrong weight")
+			}
+		})
+	}
+
+	unweighted, ok := cli.HostingCheckerFor(nil, nil, false).(*thoth.HostingChecker)
+	if !ok {
+		t.Fatal("HostingCheckerFor didn't return a *thoth.HostingChecker")
+	}
+
+	if unweighted.Hash() == hc.Hash() {
+		t.Error("wanted weights to change the hash")
+	}
+}
@@ -0,0 +1,181 @@
+package thoth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	iptoasnv1 "github.com/TecharoHQ/thoth-proto/gen/techaro/thoth/iptoasn/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	ErrCircuitOpen = errors.New("thoth: circuit breaker is open, not contacting Thoth")
+
+	breakerState = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "anubis_thoth_circuit_breaker_state",
+		Help: "The state of the Thoth circuit breaker: 0 is closed, 1 is half-open and 2 is open",
+	})
+
+	breakerTrips = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "anubis_thoth_circuit_breaker_trips_total",
+		Help: "The total number of times the Thoth circuit breaker opened",
+	})
+
+	breakerRejected = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "anubis_thoth_circuit_breaker_rejected_total",
+		Help: "The total number of Thoth lookups skipped because the circuit breaker was open",
+	})
+)
+
+const (
+	// DefaultTimeout is how long a lookup may take before Anubis gives up.
+	DefaultTimeout = 500 * time.Millisecond
+
+	// DefaultBreakerThreshold is how many lookups in a row must fail before
+	// the circuit breaker opens.
+	DefaultBreakerThreshold = 5
+
+	// DefaultBreakerCooldown is how long the circuit breaker stays open
+	// before it lets one lookup through to see if Thoth is back.
+	DefaultBreakerCooldown = 30 * time.Second
+)
+
+type breakerStatus int
+
+const (
+	breakerClosed breakerStatus = iota
+	breakerHalfOpen
+	breakerOpen
+)
+
+// Breaker is a circuit breaker around an IP to ASN service. After threshold
+// lookups in a row fail, it fails every lookup with ErrCircuitOpen for
+// cooldown, then lets one lookup through. If that one works the breaker
+// closes again, otherwise it waits for another cooldown.
+type Breaker struct {
+	next      iptoasnv1.IpToASNServiceClient
+	threshold int
+	cooldown  time.Duration
+
+	lock     sync.Mutex
+	state    breakerStatus
+	failures int
+	openedAt time.Time
+}
+
+func NewBreaker(next iptoasnv1.IpToASNServiceClient, threshold int, cooldown time.Duration) *Breaker {
+	if threshold <= 0 {
+		threshold = DefaultBreakerThreshold
+	}
+
+	if cooldown <= 0 {
+		cooldown = DefaultBreakerCooldown
+	}
+
+	return &Breaker{
+		next:      next,
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+func (b *Breaker) Lookup(ctx context.Context, lr *iptoasnv1.LookupRequest, opts ...grpc.CallOption) (*iptoasnv1.LookupResponse, error) {
+	if !b.allow() {
+		breakerRejected.Inc()
+		return nil, ErrCircuitOpen
+	}
+
+	resp, err := b.next.Lookup(ctx, lr, opts...)
+	b.record(err)
+
+	return resp, err
+}
+
+// allow reports whether a lookup may go to Thoth, moving an open breaker to
+// half-open once its cooldown is over.
+func (b *Breaker) allow() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	switch b.state {
+	case breakerClosed:
+		return true
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+
+		b.setState(breakerHalfOpen)
+		return true
+	default:
+		// Only the lookup that moved the breaker to half-open goes through.
+		return false
+	}
+}
+
+func (b *Breaker) record(err error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if isCanceled(err) {
+		// The lookup says nothing about Thoth, so let the next one probe it.
+		if b.state == breakerHalfOpen {
+			b.setState(breakerOpen)
+		}
+		return
+	}
+
+	if !isServiceFailure(err) {
+		b.failures = 0
+		if b.state != breakerClosed {
+			slog.Info("thoth is answering again, closing circuit breaker")
+			b.setState(breakerClosed)
+		}
+		return
+	}
+
+	b.failures++
+
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		if b.state != breakerOpen {
+			slog.Warn("thoth lookups are failing, opening circuit breaker", "failures", b.failures, "cooldown", b.cooldown.String(), "err", err)
+			breakerTrips.Inc()
+		}
+
+		b.openedAt = time.Now()
+		b.setState(breakerOpen)
+	}
+}
+
+func (b *Breaker) setState(state breakerStatus) {
+	b.state = state
+	breakerState.Set(float64(state))
+}
+
+// isCanceled reports whether err came from the caller giving up, such as a
+// client that went away.
+func isCanceled(err error) bool {
+	return errors.Is(err, context.Canceled) || status.Code(err) == codes.Canceled
+}
+
+// isServiceFailure reports whether err means Thoth is unhealthy, as opposed
+// to an answer about one address.
+func isServiceFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	switch status.Code(err) {
+	case codes.NotFound, codes.InvalidArgument:
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,90 @@
+package thoth_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/TecharoHQ/anubis/lib/thoth"
+	iptoasnv1 "github.com/TecharoHQ/thoth-proto/gen/techaro/thoth/iptoasn/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// flakyIPToASN fails with err while it is set and counts the lookups that
+// reach it.
+type flakyIPToASN struct {
+	err   atomic.Pointer[error]
+	calls atomic.Int64
+}
+
+func (f *flakyIPToASN) fail(err error) { f.err.Store(&err) }
+
+func (f *flakyIPToASN) Lookup(ctx context.Context, lr *iptoasnv1.LookupRequest, opts ...grpc.CallOption) (*iptoasnv1.LookupResponse, error) {
+	f.calls.Add(1)
+	if err := f.err.Load(); err != nil && *err != nil {
+		return nil, *err
+	}
+
+	return &iptoasnv1.LookupResponse{Announced: true, AsNumber: 13335, Cidr: []string{"1.1.1.0/24"}}, nil
+}
+
+func TestBreaker(t *testing.T) {
+	next := &flakyIPToASN{}
+	b := thoth.NewBreaker(next, 3, 50*time.Millisecond)
+	req := &iptoasnv1.LookupRequest{IpAddress: "1.1.1.1"}
+
+	lookup := func() error {
+		_, err := b.Lookup(t.Context(), req)
+		return err
+	}
+
+	if err := lookup(); err != nil {
+		t.Fatalf("healthy lookup failed: %v", err)
+	}
+
+	// Answers about one address don't count as failures.
+	next.fail(status.Error(codes.NotFound, "not found"))
+	for range 5 {
+		if err := lookup(); errors.Is(err, thoth.ErrCircuitOpen) {
+			t.Fatal("breaker opened on NotFound answers")
+		}
+	}
+
+	next.fail(status.Error(codes.Unavailable, "thoth is down"))
+	for range 3 {
+		if err := lookup(); errors.Is(err, thoth.ErrCircuitOpen) {
+			t.Fatal("breaker opened before the threshold")
+		}
+	}
+
+	calls := next.calls.Load()
+	if err := lookup(); !errors.Is(err, thoth.ErrCircuitOpen) {
+		t.Fatalf("wanted ErrCircuitOpen, got: %v", err)
+	}
+	if next.calls.Load() != calls {
+		t.Fatal("open breaker let a lookup through")
+	}
+
+	// After the cooldown one lookup probes Thoth. It still fails, so the
+	// breaker opens again.
+	time.Sleep(60 * time.Millisecond)
+	if err := lookup(); errors.Is(err, thoth.ErrCircuitOpen) {
+		t.Fatal("breaker did not let a probe through after the cooldown")
+	}
+	if err := lookup(); !errors.Is(err, thoth.ErrCircuitOpen) {
+		t.Fatalf("wanted the breaker to open again after a failed probe, got: %v", err)
+	}
+
+	// Once Thoth answers again, the breaker closes.
+	next.fail(nil)
+	time.Sleep(60 * time.Millisecond)
+	for range 5 {
+		if err := lookup(); err != nil {
+			t.Fatalf("lookup failed after Thoth came back: %v", err)
+		}
+	}
+}
@@ -6,21 +6,83 @@ import (
 	"fmt"
 	"log/slog"
 	"net/netip"
+	"sync"
+	"time"
 
 	iptoasnv1 "github.com/TecharoHQ/thoth-proto/gen/techaro/thoth/iptoasn/v1"
 	"github.com/gaissmai/bart"
 	"google.golang.org/grpc"
 )
 
+var (
+	ErrCachedFailure = errors.New("thoth: lookup failed recently")
+)
+
+const (
+	// DefaultCacheTTL is how long a lookup result is kept.
+	DefaultCacheTTL = 24 * time.Hour
+
+	// DefaultCacheSize is how many networks are kept at most.
+	DefaultCacheSize = 65536
+
+	// DefaultNegativeCacheTTL is how long a failed lookup is remembered, so
+	// that the same client doesn't wait for Thoth on every request while it
+	// is having trouble.
+	DefaultNegativeCacheTTL = time.Minute
+)
+
+// cacheEntry is a lookup result for a network, or the error looking up a
+// single address failed with.
+type cacheEntry struct {
+	resp    *iptoasnv1.LookupResponse
+	err     error
+	expires time.Time // zero for reserved ranges, which never expire
+	seq     uint64
+}
+
+// queuedPrefix is a cached network in the order it was added, so that the
+// oldest ones can be evicted when the cache is full.
+type queuedPrefix struct {
+	pfx netip.Prefix
+	seq uint64
+}
+
+// IPToASNWithCache remembers lookup results by the networks Thoth says they
+// hold for. Results expire after ttl and the oldest ones are evicted when
+// there are more than maxSize of them. Failed lookups are remembered for
+// the address alone for negativeTTL.
 type IPToASNWithCache struct {
-	next  iptoasnv1.IpToASNServiceClient
-	table *bart.Table[*iptoasnv1.LookupResponse]
+	next        iptoasnv1.IpToASNServiceClient
+	ttl         time.Duration
+	negativeTTL time.Duration
+	maxSize     int
+
+	lock     sync.RWMutex
+	table    *bart.Table[*cacheEntry]
+	order    []queuedPrefix
+	reserved int
+	seq      uint64
 }
 
-func NewIpToASNWithCache(next iptoasnv1.IpToASNServiceClient) *IPToASNWithCache {
+func NewIpToASNWithCache(next iptoasnv1.IpToASNServiceClient, ttl, negativeTTL time.Duration, maxSize int) *IPToASNWithCache {
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+
+	if negativeTTL <= 0 {
+		negativeTTL = DefaultNegativeCacheTTL
+	}
+
+	if maxSize <= 0 {
+		maxSize = DefaultCacheSize
+	}
+
 	result := &IPToASNWithCache{
-		next:  next,
-		table: &bart.Table[*iptoasnv1.LookupResponse]{},
+		next:        next,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		maxSize:     maxSize,
+		table:       &bart.Table[*cacheEntry]{},
 	}
 
 	for _, pfx := range []netip.Prefix{
@@ -44,8 +106,9 @@ func NewIpToASNWithCache(next iptoasnv1.IpToASNServiceClient) *IPToASNWithCache
 		netip.MustParsePrefix("100::/64"),           // Discard-only
 		netip.MustParsePrefix("2001:db8::/32"),      // Documentation
 	} {
-		result.table.Insert(pfx, &iptoasnv1.LookupResponse{Announced: false})
+		result.table.Insert(pfx, &cacheEntry{resp: &iptoasnv1.LookupResponse{Announced: false}})
 	}
+	result.reserved = result.table.Size()
 
 	return result
 }
@@ -56,13 +119,23 @@ func (ip2asn *IPToASNWithCache) Lookup(ctx context.Context, lr *iptoasnv1.Lookup
 		return nil, fmt.Errorf("input is not an IP address: %w", err)
 	}
 
-	cachedResponse, ok := ip2asn.table.Lookup(addr)
-	if ok {
-		return cachedResponse, nil
+	ip2asn.lock.RLock()
+	cached, ok := ip2asn.table.Lookup(addr)
+	ip2asn.lock.RUnlock()
+
+	if ok && (cached.expires.IsZero() || time.Now().Before(cached.expires)) {
+		if cached.err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrCachedFailure, cached.err)
+		}
+		return cached.resp, nil
 	}
 
 	resp, err := ip2asn.next.Lookup(ctx, lr, opts...)
 	if err != nil {
+		// Don't remember errors that say nothing about this address.
+		if !errors.Is(err, ErrCircuitOpen) && !isCanceled(err) {
+			ip2asn.insert(netip.PrefixFrom(addr, addr.BitLen()), &cacheEntry{err: err}, ip2asn.negativeTTL)
+		}
 		return nil, err
 	}
 
@@ -73,7 +146,7 @@ func (ip2asn *IPToASNWithCache) Lookup(ctx context.Context, lr *iptoasnv1.Lookup
 			errs = append(errs, err)
 			continue
 		}
-		ip2asn.table.Insert(pfx, resp)
+		ip2asn.insert(pfx.Masked(), &cacheEntry{resp: resp}, ip2asn.ttl)
 	}
 
 	if len(errs) != 0 {
@@ -82,3 +155,45 @@ func (ip2asn *IPToASNWithCache) Lookup(ctx context.Context, lr *iptoasnv1.Lookup
 
 	return resp, nil
 }
+
+// insert adds entry for pfx, evicting the oldest entries if the cache is
+// full.
+func (ip2asn *IPToASNWithCache) insert(pfx netip.Prefix, entry *cacheEntry, ttl time.Duration) {
+	ip2asn.lock.Lock()
+	defer ip2asn.lock.Unlock()
+
+	// Never replace the reserved ranges.
+	if old, ok := ip2asn.table.Get(pfx); ok && old.expires.IsZero() {
+		return
+	}
+
+	ip2asn.seq++
+	entry.seq = ip2asn.seq
+	entry.expires = time.Now().Add(ttl)
+
+	ip2asn.table.Insert(pfx, entry)
+	ip2asn.order = append(ip2asn.order, queuedPrefix{pfx: pfx, seq: entry.seq})
+
+	for ip2asn.table.Size()-ip2asn.reserved > ip2asn.maxSize && len(ip2asn.order) != 0 {
+		oldest := ip2asn.order[0]
+		ip2asn.order = ip2asn.order[1:]
+
+		// The network may have been looked up again since, in which case
+		// it is newer than this queue entry.
+		if cur, ok := ip2asn.table.Get(oldest.pfx); ok && cur.seq == oldest.seq {
+			ip2asn.table.Delete(oldest.pfx)
+		}
+	}
+
+	// Networks that are looked up again leave stale entries behind in the
+	// queue, drop them before it grows much past the cache.
+	if len(ip2asn.order) > 2*ip2asn.maxSize {
+		live := make([]queuedPrefix, 0, ip2asn.maxSize)
+		for _, qp := range ip2asn.order {
+			if cur, ok := ip2asn.table.Get(qp.pfx); ok && cur.seq == qp.seq {
+				live = append(live, qp)
+			}
+		}
+		ip2asn.order = live
+	}
+}
@@ -0,0 +1,138 @@
+package thoth_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/TecharoHQ/anubis/lib/thoth"
+	iptoasnv1 "github.com/TecharoHQ/thoth-proto/gen/techaro/thoth/iptoasn/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// slash24IPToASN answers that every IPv4 address is in its own /24 and
+// counts the lookups that reach it.
+type slash24IPToASN struct {
+	flakyIPToASN
+}
+
+func (s *slash24IPToASN) Lookup(ctx context.Context, lr *iptoasnv1.LookupRequest, opts ...grpc.CallOption) (*iptoasnv1.LookupResponse, error) {
+	if _, err := s.flakyIPToASN.Lookup(ctx, lr, opts...); err != nil {
+		return nil, err
+	}
+
+	var a, b, c, d int
+	fmt.Sscanf(lr.GetIpAddress(), "%d.%d.%d.%d", &a, &b, &c, &d)
+
+	return &iptoasnv1.LookupResponse{
+		Announced: true,
+		AsNumber:  13335,
+		Cidr:      []string{fmt.Sprintf("%d.%d.%d.0/24", a, b, c)},
+	}, nil
+}
+
+func TestIPToASNWithCache(t *testing.T) {
+	lookup := func(t *testing.T, cache *thoth.IPToASNWithCache, ip string) error {
+		t.Helper()
+		_, err := cache.Lookup(t.Context(), &iptoasnv1.LookupRequest{IpAddress: ip})
+		return err
+	}
+
+	t.Run("hit", func(t *testing.T) {
+		next := &slash24IPToASN{}
+		cache := thoth.NewIpToASNWithCache(next, time.Hour, time.Hour, 10)
+
+		lookup(t, cache, "1.1.1.1")
+		lookup(t, cache, "1.1.1.2")
+
+		if calls := next.calls.Load(); calls != 1 {
+			t.Errorf("wanted one lookup for two addresses in the same network, got: %d", calls)
+		}
+	})
+
+	t.Run("reserved", func(t *testing.T) {
+		next := &slash24IPToASN{}
+		cache := thoth.NewIpToASNWithCache(next, time.Hour, time.Hour, 10)
+
+		resp, err := cache.Lookup(t.Context(), &iptoasnv1.LookupRequest{IpAddress: "192.168.1.1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.GetAnnounced() || next.calls.Load() != 0 {
+			t.Error("private address was looked up")
+		}
+	})
+
+	t.Run("ttl", func(t *testing.T) {
+		next := &slash24IPToASN{}
+		cache := thoth.NewIpToASNWithCache(next, 20*time.Millisecond, time.Hour, 10)
+
+		lookup(t, cache, "1.1.1.1")
+		time.Sleep(30 * time.Millisecond)
+		lookup(t, cache, "1.1.1.1")
+
+		if calls := next.calls.Load(); calls != 2 {
+			t.Errorf("wanted the expired result to be looked up again, got %d lookups", calls)
+		}
+	})
+
+	t.Run("size", func(t *testing.T) {
+		next := &slash24IPToASN{}
+		cache := thoth.NewIpToASNWithCache(next, time.Hour, time.Hour, 2)
+
+		lookup(t, cache, "1.1.1.1")
+		lookup(t, cache, "2.2.2.2")
+		lookup(t, cache, "3.3.3.3") // evicts 1.1.1.0/24
+
+		lookup(t, cache, "3.3.3.3")
+		if calls := next.calls.Load(); calls != 3 {
+			t.Fatalf("wanted the newest network to stay cached, got %d lookups", calls)
+		}
+
+		lookup(t, cache, "1.1.1.1")
+		if calls := next.calls.Load(); calls != 4 {
+			t.Errorf("wanted the oldest network to be evicted, got %d lookups", calls)
+		}
+	})
+
+	t.Run("negative", func(t *testing.T) {
+		next := &slash24IPToASN{}
+		next.fail(status.Error(codes.Unavailable, "thoth is down"))
+		cache := thoth.NewIpToASNWithCache(next, time.Hour, 20*time.Millisecond, 10)
+
+		lookup(t, cache, "1.1.1.1")
+		if err := lookup(t, cache, "1.1.1.1"); !errors.Is(err, thoth.ErrCachedFailure) {
+			t.Errorf("wanted ErrCachedFailure, got: %v", err)
+		}
+
+		// The failure is only remembered for the address, not its network.
+		lookup(t, cache, "1.1.1.2")
+		if calls := next.calls.Load(); calls != 2 {
+			t.Errorf("wanted two lookups, got: %d", calls)
+		}
+
+		next.fail(nil)
+		time.Sleep(30 * time.Millisecond)
+		if err := lookup(t, cache, "1.1.1.1"); err != nil {
+			t.Errorf("wanted the failure to expire, got: %v", err)
+		}
+	})
+
+	t.Run("circuit open is not remembered", func(t *testing.T) {
+		next := &slash24IPToASN{}
+		next.fail(thoth.ErrCircuitOpen)
+		cache := thoth.NewIpToASNWithCache(next, time.Hour, time.Hour, 10)
+
+		lookup(t, cache, "1.1.1.1")
+		next.fail(nil)
+
+		if err := lookup(t, cache, "1.1.1.1"); err != nil {
+			t.Errorf("wanted a new lookup once the breaker closed, got: %v", err)
+		}
+	})
+}
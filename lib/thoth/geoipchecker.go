@@ -1,19 +1,17 @@
 package thoth
 
 import (
-	"context"
-	"errors"
 	"fmt"
-	"log/slog"
 	"net/http"
 	"strings"
-	"time"
 
 	"github.com/TecharoHQ/anubis/lib/policy/checker"
 	iptoasnv1 "github.com/TecharoHQ/thoth-proto/gen/techaro/thoth/iptoasn/v1"
 )
 
-func (c *Client) GeoIPCheckerFor(countries []string) checker.Impl {
+// GeoIPCheckerFor matches clients in any of countries, which must be
+// lowercase. If failClosed is set, it also matches when the lookup fails.
+func (c *Client) GeoIPCheckerFor(countries []string, failClosed bool) checker.Impl {
 	countryMap := map[string]struct{}{}
 	var sb strings.Builder
 	fmt.Fprintln(&sb, "GeoIPChecker")
@@ -21,36 +19,30 @@ func (c *Client) GeoIPCheckerFor(countries []string) checker.Impl {
 		countryMap[cc] = struct{}{}
 		fmt.Fprintln(&sb, cc)
 	}
+	if failClosed {
+		fmt.Fprintln(&sb, "fail closed")
+	}
 
 	return &GeoIPChecker{
-		IPToASN:   c.IPToASN,
-		Countries: countryMap,
-		hash:      sb.String(),
+		IPToASN:    c.IPToASN,
+		Countries:  countryMap,
+		FailClosed: failClosed,
+		hash:       sb.String(),
 	}
 }
 
 type GeoIPChecker struct {
-	IPToASN   iptoasnv1.IpToASNServiceClient
-	Countries map[string]struct{}
-	hash      string
+	IPToASN    iptoasnv1.IpToASNServiceClient
+	Countries  map[string]struct{}
+	FailClosed bool
+	hash       string
 }
 
 func (gipc *GeoIPChecker) Check(r *http.Request) (bool, error) {
-	ctx, cancel := context.WithTimeout(r.Context(), 500*time.Millisecond)
-	defer cancel()
-
-	ipInfo, err := gipc.IPToASN.Lookup(ctx, &iptoasnv1.LookupRequest{
-		IpAddress: r.Header.Get("X-Real-Ip"),
-	})
+	ipInfo, err := Lookup(r, gipc.IPToASN)
 	if err != nil {
-		switch {
-		case errors.Is(err, context.DeadlineExceeded):
-			slog.Debug("error contacting thoth", "err", err, "actionable", false)
-			return false, nil
-		default:
-			slog.Error("error contacting thoth, please contact support", "err", err, "actionable", true)
-			return false, nil
-		}
+		// Lookup logged the error
+		return gipc.FailClosed, nil
 	}
 
 	// If IP is not publicly announced, return false
@@ -14,7 +14,7 @@ var _ checker.Impl = &thoth.GeoIPChecker{}
 func TestGeoIPChecker(t *testing.T) {
 	cli := loadSecrets(t)
 
-	asnc := cli.GeoIPCheckerFor([]string{"us"})
+	asnc := cli.GeoIPCheckerFor([]string{"us"}, false)
 
 	for _, cs := range []struct {
 		ipAddress string
@@ -0,0 +1,102 @@
+package thoth
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/TecharoHQ/anubis/internal"
+	"github.com/TecharoHQ/anubis/internal/hosting"
+	"github.com/TecharoHQ/anubis/lib/policy/checker"
+	iptoasnv1 "github.com/TecharoHQ/thoth-proto/gen/techaro/thoth/iptoasn/v1"
+)
+
+// HostingCheckerFor matches clients whose ASN belongs to one of providers in
+// the built-in hosting provider dataset, or to any provider if providers is
+// empty. If failClosed is set, it also matches when the lookup fails. weights
+// is what Weight answers with for the clients of each provider.
+func (c *Client) HostingCheckerFor(providers []string, weights map[string]int, failClosed bool) checker.Impl {
+	providerMap := map[string]struct{}{}
+	var sb strings.Builder
+	fmt.Fprintln(&sb, "HostingChecker")
+	for _, p := range providers {
+		providerMap[p] = struct{}{}
+		fmt.Fprintln(&sb, p)
+	}
+	for _, p := range slices.Sorted(maps.Keys(weights)) {
+		fmt.Fprintf(&sb, "%s=%d\n", p, weights[p])
+	}
+	if failClosed {
+		fmt.Fprintln(&sb, "fail closed")
+	}
+
+	return &HostingChecker{
+		iptoasn:    c.IPToASN,
+		dataset:    hosting.Default(),
+		providers:  providerMap,
+		weights:    weights,
+		failClosed: failClosed,
+		hash:       internal.FastHash(sb.String()),
+	}
+}
+
+type HostingChecker struct {
+	iptoasn    iptoasnv1.IpToASNServiceClient
+	dataset    *hosting.Dataset
+	providers  map[string]struct{}
+	weights    map[string]int
+	failClosed bool
+	hash       string
+}
+
+func (hc *HostingChecker) Check(r *http.Request) (bool, error) {
+	ipInfo, err := Lookup(r, hc.iptoasn)
+	if err != nil {
+		// Lookup logged the error
+		return hc.failClosed, nil
+	}
+
+	// If IP is not publicly announced, return false
+	if !ipInfo.GetAnnounced() {
+		return false, nil
+	}
+
+	provider, ok := hc.dataset.ProviderFor(uint32(ipInfo.GetAsNumber()))
+	if !ok {
+		return false, nil
+	}
+
+	if len(hc.providers) == 0 {
+		return true, nil
+	}
+
+	_, ok = hc.providers[provider]
+	return ok, nil
+}
+
+// Weight returns the weight for the client's provider, if the checker has
+// one for it.
+func (hc *HostingChecker) Weight(r *http.Request) (int, bool) {
+	if len(hc.weights) == 0 {
+		return 0, false
+	}
+
+	ipInfo, err := Lookup(r, hc.iptoasn)
+	if err != nil || !ipInfo.GetAnnounced() {
+		return 0, false
+	}
+
+	provider, ok := hc.dataset.ProviderFor(uint32(ipInfo.GetAsNumber()))
+	if !ok {
+		return 0, false
+	}
+
+	weight, ok := hc.weights[provider]
+	return weight, ok
+}
+
+func (hc *HostingChecker) Hash() string {
+	return hc.hash
+}
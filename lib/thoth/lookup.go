@@ -0,0 +1,68 @@
+package thoth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	iptoasnv1 "github.com/TecharoHQ/thoth-proto/gen/techaro/thoth/iptoasn/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type lookupCacheKey struct{}
+
+// lookupCache holds the answer for a request's client, so that every rule
+// that needs it shares one lookup.
+type lookupCache struct {
+	once sync.Once
+	resp *iptoasnv1.LookupResponse
+	err  error
+}
+
+// WithLookupCache returns a context that remembers the first lookup made
+// with Lookup, so that the rules checking a request look its client up once.
+func WithLookupCache(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(lookupCacheKey{}).(*lookupCache); ok {
+		return ctx
+	}
+
+	return context.WithValue(ctx, lookupCacheKey{}, &lookupCache{})
+}
+
+// Lookup looks up the address in the X-Real-Ip header of r with iptoasn. If
+// the request context came from WithLookupCache, only the first call does
+// the lookup and later calls get the same answer.
+func Lookup(r *http.Request, iptoasn iptoasnv1.IpToASNServiceClient) (*iptoasnv1.LookupResponse, error) {
+	lc, ok := r.Context().Value(lookupCacheKey{}).(*lookupCache)
+	if !ok {
+		return lookup(r, iptoasn)
+	}
+
+	lc.once.Do(func() {
+		lc.resp, lc.err = lookup(r, iptoasn)
+	})
+
+	return lc.resp, lc.err
+}
+
+func lookup(r *http.Request, iptoasn iptoasnv1.IpToASNServiceClient) (*iptoasnv1.LookupResponse, error) {
+	ipInfo, err := iptoasn.Lookup(r.Context(), &iptoasnv1.LookupRequest{
+		IpAddress: r.Header.Get("X-Real-Ip"),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrCircuitOpen), errors.Is(err, ErrCachedFailure):
+			slog.Debug("not contacting thoth", "err", err, "actionable", false)
+		case errors.Is(err, context.DeadlineExceeded), status.Code(err) == codes.DeadlineExceeded:
+			slog.Debug("error contacting thoth", "err", err, "actionable", false)
+		default:
+			slog.Error("error contacting thoth, please contact support", "err", err, "actionable", true)
+		}
+		return nil, err
+	}
+
+	return ipInfo, nil
+}
@@ -0,0 +1,282 @@
+// Package mmdb answers Thoth IP to ASN lookups from local MMDB files, such as
+// the ones MaxMind, DB-IP and IPinfo publish, so that `asns` and `geoip`
+// rules work without a Thoth subscription.
+package mmdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	iptoasnv1 "github.com/TecharoHQ/thoth-proto/gen/techaro/thoth/iptoasn/v1"
+	"github.com/oschwald/maxminddb-golang"
+	"google.golang.org/grpc"
+)
+
+var (
+	ErrNoFiles = errors.New("mmdb: no ASN or country database file is set")
+)
+
+// DefaultReloadInterval is how often the files are checked for changes if
+// Options.ReloadInterval is not set.
+const DefaultReloadInterval = time.Hour
+
+// Options configures which files a Service reads.
+type Options struct {
+	// ASNFile is an MMDB file that maps IP addresses to autonomous systems,
+	// such as GeoLite2-ASN.mmdb.
+	ASNFile string
+
+	// CountryFile is an MMDB file that maps IP addresses to countries, such
+	// as GeoLite2-Country.mmdb. It may be the same file as ASNFile for
+	// databases that have both, such as IPinfo's.
+	CountryFile string
+
+	// ReloadInterval is how often the files are checked for changes. Changed
+	// files are read again without a restart.
+	ReloadInterval time.Duration
+
+	Logger *slog.Logger
+}
+
+// Service is an iptoasnv1.IpToASNServiceClient that looks addresses up in
+// local MMDB files instead of asking Thoth.
+type Service struct {
+	asn     *database
+	country *database
+}
+
+// New reads the files in opts and checks them for changes every
+// opts.ReloadInterval until ctx is done.
+func New(ctx context.Context, opts Options) (*Service, error) {
+	if opts.ASNFile == "" && opts.CountryFile == "" {
+		return nil, ErrNoFiles
+	}
+
+	if opts.ReloadInterval <= 0 {
+		opts.ReloadInterval = DefaultReloadInterval
+	}
+
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+
+	lg := opts.Logger.With("subsystem", "mmdb")
+	result := &Service{}
+
+	for _, db := range []struct {
+		fname string
+		into  **database
+	}{
+		{opts.ASNFile, &result.asn},
+		{opts.CountryFile, &result.country},
+	} {
+		if db.fname == "" {
+			continue
+		}
+
+		d := &database{fname: db.fname}
+		if _, err := d.reload(); err != nil {
+			return nil, err
+		}
+
+		*db.into = d
+		go d.watch(ctx, lg.With("fname", db.fname), opts.ReloadInterval)
+	}
+
+	return result, nil
+}
+
+// record holds the fields that MaxMind, DB-IP and IPinfo databases use for
+// autonomous systems and countries.
+type record struct {
+	// MaxMind and DB-IP
+	ASNumber uint32 `maxminddb:"autonomous_system_number"`
+	ASOrg    string `maxminddb:"autonomous_system_organization"`
+
+	// IPinfo, where asn is a string such as "AS13335"
+	ASN    any    `maxminddb:"asn"`
+	ASName string `maxminddb:"as_name"`
+	Name   string `maxminddb:"name"`
+
+	// MaxMind and DB-IP use a map with an iso_code, IPinfo's country
+	// databases use the code itself and IPinfo Lite uses country_code.
+	Country     any    `maxminddb:"country"`
+	CountryCode string `maxminddb:"country_code"`
+}
+
+func (r record) asNumber() uint32 {
+	if r.ASNumber != 0 {
+		return r.ASNumber
+	}
+
+	switch asn := r.ASN.(type) {
+	case string:
+		var n uint32
+		if _, err := fmt.Sscanf(strings.ToUpper(asn), "AS%d", &n); err == nil {
+			return n
+		}
+	case uint64:
+		return uint32(asn)
+	}
+
+	return 0
+}
+
+func (r record) description() string {
+	for _, s := range []string{r.ASOrg, r.ASName, r.Name} {
+		if s != "" {
+			return s
+		}
+	}
+
+	return ""
+}
+
+func (r record) countryCode() string {
+	if r.CountryCode != "" {
+		return strings.ToUpper(r.CountryCode)
+	}
+
+	switch country := r.Country.(type) {
+	case string:
+		if len(country) == 2 {
+			return strings.ToUpper(country)
+		}
+	case map[string]any:
+		if code, ok := country["iso_code"].(string); ok {
+			return strings.ToUpper(code)
+		}
+	}
+
+	return ""
+}
+
+func (s *Service) Lookup(ctx context.Context, lr *iptoasnv1.LookupRequest, opts ...grpc.CallOption) (*iptoasnv1.LookupResponse, error) {
+	addr, err := netip.ParseAddr(lr.GetIpAddress())
+	if err != nil {
+		return nil, fmt.Errorf("input is not an IP address: %w", err)
+	}
+	addr = addr.Unmap()
+
+	result := &iptoasnv1.LookupResponse{}
+	var network netip.Prefix
+
+	for _, db := range []*database{s.asn, s.country} {
+		if db == nil {
+			continue
+		}
+
+		var rec record
+		ipNet, ok, err := db.reader.Load().LookupNetwork(net.IP(addr.AsSlice()), &rec)
+		if err != nil {
+			return nil, fmt.Errorf("mmdb: can't look up %s in %s: %w", addr, db.fname, err)
+		}
+
+		if !ok {
+			continue
+		}
+
+		if result.AsNumber == 0 {
+			result.AsNumber = rec.asNumber()
+			result.Description = rec.description()
+		}
+
+		if result.CountryCode == "" {
+			result.CountryCode = rec.countryCode()
+		}
+
+		// Both networks contain addr, so the smaller one is where both
+		// answers hold.
+		if pfx, ok := prefixFromIPNet(ipNet); ok && (!network.IsValid() || pfx.Bits() > network.Bits()) {
+			network = pfx
+		}
+	}
+
+	result.Announced = result.AsNumber != 0 || result.CountryCode != ""
+	if network.IsValid() {
+		result.Cidr = []string{network.String()}
+	}
+
+	return result, nil
+}
+
+func prefixFromIPNet(ipNet *net.IPNet) (netip.Prefix, bool) {
+	if ipNet == nil {
+		return netip.Prefix{}, false
+	}
+
+	addr, ok := netip.AddrFromSlice(ipNet.IP)
+	if !ok {
+		return netip.Prefix{}, false
+	}
+
+	bits, _ := ipNet.Mask.Size()
+	return netip.PrefixFrom(addr.Unmap(), bits), true
+}
+
+// database is an MMDB file that is read into memory, so that it can be
+// replaced while lookups are running.
+type database struct {
+	fname   string
+	reader  atomic.Pointer[maxminddb.Reader]
+	modTime time.Time
+	size    int64
+}
+
+// reload reads the file again if it changed since the last time. It returns
+// true if it did.
+func (d *database) reload() (bool, error) {
+	st, err := os.Stat(d.fname)
+	if err != nil {
+		return false, fmt.Errorf("mmdb: can't stat %s: %w", d.fname, err)
+	}
+
+	if d.reader.Load() != nil && st.ModTime().Equal(d.modTime) && st.Size() == d.size {
+		return false, nil
+	}
+
+	buf, err := os.ReadFile(d.fname)
+	if err != nil {
+		return false, fmt.Errorf("mmdb: can't read %s: %w", d.fname, err)
+	}
+
+	reader, err := maxminddb.FromBytes(buf)
+	if err != nil {
+		return false, fmt.Errorf("mmdb: can't parse %s: %w", d.fname, err)
+	}
+
+	d.reader.Store(reader)
+	d.modTime, d.size = st.ModTime(), st.Size()
+
+	return true, nil
+}
+
+func (d *database) watch(ctx context.Context, lg *slog.Logger, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		reloaded, err := d.reload()
+		switch {
+		case err != nil:
+			lg.Error("can't reload database, keeping the old one", "err", err)
+		case reloaded:
+			md := d.reader.Load().Metadata
+			lg.Info("reloaded database", "type", md.DatabaseType, "build_epoch", md.BuildEpoch)
+		}
+	}
+}
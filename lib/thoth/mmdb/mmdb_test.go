@@ -0,0 +1,283 @@
+package mmdb
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/TecharoHQ/anubis/lib/policy/checker"
+	"github.com/TecharoHQ/anubis/lib/thoth"
+	iptoasnv1 "github.com/TecharoHQ/thoth-proto/gen/techaro/thoth/iptoasn/v1"
+	"github.com/maxmind/mmdbwriter"
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+)
+
+// writeDB writes an MMDB file with the given records to fname.
+func writeDB(t *testing.T, fname, dbType string, records map[string]mmdbtype.Map) {
+	t.Helper()
+
+	w, err := mmdbwriter.New(mmdbwriter.Options{DatabaseType: dbType})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for cidr, rec := range records {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := w.Insert(network, rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fout, err := os.Create(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fout.Close()
+
+	if _, err := w.WriteTo(fout); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func maxMindASN(asn uint32, org string) mmdbtype.Map {
+	return mmdbtype.Map{
+		"autonomous_system_number":       mmdbtype.Uint32(asn),
+		"autonomous_system_organization": mmdbtype.String(org),
+	}
+}
+
+func maxMindCountry(code string) mmdbtype.Map {
+	return mmdbtype.Map{
+		"country": mmdbtype.Map{
+			"iso_code": mmdbtype.String(code),
+		},
+	}
+}
+
+func TestLookup(t *testing.T) {
+	dir := t.TempDir()
+
+	asnFile := filepath.Join(dir, "GeoLite2-ASN.mmdb")
+	writeDB(t, asnFile, "GeoLite2-ASN", map[string]mmdbtype.Map{
+		"1.1.0.0/16":     maxMindASN(13335, "CLOUDFLARENET"),
+		"2606:4700::/32": maxMindASN(13335, "CLOUDFLARENET"),
+	})
+
+	countryFile := filepath.Join(dir, "GeoLite2-Country.mmdb")
+	writeDB(t, countryFile, "GeoLite2-Country", map[string]mmdbtype.Map{
+		"1.1.1.0/24": maxMindCountry("AU"),
+		"2.2.2.0/24": maxMindCountry("FR"),
+	})
+
+	ipinfoFile := filepath.Join(dir, "ipinfo_lite.mmdb")
+	writeDB(t, ipinfoFile, "ipinfo_lite.mmdb", map[string]mmdbtype.Map{
+		"1.1.1.0/24": {
+			"asn":          mmdbtype.String("AS13335"),
+			"as_name":      mmdbtype.String("Cloudflare, Inc."),
+			"country":      mmdbtype.String("Australia"),
+			"country_code": mmdbtype.String("AU"),
+		},
+	})
+
+	for _, tt := range []struct {
+		name    string
+		opts    Options
+		ip      string
+		want    *iptoasnv1.LookupResponse
+		wantErr bool
+	}{
+		{
+			name: "maxmind both",
+			opts: Options{ASNFile: asnFile, CountryFile: countryFile},
+			ip:   "1.1.1.1",
+			want: &iptoasnv1.LookupResponse{Announced: true, AsNumber: 13335, Description: "CLOUDFLARENET", CountryCode: "AU", Cidr: []string{"1.1.1.0/24"}},
+		},
+		{
+			name: "maxmind asn only",
+			opts: Options{ASNFile: asnFile, CountryFile: countryFile},
+			ip:   "1.1.2.1",
+			want: &iptoasnv1.LookupResponse{Announced: true, AsNumber: 13335, Description: "CLOUDFLARENET", Cidr: []string{"1.1.0.0/16"}},
+		},
+		{
+			name: "maxmind country only",
+			opts: Options{ASNFile: asnFile, CountryFile: countryFile},
+			ip:   "2.2.2.2",
+			want: &iptoasnv1.LookupResponse{Announced: true, CountryCode: "FR", Cidr: []string{"2.2.2.0/24"}},
+		},
+		{
+			name: "ipv6",
+			opts: Options{ASNFile: asnFile},
+			ip:   "2606:4700::1111",
+			want: &iptoasnv1.LookupResponse{Announced: true, AsNumber: 13335, Description: "CLOUDFLARENET", Cidr: []string{"2606:4700::/32"}},
+		},
+		{
+			name: "not found",
+			opts: Options{ASNFile: asnFile, CountryFile: countryFile},
+			ip:   "3.3.3.3",
+			want: &iptoasnv1.LookupResponse{},
+		},
+		{
+			name: "ipinfo in one file",
+			opts: Options{ASNFile: ipinfoFile, CountryFile: ipinfoFile},
+			ip:   "1.1.1.1",
+			want: &iptoasnv1.LookupResponse{Announced: true, AsNumber: 13335, Description: "Cloudflare, Inc.", CountryCode: "AU", Cidr: []string{"1.1.1.0/24"}},
+		},
+		{
+			name:    "not an IP",
+			opts:    Options{ASNFile: asnFile},
+			ip:      "not-an-ip",
+			wantErr: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, err := New(t.Context(), tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := svc.Lookup(t.Context(), &iptoasnv1.LookupRequest{IpAddress: tt.ip})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wanted error: %v, got: %v", tt.wantErr, err)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if got.String() != tt.want.String() {
+				t.Logf("want: %s", tt.want)
+				t.Logf("got:  %s", got)
+				t.Error("wrong lookup response")
+			}
+		})
+	}
+}
+
+func TestCheckers(t *testing.T) {
+	dir := t.TempDir()
+	asnFile := filepath.Join(dir, "GeoLite2-ASN.mmdb")
+	writeDB(t, asnFile, "GeoLite2-ASN", map[string]mmdbtype.Map{
+		"1.1.1.0/24": maxMindASN(13335, "CLOUDFLARENET"),
+	})
+
+	countryFile := filepath.Join(dir, "GeoLite2-Country.mmdb")
+	writeDB(t, countryFile, "GeoLite2-Country", map[string]mmdbtype.Map{
+		"1.1.1.0/24": maxMindCountry("AU"),
+	})
+
+	svc, err := New(t.Context(), Options{ASNFile: asnFile, CountryFile: countryFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cli := &thoth.Client{}
+	cli.WithIPToASNService(svc)
+
+	for _, tt := range []struct {
+		name    string
+		checker checker.Impl
+		ip      string
+		want    bool
+	}{
+		{name: "asn match", checker: cli.ASNCheckerFor([]uint32{13335}, false), ip: "1.1.1.1", want: true},
+		{name: "asn no match", checker: cli.ASNCheckerFor([]uint32{64496}, false), ip: "1.1.1.1"},
+		{name: "asn unknown address", checker: cli.ASNCheckerFor([]uint32{13335}, false), ip: "3.3.3.3"},
+		{name: "geoip match", checker: cli.GeoIPCheckerFor([]string{"au"}, false), ip: "1.1.1.1", want: true},
+		{name: "geoip no match", checker: cli.GeoIPCheckerFor([]string{"fr"}, false), ip: "1.1.1.1"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("X-Real-Ip", tt.ip)
+
+			got, err := tt.checker.Check(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tt.want {
+				t.Errorf("wanted %v, got: %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	if _, err := New(t.Context(), Options{}); !errors.Is(err, ErrNoFiles) {
+		t.Errorf("wanted ErrNoFiles, got: %v", err)
+	}
+
+	if _, err := New(t.Context(), Options{ASNFile: "/nonexistent/GeoLite2-ASN.mmdb"}); err == nil {
+		t.Error("wanted an error for a missing file")
+	}
+
+	garbage := filepath.Join(t.TempDir(), "garbage.mmdb")
+	if err := os.WriteFile(garbage, []byte("not an mmdb file"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := New(t.Context(), Options{CountryFile: garbage}); err == nil {
+		t.Error("wanted an error for a file that isn't an MMDB database")
+	}
+}
+
+func TestReload(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "GeoLite2-ASN.mmdb")
+	writeDB(t, fname, "GeoLite2-ASN", map[string]mmdbtype.Map{
+		"1.1.1.0/24": maxMindASN(13335, "CLOUDFLARENET"),
+	})
+
+	svc, err := New(t.Context(), Options{ASNFile: fname, ReloadInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lookup := func() uint32 {
+		resp, err := svc.Lookup(t.Context(), &iptoasnv1.LookupRequest{IpAddress: "1.1.1.1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.GetAsNumber()
+	}
+
+	if got := lookup(); got != 13335 {
+		t.Fatalf("wanted AS13335, got: AS%d", got)
+	}
+
+	// Write the new file next to the old one and move it into place, the way
+	// database updaters do.
+	next := fname + ".new"
+	writeDB(t, next, "GeoLite2-ASN", map[string]mmdbtype.Map{
+		"1.1.1.0/24": maxMindASN(64496, "EXAMPLE"),
+		"2.2.2.0/24": maxMindASN(64497, "EXAMPLE"),
+	})
+	if err := os.Rename(next, fname); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for lookup() != 64496 {
+		if time.Now().After(deadline) {
+			t.Fatal("database was never reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// A broken file keeps the old database.
+	if err := os.WriteFile(fname, []byte("not an mmdb file"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	if got := lookup(); got != 64496 {
+		t.Errorf("wanted the old database to be kept, got: AS%d", got)
+	}
+}
@@ -23,7 +23,29 @@ type Client struct {
 	IPToASN iptoasnv1.IpToASNServiceClient
 }
 
-func New(ctx context.Context, thothURL, apiToken string, plaintext bool) (*Client, error) {
+// Options tunes how the client copes with Thoth being slow or down. Zero
+// values use the defaults.
+type Options struct {
+	// Timeout is how long a lookup may take before Anubis gives up on it.
+	Timeout time.Duration
+
+	// BreakerThreshold is how many lookups in a row must fail before Anubis
+	// stops asking Thoth for BreakerCooldown.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+
+	// CacheTTL and CacheSize bound how long and how many lookup results are
+	// kept. NegativeCacheTTL is how long a failed lookup is remembered.
+	CacheTTL         time.Duration
+	CacheSize        int
+	NegativeCacheTTL time.Duration
+}
+
+func New(ctx context.Context, thothURL, apiToken string, plaintext bool, opts Options) (*Client, error) {
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+
 	clMetrics := grpcprom.NewClientMetrics(
 		grpcprom.WithClientHandlingTimeHistogram(
 			grpcprom.WithHistogramBuckets([]float64{0.001, 0.01, 0.1, 0.3, 0.6, 1, 3, 6, 9, 20, 30, 60, 90, 120}),
@@ -33,7 +55,7 @@ func New(ctx context.Context, thothURL, apiToken string, plaintext bool) (*Clien
 
 	do := []grpc.DialOption{
 		grpc.WithChainUnaryInterceptor(
-			timeout.UnaryClientInterceptor(500*time.Millisecond),
+			timeout.UnaryClientInterceptor(opts.Timeout),
 			clMetrics.UnaryClientInterceptor(),
 			authUnaryClientInterceptor(apiToken),
 		),
@@ -61,9 +83,12 @@ func New(ctx context.Context, thothURL, apiToken string, plaintext bool) (*Clien
 	hc := healthv1.NewHealthClient(conn)
 
 	return &Client{
-		conn:    conn,
-		health:  hc,
-		IPToASN: NewIpToASNWithCache(iptoasnv1.NewIpToASNServiceClient(conn)),
+		conn:   conn,
+		health: hc,
+		IPToASN: NewIpToASNWithCache(
+			NewBreaker(iptoasnv1.NewIpToASNServiceClient(conn), opts.BreakerThreshold, opts.BreakerCooldown),
+			opts.CacheTTL, opts.NegativeCacheTTL, opts.CacheSize,
+		),
 	}, nil
 }
 
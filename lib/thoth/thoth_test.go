@@ -19,7 +19,7 @@ func loadSecrets(t testing.TB) *thoth.Client {
 		return result
 	}
 
-	cli, err := thoth.New(t.Context(), os.Getenv("THOTH_URL"), os.Getenv("THOTH_API_KEY"), false)
+	cli, err := thoth.New(t.Context(), os.Getenv("THOTH_URL"), os.Getenv("THOTH_API_KEY"), false, thoth.Options{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -28,6 +28,13 @@ func MockIpToASNService() *IpToASNService {
 			CountryCode: "CA",
 			Description: "test canada",
 		},
+		"3.3.3.3": {
+			Announced:   true,
+			AsNumber:    16509,
+			Cidr:        []string{"3.0.0.0/15"},
+			CountryCode: "US",
+			Description: "AMAZON-02",
+		},
 		"1.1.1.1": {
 			Announced:   true,
 			AsNumber:    13335,
@@ -0,0 +1,130 @@
+package lib
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/net/http/httpguts"
+)
+
+var (
+	upgradesRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "anubis_upgrade_requests_rejected_total",
+		Help: "The number of connection upgrade requests (such as WebSockets) answered with an error status instead of being proxied",
+	}, []string{"status"})
+
+	upgradedConnections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "anubis_upgraded_connections_total",
+		Help: "The number of upgraded connections (such as WebSockets) proxied to upstream targets",
+	}, []string{"host"})
+
+	upgradedConnectionsActive = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "anubis_upgraded_connections_active",
+		Help: "The number of upgraded connections that are currently open",
+	})
+
+	upgradedConnectionsExpired = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "anubis_upgraded_connections_expired_total",
+		Help: "The number of upgraded connections closed because the client's JWT expired",
+	}, []string{"host"})
+)
+
+// isUpgrade reports whether r asks to switch protocols, like a WebSocket
+// handshake does. Clients making such requests can't show challenge pages.
+func isUpgrade(r *http.Request) bool {
+	return r.Header.Get("Upgrade") != "" && httpguts.HeaderValuesContainsToken(r.Header["Connection"], "upgrade")
+}
+
+// respondToUpgrade answers an upgrade request that can't be proxied with a
+// plain text error. Status codes that don't signal an error, such as a deny
+// status code of 200, are turned into 403.
+func respondToUpgrade(w http.ResponseWriter, msg string, status int) {
+	if status < http.StatusBadRequest {
+		status = http.StatusForbidden
+	}
+
+	upgradesRejected.WithLabelValues(strconv.Itoa(status)).Inc()
+	http.Error(w, msg, status)
+}
+
+type connDeadlineKey struct{}
+
+// withConnDeadline records that a connection upgraded from the request ctx
+// belongs to must be closed at deadline.
+func withConnDeadline(ctx context.Context, deadline time.Time) context.Context {
+	return context.WithValue(ctx, connDeadlineKey{}, deadline)
+}
+
+// trackUpgrade wraps w so that the connection hijacked for an upgrade is
+// counted in the metrics and closed at the deadline set by withConnDeadline,
+// if any.
+func trackUpgrade(w http.ResponseWriter, r *http.Request) http.ResponseWriter {
+	deadline, _ := r.Context().Value(connDeadlineKey{}).(time.Time)
+	return &upgradeWriter{ResponseWriter: w, host: r.Host, deadline: deadline}
+}
+
+type upgradeWriter struct {
+	http.ResponseWriter
+	host     string
+	deadline time.Time
+}
+
+func (uw *upgradeWriter) Unwrap() http.ResponseWriter {
+	return uw.ResponseWriter
+}
+
+func (uw *upgradeWriter) Flush() {
+	http.NewResponseController(uw.ResponseWriter).Flush()
+}
+
+func (uw *upgradeWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := http.NewResponseController(uw.ResponseWriter).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	upgradedConnections.WithLabelValues(uw.host).Inc()
+	upgradedConnectionsActive.Inc()
+
+	uc := &upgradedConn{Conn: conn}
+	if !uw.deadline.IsZero() {
+		uc.lock.Lock()
+		uc.timer = time.AfterFunc(time.Until(uw.deadline), func() {
+			upgradedConnectionsExpired.WithLabelValues(uw.host).Inc()
+			uc.Close()
+		})
+		uc.lock.Unlock()
+	}
+
+	return uc, brw, nil
+}
+
+// upgradedConn is a hijacked connection that updates the metrics when it is
+// closed.
+type upgradedConn struct {
+	net.Conn
+	once sync.Once
+
+	lock  sync.Mutex
+	timer *time.Timer
+}
+
+func (uc *upgradedConn) Close() error {
+	uc.once.Do(func() {
+		uc.lock.Lock()
+		if uc.timer != nil {
+			uc.timer.Stop()
+		}
+		uc.lock.Unlock()
+		upgradedConnectionsActive.Dec()
+	})
+
+	return uc.Conn.Close()
+}
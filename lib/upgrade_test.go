@@ -0,0 +1,162 @@
+package lib
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TecharoHQ/anubis/internal"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// echoUpgrader switches to an echo protocol for every request.
+func echoUpgrader(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, brw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+		brw.Flush()
+		io.Copy(conn, brw)
+	}))
+	t.Cleanup(ts.Close)
+
+	return ts
+}
+
+func upgradeRequest(t *testing.T, addr, userAgent string, cookies ...*http.Cookie) (net.Conn, *bufio.Reader, *http.Response) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	req, err := http.NewRequest(http.MethodGet, "http://"+addr+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "echo")
+	for _, ckie := range cookies {
+		req.AddCookie(ckie)
+	}
+
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return conn, br, resp
+}
+
+func TestUpgradeChallengeAndDeny(t *testing.T) {
+	pol := loadPolicies(t, "./testdata/aggressive_403.yaml", 4)
+
+	srv := spawnAnubis(t, Options{
+		Next:   http.NewServeMux(),
+		Policy: pol,
+	})
+
+	ts := httptest.NewServer(internal.RemoteXRealIP(true, "tcp", srv))
+	defer ts.Close()
+
+	for _, cs := range []struct {
+		userAgent string
+		status    int
+	}{
+		{userAgent: "CHALLENGE", status: http.StatusUnauthorized},
+		{userAgent: "DENY", status: http.StatusForbidden},
+	} {
+		t.Run(cs.userAgent, func(t *testing.T) {
+			_, _, resp := upgradeRequest(t, ts.Listener.Addr().String(), cs.userAgent)
+			defer resp.Body.Close()
+
+			if resp.StatusCode != cs.status {
+				t.Errorf("wanted status %d, got: %d", cs.status, resp.StatusCode)
+			}
+
+			if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+				t.Errorf("wanted a plain text response, got: %s", ct)
+			}
+		})
+	}
+}
+
+func TestUpgradeEnforceJWTExpiry(t *testing.T) {
+	pol := loadPolicies(t, "./testdata/aggressive_403.yaml", 4)
+
+	u, err := url.Parse(echoUpgrader(t).URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := spawnAnubis(t, Options{
+		Next:                    httputil.NewSingleHostReverseProxy(u),
+		Policy:                  pol,
+		CookieExpiration:        2 * time.Second,
+		UpgradeEnforceJWTExpiry: true,
+	})
+
+	ts := httptest.NewServer(internal.RemoteXRealIP(true, "tcp", srv))
+	defer ts.Close()
+
+	// sign a JWT the same way passing the challenge does
+	req := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	req.Header.Set("User-Agent", "CHALLENGE")
+	req.Header.Set("X-Real-Ip", "127.0.0.1")
+	_, rule, err := srv.check(req, srv.logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := srv.signJWT(jwt.MapClaims{"policyRule": rule.Hash()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, br, resp := upgradeRequest(t, ts.Listener.Addr().String(), "CHALLENGE", &http.Cookie{Name: srv.settings.CookieName, Value: token})
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("wanted status %d, got: %d", http.StatusSwitchingProtocols, resp.StatusCode)
+	}
+
+	if _, err := io.WriteString(conn, "ping\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	line, err := br.ReadString('\n')
+	if err != nil || line != "ping\n" {
+		t.Fatalf("wanted echo, got %q, %v", line, err)
+	}
+
+	start := time.Now()
+	if _, err := br.ReadString('\n'); !errors.Is(err, io.EOF) {
+		t.Fatalf("wanted connection to be closed, got: %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 4*time.Second {
+		t.Errorf("connection was closed %s after the JWT expired", elapsed)
+	}
+}
@@ -0,0 +1,58 @@
+package anubis
+
+import "context"
+
+// Settings are the settings of one Anubis server that are needed while
+// rendering pages and issuing challenges. They replace the package variables
+// of the same names so that several servers with different settings can run
+// in the same process.
+type Settings struct {
+	// BasePrefix is the prefix of all Anubis endpoints, without a trailing
+	// slash.
+	BasePrefix string
+
+	// PublicUrl is the externally accessible URL of the server.
+	PublicUrl string
+
+	// CookieName is the name of the cookie that holds the server's JWT.
+	CookieName string
+
+	// TestCookieName is the name of the cookie used to check if the client
+	// accepts cookies.
+	TestCookieName string
+
+	// ForcedLanguage is used instead of the request's Accept-Language header
+	// if set.
+	ForcedLanguage string
+
+	// UseSimplifiedExplanation shows a simpler explanation on challenge pages.
+	UseSimplifiedExplanation bool
+}
+
+type settingsKey struct{}
+
+// DefaultSettings returns the settings of a server without a base prefix or
+// public URL that uses the defaults in the package variables.
+func DefaultSettings() *Settings {
+	return &Settings{
+		CookieName:               CookieName,
+		TestCookieName:           TestCookieName,
+		ForcedLanguage:           ForcedLanguage,
+		UseSimplifiedExplanation: UseSimplifiedExplanation,
+	}
+}
+
+// WithSettings returns a copy of ctx carrying s.
+func WithSettings(ctx context.Context, s *Settings) context.Context {
+	return context.WithValue(ctx, settingsKey{}, s)
+}
+
+// SettingsFrom returns the settings of the server handling the request ctx
+// belongs to, or DefaultSettings if there are none.
+func SettingsFrom(ctx context.Context) *Settings {
+	if s, ok := ctx.Value(settingsKey{}).(*Settings); ok {
+		return s
+	}
+
+	return DefaultSettings()
+}
@@ -0,0 +1,52 @@
+// Package traefik adapts Anubis to Traefik's middleware plugin interface.
+//
+// Traefik runs plugins with the Yaegi interpreter, which can't load the
+// dependencies of Anubis, so this package is for Traefik builds that compile
+// it in and for other servers that use the same constructor signature.
+package traefik
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/TecharoHQ/anubis/lib/middleware"
+)
+
+// Config is the dynamic configuration of the middleware.
+type Config struct {
+	PolicyFile           string   `json:"policyFile,omitempty"`
+	Difficulty           int      `json:"difficulty,omitempty"`
+	BasePrefix           string   `json:"basePrefix,omitempty"`
+	PublicURL            string   `json:"publicURL,omitempty"`
+	RedirectDomains      []string `json:"redirectDomains,omitempty"`
+	ServeRobotsTXT       bool     `json:"serveRobotsTXT,omitempty"`
+	ForcedLanguage       string   `json:"forcedLanguage,omitempty"`
+	CookieDomain         string   `json:"cookieDomain,omitempty"`
+	CookiePrefix         string   `json:"cookiePrefix,omitempty"`
+	InsecureCookies      bool     `json:"insecureCookies,omitempty"`
+	ED25519PrivateKeyHex string   `json:"ed25519PrivateKeyHex,omitempty"`
+}
+
+// CreateConfig returns the default configuration.
+func CreateConfig() *Config {
+	return &Config{}
+}
+
+// New creates the middleware named name in front of next.
+func New(ctx context.Context, next http.Handler, config *Config, name string) (http.Handler, error) {
+	return middleware.New(ctx, middleware.Config{
+		PolicyFile:           config.PolicyFile,
+		Difficulty:           config.Difficulty,
+		BasePrefix:           config.BasePrefix,
+		PublicUrl:            config.PublicURL,
+		RedirectDomains:      config.RedirectDomains,
+		ServeRobotsTXT:       config.ServeRobotsTXT,
+		ForcedLanguage:       config.ForcedLanguage,
+		CookieDomain:         config.CookieDomain,
+		CookiePrefix:         config.CookiePrefix,
+		InsecureCookies:      config.InsecureCookies,
+		ED25519PrivateKeyHex: config.ED25519PrivateKeyHex,
+		Logger:               slog.With("subsystem", "anubis", "middleware", name),
+	}, next)
+}
@@ -0,0 +1,72 @@
+package traefik
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Anubis-Action", r.Header.Get("X-Anubis-Action"))
+		io.WriteString(w, "upstream")
+	})
+
+	// two instances with different settings in the same process
+	handlers := map[string]http.Handler{}
+	for _, prefix := range []string{"/a", "/b"} {
+		cfg := CreateConfig()
+		cfg.PolicyFile = "../lib/testdata/aggressive_403.yaml"
+		cfg.BasePrefix = prefix
+		cfg.CookiePrefix = "test" + strings.TrimPrefix(prefix, "/")
+
+		h, err := New(t.Context(), next, cfg, "anubis"+prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		handlers[prefix] = h
+	}
+
+	for prefix, h := range handlers {
+		t.Run(prefix, func(t *testing.T) {
+			ts := httptest.NewServer(h)
+			defer ts.Close()
+
+			for _, cs := range []struct {
+				userAgent string
+				status    int
+				body      string
+			}{
+				{userAgent: "Mozilla/5.0", status: http.StatusOK, body: "upstream"},
+				{userAgent: "DENY", status: http.StatusForbidden},
+				{userAgent: "CHALLENGE", status: http.StatusUnauthorized, body: prefix + "/.within.website/x/cmd/anubis/static/"},
+			} {
+				req, err := http.NewRequest(http.MethodGet, ts.URL+"/", nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.Header.Set("User-Agent", cs.userAgent)
+
+				resp, err := ts.Client().Do(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body, err := io.ReadAll(resp.Body)
+				resp.Body.Close()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if resp.StatusCode != cs.status {
+					t.Errorf("%s: wanted status %d, got: %d", cs.userAgent, cs.status, resp.StatusCode)
+				}
+
+				if !strings.Contains(string(body), cs.body) {
+					t.Errorf("%s: wanted body to contain %q", cs.userAgent, cs.body)
+				}
+			}
+		})
+	}
+}
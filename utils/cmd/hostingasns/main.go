@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/TecharoHQ/anubis/internal/hosting"
+	"github.com/facebookgo/flagenv"
+	"gopkg.in/yaml.v3"
+)
+
+func init() {
+	flag.Usage = func() {
+		fmt.Printf(`Usage of %[1]s:
+
+	%[1]s [flags] <filename>
+
+Fetches a feed of datacenter autonomous systems and adds the ones that are
+new to the hosting providers listed in filename, sorted by the providers'
+match expressions. ASNs that no provider matches are skipped unless -other
+is set. With -prune, the providers that the feed can fill get exactly the
+ASNs in the feed instead, and every ASN that was dropped is logged.
+
+Flags:
+`, filepath.Base(os.Args[0]))
+
+		flag.PrintDefaults()
+	}
+}
+
+var (
+	feedURL = flag.String("feed", "https://raw.githubusercontent.com/X4BNet/lists_vpn/main/input/datacenter/ASN.txt", "URL of the datacenter ASN feed, with one ASN and organization name per line")
+	other   = flag.String("other", "", "if set, name of the provider that gets ASNs no other provider matches")
+	prune   = flag.Bool("prune", false, "if set, drop ASNs that are not in the feed from providers with a match expression (and from -other)")
+)
+
+// asnLine matches feed lines such as "AS16509 # Amazon.com, Inc.",
+// "16509,Amazon.com, Inc." or "AS16509 Amazon.com, Inc.".
+var asnLine = regexp.MustCompile(`^(?i:AS)?(\d+)\s*[,#]?\s*(.*)$`)
+
+type feedEntry struct {
+	asn uint32
+	org string
+}
+
+func fetchFeed(url string) ([]feedEntry, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP request failed with status: %s", resp.Status)
+	}
+
+	return parseFeed(resp.Body)
+}
+
+func parseFeed(r io.Reader) ([]feedEntry, error) {
+	var result []feedEntry
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		m := asnLine.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+
+		asn, err := strconv.ParseUint(m[1], 10, 32)
+		if err != nil {
+			continue
+		}
+
+		result = append(result, feedEntry{asn: uint32(asn), org: strings.Trim(m[2], `" `)})
+	}
+
+	return result, scanner.Err()
+}
+
+// merge adds the ASNs in entries to the providers in ds whose match
+// expression matches the ASN's organization name. ASNs that no provider
+// matches go to the provider named other, or are skipped if other is empty.
+// ASNs that are already listed stay with their provider. If prune is set, the
+// providers that entries can fill lose every ASN that isn't in entries.
+func merge(ds *hosting.Dataset, entries []feedEntry, other string, prune bool) {
+	matchers := make([]*regexp.Regexp, len(ds.Providers))
+	for i, p := range ds.Providers {
+		if p.Match != "" {
+			// XXX: already validated in hosting.Parse
+			matchers[i] = regexp.MustCompile(p.Match)
+		}
+	}
+
+	otherIdx := slices.IndexFunc(ds.Providers, func(p hosting.Provider) bool { return other != "" && p.Name == other })
+
+	fed := make([][]uint32, len(ds.Providers))
+	skipped := 0
+	for _, e := range entries {
+		idx := slices.IndexFunc(matchers, func(rex *regexp.Regexp) bool { return rex != nil && rex.MatchString(e.org) })
+		if idx == -1 {
+			idx = otherIdx
+		}
+
+		if idx == -1 {
+			skipped++
+			continue
+		}
+
+		if !slices.Contains(fed[idx], e.asn) {
+			fed[idx] = append(fed[idx], e.asn)
+		}
+	}
+
+	if skipped != 0 {
+		log.Printf("skipped %d ASNs that no provider matches, set -other to keep them", skipped)
+	}
+
+	if prune {
+		for i, p := range ds.Providers {
+			if matchers[i] == nil && i != otherIdx {
+				continue
+			}
+
+			ds.Providers[i].ASNs = slices.DeleteFunc(p.ASNs, func(asn uint32) bool {
+				if slices.Contains(fed[i], asn) {
+					return false
+				}
+
+				log.Printf("AS%d is no longer listed for %s", asn, p.Name)
+				return true
+			})
+		}
+	}
+
+	// Look up where ASNs are listed after pruning, so that an ASN that moved
+	// to another provider in the feed can follow it.
+	listed := map[uint32]string{}
+	for _, p := range ds.Providers {
+		for _, asn := range p.ASNs {
+			listed[asn] = p.Name
+		}
+	}
+
+	for i, p := range ds.Providers {
+		for _, asn := range fed[i] {
+			if name, ok := listed[asn]; ok {
+				if name != p.Name {
+					log.Printf("AS%d matches %s in the feed but stays with %s", asn, p.Name, name)
+				}
+				continue
+			}
+
+			log.Printf("adding AS%d to %s", asn, p.Name)
+			ds.Providers[i].ASNs = append(ds.Providers[i].ASNs, asn)
+			listed[asn] = p.Name
+		}
+
+		slices.Sort(ds.Providers[i].ASNs)
+		if ds.Providers[i].ASNs == nil {
+			ds.Providers[i].ASNs = []uint32{}
+		}
+	}
+}
+
+func main() {
+	flagenv.Parse()
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	fname := flag.Arg(0)
+
+	buf, err := os.ReadFile(fname)
+	if err != nil {
+		log.Fatalf("can't read %s: %v", fname, err)
+	}
+
+	ds, err := hosting.Parse(buf)
+	if err != nil {
+		log.Fatalf("can't parse %s: %v", fname, err)
+	}
+
+	if *other != "" && !ds.Has(*other) {
+		log.Fatalf("%s has no provider named %s", fname, *other)
+	}
+
+	entries, err := fetchFeed(*feedURL)
+	if err != nil {
+		log.Fatalf("can't fetch feed %s: %v", *feedURL, err)
+	}
+
+	if len(entries) == 0 {
+		log.Fatalf("feed %s has no ASNs", *feedURL)
+	}
+
+	merge(ds, entries, *other, *prune)
+
+	var out bytes.Buffer
+	out.Write(header(buf))
+
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+	if err := enc.Encode(ds); err != nil {
+		log.Fatalf("can't marshal yaml: %v", err)
+	}
+
+	if _, err := hosting.Parse(out.Bytes()); err != nil {
+		log.Fatalf("merged dataset is invalid: %v", err)
+	}
+
+	if err := os.WriteFile(fname, out.Bytes(), 0o644); err != nil {
+		log.Fatalf("can't write %s: %v", fname, err)
+	}
+
+	log.Printf("merged %d feed entries into %d providers in %s", len(entries), len(ds.Providers), fname)
+}
+
+// header returns the comment block at the top of the dataset, so that it
+// survives a refresh.
+func header(buf []byte) []byte {
+	var result bytes.Buffer
+
+	for line := range bytes.Lines(buf) {
+		if !bytes.HasPrefix(line, []byte("#")) {
+			break
+		}
+
+		result.Write(line)
+	}
+
+	return result.Bytes()
+}
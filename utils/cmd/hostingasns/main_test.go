@@ -0,0 +1,142 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/TecharoHQ/anubis/internal/hosting"
+)
+
+func TestParseFeed(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		input string
+		want  []feedEntry
+	}{
+		{
+			name:  "comment",
+			input: "AS16509 # Amazon.com, Inc.\n",
+			want:  []feedEntry{{asn: 16509, org: "Amazon.com, Inc."}},
+		},
+		{
+			name:  "csv",
+			input: "16509,\"Amazon.com, Inc.\"\n",
+			want:  []feedEntry{{asn: 16509, org: "Amazon.com, Inc."}},
+		},
+		{
+			name:  "space",
+			input: "as24940 Hetzner Online GmbH\n",
+			want:  []feedEntry{{asn: 24940, org: "Hetzner Online GmbH"}},
+		},
+		{
+			name:  "no-org",
+			input: "AS14061\n",
+			want:  []feedEntry{{asn: 14061}},
+		},
+		{
+			name:  "skips-junk",
+			input: "# a comment\n\nnot an asn\nAS99999999999 # too big\nAS14061 # DigitalOcean, LLC\n",
+			want:  []feedEntry{{asn: 14061, org: "DigitalOcean, LLC"}},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseFeed(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Logf("want: %v", tt.want)
+				t.Logf("got:  %v", got)
+				t.Error("got wrong entries")
+			}
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	dataset := func() *hosting.Dataset {
+		return &hosting.Dataset{Providers: []hosting.Provider{
+			{Name: "amazon-aws", Match: "(?i)amazon", ASNs: []uint32{14618, 16509}},
+			{Name: "hetzner", Match: "(?i)hetzner", ASNs: []uint32{24940}},
+			{Name: "hand-picked", ASNs: []uint32{64496}},
+			{Name: "other", ASNs: []uint32{}},
+		}}
+	}
+
+	feed := []feedEntry{
+		{asn: 16509, org: "Amazon.com, Inc."},
+		{asn: 8987, org: "Amazon Data Services Ireland Ltd"},
+		{asn: 8987, org: "Amazon Data Services Ireland Ltd"},
+		{asn: 64496, org: "Hetzner Online GmbH"},
+		{asn: 64500, org: "Some Datacenter"},
+	}
+
+	for _, tt := range []struct {
+		name  string
+		feed  []feedEntry
+		other string
+		prune bool
+		want  map[string][]uint32
+	}{
+		{
+			name: "adds-new-asns",
+			feed: feed,
+			want: map[string][]uint32{
+				"amazon-aws":  {8987, 14618, 16509},
+				"hetzner":     {24940},
+				"hand-picked": {64496},
+				"other":       {},
+			},
+		},
+		{
+			name:  "other",
+			feed:  feed,
+			other: "other",
+			want: map[string][]uint32{
+				"amazon-aws":  {8987, 14618, 16509},
+				"hetzner":     {24940},
+				"hand-picked": {64496},
+				"other":       {64500},
+			},
+		},
+		{
+			name:  "prune",
+			feed:  feed,
+			prune: true,
+			want: map[string][]uint32{
+				"amazon-aws":  {8987, 16509},
+				"hetzner":     {},
+				"hand-picked": {64496},
+				"other":       {},
+			},
+		},
+		{
+			name: "no-op",
+			feed: []feedEntry{
+				{asn: 14618, org: "Amazon.com, Inc."},
+				{asn: 16509, org: "Amazon.com, Inc."},
+				{asn: 24940, org: "Hetzner Online GmbH"},
+			},
+			prune: true,
+			want: map[string][]uint32{
+				"amazon-aws":  {14618, 16509},
+				"hetzner":     {24940},
+				"hand-picked": {64496},
+				"other":       {},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ds := dataset()
+			merge(ds, tt.feed, tt.other, tt.prune)
+
+			for _, p := range ds.Providers {
+				if !slices.Equal(p.ASNs, tt.want[p.Name]) {
+					t.Errorf("%s: wanted %v, got: %v", p.Name, tt.want[p.Name], p.ASNs)
+				}
+			}
+		})
+	}
+}
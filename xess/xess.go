@@ -31,9 +31,16 @@ func init() {
 	URL = URL + "?cachebuster=" + anubis.Version
 }
 
-// Mount registers the xess static file handlers on the given mux
+// Mount registers the xess static file handlers on the given mux without a
+// base prefix.
 func Mount(mux *http.ServeMux) {
-	prefix := anubis.BasePrefix + "/.within.website/x/xess/"
+	MountAt(mux, "")
+}
+
+// MountAt registers the xess static file handlers on the given mux under
+// basePrefix.
+func MountAt(mux *http.ServeMux, basePrefix string) {
+	prefix := basePrefix + "/.within.website/x/xess/"
 
 	mux.Handle(prefix, internal.UnchangingCache(http.StripPrefix(prefix, http.FileServerFS(Static))))
 }